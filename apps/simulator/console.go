@@ -61,7 +61,7 @@ func displaySimulationResults(cfg *util.AppConfig, db *newdata.Database) {
 	switch db.Datatype {
 	case "CSV":
 		fmt.Printf("nil data requests: %d\n", db.CSVDB.Nildata)
-	case "SQL":
+	case "SQL", "SQLITE":
 	default:
 	}
 
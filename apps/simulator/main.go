@@ -41,6 +41,8 @@ type SimApp struct {
 	DNALog                    bool          // generate dnalog when true and CrucibleMode is true
 	GenInfluencerDistribution bool          // show Influencer distribution for each generation
 	FitnessScores             bool          // save the fitness scores for each generation to dbgFitnessScores.csv
+	InfluencerReport          bool          // save the fitness of every Influencer for each generation to infrep.csv
+	RealizedGainsReport       bool          // save every chunk of C2 sold by the top Investors for each generation to gains.csv
 	dbfilename                string        // override database name with this name
 	CPUProfile                string        // where is time being spent?
 	MemProfile                string        // where is memory being consumed?
@@ -60,6 +62,8 @@ type SimApp struct {
 	DispatcherURL             string        // where to reach dispatcher, simd will supply it
 	MachineID                 string        // unique id for this machine
 	WorkingDirectory          string        // working directory
+	resumeFile                string        // continue the simulation saved in this checkpoint file
+	WalkForwardMode           bool          // evolve on a training window and test on the following window
 }
 
 var app SimApp
@@ -73,7 +77,7 @@ func dateIsInDataRange(a time.Time) string {
 		if a.After(app.db.CSVDB.DtStop) {
 			return "after to Discount Rate data range"
 		}
-	case "SQL":
+	case "SQL", "SQLITE":
 		if a.Before(app.db.SQLDB.DtStart) {
 			return "prior to Discount Rate data range"
 		}
@@ -92,21 +96,25 @@ func readCommandLineArgs() {
 	flag.StringVar(&app.CPUProfile, "cpuprofile", "", "write cpu profile to file")
 	flag.BoolVar(&app.InfPredDebug, "D", false, "show prediction debug info - dumps a lot of data, use on short simulations, with minimal Influencers")
 	flag.BoolVar(&app.DayByDay, "d", false, "show day-by-day results")
-	flag.StringVar(&app.dbfilename, "db", "", "override CSV datatbase name with this name. All CSV database files are assumed to be in the same directory.")
+	flag.StringVar(&app.dbfilename, "db", "", "override CSV (or SQLite) datatbase name with this name. All CSV database files are assumed to be in the same directory.")
 	flag.BoolVar(&app.DNALog, "dnalog", false, "generate DNA log, only relevant when CrucibleMode is enabled.")
 	flag.BoolVar(&app.AllowDuplicateInvestors, "dup", false, "Allow duplicate investors within a population.")
 	flag.BoolVar(&app.FitnessScores, "fit", false, "generate a Fitness Report that shows the fitness of all Investors for each generation")
+	flag.BoolVar(&app.RealizedGainsReport, "gains", false, "for each generation, write every chunk of C2 sold by the top investors, with cost basis, proceeds and holding period, to gains.csv")
 	//  flag.BoolVar(&app.showAllInvestors, "i", false, "show all investors in the simulation results")
 	flag.BoolVar(&app.GenInfluencerDistribution, "idist", false, "report Influencer Distribution each time a generation completes")
+	flag.BoolVar(&app.InfluencerReport, "infrep", false, "for each generation, write the fitness of every Influencer to infrep.csv")
 	flag.BoolVar(&app.ReportTopInvestorInvestments, "inv", false, "for each generation, write top investors Investment List to invrep.csv")
 	flag.StringVar(&app.MemProfile, "memprofile", "", "write memory profile to this file")
 	flag.BoolVar(&app.notalk, "notalk", false, "if true, the simulator does not start up an HTTP listener")
 	flag.Int64Var(&app.randNano, "r", -1, "random number seed. ex: ./simulator -r 1687802336231490000")
+	flag.StringVar(&app.resumeFile, "resume", "", "continue the simulation saved in this checkpoint file. Use the same config file as the original run.")
 	flag.Int64Var(&app.SID, "SID", 0, "SID from dispatcher. Should only used by simd or dispatcher")
 	flag.BoolVar(&app.trace, "trace", false, "trace decision-making process every day, all investors")
 	flag.BoolVar(&app.traceTiming, "tracetime", false, "shows timing of simulation phase and next creating a new generation")
 	flag.StringVar(&app.DispatcherURL, "DISPATCHER", "", "Network address for dispatcher. Should only used by simd")
 	flag.BoolVar(&app.version, "v", false, "print the program version string")
+	flag.BoolVar(&app.WalkForwardMode, "wf", false, "walk-forward mode. Uses the WalkForward settings in the config file.")
 	flag.Parse()
 }
 
@@ -136,6 +144,9 @@ func initSimulation() {
 	if !cfg.CrucibleMode {
 		cfg.CrucibleMode = app.CrucibleMode
 	}
+	if !cfg.WalkForwardMode {
+		cfg.WalkForwardMode = app.WalkForwardMode
+	}
 	cfg.SID = app.SID
 	app.cfg = cfg
 
@@ -146,7 +157,12 @@ func initSimulation() {
 	if err != nil {
 		log.Panicf("*** PANIC ERROR ***  NewDatabase returned error: %s\n", err)
 	}
-	app.db.SetCSVFilename(app.dbfilename) // This call is not actually necessary, but this is when you'd set the override filename if you need to
+	switch app.db.Datatype {
+	case "CSV":
+		app.db.SetCSVFilename(app.dbfilename) // This call is not actually necessary, but this is when you'd set the override filename if you need to
+	case "SQLITE":
+		app.db.SetSQLiteFilename(app.dbfilename)
+	}
 	if err := app.db.Open(); err != nil {
 		log.Panicf("*** PANIC ERROR ***  db.Open returned error: %s\n", err)
 	}
@@ -191,6 +207,9 @@ func doSimulation() {
 	//##########################################################################################
 
 	if app.cfg.CrucibleMode {
+		if len(app.resumeFile) > 0 {
+			log.Fatalf("-resume is not supported in Crucible mode\n")
+		}
 		c := newcore.NewCrucible()
 		c.ReportTopInvestorInvestments = app.ReportTopInvestorInvestments
 		c.DayByDay = app.DayByDay
@@ -200,10 +219,29 @@ func doSimulation() {
 		return
 	}
 
+	if app.cfg.WalkForwardMode {
+		if len(app.resumeFile) > 0 {
+			log.Fatalf("-resume is not supported in walk-forward mode\n")
+		}
+		wf := newcore.NewWalkForward()
+		if err = wf.Init(app.cfg, app.db, &app.sim); err != nil {
+			log.Fatalf("Walk-forward Init returned error: %s\n", err)
+		}
+		if err = wf.Run(); err != nil {
+			log.Fatalf("Walk-forward Run returned error: %s\n", err)
+		}
+		return
+	}
+
 	displaySimulationDetails(app.cfg)
-	app.sim.Init(app.cfg, app.db, nil, app.DayByDay, app.ReportTopInvestorInvestments)
+	app.sim.ResumeFile = app.resumeFile
+	if err = app.sim.Init(app.cfg, app.db, nil, app.DayByDay, app.ReportTopInvestorInvestments); err != nil {
+		log.Fatalf("Simulator Init returned error: %s\n", err)
+	}
 	app.sim.GenInfluencerDistribution = app.GenInfluencerDistribution
 	app.sim.FitnessScores = app.FitnessScores
+	app.sim.InfluencerReport = app.InfluencerReport
+	app.sim.RealizedGainsReport = app.RealizedGainsReport
 	app.sim.TraceTiming = app.traceTiming
 	app.sim.Simtalkport = app.Simtalkport
 	app.sim.Run()
@@ -0,0 +1,252 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// This module computes risk-adjusted performance metrics for an Investor.
+// Each Investor records its portfolio value every simulated day. At the end
+// of a generation the daily series and the completed Investments are used to
+// compute the metrics in RiskMetrics.
+
+// RiskRatioCap is the magnitude reported for a ratio whose denominator is 0
+// while its numerator is not. For example, the Sortino ratio of an
+// Investor that never had a losing day. Infinity would be accurate, but it
+// cannot be used as a fitness score or stored in a spreadsheet.
+const RiskRatioCap = float64(100)
+
+// PVSample is the portfolio value of an Investor on one day
+type PVSample struct {
+	Dt       time.Time // the day
+	PV       float64   // portfolio value in C1
+	Exposure float64   // fraction of PV held in C2
+}
+
+// RiskMetrics are the risk-adjusted performance metrics of an Investor over
+// a generation. The ratios assume a risk free rate of 0.
+// ------------------------------------------------------------------------------
+type RiskMetrics struct {
+	Sharpe         float64   // annualized mean daily return / stddev of the daily returns
+	Sortino        float64   // annualized mean daily return / downside deviation of the daily returns
+	MaxDrawdown    float64   // largest drop from a peak portfolio value, as a fraction of the peak
+	DtPeak         time.Time // date of the peak where MaxDrawdown started
+	DtTrough       time.Time // date of the trough where MaxDrawdown ended
+	Calmar         float64   // annualized return / MaxDrawdown
+	WinRate        float64   // fraction of completed Investments that made a profit
+	ProfitFactor   float64   // gross profit / gross loss over the completed Investments
+	AvgHoldingDays float64   // average number of days from buy to final sell of the completed Investments
+}
+
+// RiskMetricsColumns are the column headers for RiskMetrics in the csv
+// reports. They are in the same order as the values written by CSV.
+var RiskMetricsColumns = []string{
+	"Sharpe",
+	"Sortino",
+	"Max Drawdown",
+	"Max Drawdown Peak",
+	"Max Drawdown Trough",
+	"Calmar",
+	"Win Rate",
+	"Profit Factor",
+	"Avg Holding Days",
+}
+
+// CSV returns the metrics as comma separated values, in the order of
+// RiskMetricsColumns.
+// ------------------------------------------------------------------------------
+func (r *RiskMetrics) CSV() string {
+	return fmt.Sprintf("%.4f,%.4f,%.2f%%,%s,%s,%.4f,%.2f%%,%.4f,%.1f",
+		r.Sharpe,
+		r.Sortino,
+		r.MaxDrawdown*100,
+		formatRiskDate(r.DtPeak),
+		formatRiskDate(r.DtTrough),
+		r.Calmar,
+		r.WinRate*100,
+		r.ProfitFactor,
+		r.AvgHoldingDays)
+}
+
+// formatRiskDate formats the date of a drawdown, it is empty if there was no
+// drawdown.
+func formatRiskDate(dt time.Time) string {
+	if dt.IsZero() {
+		return ""
+	}
+	return dt.Format("1/2/2006")
+}
+
+// riskRatio returns num/den. If den is 0 it returns RiskRatioCap with the
+// sign of num, or 0 if num is 0.
+// ------------------------------------------------------------------------------
+func riskRatio(num, den float64) float64 {
+	switch {
+	case den > 0:
+		return num / den
+	case num > 0:
+		return RiskRatioCap
+	case num < 0:
+		return -RiskRatioCap
+	}
+	return 0
+}
+
+// NewRiskMetrics computes the risk metrics.
+//
+// INPUTS
+//
+//	series      - the daily portfolio values in date order, trading days only
+//	investments - the Investments made during the period
+//	ar          - the annualized return over the period, used for Calmar
+//
+// RETURNS
+//
+//	the risk metrics
+//
+// ------------------------------------------------------------------------------
+func NewRiskMetrics(series []PVSample, investments []Investment, ar float64) RiskMetrics {
+	var r RiskMetrics
+
+	//------------------------------------------------------------------
+	// Maximum drawdown, and the dates of its peak and trough
+	//------------------------------------------------------------------
+	peak := 0
+	for k := 1; k < len(series); k++ {
+		if series[k].PV > series[peak].PV {
+			peak = k
+			continue
+		}
+		if dd := (series[peak].PV - series[k].PV) / series[peak].PV; dd > r.MaxDrawdown {
+			r.MaxDrawdown = dd
+			r.DtPeak = series[peak].Dt
+			r.DtTrough = series[k].Dt
+		}
+	}
+	r.Calmar = riskRatio(ar, r.MaxDrawdown)
+
+	//------------------------------------------------------------------
+	// Sharpe and Sortino. The daily returns are annualized with the
+	// number of samples per year actually in the series. Weekends and
+	// holidays have no exchange rate so they are not in the series.
+	//------------------------------------------------------------------
+	if len(series) > 2 {
+		n := len(series) - 1
+		returns := make([]float64, n)
+		mean := float64(0)
+		for k := 0; k < n; k++ {
+			returns[k] = series[k+1].PV/series[k].PV - 1
+			mean += returns[k]
+		}
+		mean /= float64(n)
+		variance := float64(0)
+		downside := float64(0)
+		for _, x := range returns {
+			variance += (x - mean) * (x - mean)
+			if x < 0 {
+				downside += x * x
+			}
+		}
+		stddev := math.Sqrt(variance / float64(n-1))
+		downDev := math.Sqrt(downside / float64(n))
+		years := series[n].Dt.Sub(series[0].Dt).Hours() / (24 * 365)
+		scale := float64(1)
+		if years > 0 {
+			scale = math.Sqrt(float64(n) / years)
+		}
+		r.Sharpe = riskRatio(mean*scale, stddev)
+		r.Sortino = riskRatio(mean*scale, downDev)
+	}
+
+	//------------------------------------------------------------------
+	// Trade statistics over the completed Investments. The profit of an
+	// Investment is the sum of the profit of its chunks less the fees.
+	//------------------------------------------------------------------
+	wins := 0
+	completed := 0
+	grossProfit := float64(0)
+	grossLoss := float64(0)
+	holding := float64(0)
+	for j := 0; j < len(investments); j++ {
+		inv := &investments[j]
+		if !inv.Completed || len(inv.Chunks) == 0 {
+			continue
+		}
+		completed++
+		pl := -inv.Fee
+		for k := 0; k < len(inv.Chunks); k++ {
+			pl += inv.Chunks[k].ChunkProfit - inv.Chunks[k].Fee
+		}
+		if pl > 0 {
+			wins++
+			grossProfit += pl
+		} else {
+			grossLoss -= pl
+		}
+		holding += inv.Chunks[len(inv.Chunks)-1].T4.Sub(inv.T3).Hours() / 24
+	}
+	if completed > 0 {
+		r.WinRate = float64(wins) / float64(completed)
+		r.AvgHoldingDays = holding / float64(completed)
+	}
+	r.ProfitFactor = riskRatio(grossProfit, grossLoss)
+	return r
+}
+
+// recordPV adds the portfolio value on T3 to the Investor's daily series.
+// Days with no exchange rate are skipped, even if the Investor only holds C1,
+// so that the series only has trading days.
+// ------------------------------------------------------------------------------
+func (i *Investor) recordPV(T3 time.Time) {
+	if _, err := i.db.Value(i.exchangeRef(), T3); err != nil {
+		return
+	}
+	pv := i.PortfolioValue(T3)
+	if pv <= 0 {
+		return
+	}
+	i.PVSeries = append(i.PVSeries, PVSample{Dt: T3, PV: pv, Exposure: (pv - i.BalanceC1) / pv})
+}
+
+// CalculateRiskMetrics sets the Investor's RiskMetrics and Exposure for the
+// generation that ran from dtStart to dtStop.
+// ------------------------------------------------------------------------------
+func (i *Investor) CalculateRiskMetrics(dtStart, dtStop time.Time) {
+	ar, err := util.AnnualizedReturn(i.cfg.InitFunds, i.PortfolioValueC1, dtStart, dtStop.AddDate(0, 0, 1))
+	if err != nil {
+		ar = 0
+	}
+	i.Risk = NewRiskMetrics(i.PVSeries, i.Investments, ar)
+	i.Exposure = NewExposure(i.PVSeries, i.Investments)
+}
+
+// CalculateAllRiskMetrics sets the RiskMetrics of every Investor for the
+// generation that ran from dtStart to dtStop.
+// ------------------------------------------------------------------------------
+func (s *Simulator) CalculateAllRiskMetrics(dtStart, dtStop time.Time) {
+	for i := 0; i < len(s.Investors); i++ {
+		s.Investors[i].CalculateRiskMetrics(dtStart, dtStop)
+	}
+}
+
+// RiskFitness returns the value of the risk metric named by metric, for use
+// as a fitness score.
+// ------------------------------------------------------------------------------
+func (r *RiskMetrics) RiskFitness(metric string) float64 {
+	switch metric {
+	case util.FitnessSharpe:
+		return r.Sharpe
+	case util.FitnessSortino:
+		return r.Sortino
+	case util.FitnessCalmar:
+		return r.Calmar
+	case util.FitnessProfitFactor:
+		return r.ProfitFactor
+	case util.FitnessWinRate:
+		return r.WinRate
+	}
+	return 0
+}
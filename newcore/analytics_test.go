@@ -0,0 +1,217 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// pvSeries returns a daily series starting on Jan 1, 2020 with the values pv
+func pvSeries(pv ...float64) []PVSample {
+	dt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	series := make([]PVSample, len(pv))
+	for k := range pv {
+		series[k] = PVSample{Dt: dt.AddDate(0, 0, k), PV: pv[k]}
+	}
+	return series
+}
+
+// closedInvestment returns a completed Investment bought on day t3 and sold
+// on day t4 of Jan 2020 with the given profit, before fees
+func closedInvestment(t3, t4 int, profit, fee float64) Investment {
+	dt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	return Investment{
+		T3:        dt.AddDate(0, 0, t3),
+		Fee:       fee,
+		Completed: true,
+		Chunks:    []SellInfo{{T4: dt.AddDate(0, 0, t4), ChunkProfit: profit}},
+	}
+}
+
+func TestRiskMetricsDrawdown(t *testing.T) {
+	series := pvSeries(100, 110, 99, 105, 120, 90, 130)
+	r := NewRiskMetrics(series, nil, 0.5)
+	if math.Abs(r.MaxDrawdown-0.25) > 1e-9 {
+		t.Errorf("expected MaxDrawdown 0.25, got %f", r.MaxDrawdown)
+	}
+	if !r.DtPeak.Equal(series[4].Dt) || !r.DtTrough.Equal(series[5].Dt) {
+		t.Errorf("expected the drawdown from %s to %s, got %s to %s", series[4].Dt, series[5].Dt, r.DtPeak, r.DtTrough)
+	}
+	if math.Abs(r.Calmar-2) > 1e-9 {
+		t.Errorf("expected Calmar 2, got %f", r.Calmar)
+	}
+	if r.Sortino <= r.Sharpe {
+		t.Errorf("expected Sortino > Sharpe for a rising series, got %f and %f", r.Sortino, r.Sharpe)
+	}
+
+	//---------------------------------------------------------------
+	// A series that never drops has no drawdown and capped ratios
+	//---------------------------------------------------------------
+	r = NewRiskMetrics(pvSeries(100, 101, 102, 104), nil, 0.1)
+	if r.MaxDrawdown != 0 || !r.DtPeak.IsZero() || r.Calmar != RiskRatioCap || r.Sortino != RiskRatioCap {
+		t.Errorf("unexpected metrics for a rising series: %+v", r)
+	}
+
+	//---------------------------------------------------------------
+	// An Investor that never trades has a flat series
+	//---------------------------------------------------------------
+	r = NewRiskMetrics(pvSeries(100, 100, 100, 100), nil, 0)
+	if r != (RiskMetrics{}) {
+		t.Errorf("expected zero metrics for a flat series, got %+v", r)
+	}
+}
+
+func TestRiskMetricsSharpe(t *testing.T) {
+	//---------------------------------------------------------------
+	// Daily returns of +2% and -1% alternating over a year of samples
+	//---------------------------------------------------------------
+	pv := []float64{100}
+	for k := 0; k < 365; k++ {
+		x := 0.02
+		if k%2 == 1 {
+			x = -0.01
+		}
+		pv = append(pv, pv[len(pv)-1]*(1+x))
+	}
+	r := NewRiskMetrics(pvSeries(pv...), nil, 0)
+
+	mean := (0.02*183 - 0.01*182) / 365
+	variance := (183*(0.02-mean)*(0.02-mean) + 182*(-0.01-mean)*(-0.01-mean)) / 364
+	sharpe := mean / math.Sqrt(variance) * math.Sqrt(365)
+	sortino := mean / math.Sqrt(182*0.0001/365) * math.Sqrt(365)
+	if math.Abs(r.Sharpe-sharpe) > 1e-6 {
+		t.Errorf("expected Sharpe %f, got %f", sharpe, r.Sharpe)
+	}
+	if math.Abs(r.Sortino-sortino) > 1e-6 {
+		t.Errorf("expected Sortino %f, got %f", sortino, r.Sortino)
+	}
+}
+
+func TestRiskMetricsTrades(t *testing.T) {
+	investments := []Investment{
+		closedInvestment(0, 4, 30, 1),  // win of 29, held 4 days
+		closedInvestment(2, 4, -10, 0), // loss of 10, held 2 days
+		closedInvestment(5, 11, 2, 3),  // loss of 1 after fees, held 6 days
+		{Completed: false},             // still open, not counted
+	}
+	r := NewRiskMetrics(nil, investments, 0)
+	if math.Abs(r.WinRate-1.0/3) > 1e-9 {
+		t.Errorf("expected WinRate 1/3, got %f", r.WinRate)
+	}
+	if math.Abs(r.ProfitFactor-29.0/11) > 1e-9 {
+		t.Errorf("expected ProfitFactor %f, got %f", 29.0/11, r.ProfitFactor)
+	}
+	if math.Abs(r.AvgHoldingDays-4) > 1e-9 {
+		t.Errorf("expected AvgHoldingDays 4, got %f", r.AvgHoldingDays)
+	}
+}
+
+// TestRiskMetricsFitness runs a simulation that uses the Sharpe ratio as
+// the fitness score and checks the risk metric columns of the financial
+// report.
+func TestRiskMetricsFitness(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.FitnessMetric = "Sharpe"
+	if err := util.ValidateFitnessMetric(cfg); err != nil || cfg.FitnessMetric != util.FitnessSharpe {
+		t.Fatalf("expected FitnessMetric sharpe, got %q, err = %v", cfg.FitnessMetric, err)
+	}
+	db := openSimTestDB(t, cfg)
+
+	util.Init(31)
+	s := runSimTest(t, cfg, db, "")
+	for k := range s.Investors {
+		v := &s.Investors[k]
+		if len(v.PVSeries) == 0 {
+			t.Fatalf("Investor %d has no portfolio value series", k)
+		}
+		want := math.Max(0, v.Risk.Sharpe)
+		if v.Fitness != want {
+			t.Errorf("Investor %d has Fitness %f, expected its Sharpe ratio %f", k, v.Fitness, want)
+		}
+		for j := 1; j < len(v.Investments); j++ {
+			if v.Investments[j].T3.Before(v.Investments[j-1].T3) {
+				t.Fatalf("Investor %d has Investments from an earlier generation", k) // every generation covers the same dates
+			}
+		}
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read finrep: %s", err)
+	}
+	report := string(b)
+	if !strings.Contains(report, "Fitness Metric: sharpe") {
+		t.Errorf("expected the report header to show the fitness metric")
+	}
+	hdr := "\"" + strings.Join(RiskMetricsColumns, "\",\"") + "\""
+	if !strings.Contains(report, hdr) {
+		t.Errorf("expected the risk metric columns in finrep, got:\n%s", report)
+	}
+	if !strings.Contains(report, s.TopInvestors[0].Risk.CSV()) {
+		t.Errorf("expected the risk metrics of the top Investor in finrep")
+	}
+
+	cfg.FitnessMetric = "omega"
+	if err := util.ValidateFitnessMetric(cfg); err == nil {
+		t.Errorf("expected an error for FitnessMetric omega")
+	}
+}
+
+// TestResetElite checks that an elite keeps its fitness score with the
+// default FitnessMetric, as it always has, and is scored again with a risk
+// metric
+func TestResetElite(t *testing.T) {
+	f, _ := taTestFactory(t)
+	s := Simulator{Cfg: f.cfg, factory: *f}
+	for _, metric := range []string{util.FitnessDefault, util.FitnessSharpe} {
+		f.cfg.FitnessMetric = metric
+		v := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+		v.Fitness, v.FitnessCalculated = 0.75, true
+		v.BalanceC1, v.PVSeries = 1, pvSeries(100, 110)
+		s.resetElite(&v)
+
+		if v.BalanceC1 != f.cfg.InitFunds || v.PVSeries != nil {
+			t.Errorf("%s: expected fresh funds and no portfolio values, got %f and %d", metric, v.BalanceC1, len(v.PVSeries))
+		}
+		if keep := metric == util.FitnessDefault; v.FitnessCalculated != keep {
+			t.Errorf("%s: expected FitnessCalculated %t, got %t", metric, keep, v.FitnessCalculated)
+		}
+	}
+}
+
+// TestResetEliteLots checks that an elite does not carry its open lots into
+// the next generation. Its balances start over, so the C2 of a carried lot
+// is gone. If the lot were kept, the first exit of the next generation would
+// sell it out of the C2 of the new buys, and create C1 out of nothing.
+func TestResetEliteLots(t *testing.T) {
+	f, _ := taTestFactory(t)
+	f.cfg.MaxHoldingDays = 5
+	s := Simulator{Cfg: f.cfg, factory: *f}
+	v := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	v.BalanceC1 = 1000
+	if err := v.ExecuteBuy(dt, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	s.resetElite(&v)
+
+	dt2 := dt.AddDate(0, 0, 10)
+	if err := v.ExecuteBuy(dt2, 0.1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	c1, c2 := v.BalanceC1, v.BalanceC2
+	if err := v.checkExits(dt2); err != nil {
+		t.Fatalf("checkExits returned error: %s", err)
+	}
+	if v.BalanceC1 != c1 || v.BalanceC2 != c2 || len(v.Investments) != 1 {
+		t.Errorf("expected %f C1 and %f C2 with only the new buy, got %f and %f with %d Investments",
+			c1, c2, v.BalanceC1, v.BalanceC2, len(v.Investments))
+	}
+}
@@ -0,0 +1,152 @@
+package newcore
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// This module has the trading calendar. The market for C1C2 is open every
+// day except the days the database's calendar lists as closed for the pair
+// and, unless the TradingDay rule is daily, weekends. Investors trade on the
+// open days that match the TradingDay rule. With TradingDayDeltas the
+// Influencers count Delta1 and Delta2 in open days rather than calendar days.
+// A portfolio Investor trades every pair of Pairs on the same days, so its
+// market is closed on the closed days of any of the pairs.
+
+// TradingCalendar decides which days the market is open and which days the
+// Investors trade
+// ------------------------------------------------------------------------------
+type TradingCalendar struct {
+	rule   util.TradingDayRule // the TradingDay rule
+	closed map[time.Time]bool  // the days the market for C1C2, or any of Pairs, is closed
+}
+
+// NewTradingCalendar returns the trading calendar for cfg. The closed days
+// come from db, which may be nil.
+// ------------------------------------------------------------------------------
+func NewTradingCalendar(cfg *util.AppConfig, db *newdata.Database) (*TradingCalendar, error) {
+	rule, err := util.ParseTradingDay(cfg.TradingDay)
+	if err != nil {
+		return nil, err
+	}
+	c := TradingCalendar{rule: rule, closed: map[time.Time]bool{}}
+	pairs := cfg.Pairs
+	if len(pairs) == 0 {
+		pairs = []string{cfg.C1 + cfg.C2}
+	}
+	if db != nil {
+		for _, d := range db.ClosedDays {
+			for _, pair := range pairs {
+				if d.ClosesPair(pair[:3], pair[3:]) {
+					c.closed[calendarDay(d.Date)] = true
+					break
+				}
+			}
+		}
+	}
+	return &c, nil
+}
+
+// calendarDay returns midnight UTC of the day of dt
+func calendarDay(dt time.Time) time.Time {
+	return time.Date(dt.Year(), dt.Month(), dt.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// everyDay returns true if the Investors trade every calendar day, as they
+// do without a trading calendar
+func (c *TradingCalendar) everyDay() bool {
+	return c == nil || (c.rule.Kind == util.TradingDaily && len(c.closed) == 0)
+}
+
+// calendarSummary describes the trading calendar c of cfg for the report
+// headers
+func calendarSummary(cfg *util.AppConfig, c *TradingCalendar) string {
+	s := cfg.TradingDay
+	if len(s) == 0 {
+		s = util.TradingDaily
+	}
+	if c != nil {
+		s += fmt.Sprintf(", %d closed days", len(c.closed))
+	}
+	if cfg.TradingDayDeltas {
+		s += ", deltas in open days"
+	}
+	return s
+}
+
+// IsOpen returns true if the market is open on dt. A nil calendar is
+// always open.
+// ------------------------------------------------------------------------------
+func (c *TradingCalendar) IsOpen(dt time.Time) bool {
+	if c == nil {
+		return true
+	}
+	if c.closed[calendarDay(dt)] {
+		return false
+	}
+	wd := dt.Weekday()
+	return c.rule.Kind == util.TradingDaily || (wd != time.Saturday && wd != time.Sunday)
+}
+
+// IsTradingDay returns true if the Investors trade on dt. A nil calendar
+// trades every day.
+// ------------------------------------------------------------------------------
+func (c *TradingCalendar) IsTradingDay(dt time.Time) bool {
+	if !c.IsOpen(dt) {
+		return false
+	}
+	if c == nil {
+		return true
+	}
+	switch c.rule.Kind {
+	case util.TradingEvery:
+		return c.rule.Days[dt.Weekday()]
+	case util.TradingFirstBusinessDay:
+		for d := dt.AddDate(0, 0, -1); d.Month() == dt.Month(); d = d.AddDate(0, 0, -1) {
+			if c.IsOpen(d) {
+				return false
+			}
+		}
+	case util.TradingLastBusinessDay:
+		for d := dt.AddDate(0, 0, 1); d.Month() == dt.Month(); d = d.AddDate(0, 0, 1) {
+			if c.IsOpen(d) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// AddOpenDays returns the date n days the market is open after dt, or
+// before it if n is negative. dt does not need to be open. A nil calendar
+// counts calendar days.
+// ------------------------------------------------------------------------------
+func (c *TradingCalendar) AddOpenDays(dt time.Time, n int) time.Time {
+	if c == nil {
+		return dt.AddDate(0, 0, n)
+	}
+	step := 1
+	if n < 0 {
+		step, n = -1, -n
+	}
+	for ; n > 0; n-- {
+		dt = dt.AddDate(0, 0, step)
+		for !c.IsOpen(dt) {
+			dt = dt.AddDate(0, 0, step)
+		}
+	}
+	return dt
+}
+
+// deltaDate returns the date delta days from T3, an Influencer's T1 or T2.
+// With TradingDayDeltas the days are the days the market is open.
+// ------------------------------------------------------------------------------
+func (i *Investor) deltaDate(T3 time.Time, delta int) time.Time {
+	if i.cfg.TradingDayDeltas && i.factory != nil {
+		return i.factory.cal.AddOpenDays(T3, delta)
+	}
+	return T3.AddDate(0, 0, delta)
+}
@@ -0,0 +1,138 @@
+package newcore
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// TestTradingCalendar checks the trading days of each rule and counting
+// open days around a weekend and a holiday
+func TestTradingCalendar(t *testing.T) {
+	cfg := util.CreateTestingCFG()
+	cfg.C1, cfg.C2 = "USD", "JPY"
+	var db newdata.Database
+	db.ClosedDays = []newdata.ClosedDay{
+		{Date: time.Date(2020, time.June, 1, 0, 0, 0, 0, time.UTC), Pair: "JPY"},     // a Monday
+		{Date: time.Date(2020, time.June, 30, 0, 0, 0, 0, time.UTC), Pair: "EURUSD"}, // not USDJPY
+	}
+	day := func(d int) time.Time { return time.Date(2020, time.June, d, 0, 0, 0, 0, time.UTC) }
+
+	cases := []struct {
+		rule string
+		days []int // the trading days of June 2020
+	}{
+		{"", []int{2, 3, 4, 5, 6, 7, 8}},
+		{"weekdays", []int{2, 3, 4, 5, 8}},
+		{"Every Monday,  Thursday", []int{4, 8, 11, 15, 18, 22, 25, 29}},
+		{"first business day of month", []int{2}},
+		{"last business day of month", []int{30}},
+	}
+	for _, c := range cases {
+		cfg.TradingDay = c.rule
+		cal, err := NewTradingCalendar(cfg, &db)
+		if err != nil {
+			t.Fatalf("%q: NewTradingCalendar returned error: %s", c.rule, err)
+		}
+		var got []int
+		for d := 1; d <= 30 && len(got) < len(c.days); d++ {
+			if cal.IsTradingDay(day(d)) {
+				got = append(got, d)
+			}
+		}
+		if len(got) != len(c.days) {
+			t.Errorf("%q: expected trading days %v, got %v", c.rule, c.days, got)
+			continue
+		}
+		for k := range got {
+			if got[k] != c.days[k] {
+				t.Errorf("%q: expected trading days %v, got %v", c.rule, c.days, got)
+				break
+			}
+		}
+	}
+	for _, rule := range []string{"every", "every funday", "monthly"} {
+		if _, err := util.ParseTradingDay(rule); err == nil {
+			t.Errorf("expected an error for %q", rule)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Open days skip the weekend and the holiday on June 1
+	//---------------------------------------------------------------
+	cfg.TradingDay = "weekdays"
+	cal, _ := NewTradingCalendar(cfg, &db)
+	if dt := cal.AddOpenDays(day(3), -2); !dt.Equal(time.Date(2020, time.May, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected May 29, got %s", dt.Format("Jan 2"))
+	}
+	if dt := cal.AddOpenDays(day(6), 1); !dt.Equal(day(8)) {
+		t.Errorf("expected June 8, got %s", dt.Format("Jan 2"))
+	}
+	inv := Investor{cfg: cfg, factory: &Factory{cal: cal}}
+	if dt := inv.deltaDate(day(3), -2); !dt.Equal(day(1)) {
+		t.Errorf("expected calendar days without TradingDayDeltas, got %s", dt.Format("Jan 2"))
+	}
+	cfg.TradingDayDeltas = true
+	if dt := inv.deltaDate(day(3), -2); !dt.Equal(time.Date(2020, time.May, 29, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected open days with TradingDayDeltas, got %s", dt.Format("Jan 2"))
+	}
+
+	//---------------------------------------------------------------
+	// A portfolio is closed on the closed days of any of its pairs
+	//---------------------------------------------------------------
+	cfg.Pairs = []string{"USDJPY", "EURUSD"}
+	cal, _ = NewTradingCalendar(cfg, &db)
+	if cal.IsOpen(day(1)) || cal.IsOpen(day(30)) || !cal.IsOpen(day(29)) {
+		t.Errorf("expected June 1 and June 30 closed and June 29 open for %v", cfg.Pairs)
+	}
+}
+
+// TestTradingCalendarSimulation runs a simulation that only trades on
+// Mondays and Thursdays, with a holiday on a Thursday
+func TestTradingCalendarSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 1)
+	cfg.TradingDay = "every monday, thursday"
+	cfg.TradingDayDeltas = true
+	db := openSimTestDB(t, cfg)
+	holiday := time.Date(2020, time.January, 16, 0, 0, 0, 0, time.UTC)
+	db.ClosedDays = []newdata.ClosedDay{{Date: holiday, Description: "test holiday"}}
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	check := func(dt time.Time, what string) {
+		if wd := dt.Weekday(); (wd != time.Monday && wd != time.Thursday) || dt.Equal(holiday) {
+			t.Errorf("%s on %s, which is not a trading day", what, dt.Format("Mon Jan 2, 2006"))
+		}
+	}
+	n := 0
+	for _, v := range s.Investors {
+		for _, p := range v.PVSeries {
+			check(p.Dt, "daily run")
+			n++
+		}
+		for _, m := range v.Investments {
+			check(m.T3, "buy")
+			for _, c := range m.Chunks {
+				check(c.T4, "sale")
+			}
+		}
+	}
+	if n == 0 {
+		t.Fatalf("expected the Investors to run on the trading days")
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), "Trading Calendar: every monday, thursday, 1 closed days, deltas in open days") {
+		t.Errorf("expected the trading calendar in the financial report:\n%s", b)
+	}
+}
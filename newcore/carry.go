@@ -0,0 +1,138 @@
+package newcore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// This module accrues interest on an Investor's balances, the carry. The
+// annual rate of each currency, in percent, is read from the metric named
+// for it in cfg.CarryRates, for example USDDR for {"USD": "DR"}. Interest
+// accrues every day of the simulation:
+//
+//	interest = balance * rate / 100 * days / 365
+//
+// C1 interest is added to BalanceC1. C2 interest is earned by the C2 of each
+// open Investment, it is added to the Investment's CarryC2 and to BalanceC2,
+// and it is sold along with the rest of the Investment's C2. ChunkProfit
+// takes the cost of all the C2 sold, interest included, at the Investment's
+// ERT3, so it remains the spot P&L and the carry is reported separately.
+
+// daysPerYear is the day count used to turn annual rates into daily ones
+const daysPerYear = 365
+
+// Carry is the interest an Investor earned on its balances in a generation
+// ------------------------------------------------------------------------------
+type Carry struct {
+	C1    float64 // interest earned on BalanceC1, in C1
+	C2    float64 // interest earned on BalanceC2, in C2
+	Total float64 // all the interest earned, in C1. C2 interest is converted at the exchange rate of the day it was earned
+}
+
+// CarryColumns are the column headers for Carry in the financial report, in
+// the order of the values written by CSV
+var CarryColumns = []string{
+	"Carry Interest C1",
+	"Carry Interest C2",
+	"Carry P&L",
+	"Spot P&L",
+}
+
+// CSV returns the carry as comma separated values, in the order of
+// CarryColumns. pl is the Investor's total profit or loss in C1, the spot
+// P&L is what is left of it after the carry.
+func (c *Carry) CSV(pl float64) string {
+	return fmt.Sprintf("%.2f,%.2f,%.2f,%.2f", c.C1, c.C2, c.Total, pl-c.Total)
+}
+
+// carryState is what an Investor needs to accrue interest day by day
+type carryState struct {
+	dt    time.Time            // the last day interest accrued
+	refs  [2]newdata.MetricRef // the rate metrics of C1 and C2
+	has   [2]bool              // true if the currency has a rate metric
+	rates [2]float64           // the latest rates found, used on days the database has none
+	ready bool                 // true once refs and has are set
+}
+
+// carrySummary describes cfg.CarryRates for the report headers
+// ------------------------------------------------------------------------------
+func carrySummary(cfg *util.AppConfig) string {
+	if len(cfg.CarryRates) == 0 {
+		return "none"
+	}
+	var s []string
+	for k, v := range cfg.CarryRates {
+		s = append(s, k+"="+v)
+	}
+	sort.Strings(s)
+	return strings.Join(s, ", ")
+}
+
+// remainingC2 returns the C2 of the Investment that has not been sold,
+// including the interest it earned
+func (m *Investment) remainingC2() float64 {
+	return m.T3C2Buy + m.CarryC2 - m.T4C2Sold
+}
+
+// accrueCarry adds the interest earned since the last day it accrued to the
+// balances. The rates used are the latest known before T3. Then it reads the
+// rates for T3.
+// ------------------------------------------------------------------------------
+func (i *Investor) accrueCarry(T3 time.Time) {
+	if len(i.cfg.CarryRates) == 0 {
+		return
+	}
+	st := &i.carry
+	if !st.ready {
+		for k, c := range []string{i.cfg.C1, i.cfg.C2} {
+			if m, ok := i.cfg.CarryRates[c]; ok {
+				st.refs[k] = newdata.NewMetricRef(newdata.FieldSelector{Metric: m, Locale: c})
+				st.has[k] = true
+			}
+		}
+		st.ready = true
+	}
+
+	if !st.dt.IsZero() && T3.After(st.dt) {
+		y := T3.Sub(st.dt).Hours() / 24 / daysPerYear
+		c1 := i.BalanceC1 * st.rates[0] / 100 * y
+		i.BalanceC1 += c1
+		i.Carry.C1 += c1
+		i.Carry.Total += c1
+
+		er := float64(0)
+		if v, err := i.db.Value(i.exchangeRef(), T3); err == nil {
+			er = v.Value
+		}
+		for j := 0; j < len(i.Investments) && st.rates[1] != 0; j++ {
+			m := &i.Investments[j]
+			if m.Completed || m.T3C2Buy == 0 {
+				continue
+			}
+			c2 := m.remainingC2() * st.rates[1] / 100 * y
+			m.CarryC2 += c2
+			i.BalanceC2 += c2
+			i.Carry.C2 += c2
+			if er < 0.0001 {
+				i.Carry.Total += c2 / m.ERT3 // no exchange rate on T3, the rate on the day of the buy is close enough
+			} else {
+				i.Carry.Total += c2 / er
+			}
+		}
+	}
+	st.dt = T3
+
+	for k := 0; k < 2; k++ {
+		if !st.has[k] {
+			continue
+		}
+		if v, err := i.db.Value(&st.refs[k], T3); err == nil {
+			st.rates[k] = v.Value
+		}
+	}
+}
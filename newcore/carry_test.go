@@ -0,0 +1,96 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// TestAccrueCarry accrues one day of interest on both balances and checks
+// that the C2 interest is sold with the Investment
+func TestAccrueCarry(t *testing.T) {
+	f, db := taTestFactory(t)
+	f.cfg.CarryRates = map[string]string{"USD": "DR", "JPY": "DR"}
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	inv.BalanceC1 = 1000
+	d0 := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	d1 := d0.AddDate(0, 0, 1)
+
+	rate := func(locale string, dt time.Time) float64 {
+		ref := newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: locale})
+		v, err := db.Value(&ref, dt)
+		if err != nil {
+			t.Fatalf("Value returned error: %s", err)
+		}
+		return v.Value
+	}
+
+	inv.accrueCarry(d0) // only reads the rates, there is nothing to accrue yet
+	if inv.Carry != (Carry{}) {
+		t.Fatalf("expected no carry on the first day, got %+v", inv.Carry)
+	}
+	if err := inv.ExecuteBuy(d0, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	c1, c2 := inv.BalanceC1, inv.BalanceC2
+	inv.accrueCarry(d1)
+
+	wantC1 := c1 * rate("USD", d0) / 100 / 365
+	wantC2 := c2 * rate("JPY", d0) / 100 / 365
+	if math.Abs(inv.Carry.C1-wantC1) > 1e-9 || math.Abs(inv.BalanceC1-c1-wantC1) > 1e-9 {
+		t.Errorf("expected C1 interest %f, got %f", wantC1, inv.Carry.C1)
+	}
+	if math.Abs(inv.Carry.C2-wantC2) > 1e-9 || math.Abs(inv.Investments[0].CarryC2-wantC2) > 1e-9 {
+		t.Errorf("expected C2 interest %f, got %f", wantC2, inv.Carry.C2)
+	}
+	v, _ := db.Value(inv.exchangeRef(), d1)
+	if want := wantC1 + wantC2/v.Value; math.Abs(inv.Carry.Total-want) > 1e-9 {
+		t.Errorf("expected total carry %f, got %f", want, inv.Carry.Total)
+	}
+
+	//---------------------------------------------------------------
+	// Selling everything sells the interest too
+	//---------------------------------------------------------------
+	if err := inv.ExecuteSell(d1, 1); err != nil {
+		t.Fatalf("ExecuteSell returned error: %s", err)
+	}
+	if !inv.Investments[0].Completed || math.Abs(inv.BalanceC2) > rnderr {
+		t.Errorf("expected all C2 sold, BalanceC2 = %f", inv.BalanceC2)
+	}
+}
+
+// TestCarrySimulation runs a simulation with carry and checks the carry
+// columns of the financial report
+func TestCarrySimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.CarryRates = map[string]string{"USD": "DR", "JPY": "DR"}
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	n := 0
+	for _, ti := range s.TopInvestors {
+		if ti.Carry.C1 != 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("expected top Investors with carry")
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), `"Carry Interest C1","Carry Interest C2","Carry P&L","Spot P&L"`) || !strings.Contains(string(b), "Carry Rates: JPY=DR, USD=DR") {
+		t.Errorf("expected carry columns in the financial report:\n%s", b)
+	}
+}
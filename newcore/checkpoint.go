@@ -0,0 +1,268 @@
+package newcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stmansour/psim/sqlt"
+	"github.com/stmansour/psim/util"
+)
+
+// CheckpointFileName is the name of the checkpoint file the simulator writes
+// to the report directory at the end of every generation.
+var CheckpointFileName = string("checkpoint.json")
+
+// Checkpoint is the state of a simulation at a generation boundary. It holds
+// everything needed to continue the simulation and produce the same results
+// as a run that was never interrupted. The only differences are the IDs of
+// the Influencers, which are regenerated.
+// ------------------------------------------------------------------------------
+type Checkpoint struct {
+	Version         string                 // simulator version that wrote the checkpoint
+	Saved           time.Time              // when the checkpoint was written
+	ConfigFilename  string                 // config file used by the simulation
+	ReportTimestamp string                 // timestamp used in report filenames
+	ReportDirectory string                 // where the reports are written
+	C1              string                 // must match the config on resume
+	C2              string                 // must match the config on resume
+	PopulationSize  int                    // must match the config on resume
+	DtStart         time.Time              // must match the config on resume
+	GensCompleted   int                    // total generations completed
+	NextLoop        int                    // the loop in which the next generation runs
+	NextGen         int                    // the generation number of the next generation within NextLoop
+	GenStart        time.Time              // first date of the next generation
+	RandSeed        int64                  // seed of the Factory's random number stream
+	RandDraws       uint64                 // values drawn from the Factory's random number stream so far
+	Hashes          []string               // the IDs of every Investor created so far
+	HashDuplicates  int64                  // Simulator.HashDuplicates
+	FactoryDups     int64                  // Factory.HashDuplicates
+	MutateCalls     int64                  // Factory.MutateCalls
+	Mutations       int64                  // Factory.Mutations
+	GenStats        []SimulationStatistics // stats for every generation completed
+	TopInvestors    []TopInvestor          // top investors so far
+	Investors       []CheckpointInvestor   // the population for the next generation
+}
+
+// CheckpointInvestor is an Investor in a Checkpoint. The DNA recreates the
+// Investor. The rest is the state that the DNA does not capture. Only elite
+// Investors carry predictions into the next generation, for all others
+// these are empty.
+// ------------------------------------------------------------------------------
+type CheckpointInvestor struct {
+	DNA               string
+	ID                string
+	W1                float64 // the DNA only has 4 decimal places
+	W2                float64
+	BalanceC1         float64
+	BalanceC2         float64
+	StopLossThreshold float64
+	StopLossCount     int
+	PortfolioValueC1  float64
+	DtPortfolioValue  time.Time
+	FitnessCalculated bool
+	Fitness           float64
+	Parented          int64
+	RandSeed          int64  // seed of the Investor's random number stream
+	RandDraws         uint64 // values drawn from the Investor's random number stream so far
+	Investments       []Investment
+	InvestmentIDs     []string               // the ids of the Investments, which json does not save because they are not exported
+	Influencers       []CheckpointInfluencer // same order as the Influencers in DNA
+}
+
+// CheckpointInfluencer is the state of an Influencer that its DNA does not
+// capture.
+// ------------------------------------------------------------------------------
+type CheckpointInfluencer struct {
+	FitnessCalculated bool
+	Fitness           float64
+	NilDataCount      int
+	Predictions       []Prediction
+}
+
+// WriteCheckpoint saves the state of the simulation to CheckpointFileName in
+// the report directory. It is called after the population for the next
+// generation has been created. The file is written to a temporary name and
+// renamed so that a crash while writing never destroys the previous
+// checkpoint.
+//
+// INPUTS
+//
+//	nextLoop - the loop in which the next generation will run
+//	nextGen  - generation number of the next generation within nextLoop
+//	genStart - first date of the next generation
+//
+// ------------------------------------------------------------------------------
+func (s *Simulator) WriteCheckpoint(nextLoop, nextGen int, genStart time.Time) error {
+	cp := Checkpoint{
+		Version:         util.Version(),
+		Saved:           time.Now(),
+		ConfigFilename:  s.Cfg.ConfigFilename,
+		ReportTimestamp: s.Cfg.ReportTimestamp,
+		ReportDirectory: s.Cfg.ReportDirectory,
+		C1:              s.Cfg.C1,
+		C2:              s.Cfg.C2,
+		PopulationSize:  s.Cfg.PopulationSize,
+		DtStart:         time.Time(s.Cfg.DtStart),
+		GensCompleted:   s.GensCompleted,
+		NextLoop:        nextLoop,
+		NextGen:         nextGen,
+		GenStart:        genStart,
+		HashDuplicates:  s.HashDuplicates,
+		FactoryDups:     s.factory.HashDuplicates,
+		MutateCalls:     s.factory.MutateCalls,
+		Mutations:       s.factory.Mutations,
+		GenStats:        s.GenStats,
+		TopInvestors:    s.TopInvestors,
+	}
+	cp.RandSeed, cp.RandDraws = s.factory.rng.State()
+
+	if !s.Cfg.AllowDuplicateInvestors && s.SqltDB != nil {
+		var err error
+		if cp.Hashes, err = sqlt.AllHashes(s.SqltDB); err != nil {
+			return err
+		}
+	}
+
+	for j := 0; j < len(s.Investors); j++ {
+		v := &s.Investors[j]
+		ci := CheckpointInvestor{
+			DNA:               v.DNA(),
+			ID:                v.ID,
+			W1:                v.W1,
+			W2:                v.W2,
+			BalanceC1:         v.BalanceC1,
+			BalanceC2:         v.BalanceC2,
+			StopLossThreshold: v.StopLossThreshold,
+			StopLossCount:     v.StopLossCount,
+			PortfolioValueC1:  v.PortfolioValueC1,
+			DtPortfolioValue:  v.DtPortfolioValue,
+			FitnessCalculated: v.FitnessCalculated,
+			Fitness:           v.Fitness,
+			Parented:          v.Parented,
+			Investments:       v.Investments,
+		}
+		ci.RandSeed, ci.RandDraws = v.rng.State()
+		for k := range v.Investments {
+			ci.InvestmentIDs = append(ci.InvestmentIDs, v.Investments[k].id)
+		}
+		for _, inf := range v.Influencers {
+			ci.Influencers = append(ci.Influencers, CheckpointInfluencer{
+				FitnessCalculated: inf.IsFitnessCalculated(),
+				Fitness:           inf.GetFitnessScore(),
+				NilDataCount:      inf.GetNilDataCount(),
+				Predictions:       inf.GetMyPredictions(),
+			})
+		}
+		cp.Investors = append(cp.Investors, ci)
+	}
+
+	b, err := json.Marshal(&cp)
+	if err != nil {
+		return err
+	}
+	fname := filepath.Join(s.Cfg.ReportDirectory, CheckpointFileName)
+	tmp := fname + ".tmp"
+	if err = os.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, fname)
+}
+
+// LoadCheckpoint restores the state of the simulation from the supplied
+// checkpoint file. It replaces the population and everything the simulator
+// has accumulated, and it puts the random number generator back to where it
+// was when the checkpoint was written. Run will then start with the next
+// generation. The reports are written to the same directory as the original
+// run.
+// ------------------------------------------------------------------------------
+func (s *Simulator) LoadCheckpoint(fname string) error {
+	b, err := os.ReadFile(fname)
+	if err != nil {
+		return err
+	}
+	var cp Checkpoint
+	if err = json.Unmarshal(b, &cp); err != nil {
+		return fmt.Errorf("%s: %s", fname, err)
+	}
+
+	//-------------------------------------------------------------------------
+	// The checkpoint is only meaningful with the configuration that wrote it
+	//-------------------------------------------------------------------------
+	if cp.C1 != s.Cfg.C1 || cp.C2 != s.Cfg.C2 {
+		return fmt.Errorf("checkpoint is for %s/%s, the config file is for %s/%s", cp.C1, cp.C2, s.Cfg.C1, s.Cfg.C2)
+	}
+	if cp.PopulationSize != s.Cfg.PopulationSize {
+		return fmt.Errorf("checkpoint PopulationSize is %d, the config file has %d", cp.PopulationSize, s.Cfg.PopulationSize)
+	}
+	if !cp.DtStart.Equal(time.Time(s.Cfg.DtStart)) {
+		return fmt.Errorf("checkpoint DtStart is %s, the config file has %s", cp.DtStart.Format("2006-01-02"), time.Time(s.Cfg.DtStart).Format("2006-01-02"))
+	}
+	if len(cp.ConfigFilename) > 0 && cp.ConfigFilename != s.Cfg.ConfigFilename {
+		log.Printf("*** WARNING *** checkpoint was written using config file %s, resuming with %s\n", cp.ConfigFilename, s.Cfg.ConfigFilename)
+	}
+
+	//-------------------------------------------------------------------------
+	// Recreate the population. This draws random numbers from the Factory,
+	// so its stream is restored afterwards.
+	//-------------------------------------------------------------------------
+	s.Investors = make([]Investor, 0, len(cp.Investors))
+	for _, ci := range cp.Investors {
+		v := s.factory.NewInvestorFromDNA(ci.DNA)
+		if len(v.Influencers) != len(ci.Influencers) {
+			return fmt.Errorf("investor %s: DNA has %d Influencers, checkpoint has %d", ci.ID, len(v.Influencers), len(ci.Influencers))
+		}
+		v.ID = ci.ID
+		v.W1 = ci.W1
+		v.W2 = ci.W2
+		v.BalanceC1 = ci.BalanceC1
+		v.BalanceC2 = ci.BalanceC2
+		v.StopLossThreshold = ci.StopLossThreshold
+		v.StopLossCount = ci.StopLossCount
+		v.PortfolioValueC1 = ci.PortfolioValueC1
+		v.DtPortfolioValue = ci.DtPortfolioValue
+		v.FitnessCalculated = ci.FitnessCalculated
+		v.Fitness = ci.Fitness
+		v.Parented = ci.Parented
+		v.rng = util.RestoreRandStream(ci.RandSeed, ci.RandDraws)
+		v.Investments = ci.Investments
+		for k := 0; k < len(v.Investments) && k < len(ci.InvestmentIDs); k++ {
+			v.Investments[k].id = ci.InvestmentIDs[k]
+		}
+		for k, inf := range v.Influencers {
+			ck := ci.Influencers[k]
+			inf.SetMyPredictions(ck.Predictions)
+			if ck.FitnessCalculated {
+				inf.SetFitnessScore(ck.Fitness)
+			}
+			for n := 0; n < ck.NilDataCount; n++ {
+				inf.IncNilDataCount()
+			}
+		}
+		s.Investors = append(s.Investors, v)
+	}
+
+	if !s.Cfg.AllowDuplicateInvestors && s.SqltDB != nil {
+		if err = sqlt.ReplaceHashes(s.SqltDB, cp.Hashes); err != nil {
+			return err
+		}
+	}
+	s.factory.rng = util.RestoreRandStream(cp.RandSeed, cp.RandDraws)
+
+	s.GensCompleted = cp.GensCompleted
+	s.LoopsCompleted = cp.NextLoop
+	s.GenStats = cp.GenStats
+	s.TopInvestors = cp.TopInvestors
+	s.HashDuplicates = cp.HashDuplicates
+	s.factory.HashDuplicates = cp.FactoryDups
+	s.factory.MutateCalls = cp.MutateCalls
+	s.factory.Mutations = cp.Mutations
+	s.Cfg.ReportTimestamp = cp.ReportTimestamp
+	s.Cfg.ReportDirectory = cp.ReportDirectory
+	s.Cfg.ReportDirSet = true
+	s.resume = &cp
+	return nil
+}
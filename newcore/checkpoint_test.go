@@ -0,0 +1,155 @@
+package newcore
+
+import (
+	"database/sql"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/sqlt"
+	"github.com/stmansour/psim/util"
+)
+
+// simTestCfg returns the config for tests that run complete simulations.
+// The reports are written to dir.
+func simTestCfg(dir string, generations int) *util.AppConfig {
+	cfg := util.CreateTestingCFG()
+	cfg.DtStart = util.CustomDate(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	cfg.DtStop = util.CustomDate(time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC))
+	cfg.Generations = generations
+	cfg.LoopCount = 1
+	cfg.PopulationSize = 12
+	cfg.MinInfluencers = 1
+	cfg.MaxInfluencers = 2
+	cfg.MutationRate = 10
+	cfg.PreserveElite = true
+	cfg.PreserveElitePct = 20
+	cfg.HoldWindowStatsLookBack = 20
+	cfg.StdDevVariationFactor = 0.05
+	cfg.EnforceStopDate = true
+	cfg.WorkerPoolSize = 4
+	cfg.TopInvestorCount = 10
+	cfg.ArchiveBaseDir = dir
+	return cfg
+}
+
+// openSimTestDB opens a CSV database with the same metrics as
+// writeParityCSVDB, but without gaps in the data. The simulator cannot
+// settle an investment on a day without an exchange rate.
+func openSimTestDB(t *testing.T, cfg *util.AppConfig) *newdata.Database {
+	return openSimTestDBColumns(t, cfg, parityColumns)
+}
+
+// openSimTestDBColumns is openSimTestDB with the columns cols
+func openSimTestDBColumns(t *testing.T, cfg *util.AppConfig, cols []parityColumn) *newdata.Database {
+	dtStart := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)
+	dtStop := time.Date(2020, time.June, 30, 0, 0, 0, 0, time.UTC)
+	db, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	db.SetCSVFilename(writeParityCSVDB(t, t.TempDir(), dtStart, dtStop, cols, false))
+	if err = db.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if err = db.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	return db
+}
+
+// openSimTestSqlt opens an Investor hash database in a temp directory
+func openSimTestSqlt(t *testing.T) *sql.DB {
+	sqltdb, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "sqlt.db"))
+	if err != nil {
+		t.Fatalf("sql.Open returned error: %s", err)
+	}
+	t.Cleanup(func() { sqltdb.Close() })
+	if err = sqlt.CreateSchema(sqltdb); err != nil {
+		t.Fatalf("CreateSchema returned error: %s", err)
+	}
+	return sqltdb
+}
+
+// runSimTest runs a simulation and returns the simulator when it is done
+func runSimTest(t *testing.T, cfg *util.AppConfig, db *newdata.Database, resume string) *Simulator {
+	var s Simulator
+	s.ResetSimulator()
+	s.SqltDB = openSimTestSqlt(t)
+	s.ResumeFile = resume
+	if err := s.Init(cfg, db, nil, false, false); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	s.Run()
+	return &s
+}
+
+// TestCheckpointResume runs a 4 generation simulation without interruption.
+// It then runs the same simulation again, stopping it after 2 generations
+// (as /stopsim would), and resumes it from the checkpoint. The results must
+// be identical.
+func TestCheckpointResume(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 4)
+	db := openSimTestDB(t, cfg)
+
+	util.Init(1234)
+	full := runSimTest(t, cfg, db, "")
+
+	//----------------------------------------------------------------
+	// Same seed, but the run is stopped after 2 generations. The
+	// checkpoint is then the state after generation 1.
+	//----------------------------------------------------------------
+	util.Init(1234)
+	stopDir := t.TempDir()
+	runSimTest(t, simTestCfg(stopDir, 2), db, "")
+
+	util.Init(-1) // resume must not depend on the seed in effect
+	resumed := runSimTest(t, simTestCfg(t.TempDir(), 4), db, filepath.Join(stopDir, CheckpointFileName))
+
+	if len(full.GenStats) != 4 || len(resumed.GenStats) != 4 {
+		t.Fatalf("expected 4 generations of stats, got %d and %d", len(full.GenStats), len(resumed.GenStats))
+	}
+	for i := range full.GenStats {
+		if !reflect.DeepEqual(full.GenStats[i], resumed.GenStats[i]) {
+			t.Errorf("generation %d stats differ:\n  full:    %+v\n  resumed: %+v", i, full.GenStats[i], resumed.GenStats[i])
+		}
+	}
+	if !reflect.DeepEqual(full.TopInvestors, resumed.TopInvestors) {
+		t.Errorf("top investors differ:\n  full:    %+v\n  resumed: %+v", full.TopInvestors, resumed.TopInvestors)
+	}
+	if resumed.Cfg.ReportDirectory != stopDir {
+		t.Errorf("expected resumed reports in %s, got %s", stopDir, resumed.Cfg.ReportDirectory)
+	}
+}
+
+// TestCheckpointInvestmentIDs checks that the ids of an Investor's
+// Investments survive a checkpoint
+func TestCheckpointInvestmentIDs(t *testing.T) {
+	dir := t.TempDir()
+	cfg := simTestCfg(dir, 1)
+	db := openSimTestDB(t, cfg)
+
+	util.Init(1234)
+	s := runSimTest(t, cfg, db, "")
+	dt := time.Time(cfg.DtStart)
+	s.Investors[0].Investments = []Investment{{id: "lot-a", T3: dt}, {id: "lot-b", T3: dt.AddDate(0, 0, 1)}}
+	if err := s.WriteCheckpoint(0, 1, dt); err != nil {
+		t.Fatalf("WriteCheckpoint returned error: %s", err)
+	}
+
+	var r Simulator
+	r.ResetSimulator()
+	r.SqltDB = openSimTestSqlt(t)
+	if err := r.Init(simTestCfg(t.TempDir(), 1), db, nil, false, false); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	if err := r.LoadCheckpoint(filepath.Join(cfg.ReportDirectory, CheckpointFileName)); err != nil {
+		t.Fatalf("LoadCheckpoint returned error: %s", err)
+	}
+	m := r.Investors[0].Investments
+	if len(m) != 2 || m[0].ID() != "lot-a" || m[1].ID() != "lot-b" {
+		t.Errorf("expected Investments lot-a and lot-b, got %+v", m)
+	}
+}
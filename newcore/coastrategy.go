@@ -0,0 +1,283 @@
+package newcore
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+
+	"github.com/stmansour/psim/util"
+)
+
+// COAStrategy turns the votes of an Investor's Influencers into a course of
+// action. When Decide is called, the BuyVotes, SellVotes and HoldVotes of coa
+// are the sums of Probability * Weight of the predictions for each action,
+// TotalVotes is their sum, Abstains is the number of Influencers that
+// abstained, and Predictions has every Influencer's prediction. Decide sets
+// Action and ActionPct.
+//
+// A strategy can have parameters. They are genes in the Investor's DNA, so
+// they are inherited and mutated like any other gene. Decide gets the
+// Investor's values for them.
+// ----------------------------------------------------------------------------
+type COAStrategy interface {
+	Name() string          // the Strategy value in Investor DNA
+	Genes() []StrategyGene // the parameters of the strategy, nil if it has none
+	Decide(coa *CourseOfAction, params StrategyParams) error
+}
+
+// StrategyParams holds an Investor's values of the genes of its strategy,
+// keyed by gene name
+type StrategyParams map[string]float64
+
+// StrategyGene describes a parameter of a COAStrategy
+// ----------------------------------------------------------------------------
+type StrategyGene struct {
+	Name     string  // key in Investor DNA, it must be unique over all strategies
+	Min      float64 // smallest value
+	Max      float64 // largest value
+	Decimals int     // decimal places of the value in DNA, 0 for an integer
+	Default  float64 // value used when the DNA does not have the gene
+}
+
+// coaStrategies holds every registered strategy, indexed like
+// InvestmentStrategies
+var coaStrategies []COAStrategy
+
+// RegisterCOAStrategy adds a strategy. Its index in InvestmentStrategies is
+// the Investor's Strategy value, so strategies must always be registered in
+// the same order. Registering a name or a gene name twice is a programming
+// error and panics.
+// ----------------------------------------------------------------------------
+func RegisterCOAStrategy(s COAStrategy) {
+	if _, ok := InvestmentStrategyMap[s.Name()]; ok || s.Name() == RuleTreeStrategy {
+		log.Panicf("*** PANIC ERROR *** COA strategy %s is already registered\n", s.Name())
+	}
+	for _, g := range s.Genes() {
+		if _, ok := strategyGene(g.Name); ok {
+			log.Panicf("*** PANIC ERROR *** COA strategy %s: gene %s is already in use\n", s.Name(), g.Name)
+		}
+	}
+	InvestmentStrategyMap[s.Name()] = len(InvestmentStrategies)
+	InvestmentStrategies = append(InvestmentStrategies, s.Name())
+	coaStrategies = append(coaStrategies, s)
+}
+
+// strategyGene returns the description of the strategy gene name
+func strategyGene(name string) (StrategyGene, bool) {
+	for _, s := range coaStrategies {
+		for _, g := range s.Genes() {
+			if g.Name == name {
+				return g, true
+			}
+		}
+	}
+	return StrategyGene{}, false
+}
+
+// ValidateCOAStrategies checks that every name in cfg.COAStrategies is a
+// registered strategy
+// ----------------------------------------------------------------------------
+func ValidateCOAStrategies(cfg *util.AppConfig) error {
+	for _, name := range cfg.COAStrategies {
+		if _, ok := InvestmentStrategyMap[name]; !ok {
+			return fmt.Errorf("unknown COA strategy %q in COAStrategies, it must be one of: %v", name, InvestmentStrategies)
+		}
+	}
+	return nil
+}
+
+// strategyChoices returns the indexes of the strategies that random
+// Investors may use. If COAStrategies is not set they are DistributedDecision
+// and MajorityRules.
+// ----------------------------------------------------------------------------
+func strategyChoices(cfg *util.AppConfig) []int {
+	var choices []int
+	for _, name := range cfg.COAStrategies {
+		if k, ok := InvestmentStrategyMap[name]; ok {
+			choices = append(choices, k)
+		}
+	}
+	if len(choices) == 0 {
+		choices = []int{InvestmentStrategyMap["DistributedDecision"], InvestmentStrategyMap["MajorityRules"]}
+	}
+	return choices
+}
+
+// randomStrategyParams returns random values for the genes of strategy k. It
+// returns nil, and uses no random numbers, if the strategy has no genes.
+// ----------------------------------------------------------------------------
+func randomStrategyParams(k int, rng *util.RandStream) StrategyParams {
+	genes := coaStrategies[k].Genes()
+	if len(genes) == 0 {
+		return nil
+	}
+	m := StrategyParams{}
+	for _, g := range genes {
+		m[g.Name] = fitGene(g.Min+rng.Float64()*(g.Max-g.Min), g.Min, g.Max, g.Decimals)
+	}
+	return m
+}
+
+// strategyParamsDNA returns the DNA of the genes of strategy k, each followed
+// by a semicolon, sorted by name
+// ----------------------------------------------------------------------------
+func strategyParamsDNA(k int, params StrategyParams) string {
+	gs := coaStrategies[k].Genes()
+	sort.Slice(gs, func(a, b int) bool { return gs[a].Name < gs[b].Name })
+	s := ""
+	for _, g := range gs {
+		x, ok := params[g.Name]
+		if !ok {
+			x = g.Default
+		}
+		s += fmt.Sprintf("%s=%s;", g.Name, formatGene(x, g.Decimals))
+	}
+	return s
+}
+
+// paramOrDefault returns the value of gene g in params, or its default
+func paramOrDefault(params StrategyParams, g StrategyGene) float64 {
+	if x, ok := params[g.Name]; ok {
+		return x
+	}
+	return g.Default
+}
+
+//==============================================================================
+//  BUILT-IN STRATEGIES
+//==============================================================================
+
+// coaFunc is a COAStrategy made from a function
+type coaFunc struct {
+	name   string
+	genes  []StrategyGene
+	decide func(coa *CourseOfAction, params StrategyParams) error
+}
+
+func (s *coaFunc) Name() string          { return s.name }
+func (s *coaFunc) Genes() []StrategyGene { return append([]StrategyGene(nil), s.genes...) }
+func (s *coaFunc) Decide(coa *CourseOfAction, params StrategyParams) error {
+	return s.decide(coa, params)
+}
+
+// The genes of the built-in strategies
+var (
+	geneConfidenceThreshold = StrategyGene{Name: "ConfidenceThreshold", Min: 0.1, Max: 0.9, Decimals: 2, Default: 0.5}
+	geneSupermajorityPct    = StrategyGene{Name: "SupermajorityPct", Min: 0.5, Max: 1, Decimals: 2, Default: 0.67}
+	geneQuorumPct           = StrategyGene{Name: "QuorumPct", Min: 0, Max: 1, Decimals: 2, Default: 0.5}
+	geneContrarianPct       = StrategyGene{Name: "ContrarianPct", Min: 0.5, Max: 1, Decimals: 2, Default: 0.75}
+)
+
+// The order of registration sets each strategy's index, new strategies go at
+// the end
+func init() {
+	RegisterCOAStrategy(&coaFunc{name: "DistributedDecision", decide: func(coa *CourseOfAction, _ StrategyParams) error { return distributedDecisionCOA(coa) }})
+	RegisterCOAStrategy(&coaFunc{name: "MajorityRules", decide: func(coa *CourseOfAction, _ StrategyParams) error { return majorityRulesCOA(coa) }})
+	RegisterCOAStrategy(&coaFunc{name: "ConfidenceWeighted", genes: []StrategyGene{geneConfidenceThreshold}, decide: confidenceWeightedCOA})
+	RegisterCOAStrategy(&coaFunc{name: "Supermajority", genes: []StrategyGene{geneSupermajorityPct, geneQuorumPct}, decide: supermajorityCOA})
+	RegisterCOAStrategy(&coaFunc{name: "Unanimous", decide: unanimousCOA})
+	RegisterCOAStrategy(&coaFunc{name: "Contrarian", genes: []StrategyGene{geneContrarianPct}, decide: contrarianCOA})
+}
+
+// activeCount returns the number of Influencers that did not abstain
+func activeCount(coa *CourseOfAction) float64 {
+	return float64(len(coa.Predictions)) - coa.Abstains
+}
+
+// confidenceWeightedCOA measures the confidence behind buy and sell as the
+// average Probability * Weight over the Influencers that did not abstain.
+// It acts when the stronger of the two reaches ConfidenceThreshold, and
+// ActionPct is the confidence. Otherwise it holds.
+//
+// -----------------------------------------------------------------------------
+func confidenceWeightedCOA(coa *CourseOfAction, params StrategyParams) error {
+	coa.Action = "hold"
+	coa.ActionPct = 1
+	n := activeCount(coa)
+	if n <= 0 {
+		return nil
+	}
+	threshold := paramOrDefault(params, geneConfidenceThreshold)
+	buy := coa.BuyVotes / n
+	sell := coa.SellVotes / n
+	if buy >= threshold && buy > sell {
+		coa.Action = "buy"
+		coa.ActionPct = math.Min(1, buy)
+	} else if sell >= threshold && sell > buy {
+		coa.Action = "sell"
+		coa.ActionPct = math.Min(1, sell)
+	}
+	return nil
+}
+
+// supermajorityCOA abstains unless at least QuorumPct of the Influencers
+// voted. It buys or sells when that action has at least SupermajorityPct of
+// the votes, otherwise it holds. The ActionPct is always 100%.
+//
+// -----------------------------------------------------------------------------
+func supermajorityCOA(coa *CourseOfAction, params StrategyParams) error {
+	coa.ActionPct = 1
+	if len(coa.Predictions) == 0 || coa.TotalVotes <= 0 || activeCount(coa)/float64(len(coa.Predictions)) < paramOrDefault(params, geneQuorumPct) {
+		coa.Action = "abstain"
+		coa.ActionPct = 0
+		return nil
+	}
+	pct := paramOrDefault(params, geneSupermajorityPct)
+	if coa.BuyVotes/coa.TotalVotes >= pct {
+		coa.Action = "buy"
+	} else if coa.SellVotes/coa.TotalVotes >= pct {
+		coa.Action = "sell"
+	} else {
+		coa.Action = "hold"
+	}
+	return nil
+}
+
+// unanimousCOA buys or sells only when every Influencer that did not
+// abstain predicted that action. Otherwise it holds. The ActionPct is always
+// 100%.
+//
+// -----------------------------------------------------------------------------
+func unanimousCOA(coa *CourseOfAction, _ StrategyParams) error {
+	coa.Action = "hold"
+	coa.ActionPct = 1
+	action := ""
+	for _, p := range coa.Predictions {
+		switch {
+		case p.Action == "abstain":
+		case action == "":
+			action = p.Action
+		case p.Action != action:
+			return nil
+		}
+	}
+	if action == "buy" || action == "sell" {
+		coa.Action = action
+	}
+	return nil
+}
+
+// contrarianCOA bets against a crowded trade. When buy has at least
+// ContrarianPct of the votes it sells, when sell does it buys. ActionPct is
+// the share of the votes of the crowded side. Otherwise it holds.
+//
+// -----------------------------------------------------------------------------
+func contrarianCOA(coa *CourseOfAction, params StrategyParams) error {
+	coa.Action = "hold"
+	coa.ActionPct = 1
+	if coa.TotalVotes <= 0 {
+		return nil
+	}
+	pct := paramOrDefault(params, geneContrarianPct)
+	buy := coa.BuyVotes / coa.TotalVotes
+	sell := coa.SellVotes / coa.TotalVotes
+	if buy >= pct {
+		coa.Action = "sell"
+		coa.ActionPct = buy
+	} else if sell >= pct {
+		coa.Action = "buy"
+		coa.ActionPct = sell
+	}
+	return nil
+}
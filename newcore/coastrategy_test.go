@@ -0,0 +1,162 @@
+package newcore
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stmansour/psim/util"
+)
+
+// coaVotes returns a CourseOfAction with one prediction for each action in
+// actions, each with a Probability of p and a Weight of 1, tallied the way
+// DecideCourseOfAction tallies them
+func coaVotes(p float64, actions ...string) CourseOfAction {
+	var coa CourseOfAction
+	for _, a := range actions {
+		coa.Predictions = append(coa.Predictions, Prediction{Action: a, Probability: p, Weight: 1})
+		switch a {
+		case "buy":
+			coa.BuyVotes += p
+		case "sell":
+			coa.SellVotes += p
+		case "hold":
+			coa.HoldVotes += p
+		case "abstain":
+			coa.Abstains++
+		}
+	}
+	return coa
+}
+
+// TestCOAStrategies checks the decision of every built-in strategy on a
+// handful of votes
+func TestCOAStrategies(t *testing.T) {
+	cases := []struct {
+		method  string
+		params  StrategyParams
+		p       float64
+		actions []string
+		want    string
+		pct     float64
+	}{
+		{"DistributedDecision", nil, 1, []string{"buy", "buy", "sell"}, "buy", 2.0 / 3},
+		{"MajorityRules", nil, 1, []string{"buy", "buy", "sell"}, "buy", 1},
+		{"MajorityRules", nil, 1, []string{"buy", "hold", "sell"}, "hold", 1},
+
+		{"ConfidenceWeighted", StrategyParams{"ConfidenceThreshold": 0.6}, 1, []string{"buy", "buy", "sell"}, "buy", 2.0 / 3},
+		{"ConfidenceWeighted", StrategyParams{"ConfidenceThreshold": 0.6}, 0.8, []string{"buy", "buy", "sell"}, "hold", 1},
+		{"ConfidenceWeighted", StrategyParams{"ConfidenceThreshold": 0.5}, 1, []string{"sell", "sell", "abstain", "hold"}, "sell", 2.0 / 3},
+		{"ConfidenceWeighted", nil, 1, []string{"abstain"}, "hold", 1},
+
+		{"Supermajority", StrategyParams{"SupermajorityPct": 0.75, "QuorumPct": 0.5}, 1, []string{"buy", "buy", "buy", "sell"}, "buy", 1},
+		{"Supermajority", StrategyParams{"SupermajorityPct": 0.8, "QuorumPct": 0.5}, 1, []string{"buy", "buy", "buy", "sell"}, "hold", 1},
+		{"Supermajority", StrategyParams{"SupermajorityPct": 0.6, "QuorumPct": 0.5}, 1, []string{"sell", "abstain", "abstain"}, "abstain", 0},
+		{"Supermajority", StrategyParams{"SupermajorityPct": 0.6, "QuorumPct": 0.3}, 1, []string{"sell", "abstain", "abstain"}, "sell", 1},
+
+		{"Unanimous", nil, 1, []string{"buy", "abstain", "buy"}, "buy", 1},
+		{"Unanimous", nil, 1, []string{"buy", "sell", "buy"}, "hold", 1},
+		{"Unanimous", nil, 1, []string{"hold", "hold"}, "hold", 1},
+
+		{"Contrarian", StrategyParams{"ContrarianPct": 0.75}, 1, []string{"buy", "buy", "buy", "hold"}, "sell", 0.75},
+		{"Contrarian", StrategyParams{"ContrarianPct": 0.75}, 1, []string{"sell", "sell", "sell", "sell"}, "buy", 1},
+		{"Contrarian", StrategyParams{"ContrarianPct": 0.75}, 1, []string{"buy", "buy", "sell"}, "hold", 1},
+	}
+	for _, c := range cases {
+		coa := coaVotes(c.p, c.actions...)
+		if err := setCourseOfAction(&coa, c.method, c.params); err != nil {
+			t.Fatalf("%s: setCourseOfAction returned error: %s", c.method, err)
+		}
+		if coa.Action != c.want || coa.ActionPct-c.pct > 1e-9 || c.pct-coa.ActionPct > 1e-9 {
+			t.Errorf("%s %v %v: expected %s %.3f, got %s %.3f", c.method, c.params, c.actions, c.want, c.pct, coa.Action, coa.ActionPct)
+		}
+	}
+	coa := coaVotes(1, "buy")
+	if err := setCourseOfAction(&coa, "Astrology", nil); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
+
+// TestStrategyParamsDNA checks that strategy genes are written to and read
+// from Investor DNA, and that they stay in range when bred and mutated
+func TestStrategyParamsDNA(t *testing.T) {
+	f, _ := taTestFactory(t)
+	infs := ";InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}"
+	dna := "{Investor;Strategy=Supermajority;QuorumPct=0.4;SupermajorityPct=0.8" + infs
+	inv := f.NewInvestorFromDNA(dna)
+	if s := inv.DNA(); s != strings.Replace(dna, "{Investor;", "{Investor;ID="+inv.ID+";", 1) {
+		t.Errorf("DNA did not round trip, got %s", s)
+	}
+	if inv.StrategyParams["QuorumPct"] != 0.4 || inv.StrategyParams["SupermajorityPct"] != 0.8 {
+		t.Errorf("unexpected params %v", inv.StrategyParams)
+	}
+
+	//---------------------------------------------------------------
+	// Missing genes get their defaults, values out of range are
+	// clamped, strategies without genes have the DNA they always had
+	//---------------------------------------------------------------
+	inv = f.NewInvestorFromDNA("{Investor;Strategy=Supermajority;SupermajorityPct=1.5" + infs)
+	if inv.StrategyParams["QuorumPct"] != 0.5 || inv.StrategyParams["SupermajorityPct"] != 1 {
+		t.Errorf("expected QuorumPct 0.5 and SupermajorityPct 1, got %v", inv.StrategyParams)
+	}
+	inv = f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules" + infs)
+	if s := inv.DNA(); !strings.Contains(s, ";Strategy=MajorityRules;InvW1=") || inv.StrategyParams != nil {
+		t.Errorf("unexpected DNA %s", s)
+	}
+
+	//---------------------------------------------------------------
+	// Breeding and mutation
+	//---------------------------------------------------------------
+	f.cfg.COAStrategies = []string{"Supermajority", "Contrarian"}
+	f.cfg.MutationRate = 100
+	pop := []Investor{
+		f.NewInvestorFromDNA("{Investor;Strategy=Supermajority;QuorumPct=0;SupermajorityPct=0.5" + infs),
+		f.NewInvestorFromDNA("{Investor;Strategy=Supermajority;QuorumPct=1;SupermajorityPct=1" + infs),
+	}
+	values := map[float64]bool{}
+	for k := 0; k < 200; k++ {
+		child := f.BreedNewInvestor(&pop, 0, 1)
+		name := InvestmentStrategies[child.Strategy]
+		if name != "Supermajority" && name != "Contrarian" {
+			t.Fatalf("unexpected strategy %s", name)
+		}
+		for _, g := range coaStrategies[child.Strategy].Genes() {
+			x, ok := child.StrategyParams[g.Name]
+			if !ok || x < g.Min || x > g.Max {
+				t.Fatalf("gene %s is missing or out of range: %s", g.Name, child.DNA())
+			}
+			values[x] = true
+		}
+		again := f.NewInvestorFromDNA(child.DNA())
+		if again.DNA() != child.DNA() {
+			t.Fatalf("expected %s, got %s", child.DNA(), again.DNA())
+		}
+	}
+	if len(values) < 20 {
+		t.Errorf("expected many different gene values, got %d", len(values))
+	}
+}
+
+// TestCOAStrategySimulation runs a simulation with every strategy and checks
+// that an unknown strategy in the config is an error
+func TestCOAStrategySimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.COAStrategies = append([]string(nil), InvestmentStrategies...)
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	used := map[int]bool{}
+	for _, inv := range s.Investors {
+		used[inv.Strategy] = true
+	}
+	if len(used) < 3 {
+		t.Errorf("expected Investors with many strategies, got %v", used)
+	}
+
+	cfg.COAStrategies = []string{"MajorityRules", "Astrology"}
+	var sim Simulator
+	sim.ResetSimulator()
+	if err := sim.Init(cfg, db, nil, false, false); err == nil {
+		t.Errorf("expected an error for an unknown strategy")
+	}
+}
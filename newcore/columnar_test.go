@@ -0,0 +1,142 @@
+package newcore
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+var (
+	columnarStart = time.Date(2019, time.January, 1, 0, 0, 0, 0, time.UTC)
+	columnarStop  = time.Date(2020, time.December, 31, 0, 0, 0, 0, time.UTC)
+)
+
+// openColumnarCSVDB returns a CSV database loaded with two years of synthetic
+// data, and the configuration it was opened with.
+func openColumnarCSVDB(tb testing.TB) (*newdata.Database, *util.AppConfig) {
+	util.Init(1)
+	cfg := util.CreateTestingCFG()
+	cfg.HoldWindowStatsLookBack = 20
+	db, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		tb.Fatalf("NewDatabase returned error: %s", err)
+	}
+	db.SetCSVFilename(writeParityCSVDB(tb, tb.TempDir(), columnarStart, columnarStop, parityColumns, true))
+	if err = db.Open(); err != nil {
+		tb.Fatalf("Open returned error: %s", err)
+	}
+	if err = db.Init(); err != nil {
+		tb.Fatalf("Init returned error: %s", err)
+	}
+	return db, cfg
+}
+
+// TestValueMatchesSelect verifies that reading through a MetricRef returns
+// exactly what Select returns, for every metric on every day, including
+// days outside the range of the data.
+func TestValueMatchesSelect(t *testing.T) {
+	db, _ := openColumnarCSVDB(t)
+	fields := db.AllFieldSelectors()
+	refs := make([]newdata.MetricRef, len(fields))
+	for i := range fields {
+		refs[i] = newdata.NewMetricRef(fields[i])
+	}
+	for dt := columnarStart.AddDate(0, 0, -3); !dt.After(columnarStop.AddDate(0, 0, 3)); dt = dt.AddDate(0, 0, 1) {
+		rec, err := db.Select(dt, fields)
+		if err != nil {
+			t.Fatalf("Select returned error: %s", err)
+		}
+		for i := range refs {
+			m, err := db.Value(&refs[i], dt)
+			if rec == nil {
+				if err != newdata.ErrNoRecord {
+					t.Errorf("%s %s: expected ErrNoRecord, got %v", dt.Format("2006-01-02"), fields[i].FQMetric(), err)
+				}
+				continue
+			}
+			v, ok := rec.Fields[fields[i].FQMetric()]
+			switch {
+			case !ok && err != newdata.ErrNoValue:
+				t.Errorf("%s %s: expected ErrNoValue, got %v", dt.Format("2006-01-02"), fields[i].FQMetric(), err)
+			case ok && (err != nil || m != v):
+				t.Errorf("%s %s: Select = %v, Value = %v (err = %v)", dt.Format("2006-01-02"), fields[i].FQMetric(), v, m, err)
+			}
+		}
+	}
+}
+
+// TestValueAllocs verifies that Value does not allocate once the handle has
+// been resolved.
+func TestValueAllocs(t *testing.T) {
+	db, _ := openColumnarCSVDB(t)
+	ref := newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "USD"})
+	dt := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	n := testing.AllocsPerRun(100, func() {
+		db.Value(&ref, dt)
+	})
+	if n != 0 {
+		t.Errorf("expected no allocations, got %v", n)
+	}
+}
+
+// BenchmarkSelect reads the values an LSMInfluencer with a C1C2 metric
+// needs for one prediction using Select.
+func BenchmarkSelect(b *testing.B) {
+	db, _ := openColumnarCSVDB(b)
+	fields := []newdata.FieldSelector{{Metric: "DR", Locale: "USD"}, {Metric: "DR", Locale: "JPY"}}
+	t1 := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	t2 := t1.AddDate(0, 0, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		rec1, _ := db.Select(t1, fields)
+		rec2, _ := db.Select(t2, fields)
+		for _, f := range fields {
+			_ = rec2.Fields[f.FQMetric()].Value - rec1.Fields[f.FQMetric()].Value
+		}
+	}
+}
+
+// BenchmarkValue reads the same values as BenchmarkSelect through
+// MetricRefs.
+func BenchmarkValue(b *testing.B) {
+	db, _ := openColumnarCSVDB(b)
+	refs := []newdata.MetricRef{
+		newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "USD"}),
+		newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "JPY"}),
+	}
+	t1 := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	t2 := t1.AddDate(0, 0, 10)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range refs {
+			v1, _ := db.Value(&refs[j], t1)
+			v2, _ := db.Value(&refs[j], t2)
+			_ = v2.Value - v1.Value
+		}
+	}
+}
+
+// BenchmarkGetPrediction measures a complete LSMInfluencer prediction
+func BenchmarkGetPrediction(b *testing.B) {
+	db, cfg := openColumnarCSVDB(b)
+	var f Factory
+	f.Init(cfg, db, nil, nil)
+	inv := Investor{cfg: cfg, factory: &f, db: db}
+	inf, err := f.NewInfluencer("{LSMInfluencer,Delta1=-20,Delta2=-3,Metric=DR}")
+	if err != nil {
+		b.Fatalf("NewInfluencer returned error: %s", err)
+	}
+	inf.SetMyInvestor(&inv)
+	dt := time.Date(2020, time.March, 2, 0, 0, 0, 0, time.UTC)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := inf.GetPrediction(dt); err != nil {
+			b.Fatalf("GetPrediction returned error: %s", err)
+		}
+	}
+}
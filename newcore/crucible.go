@@ -24,7 +24,8 @@ type Crucible struct {
 	fname                        string  // name of the crucible report file
 	ReportTopInvestorInvestments bool
 	DayByDay                     bool
-	AnnualizedReturnList         []float64 // annualized for each crucible period
+	AnnualizedReturnList         []float64     // annualized for each crucible period
+	RiskList                     []RiskMetrics // risk metrics for each crucible period
 	// The next field is best explained by example:
 	//     "CruciblePeriods": [
 	//         {"Index":  0, "Duration": "1w", "Ending": "yesterday"},
@@ -81,32 +82,24 @@ func (c *Crucible) Run() {
 	ir := NewInvestorReport(c.sim)
 	ir.Cru = c
 	ir.CrucibleMode = true
+	//--------------------------------------------------------------------
+	// With CrucibleLotSelections each DNA runs once with each policy, so
+	// the same DNA can be compared under different lot selections
+	//--------------------------------------------------------------------
+	lotPolicy := c.cfg.LotSelection
+	policies := c.cfg.CrucibleLotSelections
+	if len(policies) == 0 {
+		policies = []string{lotPolicy}
+	}
 	for i := 0; i < len(c.cfg.TopInvestors); i++ {
 		c.idx = i // mark the investor we're testing
-		c.SubHeader()
-		for j := 0; j < len(c.cfg.CrucibleSpans); j++ {
-			c.jdx = j // mark the time span we're testing
-			c.sim.ResetSimulator()
-			c.cfg.DtStart = util.CustomDate(c.cfg.CrucibleSpans[j].DtStart)
-			c.cfg.DtStop = util.CustomDate(c.cfg.CrucibleSpans[j].DtStop)
-			c.cfg.SingleInvestorDNA = c.cfg.TopInvestors[i].DNA
-			c.cfg.SingleInvestorMode = true
-			c.cfg.PopulationSize = 1
-			c.cfg.LoopCount = 1
-			c.cfg.Generations = 1
-			c.sim.Init(c.cfg, c.db, c, c.DayByDay, c.ReportTopInvestorInvestments)
-			c.sim.ir = ir // we need to override the simulators new creation of this with our ongoing report
-			if c.CreateDLog {
-				c.InvestorHistory[c.jdx] = make([]float64, 0)
-				c.cfg.DNALog = true
-			}
-			c.sim.Run()
-		}
-		c.DumpSuccessCoefficient()
-		if c.CreateDLog {
-			c.dlog.WriteRow()
+		for _, policy := range policies {
+			c.cfg.LotSelection = policy
+			c.runSpans(ir)
 		}
 	}
+	c.cfg.LotSelection = lotPolicy
+
 	//--------------------------------------------
 	// Now do todays recommendation if requested...
 	//--------------------------------------------
@@ -136,6 +129,35 @@ func (c *Crucible) Run() {
 	}
 }
 
+// runSpans runs the current DNA, c.idx, through every crucible period and
+// reports the results
+// --------------------------------------------------------------------------
+func (c *Crucible) runSpans(ir *InvestorReport) {
+	c.SubHeader()
+	for j := 0; j < len(c.cfg.CrucibleSpans); j++ {
+		c.jdx = j // mark the time span we're testing
+		c.sim.ResetSimulator()
+		c.cfg.DtStart = util.CustomDate(c.cfg.CrucibleSpans[j].DtStart)
+		c.cfg.DtStop = util.CustomDate(c.cfg.CrucibleSpans[j].DtStop)
+		c.cfg.SingleInvestorDNA = c.cfg.TopInvestors[c.idx].DNA
+		c.cfg.SingleInvestorMode = true
+		c.cfg.PopulationSize = 1
+		c.cfg.LoopCount = 1
+		c.cfg.Generations = 1
+		c.sim.Init(c.cfg, c.db, c, c.DayByDay, c.ReportTopInvestorInvestments)
+		c.sim.ir = ir // we need to override the simulators new creation of this with our ongoing report
+		if c.CreateDLog {
+			c.InvestorHistory[c.jdx] = make([]float64, 0)
+			c.cfg.DNALog = true
+		}
+		c.sim.Run()
+	}
+	c.DumpSuccessCoefficient()
+	if c.CreateDLog {
+		c.dlog.WriteRow()
+	}
+}
+
 // SaveInvestorPortfolioValue saves the annualized return value for the day in
 // the current crucible time span
 // --------------------------------------------------------------------------
@@ -156,15 +178,30 @@ func (c *Crucible) SubHeader() {
 		os.Exit(1)
 	}
 	defer file.Close()
-	fmt.Fprintf(file, "\n\"DNA Name: %s\",,,,,%q\n", c.cfg.TopInvestors[c.idx].Name, c.cfg.TopInvestors[c.idx].DNA)
-	fmt.Fprintf(file, "%q,%q,%q,%q,%q\n", "Start", "End", "Opening Portfolio Value", "Ending Portfolio Value", "Annualized Return")
+	name := c.cfg.TopInvestors[c.idx].Name
+	if len(c.cfg.CrucibleLotSelections) > 0 {
+		name += fmt.Sprintf("  (lot selection %s)", lotSelection(c.cfg))
+	}
+	fmt.Fprintf(file, "\n\"DNA Name: %s\",,,,,%q\n", name, c.cfg.TopInvestors[c.idx].DNA)
+	fmt.Fprintf(file, "\"Hold Windows: %s\"\n", HoldWindows(c.cfg.TopInvestors[c.idx].DNA))
+	fmt.Fprintf(file, "%q,%q,%q,%q,%q", "Start", "End", "Opening Portfolio Value", "Ending Portfolio Value", "Annualized Return")
+	for _, col := range RiskMetricsColumns {
+		fmt.Fprintf(file, ",%q", col)
+	}
+	fmt.Fprintf(file, ",%q,%q", "Short-Term Gains", "Long-Term Gains")
+	for _, pair := range c.cfg.Pairs {
+		fmt.Fprintf(file, ",%q,%q", pair+" Ending Value", pair+" Annualized Return")
+	}
+	fmt.Fprintf(file, "\n")
 
 	c.AnnualizedReturnList = make([]float64, 0) // reset the list
+	c.RiskList = make([]RiskMetrics, 0)
 }
 
 // DumpResults sends the crucible report to a csv file.
 //
 //	This is called upon the completion of a generation.  So we'll save the annualized return
+//	and the risk metrics
 func (c *Crucible) DumpResults() {
 	file, err := os.OpenFile(c.fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 	if err != nil {
@@ -176,6 +213,9 @@ func (c *Crucible) DumpResults() {
 	dtStop := time.Time(c.cfg.DtStop)
 	pv := float64(0)
 	roi := float64(0)
+	var risk RiskMetrics
+	var short, long float64
+	pairs := map[string]PairResult{}
 	if len(c.sim.Investors) > 0 {
 		pv = c.sim.Investors[0].PortfolioValueC1
 		roi, err = util.AnnualizedReturn(c.cfg.InitFunds, pv, dtStart, dtStop)
@@ -183,9 +223,32 @@ func (c *Crucible) DumpResults() {
 			fmt.Printf("error computing AnnualizedReturn: %s\n", err.Error())
 			os.Exit(1)
 		}
+		risk = c.sim.Investors[0].Risk
+		short, long = summarizeGains(c.sim.Investors[0].RealizedGains())
+		for _, r := range c.sim.Investors[0].PairResults() {
+			pairs[r.Pair] = r
+		}
+	}
+	fmt.Fprintf(file, "%q,%q,%9.2f,%9.2f,%5.2f%%,%s,%.2f,%.2f", dtStart.Format("1/2/2006"), dtStop.Format("1/2/2006"), c.cfg.InitFunds, pv, roi*100, risk.CSV(), short, long)
+	//----------------------------------------------------------------------
+	// A portfolio breaks its results down by pair. A pair the Investor has
+	// no Influencers for was not traded.
+	//----------------------------------------------------------------------
+	for _, pair := range c.cfg.Pairs {
+		r, ok := pairs[pair]
+		if !ok {
+			fmt.Fprintf(file, ",,")
+			continue
+		}
+		ar, err := util.AnnualizedReturn(r.InitFunds, r.PortfolioValue, dtStart, dtStop)
+		if err != nil {
+			ar = 0
+		}
+		fmt.Fprintf(file, ",%9.2f,%5.2f%%", r.PortfolioValue, ar*100)
 	}
-	fmt.Fprintf(file, "%q,%q,%9.2f,%9.2f,%5.2f%%\n", dtStart.Format("1/2/2006"), dtStop.Format("1/2/2006"), c.cfg.InitFunds, pv, roi*100)
+	fmt.Fprintf(file, "\n")
 	c.AnnualizedReturnList = append(c.AnnualizedReturnList, roi)
+	c.RiskList = append(c.RiskList, risk)
 }
 
 // DumpSuccessCoefficient calculates the success coefficient and adds it to the report
@@ -0,0 +1,44 @@
+package newcore
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stmansour/psim/util"
+)
+
+// finrepRows runs a simulation with the supplied number of workers and
+// returns its financial report without the header block. The header has
+// the run date, the elapsed time and the worker count, which differ from
+// run to run.
+func finrepRows(t *testing.T, workers int) []byte {
+	cfg := simTestCfg(t.TempDir(), 4)
+	cfg.WorkerPoolSize = workers
+	db := openSimTestDB(t, cfg)
+
+	util.Init(98765)
+	s := runSimTest(t, cfg, db, "")
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read finrep: %s", err)
+	}
+	i := bytes.Index(b, []byte("\"Rank\","))
+	if i < 0 {
+		t.Fatalf("finrep has no column headers:\n%s", b)
+	}
+	return b[i:]
+}
+
+// TestWorkerCountDeterminism verifies that a seed reproduces the same
+// simulation regardless of how many workers run the Investors.
+func TestWorkerCountDeterminism(t *testing.T) {
+	one := finrepRows(t, 1)
+	eight := finrepRows(t, 8)
+	if !bytes.Equal(one, eight) {
+		t.Errorf("finrep differs between 1 and 8 workers:\n--- 1 worker ---\n%s\n--- 8 workers ---\n%s", one, eight)
+	}
+}
@@ -29,6 +29,7 @@ type DNALog struct {
 	f                 *excelize.File // excel file
 	Results           map[string]*DNALogResult
 	stdReportStartRow int
+	riskCol           int // column number of the first risk metric
 }
 
 // NewDNALog creates and returns a new DNA log object
@@ -44,6 +45,7 @@ func (dl *DNALog) Init(c *Crucible, cfg *util.AppConfig, sim *Simulator) {
 	dl.parent = c
 	dl.s = sim
 	dl.stdReportStartRow = 4
+	dl.riskCol, _ = excelize.ColumnNameToNumber("BD")
 }
 
 // setCellNext - adds a line to the excel file
@@ -65,6 +67,8 @@ func (dl *DNALog) ReportHeader(row int) int {
 	if dl.s.db.Datatype == "CSV" {
 		row = dl.setCellNext(row, "A", fmt.Sprintf("Database: %s", dl.s.db.CSVDB.DBFname))
 		row = dl.setCellNext(row, "A", fmt.Sprintf("Nil data requests: %d", dl.s.db.CSVDB.Nildata))
+	} else if dl.s.db.Datatype == "SQLITE" {
+		row = dl.setCellNext(row, "A", fmt.Sprintf("Database: %s  (SQLite)", dl.s.db.SQLDB.DBFname))
 	} else {
 		row = dl.setCellNext(row, "A", fmt.Sprintf("Database: %s  (SQL)", dl.s.db.SQLDB.Name))
 	}
@@ -206,6 +210,9 @@ func (dl *DNALog) WriteHeader() error {
 	f.MergeCell(dl.sheetName, "ay"+hdr1, "ba"+hdr1)
 	f.SetCellValue(dl.sheetName, "ay"+hdr1, "2019")
 
+	f.MergeCell(dl.sheetName, "bd"+hdr1, "bl"+hdr1)
+	f.SetCellValue(dl.sheetName, "bd"+hdr1, "Risk Metrics, Longest Crucible Period")
+
 	hdrRow2 := hdrRow1 + 1
 	hdr2 := fmt.Sprintf("%d", hdrRow2)
 
@@ -280,6 +287,10 @@ func (dl *DNALog) WriteHeader() error {
 	f.SetCellValue(dl.sheetName, "bb"+hdr2, "Investor ID")
 	f.SetCellValue(dl.sheetName, "bc"+hdr2, "Investor DNA")
 
+	for k, col := range RiskMetricsColumns {
+		f.SetCellValue(dl.sheetName, dl.getCell(dl.riskCol+k, hdrRow2), col)
+	}
+
 	// Define a new style with bold font
 	colHdrStyle, err := f.NewStyle(&excelize.Style{
 		Alignment: &excelize.Alignment{
@@ -307,7 +318,7 @@ func (dl *DNALog) WriteHeader() error {
 		return err
 	}
 
-	f.SetCellStyle(dl.sheetName, "A"+hdr1, "BC"+hdr2, colHdrStyle)
+	f.SetCellStyle(dl.sheetName, "A"+hdr1, "BL"+hdr2, colHdrStyle)
 
 	//--------------------------------
 	// SET CRUCIBLE TITLE STYLE
@@ -332,7 +343,7 @@ func (dl *DNALog) WriteHeader() error {
 		fmt.Println(err)
 		return err
 	}
-	if err = f.SetColWidth(dl.sheetName, "B", "bc", 15); err != nil {
+	if err = f.SetColWidth(dl.sheetName, "B", "bl", 15); err != nil {
 		fmt.Println(err)
 		return err
 	}
@@ -496,6 +507,14 @@ func (dl *DNALog) WriteRow() {
 		return
 	}
 
+	//---------------------------------------------------------------------------
+	// RISK METRICS FOR THE LONGEST CRUCIBLE PERIOD
+	//---------------------------------------------------------------------------
+	if err = dl.writeRiskMetrics(f, dl.row, percentStyle); err != nil {
+		fmt.Println("Error writing risk metrics:", err)
+		return
+	}
+
 	if err = f.Save(); err != nil {
 		log.Fatal(err)
 	}
@@ -503,6 +522,63 @@ func (dl *DNALog) WriteRow() {
 	dl.row++ // move to the next row
 }
 
+// writeRiskMetrics writes the risk metrics of the current Investor over the
+// longest crucible period to row r
+func (dl *DNALog) writeRiskMetrics(f *excelize.File, r int, percentStyle int) error {
+	k := dl.longestSpan()
+	if k < 0 || k >= len(dl.parent.RiskList) {
+		return nil
+	}
+	m := dl.parent.RiskList[k]
+	vals := []interface{}{
+		m.Sharpe,
+		m.Sortino,
+		m.MaxDrawdown,
+		formatRiskDate(m.DtPeak),
+		formatRiskDate(m.DtTrough),
+		m.Calmar,
+		m.WinRate,
+		m.ProfitFactor,
+		m.AvgHoldingDays,
+	}
+	for j, v := range vals {
+		f.SetCellValue(dl.sheetName, dl.getCell(dl.riskCol+j, r), v)
+	}
+	numberStyle, err := f.NewStyle(&excelize.Style{
+		NumFmt: 2, // 0.00
+		Alignment: &excelize.Alignment{
+			Horizontal: "center",
+		},
+		Font: &excelize.Font{
+			Size: 14,
+		},
+	})
+	if err != nil {
+		return err
+	}
+	if err = f.SetCellStyle(dl.sheetName, dl.getCell(dl.riskCol, r), dl.getCell(dl.riskCol+len(vals)-1, r), numberStyle); err != nil {
+		return err
+	}
+	for _, j := range []int{2, 6} { // Max Drawdown and Win Rate
+		if err = f.SetCellStyle(dl.sheetName, dl.getCell(dl.riskCol+j, r), dl.getCell(dl.riskCol+j, r), percentStyle); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// longestSpan returns the index of the longest crucible period
+func (dl *DNALog) longestSpan() int {
+	k := -1
+	var longest time.Duration
+	for j, p := range dl.cfg.CrucibleSpans {
+		if d := p.DtStop.Sub(p.DtStart); k < 0 || d > longest {
+			k, longest = j, d
+		}
+	}
+	return k
+}
+
 // ConsistencySC returns the consistency and success coefficient
 func (dl *DNALog) ConsistencySC(m []float64) (float64, float64) {
 	mean, stddev := stat.MeanStdDev(m, nil)
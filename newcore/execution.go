@@ -0,0 +1,179 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// This module decides the exchange rate an Investor actually gets when it
+// converts. EXClose is a mid rate, a real conversion pays half the bid/ask
+// spread and some slippage on top of it. The exchange rate is C2 per C1, so
+// a buy of C2 gets a rate below the mid and a sale of C2 a rate above it.
+
+// ExecutionModel decides the exchange rate of a conversion
+// ------------------------------------------------------------------------------
+type ExecutionModel interface {
+	Name() string
+
+	// Rate returns the exchange rate inv gets for a conversion on T. er is
+	// EXClose on T. buy is true for a conversion of C1 to C2 and false for
+	// C2 to C1. The rate is never better for inv than er.
+	Rate(inv *Investor, T time.Time, er float64, buy bool) (float64, error)
+}
+
+// NewExecutionModel returns the ExecutionModel selected in cfg. Settings of
+// the model that are not set in cfg get their default values.
+// ------------------------------------------------------------------------------
+func NewExecutionModel(cfg *util.AppConfig) ExecutionModel {
+	spread := cfg.ExecSpreadPips * pipSize(cfg)
+	switch cfg.ExecutionModel {
+	case util.ExecFixedSpread:
+		if cfg.ExecSpreadPips == 0 {
+			spread = util.DefaultExecSpreadPips * pipSize(cfg)
+		}
+		return &FixedSpreadExecution{Spread: spread}
+	case util.ExecMetricSpread:
+		bid, ask := cfg.ExecBidMetric, cfg.ExecAskMetric
+		if len(bid) == 0 {
+			bid = util.DefaultExecBidMetric
+		}
+		if len(ask) == 0 {
+			ask = util.DefaultExecAskMetric
+		}
+		return &MetricSpreadExecution{
+			Bid:      newdata.NewMetricRef(newdata.FieldSelector{Metric: bid, Locale: cfg.C1, Locale2: cfg.C2}),
+			Ask:      newdata.NewMetricRef(newdata.FieldSelector{Metric: ask, Locale: cfg.C1, Locale2: cfg.C2}),
+			Factor:   orDefault(cfg.ExecRangeFactor, util.DefaultExecRangeFactor),
+			Fallback: spread,
+		}
+	case util.ExecVolSlippage:
+		return &VolSlippageExecution{Spread: spread, Factor: orDefault(cfg.ExecSlippageFactor, util.DefaultExecSlippageFactor)}
+	default:
+		return &MidExecution{}
+	}
+}
+
+// pipSize returns the size of a pip in the C1C2 exchange rate
+func pipSize(cfg *util.AppConfig) float64 {
+	switch {
+	case cfg.ExecPipSize > 0:
+		return cfg.ExecPipSize
+	case cfg.C1 == "JPY" || cfg.C2 == "JPY":
+		return 0.01
+	default:
+		return 0.0001
+	}
+}
+
+// executionSummary describes the execution model of cfg for the report
+// headers
+func executionSummary(cfg *util.AppConfig) string {
+	switch m := NewExecutionModel(cfg).(type) {
+	case *FixedSpreadExecution:
+		return fmt.Sprintf("%s  (%.1f pips of %g)", m.Name(), m.Spread/pipSize(cfg), pipSize(cfg))
+	case *MetricSpreadExecution:
+		return fmt.Sprintf("%s  (%.2f * (%s - %s), else %.1f pips)", m.Name(), m.Factor, m.Ask.Field.Metric, m.Bid.Field.Metric, m.Fallback/pipSize(cfg))
+	case *VolSlippageExecution:
+		return fmt.Sprintf("%s  (%.1f pips + %.2f standard deviations)", m.Name(), m.Spread/pipSize(cfg), m.Factor)
+	default:
+		return m.Name()
+	}
+}
+
+// adverseRate moves er half away from the Investor, down for a buy and up
+// for a sale. It never goes below half of er.
+func adverseRate(er, half float64, buy bool) float64 {
+	if buy {
+		return math.Max(er-half, er/2)
+	}
+	return er + half
+}
+
+// executionRate returns the exchange rate the Investor gets for a conversion
+// on T when EXClose is er
+// ------------------------------------------------------------------------------
+func (i *Investor) executionRate(T time.Time, er float64, buy bool) (float64, error) {
+	if i.exec == nil {
+		i.exec = NewExecutionModel(i.cfg)
+	}
+	return i.exec.Rate(i, T, er, buy)
+}
+
+// MidExecution converts at EXClose, with no cost
+// ------------------------------------------------------------------------------
+type MidExecution struct{}
+
+// Name returns the name of the model
+func (e *MidExecution) Name() string { return util.ExecMid }
+
+// Rate returns the exchange rate of the conversion
+func (e *MidExecution) Rate(inv *Investor, T time.Time, er float64, buy bool) (float64, error) {
+	return er, nil
+}
+
+// FixedSpreadExecution pays half of a fixed bid/ask spread on each
+// conversion
+// ------------------------------------------------------------------------------
+type FixedSpreadExecution struct {
+	Spread float64 // the bid/ask spread, in units of the exchange rate
+}
+
+// Name returns the name of the model
+func (e *FixedSpreadExecution) Name() string { return util.ExecFixedSpread }
+
+// Rate returns the exchange rate of the conversion
+func (e *FixedSpreadExecution) Rate(inv *Investor, T time.Time, er float64, buy bool) (float64, error) {
+	return adverseRate(er, e.Spread/2, buy), nil
+}
+
+// MetricSpreadExecution pays half of the spread between two metrics of the
+// exchange rate on the day of the conversion, a bid and an ask, or a low and
+// a high scaled down by Factor. On days the database does not have both it
+// uses the Fallback spread.
+// ------------------------------------------------------------------------------
+type MetricSpreadExecution struct {
+	Bid      newdata.MetricRef // the bid, or the low
+	Ask      newdata.MetricRef // the ask, or the high
+	Factor   float64           // the spread is Factor * (Ask - Bid)
+	Fallback float64           // the spread when there is no Ask or Bid, in units of the exchange rate
+}
+
+// Name returns the name of the model
+func (e *MetricSpreadExecution) Name() string { return util.ExecMetricSpread }
+
+// Rate returns the exchange rate of the conversion
+func (e *MetricSpreadExecution) Rate(inv *Investor, T time.Time, er float64, buy bool) (float64, error) {
+	spread := e.Fallback
+	bid, err1 := inv.db.Value(&e.Bid, T)
+	ask, err2 := inv.db.Value(&e.Ask, T)
+	if err1 == nil && err2 == nil && ask.Value > bid.Value {
+		spread = e.Factor * (ask.Value - bid.Value)
+	}
+	return adverseRate(er, spread/2, buy), nil
+}
+
+// VolSlippageExecution pays half of a fixed spread plus slippage that grows
+// with the volatility of the market, Factor rolling standard deviations of
+// EXClose. If there are no valid statistics on the day there is no
+// slippage.
+// ------------------------------------------------------------------------------
+type VolSlippageExecution struct {
+	Spread float64 // the bid/ask spread, in units of the exchange rate
+	Factor float64 // slippage in standard deviations of EXClose
+}
+
+// Name returns the name of the model
+func (e *VolSlippageExecution) Name() string { return util.ExecVolSlippage }
+
+// Rate returns the exchange rate of the conversion
+func (e *VolSlippageExecution) Rate(inv *Investor, T time.Time, er float64, buy bool) (float64, error) {
+	slip := float64(0)
+	if m, err := inv.db.Value(inv.exchangeRef(), T); err == nil && m.StatsValid && m.StdDevSquared > 0 {
+		slip = e.Factor * math.Sqrt(m.StdDevSquared)
+	}
+	return adverseRate(er, e.Spread/2+slip, buy), nil
+}
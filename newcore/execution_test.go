@@ -0,0 +1,125 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// TestExecutionModels checks the rate each execution model gives for a buy
+// and a sale
+func TestExecutionModels(t *testing.T) {
+	f, db := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	er := 110.0
+
+	check := func(m ExecutionModel, half float64) {
+		buy, err := m.Rate(&inv, dt, er, true)
+		if err != nil {
+			t.Fatalf("%s: Rate returned error: %s", m.Name(), err)
+		}
+		sell, _ := m.Rate(&inv, dt, er, false)
+		if math.Abs(buy-(er-half)) > 1e-9 || math.Abs(sell-(er+half)) > 1e-9 {
+			t.Errorf("%s: expected %.4f and %.4f, got %.4f and %.4f", m.Name(), er-half, er+half, buy, sell)
+		}
+	}
+
+	f.cfg.ExecSpreadPips = 2 // USDJPY pips are 0.01
+	check(&MidExecution{}, 0)
+	f.cfg.ExecutionModel = util.ExecFixedSpread
+	check(NewExecutionModel(f.cfg), 0.01)
+
+	//---------------------------------------------------------------
+	// The test database has no bid and ask, so the spread falls back
+	// to ExecSpreadPips. Two metrics it does have stand in for them.
+	//---------------------------------------------------------------
+	f.cfg.ExecutionModel = util.ExecMetricSpread
+	check(NewExecutionModel(f.cfg), 0.01)
+	val := func(locale string) float64 {
+		ref := newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: locale})
+		v, err := db.Value(&ref, dt)
+		if err != nil {
+			t.Fatalf("Value returned error: %s", err)
+		}
+		return v.Value
+	}
+	check(&MetricSpreadExecution{
+		Bid:    newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "JPY"}),
+		Ask:    newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "USD"}),
+		Factor: 0.5,
+	}, 0.5*(val("USD")-val("JPY"))/2)
+
+	f.cfg.ExecutionModel = util.ExecVolSlippage
+	f.cfg.ExecSlippageFactor = 0.2
+	m, _ := db.Value(inv.exchangeRef(), dt)
+	slip := float64(0)
+	if m.StatsValid {
+		slip = 0.2 * math.Sqrt(m.StdDevSquared)
+	}
+	check(NewExecutionModel(f.cfg), 0.01+slip)
+}
+
+// TestExecutionCost buys and sells on the same day with a fixed spread. The
+// C1 lost must be the execution cost.
+func TestExecutionCost(t *testing.T) {
+	f, _ := taTestFactory(t)
+	f.cfg.ExecutionModel = util.ExecFixedSpread
+	f.cfg.ExecSpreadPips = 5
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	inv.BalanceC1 = 1000
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	if err := inv.ExecuteBuy(dt, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	if err := inv.ExecuteSell(dt, 1); err != nil {
+		t.Fatalf("ExecuteSell returned error: %s", err)
+	}
+	m := inv.Investments[0]
+	if !m.Completed || m.ERT4-m.ERT3 < 0.05-1e-9 || m.Chunks[0].Profitable {
+		t.Errorf("expected a losing round trip across the spread, ERT3 %f, ERT4 %f", m.ERT3, m.ERT4)
+	}
+	if inv.ExecCost <= 0 || math.Abs(1000-inv.BalanceC1-inv.ExecCost) > 1e-9 {
+		t.Errorf("expected the C1 lost, %f, to be the execution cost %f", 1000-inv.BalanceC1, inv.ExecCost)
+	}
+}
+
+// TestExecutionSimulation runs a simulation with slippage and checks the
+// execution cost in the financial report
+func TestExecutionSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.ExecutionModel = util.ExecVolSlippage
+	cfg.ExecSpreadPips = 1
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	n := 0
+	for _, ti := range s.TopInvestors {
+		if ti.ExecCost < 0 {
+			t.Errorf("negative execution cost %f", ti.ExecCost)
+		}
+		if ti.ExecCost > 0 {
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("expected top Investors with execution costs")
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), `"Execution Cost"`) || !strings.Contains(string(b), "Execution Model: volslippage  (1.0 pips + 0.10 standard deviations)") {
+		t.Errorf("expected the execution cost in the financial report:\n%s", b)
+	}
+}
@@ -0,0 +1,112 @@
+package newcore
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// This module has the exit rules. They are applied to each Investment on
+// its own, unlike StopLoss which looks at the whole portfolio. Each chunk
+// sold is tagged with the reason for the sale.
+
+// The reasons C2 is sold, saved in SellInfo.Exit
+const (
+	ExitSell         = "sell"         // the Investor's course of action was to sell
+	ExitStopLoss     = "stoploss"     // the portfolio value fell below StopLossThreshold
+	ExitTakeProfit   = "takeprofit"   // the Investment gained TakeProfit
+	ExitTrailingStop = "trailingstop" // the Investment fell TrailingStop from its best value
+	ExitMaxHolding   = "maxhold"      // the Investment was held MaxHoldingDays
+)
+
+// exitRulesOn returns true if any exit rule is turned on in cfg
+func exitRulesOn(cfg *util.AppConfig) bool {
+	return cfg.TakeProfit > 0 || cfg.TrailingStop > 0 || cfg.MaxHoldingDays > 0
+}
+
+// exitSummary describes the exit rules of cfg for the report headers
+// ------------------------------------------------------------------------------
+func exitSummary(cfg *util.AppConfig) string {
+	var rules []string
+	if cfg.TakeProfit > 0 {
+		rules = append(rules, fmt.Sprintf("take profit %.2f%%", cfg.TakeProfit*100))
+	}
+	if cfg.TrailingStop > 0 {
+		rules = append(rules, fmt.Sprintf("trailing stop %.2f%%", cfg.TrailingStop*100))
+	}
+	if cfg.MaxHoldingDays > 0 {
+		rules = append(rules, fmt.Sprintf("max holding %d days", cfg.MaxHoldingDays))
+	}
+	if len(rules) == 0 {
+		return "none"
+	}
+	return strings.Join(rules, ", ")
+}
+
+// exitReason returns the exit rule that fires for Investment m on T3 when
+// the exchange rate is er, or "" if none does. The C2 of m gains value as
+// the exchange rate falls, so its gain is ERT3/er - 1 and its fall from its
+// best value is 1 - BestER/er.
+// ------------------------------------------------------------------------------
+func (i *Investor) exitReason(m *Investment, T3 time.Time, er float64) string {
+	switch {
+	case i.cfg.TakeProfit > 0 && m.ERT3/er-1 >= i.cfg.TakeProfit:
+		return ExitTakeProfit
+	case i.cfg.TrailingStop > 0 && 1-m.BestER/er >= i.cfg.TrailingStop:
+		return ExitTrailingStop
+	case i.cfg.MaxHoldingDays > 0 && int(T3.Sub(m.T3).Hours()/24) >= i.cfg.MaxHoldingDays:
+		return ExitMaxHolding
+	}
+	return ""
+}
+
+// checkExits applies the exit rules to every open Investment on T3. The
+// remaining C2 of each Investment whose rule fires is sold. If there is no
+// exchange rate on T3 nothing is done.
+// ------------------------------------------------------------------------------
+func (i *Investor) checkExits(T3 time.Time) error {
+	if !exitRulesOn(i.cfg) || i.BalanceC2 < 1.00 {
+		return nil
+	}
+	v, err := i.db.Value(i.exchangeRef(), T3)
+	if err != nil || v.Value < 0.0001 {
+		return nil
+	}
+	er := v.Value
+	rate, err := i.executionRate(T3, er, false) // the exchange rate of a sale on T3
+	if err != nil {
+		return err
+	}
+
+	sold := false
+	for j := 0; j < len(i.Investments); j++ {
+		m := &i.Investments[j]
+		if m.Completed || m.T3C2Buy == 0 {
+			continue
+		}
+		if m.BestER == 0 || er < m.BestER {
+			m.BestER = er
+		}
+		exit := i.exitReason(m, T3, er)
+		if len(exit) == 0 {
+			continue
+		}
+		if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
+			fmt.Printf("        <<<%s>>>  investment %s bought %s, ER T3 = %8.4f, best = %8.4f, now = %8.4f\n",
+				strings.ToUpper(exit), m.id, m.T3.Format("Jan _2, 2006"), m.ERT3, m.BestER, er)
+		}
+		m.ERT4 = rate
+		i.sellChunk(m, T3, m.remainingC2(), er, exit)
+		sold = true
+	}
+
+	//---------------------------------------------------------------------
+	// all the exits of the day are one transaction
+	//---------------------------------------------------------------------
+	if sold {
+		i.chargeFlatFee(T3)
+	}
+	return nil
+}
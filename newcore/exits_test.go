@@ -0,0 +1,134 @@
+package newcore
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// TestExitReason checks which exit rule fires for an Investment bought at
+// an exchange rate of 100
+func TestExitReason(t *testing.T) {
+	f, _ := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	f.cfg.TakeProfit = 0.05
+	f.cfg.TrailingStop = 0.03
+	f.cfg.MaxHoldingDays = 10
+	t3 := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		best, er float64
+		days     int
+		want     string
+	}{
+		{100, 100, 1, ""},
+		{95, 95, 1, ExitTakeProfit},     // 100/95 - 1 = 5.3%
+		{96, 98, 1, ""},                 // 2% up, 2% off the best
+		{96, 99.5, 1, ExitTrailingStop}, // 3.5% off the best
+		{100, 101, 9, ""},
+		{100, 101, 10, ExitMaxHolding},
+		{90, 94, 20, ExitTakeProfit}, // take profit wins over the others
+	} {
+		m := Investment{T3: t3, ERT3: 100, T3C2Buy: 100, BestER: c.best}
+		if got := inv.exitReason(&m, t3.AddDate(0, 0, c.days), c.er); got != c.want {
+			t.Errorf("best %.1f, er %.1f, %d days: expected %q, got %q", c.best, c.er, c.days, c.want, got)
+		}
+	}
+
+	f.cfg.TakeProfit = 0
+	f.cfg.TrailingStop = 0
+	f.cfg.MaxHoldingDays = 0
+	m := Investment{T3: t3, ERT3: 100, T3C2Buy: 100, BestER: 50}
+	if got := inv.exitReason(&m, t3.AddDate(1, 0, 0), 200); got != "" || exitRulesOn(f.cfg) {
+		t.Errorf("expected no exit with the rules off, got %q", got)
+	}
+}
+
+// TestCheckExits buys, then lets the holding period run out. The whole
+// Investment must be sold in a chunk tagged maxhold, and the vote never
+// gets the chance.
+func TestCheckExits(t *testing.T) {
+	f, _ := taTestFactory(t)
+	f.cfg.MaxHoldingDays = 2
+	f.cfg.TxnFee = 1
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	inv.BalanceC1 = 1000
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	if err := inv.ExecuteBuy(dt, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	for k := 1; k <= 2; k++ {
+		if err := inv.checkExits(dt.AddDate(0, 0, k)); err != nil {
+			t.Fatalf("checkExits returned error: %s", err)
+		}
+	}
+	m := inv.Investments[0]
+	if !m.Completed || len(m.Chunks) != 1 || m.Chunks[0].Exit != ExitMaxHolding {
+		t.Fatalf("expected the Investment to be sold by maxhold, got %+v", m)
+	}
+	if !m.Chunks[0].T4.Equal(dt.AddDate(0, 0, 2)) || inv.BalanceC2 > rnderr {
+		t.Errorf("expected everything sold on day 2, T4 = %s, BalanceC2 = %f", m.Chunks[0].T4.Format("1/2/2006"), inv.BalanceC2)
+	}
+	if len(inv.Investments) != 2 || inv.Investments[1].Fee != 1 {
+		t.Errorf("expected one flat fee for the exit, got %d Investments", len(inv.Investments))
+	}
+
+	//---------------------------------------------------------------
+	// An ordinary sell is tagged sell
+	//---------------------------------------------------------------
+	if err := inv.ExecuteBuy(dt, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	if err := inv.ExecuteSell(dt.AddDate(0, 0, 1), 1); err != nil {
+		t.Fatalf("ExecuteSell returned error: %s", err)
+	}
+	for _, m := range inv.Investments {
+		if m.T3.Equal(dt) && len(m.Chunks) > 0 && m.Chunks[0].T4.Equal(dt.AddDate(0, 0, 1)) && m.Chunks[0].Exit != ExitSell {
+			t.Errorf("expected exit sell, got %q", m.Chunks[0].Exit)
+		}
+	}
+}
+
+// TestExitSimulation runs a simulation with a short holding limit. No
+// Investment may be held longer, and the investor report must show the
+// exits.
+func TestExitSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.MaxHoldingDays = 3
+	cfg.TrailingStop = 0.002
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	var s Simulator
+	s.ResetSimulator()
+	s.SqltDB = openSimTestSqlt(t)
+	if err := s.Init(cfg, db, nil, false, true); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	s.Run()
+
+	exits := map[string]int{}
+	for _, inv := range s.Investors {
+		for _, m := range inv.Investments {
+			for _, c := range m.Chunks {
+				exits[c.Exit]++
+				if days := int(c.T4.Sub(m.T3).Hours() / 24); days > 3 && !c.T4.After(time.Time(cfg.DtStop)) {
+					t.Errorf("Investment bought %s was held %d days", m.T3.Format("1/2/2006"), days)
+				}
+			}
+		}
+	}
+	if exits[ExitMaxHolding] == 0 || exits[ExitTrailingStop] == 0 {
+		t.Errorf("expected maxhold and trailingstop exits, got %v", exits)
+	}
+
+	b, err := os.ReadFile(cfg.GenerateFName("invrep"))
+	if err != nil {
+		t.Fatalf("could not read the investor report: %s", err)
+	}
+	if !strings.Contains(string(b), "Exit Rules: trailing stop 0.20%, max holding 3 days") || !strings.Contains(string(b), ","+ExitMaxHolding+"\n") {
+		t.Errorf("expected exits in the investor report:\n%s", b)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -23,6 +24,9 @@ type Factory struct {
 	HashDuplicates int64             // number of times an Investor was duplicated
 	MutateCalls    int64             // how many calls were made to Mutate()
 	Mutations      int64             // how many times did mutation happen
+	rng            *util.RandStream  // all of the Factory's random numbers come from here
+	selector       Selector          // chooses the parents of the next generation
+	cal            *TradingCalendar  // the days the market is open and the Investors trade
 	// InvCounter  int64             // used in ID generation
 }
 
@@ -44,6 +48,25 @@ func (f *Factory) Init(cfg *util.AppConfig, db *newdata.Database, sqltdb *sql.DB
 	f.cfg = cfg
 	f.db = db
 	f.sim = sim
+	seed, _ := util.RandState()
+	f.rng = util.NewRandStream(seed)
+	f.selector = NewSelector(cfg)
+	cal, err := NewTradingCalendar(cfg, db)
+	if err != nil {
+		log.Panicf("Invalid TradingDay: %s\n", err)
+	}
+	f.cal = cal
+	if db != nil && db.Mim != nil {
+		db.Mim.RegisterInfluencerSubclass("TAInfluencer", TAMetricInfo())
+	}
+}
+
+// newInvestorRand returns the random number stream for a new Investor. Its
+// seed comes from the Factory's stream, so the Investors are created with
+// the same streams every time the simulation is run with the same seed.
+// --------------------------------------------------------------------------------
+func (f *Factory) newInvestorRand() *util.RandStream {
+	return util.NewRandStream(f.rng.Int63())
 }
 
 // NewPopulation creates a new population based on the current population
@@ -69,19 +92,25 @@ func (f *Factory) NewPopulation(population []Investor) ([]Investor, error) {
 
 	popCount := f.cfg.PopulationSize - f.cfg.EliteCount
 	newPopulation := make([]Investor, popCount)
-	fitnessSum := float64(0.0) // used by rouletteSelect
-
-	for i := 0; i < popCount; i++ {
-		fitnessSum += population[i].CalculateFitnessScore()
+	fitness := make([]float64, len(population)) // computed once, used by the selector
+	for i := 0; i < len(population); i++ {
+		fitness[i] = population[i].CalculateFitnessScore()
 	}
+	if ps, ok := f.selector.(*ParetoSelector); ok {
+		ps.Objectives = make([][]float64, len(population))
+		for i := 0; i < len(population); i++ {
+			ps.Objectives[i] = population[i].Objectives.Vector()
+		}
+	}
+	f.selector.Prepare(fitness, 2*popCount, f.rng)
 
 	// Build the new population... Select parents, create a new Investor
 	for i := 0; i < popCount; i++ {
-		idxParent1 := f.rouletteSelect(population, fitnessSum, -1) // parent 1
+		idxParent1 := f.selector.Select(f.rng, -1) // parent 1
 		var idxParent2 int
 		retryLimit := 10 // Set a sensible retry limit to prevent infinite loops
 		for j := 0; j < retryLimit; j++ {
-			idxParent2 = f.rouletteSelect(population, fitnessSum, idxParent1) // attempt to select parent 2
+			idxParent2 = f.selector.Select(f.rng, idxParent1) // attempt to select parent 2
 			if idxParent2 != idxParent1 {
 				break // We found a different parent, exit the loop
 			}
@@ -151,26 +180,33 @@ func (f *Factory) PrefixMetricC1C2(s string) newdata.FieldSelector {
 
 // InitialFundsSplit determines how much C1 and C2 the Investor is staked with.
 func (f *Factory) InitialFundsSplit() (float64, float64) {
-	if f.cfg.SplitInitFunds {
-		s := f.PrefixMetricC1C2("EXClose")
+	return f.fundsSplit(f.cfg)
+}
+
+// fundsSplit determines how much C1 and C2 an Investor trading the C1 and C2
+// of cfg is staked with. The sleeves of a portfolio Investor each have their
+// own cfg.
+func (f *Factory) fundsSplit(cfg *util.AppConfig) (float64, float64) {
+	if cfg.SplitInitFunds {
+		s := newdata.FieldSelector{Metric: "EXClose", Locale: cfg.C1, Locale2: cfg.C2}
 		ss := []newdata.FieldSelector{s}
-		er3, err := f.db.Select(time.Time(f.cfg.DtStart), ss)
+		er3, err := f.db.Select(time.Time(cfg.DtStart), ss)
 		if err != nil {
-			log.Printf("*** ERROR *** SellConversion: ExchangeRate Record for %s not found. All initial funds go to C1", time.Time(f.cfg.DtStart).Format("1/2/2006"))
-			return f.cfg.InitFunds, 0
+			log.Printf("*** ERROR *** SellConversion: ExchangeRate Record for %s not found. All initial funds go to C1", time.Time(cfg.DtStart).Format("1/2/2006"))
+			return cfg.InitFunds, 0
 		}
 		if er3 == nil {
-			log.Printf("*** ERROR *** SellConversion: ExchangeRate Record for %s not found. All initial funds go to C1", time.Time(f.cfg.DtStart).Format("1/2/2006"))
-			return f.cfg.InitFunds, 0
+			log.Printf("*** ERROR *** SellConversion: ExchangeRate Record for %s not found. All initial funds go to C1", time.Time(cfg.DtStart).Format("1/2/2006"))
+			return cfg.InitFunds, 0
 		}
 
-		c1 := f.cfg.InitFunds / 2
+		c1 := cfg.InitFunds / 2
 		ERT3 := er3.Fields[s.FQMetric()].Value // exchange rate on T3
 		c2 := c1 * ERT3                        // amount of C2 we purchased on T3
 		return c1, c2
 	}
 
-	return f.cfg.InitFunds, 0
+	return cfg.InitFunds, 0
 }
 
 // BreedNewInvestor creates a new Investor by going through the genetic
@@ -225,27 +261,48 @@ func (f *Factory) BreedNewInvestor(population *[]Investor, idxParent1, idxParent
 	//-----------------------------------------------------------------
 	// Randomly choose one of the parents and copy its DNA value...
 	//-----------------------------------------------------------------
-	if util.RandomInRange(0, 1) == 0 {
-		if val, ok := maps[util.RandomInRange(0, 1)]["InvW1"].(float64); ok {
+	if f.rng.InRange(0, 1) == 0 {
+		if val, ok := maps[f.rng.InRange(0, 1)]["InvW1"].(float64); ok {
 			newInvestor.W1 = val
 			newInvestor.W2 = 1 - val
 		}
 	} else {
-		if val, ok := maps[util.RandomInRange(0, 1)]["InvW2"].(float64); ok {
+		if val, ok := maps[f.rng.InRange(0, 1)]["InvW2"].(float64); ok {
 			newInvestor.W2 = val
 			newInvestor.W1 = 1 - val
 		}
 	}
-	switch util.RandomInRange(0, 2) {
+	switch f.rng.InRange(0, 2) {
 	case 0:
 		newInvestor.Strategy = parent1.Strategy
+		newInvestor.StrategyParams = f.crossoverStrategyParams(&parent1, &parent2)
 	case 1:
 		newInvestor.Strategy = parent2.Strategy
+		newInvestor.StrategyParams = f.crossoverStrategyParams(&parent2, &parent1)
 	case 2:
-		newInvestor.Strategy = util.RandomInRange(0, len(InvestmentStrategies)-1) // 0 = Distributed Decsion, 1 = majority wins
+		choices := strategyChoices(f.cfg)
+		newInvestor.Strategy = choices[f.rng.InRange(0, len(choices)-1)]
+		newInvestor.StrategyParams = randomStrategyParams(newInvestor.Strategy, f.rng)
+	}
+
+	if f.cfg.EvolvePositionSizing {
+		newInvestor.Sizing = parents[f.rng.InRange(0, 1)].Sizing
+	}
+
+	k := f.rng.InRange(0, 1)
+	parent := parents[k]
+
+	//------------------------------------------------------------------------------------
+	// The child of a rule tree parent is a rule tree Investor. If the other parent has
+	// rules too, the child's rules are subtree crossovers of theirs.
+	//------------------------------------------------------------------------------------
+	if parent.Rules != nil {
+		newInvestor.Rules = f.crossoverRuleSet(parent.Rules, parents[1-k].Rules)
+		f.Mutate(&newInvestor)
+		newInvestor.DNA() // force ID to be generated
+		return newInvestor
 	}
 
-	parent := parents[util.RandomInRange(0, 1)]
 	newInfCount := len(parent.Influencers) // use the count from one of the parents
 	if newInfCount == 0 {
 		log.Panicf("newInfCount == 0, we cannot have an Investor with 0 Influencers\n")
@@ -279,18 +336,10 @@ func (f *Factory) BreedNewInvestor(population *[]Investor, idxParent1, idxParent
 			if err != nil {
 				log.Panicf("BreedNewInvestor:  Error parsing Influencer DNA2 = %s : %s\n", dna2, err.Error())
 			}
-			m := []map[string]interface{}{map1, map2}
 			//--------------------------------------------------------------------
 			// build a new DNA string that is a crossover blend of dna1 and dna2
 			//--------------------------------------------------------------------
-			dna = "{" + subclass + "," // this will be the dna of the new Influencer
-			j := 0
-			for k := range map1 {
-				dna += fmt.Sprintf("%s=%v,", k, m[j][k]) // first time through it gets map1[k], next time map2[k], next time map1[k]...
-				j = 1 - j                                // alternates between 0 and 1, you have to think about this, it's a very efficient way to do this kind of a toggle
-			}
-			dna = dna[:len(dna)-1] // remove the trailing comma
-			dna += "}"
+			dna = f.crossoverInfluencerDNA(subclass, map1, map2)
 		} else {
 			//------------------------------------------------------------------------------
 			// We only have 1 DNA strand. Assume it dominant and make the new Influencer...
@@ -341,11 +390,13 @@ func (f *Factory) createInfluencerDNAList(parent1, parent2 *Investor, n int) []I
 	}
 
 	infMetricMap := make(map[string]InfluencerDNA)
+	var metrics []string // the keys of infMetricMap in the order they were added
 	for _, investor := range []*Investor{parent1, parent2} {
 		for _, influencer := range investor.Influencers {
 			metric := influencer.GetMetric()
 			if _, exists := infMetricMap[metric]; !exists {
 				infMetricMap[metric] = InfluencerDNA{Subclass: influencer.Subclass(), DNA1: influencer.DNA()}
+				metrics = append(metrics, metric)
 			} else {
 				// If already exists and DNA1 is filled, fill DNA2
 				dna := infMetricMap[metric]
@@ -359,12 +410,12 @@ func (f *Factory) createInfluencerDNAList(parent1, parent2 *Investor, n int) []I
 
 	// Convert map to slice
 	allInfluencersDNA := make([]InfluencerDNA, 0, len(infMetricMap))
-	for _, dna := range infMetricMap {
-		allInfluencersDNA = append(allInfluencersDNA, dna)
+	for _, metric := range metrics {
+		allInfluencersDNA = append(allInfluencersDNA, infMetricMap[metric])
 	}
 
 	// Shuffle slice to randomize
-	util.UtilData.Rand.Shuffle(len(allInfluencersDNA), func(i, j int) {
+	f.rng.Shuffle(len(allInfluencersDNA), func(i, j int) {
 		allInfluencersDNA[i], allInfluencersDNA[j] = allInfluencersDNA[j], allInfluencersDNA[i]
 	})
 
@@ -397,7 +448,7 @@ func (f *Factory) max(a, b int) int {
 func (f *Factory) Mutate(inv *Investor) {
 	f.MutateCalls++ // this marks another call to Mutate
 
-	if util.RandomInRange(1, 100) > f.cfg.MutationRate {
+	if f.rng.InRange(1, 100) > f.cfg.MutationRate {
 		return
 	}
 
@@ -411,10 +462,11 @@ func (f *Factory) Mutate(inv *Investor) {
 	for k := range m {
 		keys = append(keys, k)
 	}
+	sort.Strings(keys) // map order is random, a seed must reproduce the same mutation
 
 	randomKey := "ID"
 	for randomKey == "ID" {
-		randomKey = keys[util.UtilData.Rand.Intn(len(keys))]
+		randomKey = keys[f.rng.Intn(len(keys))]
 	}
 	// fmt.Printf("Random key: %s, value: %v\n", randomKey, m[randomKey])
 
@@ -423,7 +475,7 @@ func (f *Factory) Mutate(inv *Investor) {
 		w := float64(0)
 		found := false
 		for !found {
-			w = util.UtilData.Rand.Float64()
+			w = f.rng.Float64()
 			found = (w != inv.W1)
 		}
 		inv.W1 = w
@@ -432,7 +484,7 @@ func (f *Factory) Mutate(inv *Investor) {
 		w := float64(0)
 		found := false
 		for !found {
-			w = util.UtilData.Rand.Float64()
+			w = f.rng.Float64()
 			found = (w != inv.W2)
 		}
 		inv.W2 = w
@@ -440,14 +492,69 @@ func (f *Factory) Mutate(inv *Investor) {
 	case "Influencers":
 		f.MutateInfluencer(inv)
 
+	case "Sizing":
+		sizing := inv.Sizing
+		for sizing == inv.Sizing {
+			sizing = util.PositionSizings[f.rng.Intn(len(util.PositionSizings))]
+		}
+		inv.Sizing = sizing
+
+	case "Buy":
+		inv.Rules.Buy = f.mutateRule(inv.Rules.Buy)
+
+	case "Sell":
+		inv.Rules.Sell = f.mutateRule(inv.Rules.Sell)
+
 	case "Strategy":
-		inv.Strategy = util.UtilData.Rand.Intn(len(InvestmentStrategies))
+		if inv.Rules != nil { // a rule tree Investor has no voting strategy, change one of its rules
+			if f.rng.Intn(2) == 0 {
+				inv.Rules.Buy = f.mutateRule(inv.Rules.Buy)
+			} else {
+				inv.Rules.Sell = f.mutateRule(inv.Rules.Sell)
+			}
+			break
+		}
+		choices := strategyChoices(f.cfg)
+		inv.Strategy = choices[f.rng.Intn(len(choices))]
+		inv.StrategyParams = randomStrategyParams(inv.Strategy, f.rng)
 
 	default:
-		log.Panicf("*** PANIC ERROR *** Unhandled key from DNA: %s\n", randomKey)
+		//-----------------------------------------------------------------
+		// The genes of the Investor's strategy are nudged like the genes
+		// of an Influencer
+		//-----------------------------------------------------------------
+		g, ok := strategyGene(randomKey)
+		if !ok {
+			log.Panicf("*** PANIC ERROR *** Unhandled key from DNA: %s\n", randomKey)
+		}
+		if inv.StrategyParams == nil {
+			inv.StrategyParams = StrategyParams{}
+		}
+		inv.StrategyParams[g.Name] = f.mutateGene(paramOrDefault(inv.StrategyParams, g), g.Min, g.Max, g.Decimals)
 	}
 }
 
+// crossoverStrategyParams returns the strategy params of a child that uses
+// the strategy of parent. If the other parent has the same strategy, each
+// gene is combined by crossoverGene. Otherwise the child gets a copy of
+// parent's params.
+// ----------------------------------------------------------------------------
+func (f *Factory) crossoverStrategyParams(parent, other *Investor) StrategyParams {
+	genes := coaStrategies[parent.Strategy].Genes()
+	if len(genes) == 0 {
+		return nil
+	}
+	m := StrategyParams{}
+	for _, g := range genes {
+		x := paramOrDefault(parent.StrategyParams, g)
+		if other.Strategy == parent.Strategy && other.Rules == nil {
+			x = f.crossoverGene(x, paramOrDefault(other.StrategyParams, g), g.Min, g.Max, g.Decimals)
+		}
+		m[g.Name] = x
+	}
+	return m
+}
+
 // MutateInfluencer will mutate the supplied investor by adding or removing an Influencer
 // where possible.
 //
@@ -461,7 +568,7 @@ func (f *Factory) Mutate(inv *Investor) {
 //
 // ----------------------------------------------------------------------------------------------------
 func (f *Factory) MutateInfluencer(inv *Investor) {
-	mutation := util.RandomInRange(0, 2)
+	mutation := f.rng.InRange(0, 3)
 	f.doMutateInfluencer(inv, mutation)
 }
 
@@ -470,7 +577,7 @@ func (f *Factory) MutateInfluencer(inv *Investor) {
 // INPUTS
 //
 //	 inv: the investor
-//		mutation:  0 = add, 1 = delete, 2 = modify
+//		mutation:  0 = add, 1 = delete, 2 = replace, 3 = modify one gene
 //
 // ----------------------------------------------------------------------------------------------------
 func (f *Factory) doMutateInfluencer(inv *Investor, mutation int) {
@@ -481,13 +588,14 @@ func (f *Factory) doMutateInfluencer(inv *Investor, mutation int) {
 		}
 	case 1: // DELETE
 		if len(inv.Influencers) > f.cfg.MinInfluencers {
-			index := util.UtilData.Rand.Intn(len(inv.Influencers))
+			index := f.rng.Intn(len(inv.Influencers))
 			inv.Influencers = append(inv.Influencers[:index], inv.Influencers[index+1:]...)
 		}
-	case 2: // MODIFY
-		idx := util.RandomInRange(0, len(inv.Influencers)-1) // pick the one to mutate
+	case 2: // REPLACE
+		idx := f.rng.InRange(0, len(inv.Influencers)-1) // pick the one to mutate
 		subclass, metric := f.RandomUnusedSubclassAndMetric(inv)
 		if len(metric) == 0 {
+			subclass = inv.Influencers[idx].Subclass()
 			metric = inv.Influencers[idx].GetMetric()
 		}
 		dna := fmt.Sprintf("{%s,Metric=%s}", subclass, metric)
@@ -497,6 +605,18 @@ func (f *Factory) doMutateInfluencer(inv *Investor, mutation int) {
 		}
 		r.Init(inv, inv.cfg)     // intialize it
 		inv.Influencers[idx] = r // and replace it in the slot we chose randomly
+	case 3: // MODIFY
+		idx := f.rng.InRange(0, len(inv.Influencers)-1) // pick the one to mutate
+		dna, err := f.mutateInfluencerGene(inv.Influencers[idx])
+		if err != nil {
+			log.Panicf("*** PANIC ERROR mutateInfluencerGene returned error: %s\n", err)
+		}
+		r, err := f.NewInfluencer(dna)
+		if err != nil {
+			log.Panicf("*** PANIC ERROR NewInfluncer(%q) returned error: %s\n", dna, err)
+		}
+		r.Init(inv, inv.cfg)
+		inv.Influencers[idx] = r
 	default:
 		fmt.Printf("*** INVALID MUTATION OPERATION *** --> %d, ignored.\n", mutation)
 	}
@@ -540,8 +660,9 @@ func (f *Factory) createInfluencer(inv *Investor) *Influencer {
 	return &inf
 }
 
-// RandomUnusedSubclassAndMetric selects a random subclass not yet present in the
-// given Investor's Influencers.
+// RandomUnusedSubclassAndMetric selects a random metric not yet present in the
+// given Investor's Influencers and returns it along with the subclass that
+// makes predictions from it.
 // -----------------------------------------------------------------------------------
 func (f *Factory) RandomUnusedSubclassAndMetric(inv *Investor) (string, string) {
 	subclass := "LSMInfluencer"
@@ -564,8 +685,12 @@ func (f *Factory) RandomUnusedSubclassAndMetric(inv *Investor) (string, string)
 		return subclass, ""
 	}
 
-	// Randomly select a new subclass from the available ones
-	return subclass, availableMetrics[util.UtilData.Rand.Intn(len(availableMetrics))]
+	// Randomly select a new metric from the available ones
+	metric := availableMetrics[f.rng.Intn(len(availableMetrics))]
+	if s := f.db.Mim.MInfluencerSubclasses[metric].Subclass; len(s) > 0 {
+		subclass = s
+	}
+	return subclass, metric
 }
 
 // NewInvestorFromDNA creates a new investor from supplied DNA.
@@ -579,7 +704,21 @@ func (f *Factory) NewInvestorFromDNA(DNA string) Investor {
 	inv := Investor{}
 
 	if val, ok := m["Strategy"].(string); ok {
-		inv.Strategy = InvestmentStrategyMap[val]
+		k, found := InvestmentStrategyMap[val]
+		if !found && val != RuleTreeStrategy {
+			log.Panicf("*** PANIC ERROR *** unknown Strategy: %s\n", val)
+		}
+		inv.Strategy = k
+		for _, g := range coaStrategies[k].Genes() {
+			if inv.StrategyParams == nil {
+				inv.StrategyParams = StrategyParams{}
+			}
+			x, ok := geneValue(m[g.Name])
+			if !ok {
+				x = g.Default
+			}
+			inv.StrategyParams[g.Name] = fitGene(x, g.Min, g.Max, g.Decimals)
+		}
 	}
 
 	if val, ok := m["ID"].(string); ok {
@@ -599,9 +738,37 @@ func (f *Factory) NewInvestorFromDNA(DNA string) Investor {
 	inv.cfg = f.cfg
 	inv.factory = f
 	inv.db = f.db
+	inv.rng = f.newInvestorRand()
 	inv.BalanceC1, inv.BalanceC2 = f.InitialFundsSplit()
 	inv.CreatedByDNA = true
 
+	if val, ok := m["Sizing"].(string); ok {
+		for _, v := range util.PositionSizings {
+			if v == val {
+				inv.Sizing = val
+			}
+		}
+		if inv.Sizing != val {
+			log.Panicf("*** PANIC ERROR *** unknown Sizing: %s\n", val)
+		}
+	}
+
+	//-----------------------------------------------------------------
+	// A rule tree Investor has rules instead of Influencers
+	//-----------------------------------------------------------------
+	if buy, ok := m["Buy"].(string); ok {
+		sell, _ := m["Sell"].(string)
+		inv.Rules = &RuleSet{}
+		if inv.Rules.Buy, err = f.ParseRuleTree(buy); err != nil {
+			log.Panicf("*** PANIC ERROR *** Buy rule: %s\n", err.Error())
+		}
+		if inv.Rules.Sell, err = f.ParseRuleTree(sell); err != nil {
+			log.Panicf("*** PANIC ERROR *** Sell rule: %s\n", err.Error())
+		}
+		inv.DNA() // force ID to be generated
+		return inv
+	}
+
 	infDNA, ok := m["Influencers"].(string)
 	if !ok {
 		log.Panicf("*** PANIC ERROR *** no string available for Influencers from DNA\n")
@@ -709,6 +876,11 @@ func (f *Factory) NewInfluencer(DNA string) (Influencer, error) {
 		return nil, err
 	}
 
+	pair, err := f.pairGene(DNAmap)
+	if err != nil {
+		return nil, err
+	}
+
 	switch subclassName {
 	case "LSMInfluencer":
 		x := LSMInfluencer{
@@ -717,17 +889,125 @@ func (f *Factory) NewInfluencer(DNA string) (Influencer, error) {
 			// HoldWindowNeg: f.db.Mim.MInfluencerSubclasses[metric].HoldWindowNeg,
 			// HoldWindowPos: f.db.Mim.MInfluencerSubclasses[metric].HoldWindowPos,
 			Metric: metric,
+			Pair:   pair,
 			cfg:    f.cfg,
 		}
 		minf := f.db.Mim.MInfluencerSubclasses[metric]
 		x.LocaleType = minf.LocaleType
 		x.Predictor = minf.Predictor
+		if x.LocaleType == newdata.LocaleBloc {
+			if err = f.setBlocGenes(&x, DNAmap); err != nil {
+				return nil, err
+			}
+		}
+		if err = f.setHoldWindowGenes(&x, DNAmap); err != nil {
+			return nil, err
+		}
 		return &x, nil
+	case "TAInfluencer":
+		return f.newTAInfluencer(metric, pair, Delta2, DNAmap)
 	default:
 		return nil, errors.New("unknown subclass")
 	}
 }
 
+// pairGene returns the Pair gene of an Influencer from DNA. Influencers only
+// have one when cfg.Pairs is set, it is the pair whose sleeve of the
+// portfolio Investor the Influencer advises. If it is not in DNA it is
+// chosen at random.
+// --------------------------------------------------------------------------------
+func (f *Factory) pairGene(DNA map[string]interface{}) (string, error) {
+	val, ok := DNA["Pair"].(string)
+	if len(f.cfg.Pairs) == 0 {
+		if ok {
+			return "", fmt.Errorf("influencer has Pair=%s but the config file has no Pairs", val)
+		}
+		return "", nil
+	}
+	if !ok {
+		return f.cfg.Pairs[f.rng.Intn(len(f.cfg.Pairs))], nil
+	}
+	for _, v := range f.cfg.Pairs {
+		if v == val {
+			return val, nil
+		}
+	}
+	return "", fmt.Errorf("unknown pair: %s, it is not in Pairs", val)
+}
+
+// setBlocGenes sets the Bloc, Versus and Agg of an LSMInfluencer for a
+// LocaleBloc metric from DNA. Genes not in DNA are chosen at random.
+// --------------------------------------------------------------------------------
+func (f *Factory) setBlocGenes(x *LSMInfluencer, DNA map[string]interface{}) error {
+	if len(f.db.BlocNames) == 0 {
+		return fmt.Errorf("metric %s is a bloc metric but no blocs are defined", x.Metric)
+	}
+	if val, ok := DNA["Bloc"].(string); ok {
+		if _, ok = f.db.Blocs[val]; !ok {
+			return fmt.Errorf("unknown bloc: %s", val)
+		}
+		x.Bloc = val
+	} else {
+		x.Bloc = f.db.BlocNames[f.rng.Intn(len(f.db.BlocNames))]
+	}
+
+	if val, ok := DNA["Versus"].(string); ok {
+		if val != "C1" && val != "C2" {
+			return fmt.Errorf("bloc influencers compare to C1 or C2, found Versus=%s", val)
+		}
+		x.Versus = val
+	} else {
+		x.Versus = []string{"C1", "C2"}[f.rng.Intn(2)]
+	}
+
+	if val, ok := DNA["Agg"].(string); ok {
+		found := false
+		for _, v := range newdata.BlocAggregates {
+			found = found || v == val
+		}
+		if !found {
+			return fmt.Errorf("unknown bloc aggregate: %s", val)
+		}
+		x.Agg = val
+	} else {
+		x.Agg = newdata.BlocAggregates[f.rng.Intn(len(newdata.BlocAggregates))]
+	}
+	return nil
+}
+
+// setHoldWindowGenes sets the LookBack and VarFactor of an LSMInfluencer from
+// DNA. They are genes only for metrics whose MISubclasses entry bounds them
+// (MaxLookBack > 0, MaxVarFactor > 0); for other metrics they are ignored and
+// the Influencer uses cfg.HoldWindowStatsLookBack and cfg.StdDevVariationFactor.
+// Genes not in DNA are chosen at random within the bounds.
+// --------------------------------------------------------------------------------
+func (f *Factory) setHoldWindowGenes(x *LSMInfluencer, DNA map[string]interface{}) error {
+	minf := f.db.Mim.MInfluencerSubclasses[x.Metric]
+	if minf.MaxLookBack > 0 {
+		if val, ok := DNA["LookBack"].(int); ok {
+			if val < minf.MinLookBack || val > minf.MaxLookBack {
+				return fmt.Errorf("invalid LookBack value: %d, it must be in the range %d to %d", val, minf.MinLookBack, minf.MaxLookBack)
+			}
+			x.LookBack = val
+		} else {
+			x.LookBack = f.rng.InRange(minf.MinLookBack, minf.MaxLookBack)
+		}
+	}
+
+	if minf.MaxVarFactor > 0 {
+		x.HasVarFactor = true
+		if val, ok := geneValue(DNA["VarFactor"]); ok {
+			if val < minf.MinVarFactor || val > minf.MaxVarFactor {
+				return fmt.Errorf("invalid VarFactor value: %g, it must be in the range %g to %g", val, minf.MinVarFactor, minf.MaxVarFactor)
+			}
+			x.VarFactor = val
+		} else {
+			x.VarFactor = fitGene(minf.MinVarFactor+f.rng.Float64()*(minf.MaxVarFactor-minf.MinVarFactor), minf.MinVarFactor, minf.MaxVarFactor, varFactorDecimals)
+		}
+	}
+	return nil
+}
+
 // ParseInfluencerDNA does what you think
 //
 // The format of a DNA string:
@@ -805,7 +1085,7 @@ func (f *Factory) GenerateDeltas(metric string, DNA map[string]interface{}) (Del
 		}
 	} else {
 		// if no value found, generate based on configuration limits
-		Delta1 = util.RandomInRange(f.db.Mim.MInfluencerSubclasses[metric].MinDelta1, f.db.Mim.MInfluencerSubclasses[metric].MaxDelta1)
+		Delta1 = f.rng.InRange(f.db.Mim.MInfluencerSubclasses[metric].MinDelta1, f.db.Mim.MInfluencerSubclasses[metric].MaxDelta1)
 	}
 
 	// Generate or validate Delta2
@@ -818,56 +1098,8 @@ func (f *Factory) GenerateDeltas(metric string, DNA map[string]interface{}) (Del
 		}
 	} else {
 		// if no value found, generate based on configuration limits
-		Delta2 = util.RandomInRange(f.db.Mim.MInfluencerSubclasses[metric].MinDelta2, f.db.Mim.MInfluencerSubclasses[metric].MaxDelta2)
+		Delta2 = f.rng.InRange(f.db.Mim.MInfluencerSubclasses[metric].MinDelta2, f.db.Mim.MInfluencerSubclasses[metric].MaxDelta2)
 	}
 
 	return Delta1, Delta2, nil
 }
-
-// rouletteSelect selects a single parent from the population, using
-// "roulette wheel selection" method.
-//
-// Here is the detailed process:
-// Calculate the sum of all fitness values in the population. This sum
-// represents the entire "wheel" in the roulette analogy. Each individual
-// in the population is then a "section" of the wheel whose section size
-// is proportional to its fitness.
-//
-// Generate a random number in the range [0, SumOfFitnessScores]
-// This number represents the "spin" of the roulette wheel.
-//
-// Iterate over the population and sum the fitness values from the start
-// to each individual (the cumulative sum). Whenever this
-// sum is >= to the random number generated in step 2,
-// return that individual.
-//
-// INPUTS
-//
-//	population = the old population
-//
-// RETURN
-//
-//	index of the investor selected
-//
-// -----------------------------------------------------------------------------
-func (f *Factory) rouletteSelect(population []Investor, fitnessSum float64, used int) int {
-	spin := util.UtilData.Rand.Float64() * fitnessSum
-	runningSum := 0.0
-	zeros := 0 // count the number of Investors in the population with a 0 fitness score
-
-	for i, investor := range population {
-		if i == used {
-			continue
-		}
-		score := investor.CalculateFitnessScore()
-		if score == 0 {
-			zeros++
-		}
-		runningSum += score
-		if runningSum >= spin {
-			return i
-		}
-	}
-
-	return len(population) - 1 // In case of rounding errors or zero fitnessSum, return the last investor
-}
@@ -3,6 +3,7 @@ package newcore
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/stmansour/psim/util"
@@ -57,17 +58,30 @@ func (f *FinRep) GenerateHeader() error {
 func (f *FinRep) GenerateRows() error {
 	c1b := fmt.Sprintf("C1 Balance (%s)", f.Sim.Cfg.C1)
 	c2b := fmt.Sprintf("C2 Balance (%s)", f.Sim.Cfg.C2)
+	portfolio := len(f.Sim.Cfg.Pairs) > 0
+	if portfolio {
+		c2b = "C2 Balance (all pairs)" // the sum of the foreign currencies, the Pairs column has each one
+	}
 	cols := []string{
 		"Rank",
 		"Date",
 		"Generation",
 		"Portfolio Value",
 		"Annualized Return",
+	}
+	cols = append(cols, RiskMetricsColumns...)
+	cols = append(cols, ExposureColumns...)
+	cols = append(cols, CarryColumns...)
+	cols = append(cols,
+		"Execution Cost",
 		"Stop Loss Count",
 		c1b,
 		c2b,
-		"DNA",
+	)
+	if portfolio {
+		cols = append(cols, "Pairs") // the value and balances of each pair
 	}
+	cols = append(cols, "Hold Windows", "DNA")
 
 	//------------------------------------------------------------------------
 	// WRITE COLUMN HEADERS...
@@ -94,18 +108,65 @@ func (f *FinRep) GenerateRows() error {
 		if err != nil {
 			fmt.Printf("Error calculating annualized return: %s\n", err.Error())
 		}
-		fmt.Fprintf(f.file, "%d,%s,%d,%12.2f,%.2f,%d,%12.2f,%12.2f,%q\n",
+		pl := t.PortfolioValue - f.Sim.Cfg.InitFunds // total profit or loss
+		fmt.Fprintf(f.file, "%d,%s,%d,%12.2f,%.2f,%s,%s,%s,%.2f,%d,%12.2f,%12.2f,",
 			i+1,                       // rank
 			t.DtPV.Format("1/2/2006"), // date
 			t.GenNo,                   // generation number
 			t.PortfolioValue,          // portfolio
 			ar*100,                    // annualized return
+			t.Risk.CSV(),              // risk metrics
+			t.Exposure.CSV(),          // exposure and utilization
+			t.Carry.CSV(pl),           // carry and spot P&L
+			t.ExecCost,                // cost of the spread and slippage
 			t.StopLossCount,           // count of stoploss invocations
 			t.BalanceC1,               // C1
 			t.BalanceC2,               // C2
-			t.DNA,
 		)
+		if portfolio {
+			fmt.Fprintf(f.file, "%q,", pairSummary(t.Pairs))
+		}
+		fmt.Fprintf(f.file, "%q,%q\n", HoldWindows(t.DNA), t.DNA)
 	}
 
 	return nil
 }
+
+// HoldWindows returns a summary of the hold window genes, LookBack and
+// VarFactor, of the Influencers in an Investor's DNA. For example:
+//
+//	"Gold LookBack=120 VarFactor=0.85 | DR VarFactor=1.2"
+//
+// Influencers that use cfg.HoldWindowStatsLookBack and
+// cfg.StdDevVariationFactor are not listed. If none of the Influencers have
+// their own it returns "defaults".
+// -----------------------------------------------------------------------------
+func HoldWindows(dna string) string {
+	i := strings.Index(dna, "Influencers=[")
+	j := strings.LastIndex(dna, "]")
+	if i < 0 || j < i {
+		return "defaults"
+	}
+	var list []string
+	for _, inf := range strings.Split(dna[i+len("Influencers=["):j], "|") {
+		genes := map[string]string{}
+		for _, g := range strings.Split(strings.Trim(inf, "{}"), ",") {
+			if kv := strings.SplitN(g, "=", 2); len(kv) == 2 {
+				genes[kv[0]] = kv[1]
+			}
+		}
+		s := genes["Metric"]
+		for _, k := range []string{"LookBack", "VarFactor"} {
+			if v, ok := genes[k]; ok {
+				s += " " + k + "=" + v
+			}
+		}
+		if s != genes["Metric"] {
+			list = append(list, s)
+		}
+	}
+	if len(list) == 0 {
+		return "defaults"
+	}
+	return strings.Join(list, " | ")
+}
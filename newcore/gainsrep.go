@@ -0,0 +1,54 @@
+package newcore
+
+import (
+	"fmt"
+	"os"
+)
+
+// dumpRealizedGains writes every chunk of C2 sold by the top Investors of
+// the current generation to gains.csv, with the C1 values needed for taxes
+//
+// RETURNS
+//
+//	any error encountered
+//
+// ----------------------------------------------------------------------------
+func (s *Simulator) dumpRealizedGains() error {
+	var file *os.File
+	var err error
+	fname := s.Cfg.GenerateFName("gains")
+	if s.GensCompleted == 1 {
+		file, err = os.Create(fname)
+	} else {
+		file, err = os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if s.GensCompleted == 1 {
+		fmt.Fprintf(file, "%q\n", "PLATO Simulator - Realized Gains")
+		fmt.Fprintf(file, "\"Configuration File:  %s\"\n", s.Cfg.ConfigFilename)
+		fmt.Fprintf(file, "\"Lot Selection: %s\"\n", lotSelection(s.Cfg))
+		fmt.Fprintf(file, "\"Long-Term: held more than %d days\"\n", longTermDays(s.Cfg))
+		fmt.Fprintf(file, "%q,%q", "Generation", "Investor")
+		for _, col := range RealizedGainColumns {
+			fmt.Fprintf(file, ",%q", col)
+		}
+		fmt.Fprintf(file, "\n")
+	}
+
+	lim := s.Cfg.TopInvestorCount
+	if lim > len(s.Investors) {
+		lim = len(s.Investors)
+	}
+	for i := 0; i < lim; i++ {
+		inv := &s.Investors[i]
+		gains := inv.RealizedGains()
+		for k := range gains {
+			fmt.Fprintf(file, "%d,%q,%s\n", s.GensCompleted, inv.ID, gains[k].CSV())
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+
+	"github.com/stmansour/psim/util"
+)
+
+// varFactorDecimals is the number of decimal places of the VarFactor gene
+const varFactorDecimals = 4
+
+// geneRange returns the smallest and largest value of a numeric gene of an
+// Influencer for metric, and the number of decimal places its values have in
+// DNA; 0 for integer genes. ok is false if the gene is not numeric, for
+// example Metric or Indicator.
+// ------------------------------------------------------------------------------
+func (f *Factory) geneRange(metric, gene string) (lo, hi float64, decimals int, ok bool) {
+	mi := f.db.Mim.MInfluencerSubclasses[metric]
+	switch gene {
+	case "Delta1":
+		return float64(mi.MinDelta1), float64(mi.MaxDelta1), 0, true
+	case "Delta2":
+		return float64(mi.MinDelta2), float64(mi.MaxDelta2), 0, true
+	case "LookBack":
+		return float64(mi.MinLookBack), float64(mi.MaxLookBack), 0, mi.MaxLookBack > 0
+	case "VarFactor":
+		return mi.MinVarFactor, mi.MaxVarFactor, varFactorDecimals, mi.MaxVarFactor > 0
+	}
+	r, ok := taGeneRanges[gene]
+	if !ok {
+		return 0, 0, 0, false
+	}
+	if gene == "Width" || gene == "Threshold" {
+		return r[0], r[1], 2, true
+	}
+	return r[0], r[1], 0, true
+}
+
+// fitGene keeps x in the range lo to hi, rounded to the number of decimal
+// places the gene has in DNA.
+// ------------------------------------------------------------------------------
+func fitGene(x, lo, hi float64, decimals int) float64 {
+	scale := math.Pow(10, float64(decimals))
+	x = math.Round(x*scale) / scale
+	return math.Max(lo, math.Min(hi, x))
+}
+
+// formatGene returns the DNA representation of a numeric gene value
+func formatGene(x float64, decimals int) string {
+	if decimals == 0 {
+		return fmt.Sprintf("%d", int(x))
+	}
+	return strconv.FormatFloat(x, 'f', -1, 64)
+}
+
+// crossoverGene combines the values a and b of a numeric gene of two parents
+// using cfg.Crossover. The result is within the gene's range.
+// ------------------------------------------------------------------------------
+func (f *Factory) crossoverGene(a, b, lo, hi float64, decimals int) float64 {
+	var x float64
+	switch f.cfg.Crossover {
+	case util.CrossoverArithmetic:
+		w := f.rng.Float64()
+		x = w*a + (1-w)*b
+	case util.CrossoverUniform:
+		x = a
+		if f.rng.Intn(2) == 1 {
+			x = b
+		}
+	default: // blend
+		d := math.Abs(a-b) * f.cfg.CrossoverAlpha
+		x0 := math.Min(a, b) - d
+		x1 := math.Max(a, b) + d
+		x = x0 + f.rng.Float64()*(x1-x0)
+	}
+	return fitGene(x, lo, hi, decimals)
+}
+
+// mutateGene changes the value x of a numeric gene using cfg.GeneMutation.
+// The size of the change is GeneMutationSigma times the gene's range. The
+// result is within the gene's range.
+// ------------------------------------------------------------------------------
+func (f *Factory) mutateGene(x, lo, hi float64, decimals int) float64 {
+	sigma := f.cfg.GeneMutationSigma
+	if sigma <= 0 {
+		sigma = util.DefaultGeneMutationSigma
+	}
+	step := sigma * (hi - lo)
+	switch f.cfg.GeneMutation {
+	case util.MutationCreep:
+		if decimals == 0 {
+			step = math.Max(1, math.Round(step)) // an integer gene must move by at least 1
+		}
+		x += (2*f.rng.Float64() - 1) * step
+	default: // gaussian
+		x += f.rng.NormFloat64() * step
+	}
+	return fitGene(x, lo, hi, decimals)
+}
+
+// crossoverInfluencerDNA returns the DNA of a child Influencer of two parent
+// Influencers of the same metric. One parent is chosen to supply the list of
+// genes; this matters for TAInfluencers with different indicators. Numeric
+// genes that both parents have are combined by crossoverGene. Every other gene
+// comes from a randomly chosen parent.
+// ------------------------------------------------------------------------------
+func (f *Factory) crossoverInfluencerDNA(subclass string, map1, map2 map[string]interface{}) string {
+	if f.rng.Intn(2) == 1 {
+		map1, map2 = map2, map1
+	}
+	metric, _ := map1["Metric"].(string)
+
+	// visit the keys in a fixed order so that a seed always reproduces the same run
+	keys := make([]string, 0, len(map1))
+	for k := range map1 {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	dna := "{" + subclass
+	for _, k := range keys {
+		v := map1[k]
+		v2, ok := map2[k]
+		switch {
+		case !ok || k == "Metric" || k == "Indicator":
+			// keep the gene of the parent that supplies the list
+		default:
+			a, aok := geneValue(v)
+			b, bok := geneValue(v2)
+			lo, hi, decimals, numeric := f.geneRange(metric, k)
+			if aok && bok && numeric {
+				v = formatGene(f.crossoverGene(a, b, lo, hi, decimals), decimals)
+			} else if f.rng.Intn(2) == 1 {
+				v = v2
+			}
+		}
+		dna += fmt.Sprintf(",%s=%v", k, v)
+	}
+	return dna + "}"
+}
+
+// geneValue returns the numeric value of a gene parsed by ParseInfluencerDNA
+func geneValue(v interface{}) (float64, bool) {
+	switch x := v.(type) {
+	case int:
+		return float64(x), true
+	case float64:
+		return x, true
+	}
+	return 0, false
+}
+
+// mutateInfluencerGene returns the DNA of the Influencer with one of its
+// numeric genes changed by mutateGene. All other genes are unchanged. If the
+// Influencer has no numeric genes its DNA is returned unchanged.
+// ------------------------------------------------------------------------------
+func (f *Factory) mutateInfluencerGene(inf Influencer) (string, error) {
+	dna := inf.DNA()
+	subclass, m, err := f.ParseInfluencerDNA(dna)
+	if err != nil {
+		return "", err
+	}
+	metric := inf.GetMetric()
+	var genes []string
+	for k, v := range m {
+		if _, ok := geneValue(v); !ok {
+			continue
+		}
+		if _, _, _, ok := f.geneRange(metric, k); ok {
+			genes = append(genes, k)
+		}
+	}
+	if len(genes) == 0 {
+		return dna, nil
+	}
+	sort.Strings(genes) // map order is random, a seed must reproduce the same mutation
+	gene := genes[f.rng.Intn(len(genes))]
+	x, _ := geneValue(m[gene])
+	lo, hi, decimals, _ := f.geneRange(metric, gene)
+	//----------------------------------------------------------------------
+	// A fast period must stay shorter than the slow one, otherwise
+	// newTAInfluencer swaps them and two genes change
+	//----------------------------------------------------------------------
+	if slow, ok := geneValue(m["Slow"]); ok && gene == "Fast" {
+		hi = math.Min(hi, slow-1)
+	}
+	if fast, ok := geneValue(m["Fast"]); ok && gene == "Slow" {
+		lo = math.Max(lo, fast+1)
+	}
+	m[gene] = formatGene(f.mutateGene(x, lo, hi, decimals), decimals)
+
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	dna = "{" + subclass
+	for _, k := range keys {
+		dna += fmt.Sprintf(",%s=%v", k, m[k])
+	}
+	return dna + "}", nil
+}
@@ -0,0 +1,218 @@
+package newcore
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stmansour/psim/util"
+)
+
+// TestCrossoverInfluencerGenes breeds Influencers from parents at opposite
+// ends of the Delta1/Delta2 ranges with every crossover operator. The
+// children's genes must stay within the MISubclasses bounds and, except for
+// blend crossover, between the parents' values.
+func TestCrossoverInfluencerGenes(t *testing.T) {
+	f, _ := taTestFactory(t)
+	_, map1, err := f.ParseInfluencerDNA("{LSMInfluencer,Delta1=-60,Delta2=-9,Metric=Gold}")
+	if err != nil {
+		t.Fatalf("ParseInfluencerDNA returned error: %s", err)
+	}
+	_, map2, _ := f.ParseInfluencerDNA("{LSMInfluencer,Delta1=-12,Delta2=-1,Metric=Gold}")
+
+	for _, op := range util.Crossovers {
+		f.cfg.Crossover = op
+		f.cfg.CrossoverAlpha = 0.5
+		d1 := map[int]bool{}
+		for k := 0; k < 200; k++ {
+			dna := f.crossoverInfluencerDNA("LSMInfluencer", map1, map2)
+			inf, err := f.NewInfluencer(dna)
+			if err != nil {
+				t.Fatalf("%s: NewInfluencer(%s) returned error: %s", op, dna, err)
+			}
+			p := inf.(*LSMInfluencer)
+			if p.Delta1 < -60 || p.Delta1 > -10 || p.Delta2 < -9 || p.Delta2 > -1 {
+				t.Fatalf("%s: child out of range: %s", op, dna)
+			}
+			if op != util.CrossoverBlend && (p.Delta1 < -60 || p.Delta1 > -12) {
+				t.Fatalf("%s: Delta1 is not between the parents' values: %s", op, dna)
+			}
+			if op == util.CrossoverUniform && p.Delta1 != -60 && p.Delta1 != -12 {
+				t.Fatalf("%s: Delta1 is not a parent's value: %s", op, dna)
+			}
+			d1[p.Delta1] = true
+		}
+		if op != util.CrossoverUniform && len(d1) < 10 {
+			t.Errorf("%s: expected children with many Delta1 values, got %d", op, len(d1))
+		}
+	}
+
+	//---------------------------------------------------------------
+	// TAInfluencers with different indicators still make valid
+	// children. Width is a floating point gene.
+	//---------------------------------------------------------------
+	f.cfg.Crossover = util.CrossoverBlend
+	_, map1, _ = f.ParseInfluencerDNA("{TAInfluencer,Delta2=-1,Indicator=Bollinger,Metric=EXClose,Period=5,Width=1.1}")
+	_, map2, _ = f.ParseInfluencerDNA("{TAInfluencer,Delta2=-5,Indicator=RSI,Level=80,Metric=EXClose,Period=50}")
+	_, map3, _ := f.ParseInfluencerDNA("{TAInfluencer,Delta2=-5,Indicator=Bollinger,Metric=EXClose,Period=50,Width=3}")
+	for k := 0; k < 100; k++ {
+		for _, m := range []map[string]interface{}{map2, map3} {
+			dna := f.crossoverInfluencerDNA("TAInfluencer", map1, m)
+			if _, err := f.NewInfluencer(dna); err != nil {
+				t.Fatalf("NewInfluencer(%s) returned error: %s", dna, err)
+			}
+		}
+	}
+}
+
+// TestMutateInfluencerGene mutates one gene at a time with each mutation
+// operator. Exactly one gene may change and it must stay in range.
+func TestMutateInfluencerGene(t *testing.T) {
+	f, _ := taTestFactory(t)
+	dnas := []string{
+		"{LSMInfluencer,Delta1=-60,Delta2=-1,Metric=Gold}",
+		"{LSMInfluencer,Delta1=-35,Delta2=-5,Metric=DR}",
+		"{TAInfluencer,Delta2=-3,Fast=12,Indicator=MACD,Metric=EXClose,Signal=9,Slow=26}",
+		"{TAInfluencer,Delta2=-3,Indicator=ROC,Metric=EXClose,Period=20,Threshold=2.5}",
+	}
+	genes := func(dna string) map[string]string {
+		m := map[string]string{}
+		for _, g := range strings.Split(strings.Trim(dna, "{}"), ",")[1:] {
+			kv := strings.Split(g, "=")
+			m[kv[0]] = kv[1]
+		}
+		return m
+	}
+	for _, op := range util.GeneMutations {
+		f.cfg.GeneMutation = op
+		f.cfg.GeneMutationSigma = 0.2
+		for _, dna := range dnas {
+			inf, err := f.NewInfluencer(dna)
+			if err != nil {
+				t.Fatalf("NewInfluencer(%s) returned error: %s", dna, err)
+			}
+			before := genes(inf.DNA())
+			changed := 0
+			for k := 0; k < 100; k++ {
+				s, err := f.mutateInfluencerGene(inf)
+				if err != nil {
+					t.Fatalf("mutateInfluencerGene returned error: %s", err)
+				}
+				mutant, err := f.NewInfluencer(s)
+				if err != nil {
+					t.Fatalf("%s: the mutant %s is not valid: %s", op, s, err)
+				}
+				after := genes(mutant.DNA())
+				diffs := []string{}
+				for g, v := range before {
+					if after[g] != v {
+						diffs = append(diffs, fmt.Sprintf("%s: %s -> %s", g, v, after[g]))
+					}
+				}
+				if len(diffs) > 1 {
+					t.Errorf("%s: more than one gene of %s changed: %v", op, dna, diffs)
+				}
+				changed += len(diffs)
+			}
+			if changed == 0 {
+				t.Errorf("%s: no gene of %s was ever changed", op, dna)
+			}
+		}
+	}
+
+	//---------------------------------------------------------------
+	// doMutateInfluencer with mutation 3 modifies an Influencer in
+	// place, it keeps its metric
+	//---------------------------------------------------------------
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}")
+	for k := 0; k < 20; k++ {
+		f.doMutateInfluencer(&inv, 3)
+		if len(inv.Influencers) != 2 || inv.Influencers[0].GetMetric() != "DR" || inv.Influencers[1].GetMetric() != "Gold" {
+			t.Fatalf("mutation 3 must only change genes, got %s", inv.DNA())
+		}
+	}
+}
+
+// TestHoldWindowGenes checks the LookBack and VarFactor genes. They are
+// genes only for metrics with bounds in MISubclasses; the DNA of other
+// metrics is unchanged.
+func TestHoldWindowGenes(t *testing.T) {
+	f, db := taTestFactory(t)
+	mi := db.Mim.MInfluencerSubclasses["Gold"]
+	mi.MinLookBack, mi.MaxLookBack, mi.MinVarFactor, mi.MaxVarFactor = 20, 200, 0.5, 2
+	db.Mim.MInfluencerSubclasses["Gold"] = mi
+
+	dna := "{LSMInfluencer,Delta1=-30,Delta2=-5,LookBack=120,Metric=Gold,VarFactor=0.75}"
+	inf, err := f.NewInfluencer(dna)
+	if err != nil {
+		t.Fatalf("NewInfluencer(%s) returned error: %s", dna, err)
+	}
+	p := inf.(*LSMInfluencer)
+	if p.LookBack != 120 || !p.HasVarFactor || p.VarFactor != 0.75 || inf.DNA() != dna {
+		t.Errorf("expected %s, got %s", dna, inf.DNA())
+	}
+	if p.varFactor() != 0.75 {
+		t.Errorf("expected a variation factor of 0.75, got %f", p.varFactor())
+	}
+	for _, bad := range []string{
+		"{LSMInfluencer,Delta1=-30,Delta2=-5,LookBack=10,Metric=Gold}",
+		"{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold,VarFactor=2.5}",
+	} {
+		if _, err := f.NewInfluencer(bad); err == nil {
+			t.Errorf("expected an error for %s", bad)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Missing genes are chosen at random, bred and mutated within
+	// the bounds
+	//---------------------------------------------------------------
+	f.cfg.GeneMutationSigma = 0.3
+	for k := 0; k < 100; k++ {
+		inf, err := f.NewInfluencer("{LSMInfluencer,Metric=Gold}")
+		if err != nil {
+			t.Fatalf("NewInfluencer returned error: %s", err)
+		}
+		s, err := f.mutateInfluencerGene(inf)
+		if err != nil {
+			t.Fatalf("mutateInfluencerGene returned error: %s", err)
+		}
+		_, map1, _ := f.ParseInfluencerDNA(s)
+		_, map2, _ := f.ParseInfluencerDNA(dna)
+		for _, d := range []string{inf.DNA(), s, f.crossoverInfluencerDNA("LSMInfluencer", map1, map2)} {
+			child, err := f.NewInfluencer(d)
+			if err != nil {
+				t.Fatalf("NewInfluencer(%s) returned error: %s", d, err)
+			}
+			c := child.(*LSMInfluencer)
+			if c.LookBack < 20 || c.LookBack > 200 || c.VarFactor < 0.5 || c.VarFactor > 2 {
+				t.Fatalf("hold window genes out of range: %s", d)
+			}
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Metrics without bounds ignore the genes and use the config
+	//---------------------------------------------------------------
+	inf, err = f.NewInfluencer("{LSMInfluencer,Delta1=-30,Delta2=-5,LookBack=120,Metric=DR,VarFactor=0.75}")
+	if err != nil {
+		t.Fatalf("NewInfluencer returned error: %s", err)
+	}
+	if s := inf.DNA(); s != "{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}" {
+		t.Errorf("expected no hold window genes, got %s", s)
+	}
+	if x := inf.(*LSMInfluencer).varFactor(); x != f.cfg.StdDevVariationFactor {
+		t.Errorf("expected the config file's variation factor, got %f", x)
+	}
+
+	//---------------------------------------------------------------
+	// The reports summarize the genes
+	//---------------------------------------------------------------
+	inv := "{Investor;Strategy=DistributedDecision;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|" + dna + "]}"
+	if s := HoldWindows(inv); s != "Gold LookBack=120 VarFactor=0.75" {
+		t.Errorf("unexpected hold windows: %s", s)
+	}
+	if s := HoldWindows("{Investor;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}]}"); s != "defaults" {
+		t.Errorf("expected defaults, got %s", s)
+	}
+}
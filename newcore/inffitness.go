@@ -0,0 +1,104 @@
+package newcore
+
+import (
+	"time"
+)
+
+// PredictionStats summarizes the predictions an Influencer made. A prediction
+// is recorded each day its Investor buys C2. It is finalized when that
+// investment is sold: a "buy" is correct if the sale was profitable, a "sell"
+// is correct if it was not. "hold" and "abstain" are not judged.
+type PredictionStats struct {
+	Predictions int // predictions recorded
+	Active      int // recorded predictions that were not "abstain"
+	Judged      int // finalized "buy" and "sell" predictions
+	Correct     int // judged predictions that were correct
+}
+
+// NewPredictionStats counts the predictions in ps
+// ---------------------------------------------------------------------------
+func NewPredictionStats(ps []Prediction) PredictionStats {
+	var s PredictionStats
+	for i := 0; i < len(ps); i++ {
+		s.Predictions++
+		if ps[i].Action != "abstain" {
+			s.Active++
+		}
+		if ps[i].Completed && (ps[i].Action == "buy" || ps[i].Action == "sell") {
+			s.Judged++
+			if ps[i].Correct {
+				s.Correct++
+			}
+		}
+	}
+	return s
+}
+
+// Correctness returns the fraction of judged predictions that were correct,
+// 0 if none were judged
+func (s *PredictionStats) Correctness() float64 {
+	if s.Judged == 0 {
+		return 0
+	}
+	return float64(s.Correct) / float64(s.Judged)
+}
+
+// Activity returns the fraction of recorded predictions that were not
+// "abstain", 0 if none were recorded
+func (s *PredictionStats) Activity() float64 {
+	if s.Predictions == 0 {
+		return 0
+	}
+	return float64(s.Active) / float64(s.Predictions)
+}
+
+// influencerFitness computes an Influencer's fitness from its predictions:
+//
+//	fitness = w1 * correctness + w2 * activity
+//
+// w1 and w2 are the FitnessW1 and FitnessW2 of the Influencer's metric.
+// ---------------------------------------------------------------------------
+func influencerFitness(inv *Investor, metric string, ps []Prediction) float64 {
+	w1, w2 := 0.5, 0.5
+	if inv != nil && inv.db != nil && inv.db.Mim != nil {
+		if mi, ok := inv.db.Mim.MInfluencerSubclasses[metric]; ok && mi.FitnessW1+mi.FitnessW2 > 0 {
+			w1, w2 = mi.FitnessW1, mi.FitnessW2
+		}
+	}
+	s := NewPredictionStats(ps)
+	return w1*s.Correctness() + w2*s.Activity()
+}
+
+// finalizePrediction marks the open prediction made on t3 as completed and
+// sets whether it was correct.
+//
+// RETURNS
+//
+//	judged  - true if the prediction was a "buy" or "sell"
+//	correct - true if it was judged and was correct
+//
+// ---------------------------------------------------------------------------
+func finalizePrediction(ps []Prediction, t3 time.Time, profitable bool) (bool, bool) {
+	for i := 0; i < len(ps); i++ {
+		if ps[i].Completed || !t3.Equal(ps[i].T3) {
+			continue
+		}
+		ps[i].Completed = true
+		switch ps[i].Action {
+		case "buy":
+			ps[i].Correct = profitable
+		case "sell":
+			ps[i].Correct = !profitable
+		default:
+			return false, false
+		}
+		return true, ps[i].Correct
+	}
+	return false, false
+}
+
+// runningAccuracy is an Influencer's accuracy so far. It starts at 0.5 and
+// moves toward the fraction of correct predictions as they are judged.
+func runningAccuracy(correct, judged int) float64 {
+	return float64(correct+1) / float64(judged+2)
+}
@@ -0,0 +1,154 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// TestInfluencerFitness finalizes a handful of predictions and checks the
+// counts, the running accuracy and the fitness computed from them.
+func TestInfluencerFitness(t *testing.T) {
+	f, db := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}")
+	inf := inv.Influencers[0]
+	if inf.Accuracy() != 0.5 {
+		t.Errorf("expected an accuracy of 0.5 before any predictions, got %f", inf.Accuracy())
+	}
+
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	actions := []string{"buy", "buy", "sell", "hold", "abstain", "buy"}
+	for k, a := range actions {
+		inf.AppendPrediction(Prediction{Action: a, T3: dt.AddDate(0, 0, k), Probability: 1, Weight: 1})
+	}
+	profitable := []bool{true, false, false, true, true}
+	for k, p := range profitable {
+		inf.FinalizePrediction(dt.AddDate(0, 0, k), dt.AddDate(0, 0, 10), p)
+	}
+
+	//---------------------------------------------------------------
+	// buy/profitable and sell/not profitable are correct, the second
+	// buy is wrong, hold and abstain are not judged, the last buy is
+	// still open.
+	//---------------------------------------------------------------
+	ps := NewPredictionStats(inf.GetMyPredictions())
+	want := PredictionStats{Predictions: 6, Active: 5, Judged: 3, Correct: 2}
+	if ps != want {
+		t.Fatalf("expected %+v, got %+v", want, ps)
+	}
+	if math.Abs(inf.Accuracy()-0.6) > 1e-9 {
+		t.Errorf("expected an accuracy of 0.6, got %f", inf.Accuracy())
+	}
+
+	mi := db.Mim.MInfluencerSubclasses["Gold"]
+	mi.FitnessW1, mi.FitnessW2 = 0.75, 0.25
+	db.Mim.MInfluencerSubclasses["Gold"] = mi
+	x := inf.CalculateFitnessScore()
+	if wantx := 0.75*2/3 + 0.25*5/6; math.Abs(x-wantx) > 1e-9 {
+		t.Errorf("expected a fitness of %f, got %f", wantx, x)
+	}
+
+	//---------------------------------------------------------------
+	// Restoring predictions (as a checkpoint does) recomputes the
+	// running accuracy and the fitness.
+	//---------------------------------------------------------------
+	inf.SetMyPredictions(inf.GetMyPredictions()[:1])
+	if math.Abs(inf.Accuracy()-2.0/3) > 1e-9 || inf.IsFitnessCalculated() {
+		t.Errorf("expected an accuracy of 0.667 and no fitness, got %f, %v", inf.Accuracy(), inf.IsFitnessCalculated())
+	}
+	if x = inf.CalculateFitnessScore(); math.Abs(x-1) > 1e-9 {
+		t.Errorf("expected a fitness of 1, got %f", x)
+	}
+	inf.SetMyPredictions(nil)
+	if x = inf.CalculateFitnessScore(); x != 0 || inf.Accuracy() != 0.5 {
+		t.Errorf("expected a fitness of 0 and an accuracy of 0.5, got %f, %f", x, inf.Accuracy())
+	}
+}
+
+// TestAccuracyWeightedVotes checks that each vote is weighted by the
+// Influencer's accuracy when AccuracyWeightedVotes is set
+func TestAccuracyWeightedVotes(t *testing.T) {
+	f, _ := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}")
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	for k := 0; k < 3; k++ {
+		inv.Influencers[0].AppendPrediction(Prediction{Action: "buy", T3: dt.AddDate(0, 0, -k-1)})
+		inv.Influencers[0].FinalizePrediction(dt.AddDate(0, 0, -k-1), dt, true)
+	}
+
+	for _, weighted := range []bool{false, true} {
+		inv.cfg.AccuracyWeightedVotes = weighted
+		coa, err := inv.DecideCourseOfAction(dt)
+		if err != nil {
+			t.Fatalf("DecideCourseOfAction returned error: %s", err)
+		}
+		if len(coa.Predictions) != 2 {
+			t.Fatalf("expected 2 predictions, got %d", len(coa.Predictions))
+		}
+		for k, w := range []float64{0.8, 0.5} {
+			if !weighted {
+				w = 1
+			}
+			if got := coa.Predictions[k].Weight; math.Abs(got-w) > 1e-9 {
+				t.Errorf("weighted=%v, %s: expected a weight of %f, got %f", weighted, coa.Predictions[k].Metric, w, got)
+			}
+		}
+	}
+}
+
+// TestInfluencerReport runs a simulation with the influencer report and
+// checks that it has a row for every Influencer of every generation.
+func TestInfluencerReport(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.AccuracyWeightedVotes = true
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	var s Simulator
+	s.ResetSimulator()
+	s.SqltDB = openSimTestSqlt(t)
+	s.InfluencerReport = true
+	if err := s.Init(cfg, db, nil, false, false); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	s.Run()
+
+	b, err := os.ReadFile(cfg.GenerateFName("infrep"))
+	if err != nil {
+		t.Fatalf("could not read the influencer report: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	rows := map[string]int{}
+	predictions := 0
+	for _, l := range lines[1:] {
+		cols := strings.Split(l, ",")
+		rows[cols[0]]++
+		n, err := strconv.Atoi(cols[4])
+		if err != nil {
+			t.Fatalf("bad Predictions column in %s", l)
+		}
+		predictions += n
+		if x, err := strconv.ParseFloat(cols[10], 64); err != nil || x < 0 || x > 1 {
+			t.Errorf("bad Fitness column in %s", l)
+		}
+	}
+	if len(rows) != 2 || predictions == 0 {
+		t.Fatalf("expected rows with predictions for 2 generations, got:\n%s", b)
+	}
+
+	//---------------------------------------------------------------
+	// The last generation is still in s.Investors
+	//---------------------------------------------------------------
+	n := 0
+	for i := range s.Investors {
+		n += len(s.Investors[i].Influencers)
+	}
+	if rows["2"] != n {
+		t.Errorf("expected %d rows for generation 2, got %d", n, rows["2"])
+	}
+}
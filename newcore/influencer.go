@@ -3,7 +3,6 @@ package newcore
 import (
 	"time"
 
-	"github.com/stmansour/psim/newdata"
 	"github.com/stmansour/psim/util"
 )
 
@@ -13,22 +12,21 @@ import (
 // its own performance.
 // -----------------------------------------------------------------------------
 type Prediction struct {
-	Action        string                        // buy or hold
-	Probability   float64                       // probability that the action is correct
-	Weight        float64                       // how heavily should this prediction weigh in the overall decision
-	Delta1        int                           // research start offset
-	Delta2        int                           // research stop offset
-	T3            time.Time                     // date of buy
-	Recs          []*newdata.EconometricsRecord // one, two, or more records of data, depending on the LocaleType
-	Fields        []newdata.FieldSelector       // names of database fields
-	Val1          float64                       // value or ratio at time T1
-	Val2          float64                       // value ratio at time T2
-	Metric        string                        // specific influencer type
-	ID            string                        // id of this influencer
-	Correct       bool                          // was this profitable (correct)?
-	Completed     bool                          // has this Prediction been Finalized
-	AvgDelta      float64                       // average delta between T1 and T2
-	StdDevSquared float64                       // standard deviation squared of delta over cfg.HoldWindowStatsLookBack period (365 days by default)
+	Action        string    // buy or hold
+	Probability   float64   // probability that the action is correct
+	Weight        float64   // how heavily should this prediction weigh in the overall decision
+	Delta1        int       // research start offset
+	Delta2        int       // research stop offset
+	T3            time.Time // date of buy
+	Val1          float64   // value or ratio at time T1
+	Val2          float64   // value ratio at time T2
+	Metric        string    // specific influencer type
+	ID            string    // id of this influencer
+	Correct       bool      // was this profitable (correct)?
+	Completed     bool      // has this Prediction been Finalized
+	AvgDelta      float64   // average delta between T1 and T2
+	StdDevSquared float64   // standard deviation squared of delta over the Influencer's look-back period (cfg.HoldWindowStatsLookBack, 365 days by default)
+	VarFactor     float64   // the StdDevVariationFactor used for this prediction, 0 if none was used
 }
 
 // Influencer is a base class / struct definition for the types of objects that will
@@ -42,6 +40,7 @@ type Influencer interface {
 	SetID()
 	Subclass() string
 	GetMetric() string
+	GetPair() string
 	SetDelta1(d int)
 	SetDelta2(d int)
 	SetAppConfig(cfg *util.AppConfig)
@@ -62,6 +61,7 @@ type Influencer interface {
 
 	AppendPrediction(pr Prediction)
 	FinalizePrediction(t3, t4 time.Time, profitable bool)
+	Accuracy() float64
 	GetLenMyPredictions() int
 	GetMyPredictions() []Prediction
 	GetPrediction(t3 time.Time) (*Prediction, error)
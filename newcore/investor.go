@@ -3,7 +3,7 @@ package newcore
 import (
 	"fmt"
 	"log"
-	"math/rand"
+	"math"
 	"sort"
 	"strings"
 	"time"
@@ -15,28 +15,25 @@ import (
 // CourseOfAction encapsulates the elements of an Influencer's prediction
 // ----------------------------------------------------------------------------
 type CourseOfAction struct {
-	Action     string
-	ActionPct  float64
-	BuyVotes   float64
-	SellVotes  float64
-	HoldVotes  float64
-	TotalVotes float64
-	Abstains   float64
+	Action      string
+	ActionPct   float64
+	BuyVotes    float64
+	SellVotes   float64
+	HoldVotes   float64
+	TotalVotes  float64
+	Abstains    float64
+	Predictions []Prediction // one per Influencer, in the order of Investor.Influencers
 }
 
-// InvestmentStrategyMap links the name of the strategy to an index number
+// InvestmentStrategyMap links the name of the strategy to an index number.
+// It is filled by RegisterCOAStrategy.
 // ----------------------------------------------------------------------------
-var InvestmentStrategyMap = map[string]int{
-	"DistributedDecision": 0,
-	"MajorityRules":       1,
-}
+var InvestmentStrategyMap = map[string]int{}
 
-// InvestmentStrategies is a slice of investment strategy names
+// InvestmentStrategies is a slice of investment strategy names in the order
+// they were registered by RegisterCOAStrategy
 // ----------------------------------------------------------------------------
-var InvestmentStrategies = []string{
-	"DistributedDecision",
-	"MajorityRules",
-}
+var InvestmentStrategies []string
 
 // Investor is the class that manages one or more influencers to pursue an
 // investment strategy in currency exchange.
@@ -60,11 +57,26 @@ type Investor struct {
 	Fitness           float64           // Fitness score calculated at the end of a simulation cycle
 	CreatedByDNA      bool              // some init steps must be skipped if it's created from DNA
 	Strategy          int               // which strategy to use for predictions
+	StrategyParams    StrategyParams    // the values of the genes of Strategy, nil if it has none
 	ID                string            // unique id for this investor
 	Parented          int64             // how many times was this Investor a parent for the next gen?
 	IDGenerated       bool              // true if ID was generated
 	Elite             bool              // an ephemeral flag, if true it means that it may propagate the next generation if we're preserving the elites
 	COATrace          Trace             // a struct to keep track of trace information
+	exRef             newdata.MetricRef // the C1C2 exchange rate, resolved on first use by exchangeRef
+	rng               *util.RandStream  // this Investor's random numbers, seeded by the Factory
+	PVSeries          []PVSample        // portfolio value on each trading day of this generation
+	Risk              RiskMetrics       // risk-adjusted metrics, set at the end of each generation
+	Objectives        Objectives        // scores used in multi-objective mode, set at the end of each generation
+	Rules             *RuleSet          // rule tree Investors only: the buy and sell rules, nil for Investors that decide with Influencers
+	Sizing            string            // position sizing policy, a gene when cfg.EvolvePositionSizing is set. If empty cfg.PositionSizing is used
+	Exposure          Exposure          // how much of its capital the Investor put to work, set at the end of each generation
+	Carry             Carry             // interest earned on the balances this generation
+	ExecCost          float64           // C1 lost to the spread and slippage of the execution model this generation
+	exec              ExecutionModel    // decides the exchange rate of each conversion, set on first use
+	lotIDs            []string          // specificid: the ids of the Investments to sell first, see SelectLots
+	Sleeves           []Investor        // portfolio Investors only: one Investor per pair traded this generation, see portfolio.go
+	carry             carryState        // where the interest accrual is
 	// maxPredictions    map[string]int           // max predictions indexed by Influencer subclass, set by simulator at the end of each simulation cycle
 	// maxPredictions    map[string]int    // max predictions indexed by Influencer subclass, set by simulator at the end of each simulation cycle, used when calculating fitness
 }
@@ -81,6 +93,7 @@ type SellInfo struct {
 	ChunkProfit   float64   // amount of profit in this chunk
 	Fee           float64   // cost of making this transaction
 	Profitable    bool      // was this exchange profitable
+	Exit          string    // why it was sold: sell, stoploss, takeprofit, trailingstop or maxhold
 }
 
 // Investment describes a full transaction when the Investor decides to buy.
@@ -108,7 +121,11 @@ type Investment struct {
 	Completed   bool       // true when the entire original buy amount of C2 has been exchanged for C1
 	Chunks      []SellInfo // was this a profitable investment?  Can be multiple if sold across multiple sales.
 	RetryCount  int        // how many times was this retried
-	// Delta4      int       // t4 = t3 + Delta4 - "sell" date
+	Utilization float64    // fraction of the C1 balance spent on T3
+	Exposure    float64    // fraction of the portfolio value held in C2 after the exchange on T3
+	BestER      float64    // lowest exchange rate since T3, where the C2 was worth the most. Used by the trailing stop
+	CarryC2     float64    // interest earned by the C2 of this Investment while it was held, in C2
+	Pair        string     // portfolio Investors only: the pair of the sleeve that made the Investment
 }
 
 var rnderr = float64(0.01) // if we have less than this amount of C2 remaining, just assume we're done.
@@ -126,14 +143,26 @@ func (i *Investor) EnsureID() {
 	}
 }
 
+// GenerateRefNo returns a new reference number drawn from the Investor's
+// random number stream. Investors that were not created by the Factory do
+// not have a stream, for them it falls back to util.GenerateRefNo.
+// --------------------------------------------------------------------------------
+func (i *Investor) GenerateRefNo() string {
+	if i == nil || i.rng == nil {
+		return util.GenerateRefNo()
+	}
+	return util.GenerateRefNoFrom(i.rng)
+}
+
 // ShortID returns the first 5 characters of the ID
 // --------------------------------------------------------------------------------
 func (i *Investor) ShortID() string {
 	return i.ID[:5]
 }
 
-// SelectNUniqueSubclasses shuffles the indexes to the map of MInfluencerSubclasses
-// then selects the first n, and returns the list
+// SelectNUniqueSubclasses shuffles a copy of the indexes to the map of
+// MInfluencerSubclasses then selects the first n, and returns the list. The
+// Mim is shared by all Investors, so it must not be changed.
 // ----------------------------------------------------------------------------------
 func (i *Investor) SelectNUniqueSubclasses(n int) []newdata.MInfluencerSubclass {
 	if n <= 0 || n > len(i.db.Mim.MInfluencerSubclasses) {
@@ -141,13 +170,15 @@ func (i *Investor) SelectNUniqueSubclasses(n int) []newdata.MInfluencerSubclass
 		return nil
 	}
 
-	// Shuffle the keys slice
-	rand.Shuffle(len(i.db.Mim.MInfluencerSubclassMetricNames), func(k, j int) {
-		i.db.Mim.MInfluencerSubclassMetricNames[k], i.db.Mim.MInfluencerSubclassMetricNames[j] = i.db.Mim.MInfluencerSubclassMetricNames[j], i.db.Mim.MInfluencerSubclassMetricNames[k]
+	// Shuffle a copy of the keys slice
+	keys := make([]string, len(i.db.Mim.MInfluencerSubclassMetricNames))
+	copy(keys, i.db.Mim.MInfluencerSubclassMetricNames)
+	i.rng.Shuffle(len(keys), func(k, j int) {
+		keys[k], keys[j] = keys[j], keys[k]
 	})
 
 	selected := make([]newdata.MInfluencerSubclass, n)
-	for j, key := range i.db.Mim.MInfluencerSubclassMetricNames[:n] {
+	for j, key := range keys[:n] {
 		selected[j] = i.db.Mim.MInfluencerSubclasses[key]
 	}
 
@@ -166,6 +197,9 @@ func (i *Investor) Init(cfg *util.AppConfig, f *Factory, db *newdata.Database) {
 	i.Fitness = float64(0)
 	i.factory = f
 	i.db = db
+	if i.rng == nil {
+		i.rng = f.newInvestorRand()
+	}
 
 	if !i.CreatedByDNA {
 		i.W1 = 1
@@ -179,10 +213,24 @@ func (i *Investor) Init(cfg *util.AppConfig, f *Factory, db *newdata.Database) {
 		return
 	}
 
+	if i.cfg.EvolvePositionSizing {
+		i.Sizing = util.PositionSizings[i.rng.Intn(len(util.PositionSizings))]
+	}
+
+	//------------------------------------------------------------------
+	// Some Investors decide with rule trees rather than Influencers
+	//------------------------------------------------------------------
+	if i.cfg.RuleTreeInvestors > 0 && i.rng.Float64() < i.cfg.RuleTreeInvestors {
+		i.Rules = f.NewRuleSet(i.rng)
+		return
+	}
+
 	//------------------------------------------------------------------
 	// Pick a strategy for this influencer to use
 	//------------------------------------------------------------------
-	i.Strategy = util.RandomInRange(0, len(InvestmentStrategies)-1) // 0 = Distributed Decsion, 1 = majority wins
+	choices := strategyChoices(i.cfg)
+	i.Strategy = choices[i.rng.InRange(0, len(choices)-1)]
+	i.StrategyParams = randomStrategyParams(i.Strategy, i.rng)
 
 	//------------------------------------------------------------------
 	// Create a team of influencers.
@@ -192,7 +240,7 @@ func (i *Investor) Init(cfg *util.AppConfig, f *Factory, db *newdata.Database) {
 	if max > len(i.db.Mim.MInfluencerSubclasses) {
 		log.Fatalf("The config file has MaxInfluencers set to %d, however there are only %d Influencers available.\n", max, len(i.db.Mim.MInfluencerSubclasses))
 	}
-	numInfluencers := util.RandomInRange(min, max) // create this many
+	numInfluencers := i.rng.InRange(min, max) // create this many
 	inflist := i.SelectNUniqueSubclasses(numInfluencers)
 	for j := 0; j < len(inflist); j++ {
 		subclass := inflist[j].Subclass
@@ -212,9 +260,24 @@ func (i *Investor) Init(cfg *util.AppConfig, f *Factory, db *newdata.Database) {
 //
 //	Delta4=5;Influencers=[{subclass,var1=val1,var2=val2,...}|{subclass,var1=val1,var2=val2,...}|...]
 //
+// The genes of the Investor's strategy, if it has any, follow Strategy. The
+// position sizing policy follows them if it is a gene:
+//
+//	Strategy=Supermajority;QuorumPct=0.5;SupermajorityPct=0.7;Sizing=kelly;InvW1=0.5000;...
+//
+// A rule tree Investor has its rules in place of the Influencers:
+//
+//	Strategy=RuleTree;InvW1=0.5000;InvW2=0.5000;Buy=gt(chg(EXClose,5),0.01);Sell=lt(z(C1:DR,1),-0.5)
+//
 // ----------------------------------------------------------------------------
 func (i *Investor) DNA() string {
-	s := fmt.Sprintf("Strategy=%s;InvW1=%6.4f;InvW2=%6.4f;Influencers=[", InvestmentStrategies[i.Strategy], i.W1, i.W2)
+	if i.Rules != nil {
+		s := fmt.Sprintf("Strategy=%s;%sInvW1=%6.4f;InvW2=%6.4f;Buy=%s;Sell=%s}", RuleTreeStrategy, i.sizingDNA(), i.W1, i.W2, i.Rules.Buy, i.Rules.Sell)
+		i.IDGenerated = true
+		i.ID = util.HashDNA(s)
+		return fmt.Sprintf("{Investor;ID=%s;", i.ID) + s
+	}
+	s := fmt.Sprintf("Strategy=%s;%s%sInvW1=%6.4f;InvW2=%6.4f;Influencers=[", InvestmentStrategies[i.Strategy], strategyParamsDNA(i.Strategy, i.StrategyParams), i.sizingDNA(), i.W1, i.W2)
 	//----------------------------------------------------------------------------
 	// only sort them if this is the first time DNA has been asked for...
 	//----------------------------------------------------------------------------
@@ -268,7 +331,7 @@ func (i *Investor) DecideCourseOfAction(T3 time.Time) (CourseOfAction, error) {
 	//---------------------------------------------------------------------
 	pv := i.PortfolioValue(T3)
 	if pv < i.StopLossThreshold {
-		if err := i.ExecuteSell(T3, 1); err != nil {
+		if err := i.executeSell(T3, 1, ExitStopLoss); err != nil {
 			return coa, err
 		}
 		i.StopLossThreshold = (1 - i.cfg.StopLoss) * i.BalanceC1
@@ -278,6 +341,10 @@ func (i *Investor) DecideCourseOfAction(T3 time.Time) (CourseOfAction, error) {
 		i.StopLossCount++
 	}
 
+	if i.Rules != nil {
+		return i.ruleCourseOfAction(T3, coa)
+	}
+
 	//---------------------------------------------------------------------
 	// No stop-loss. So carry on with determiniing the coarse of action
 	//---------------------------------------------------------------------
@@ -294,6 +361,9 @@ func (i *Investor) DecideCourseOfAction(T3 time.Time) (CourseOfAction, error) {
 		pred.Metric = i.Influencers[j].GetMetric()
 		pred.ID = i.Influencers[j].GetID()
 		pred.Correct = false // don't know yet
+		if i.cfg.AccuracyWeightedVotes {
+			pred.Weight = i.Influencers[j].Accuracy() // trust influencers in proportion to how well they have done so far
+		}
 		recs = append(recs, *pred)
 
 	}
@@ -318,7 +388,10 @@ func (i *Investor) DecideCourseOfAction(T3 time.Time) (CourseOfAction, error) {
 		}
 	}
 
-	setCourseOfAction(&coa, InvestmentStrategies[i.Strategy]) // use course of action strategy called out in the config file
+	coa.Predictions = recs
+	if err := setCourseOfAction(&coa, InvestmentStrategies[i.Strategy], i.StrategyParams); err != nil { // use the Investor's course of action strategy
+		return coa, err
+	}
 	if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
 		for j := 0; j < len(recs); j++ {
 			i.FormatPrediction(&recs[j], T3)
@@ -330,16 +403,15 @@ func (i *Investor) DecideCourseOfAction(T3 time.Time) (CourseOfAction, error) {
 }
 
 // setCourseOfAction sets the Action and ActionPct based on influencers input
+// using the registered strategy method and the Investor's params for it
 // ----------------------------------------------------------------------------
-func setCourseOfAction(coa *CourseOfAction, method string) error {
+func setCourseOfAction(coa *CourseOfAction, method string, params StrategyParams) error {
 	coa.TotalVotes = coa.BuyVotes + coa.HoldVotes + coa.SellVotes // even if it's already been added, this won't hurt anything
-	switch method {
-	case "DistributedDecision":
-		return distributedDecisionCOA(coa)
-	case "MajorityRules":
-		return majorityRulesCOA(coa)
+	k, ok := InvestmentStrategyMap[method]
+	if !ok {
+		return fmt.Errorf("course of action method not recognized: %s", method)
 	}
-	return fmt.Errorf("course of action method not recognized: %s", method)
+	return coaStrategies[k].Decide(coa, params)
 }
 
 // distributedDecisionCOA accommodates all votes in its course of action
@@ -397,9 +469,24 @@ func majorityRulesCOA(coa *CourseOfAction) error {
 // err - any error encountered
 // ------------------------------------------------------------------------------
 func (i *Investor) DailyRun(T3 time.Time, winddown bool) error {
+	if i.isPortfolio() {
+		return i.portfolioDailyRun(T3, winddown)
+	}
 	if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
 		fmt.Printf("%s - Investor: %s\n", T3.Format("Jan _2, 2006"), i.ID)
 	}
+
+	//---------------------------------------------------------------------
+	// Interest accrues, then the exit rules look at each Investment
+	// before the Influencers vote
+	//---------------------------------------------------------------------
+	if !i.cfg.PredictionMode {
+		i.accrueCarry(T3)
+		if err := i.checkExits(T3); err != nil {
+			return err
+		}
+	}
+
 	coa, err := i.DecideCourseOfAction(T3)
 	if err != nil {
 		return err
@@ -412,9 +499,19 @@ func (i *Investor) DailyRun(T3 time.Time, winddown bool) error {
 		if winddown {
 			return nil
 		}
+		n := len(i.Investments)
 		if err = i.ExecuteBuy(T3, coa.ActionPct); err != nil {
 			return err
 		}
+		//-------------------------------------------------------------
+		// If we bought, each Influencer keeps its prediction. It is
+		// finalized when the investment is sold.
+		//-------------------------------------------------------------
+		if len(i.Investments) > n {
+			for j := 0; j < len(i.Influencers); j++ {
+				i.Influencers[j].AppendPrediction(coa.Predictions[j])
+			}
+		}
 
 	case "sell":
 		if err = i.ExecuteSell(T3, coa.ActionPct); err != nil {
@@ -432,6 +529,7 @@ func (i *Investor) DailyRun(T3 time.Time, winddown bool) error {
 	if i.cfg.CrucibleMode && i.cfg.DNALog {
 		i.SaveCrucibleStats(T3)
 	}
+	i.recordPV(T3)
 
 	return nil
 }
@@ -466,13 +564,18 @@ func (i *Investor) ExecuteBuy(T3 time.Time, pct float64) error {
 	}
 
 	var inv Investment
-	inv.id = util.GenerateRefNo()
-	inv.T3C1 = i.cfg.StdInvestment * pct
-	if i.BalanceC1 < i.cfg.StdInvestment {
-		inv.T3C1 = i.BalanceC1
+	amt, err := NewPositionSizer(i.positionSizing(), i.cfg).Size(i, T3, pct)
+	if err != nil {
+		return err
 	}
+	inv.T3C1 = math.Min(amt, i.BalanceC1)
+	if inv.T3C1 <= 0 {
+		return nil // the sizing policy says not to buy
+	}
+	inv.id = i.GenerateRefNo()
+	inv.Utilization = inv.T3C1 / i.BalanceC1
 	inv.T3 = T3
-	s := i.factory.PrefixMetricC1C2("EXClose")
+	s := i.exchangeSelector()
 	ss := []newdata.FieldSelector{s}
 	er3, err := i.db.Select(inv.T3, ss)
 	if err != nil {
@@ -481,8 +584,11 @@ func (i *Investor) ExecuteBuy(T3 time.Time, pct float64) error {
 	if er3 == nil {
 		return fmt.Errorf("*** ERROR *** SellConversion: ExchangeRate Record for %s not found", inv.T3.Format("1/2/2006"))
 	}
+	er := er3.Fields[s.FQMetric()].Value // EXClose on T3
+	if inv.ERT3, err = i.executionRate(T3, er, true); err != nil {
+		return err
+	}
 
-	inv.ERT3 = er3.Fields[s.FQMetric()].Value                // exchange rate on T3
 	inv.T3C2Buy = inv.T3C1 * inv.ERT3                        // amount of C2 we purchased on T3
 	inv.Fee = (inv.T3C1 * i.cfg.TxnFeeFactor) + i.cfg.TxnFee // cost of the transaction: flat fee plus percentage is here because a buy is wholly done here, not in chunks as with sells
 	inv.T4C2Sold = 0                                         // just being explicit, haven't sold any of it yet
@@ -490,7 +596,10 @@ func (i *Investor) ExecuteBuy(T3 time.Time, pct float64) error {
 	i.BalanceC2 += inv.T3C2Buy                               // to purchase this much more C2
 	inv.T3BalanceC1 = i.BalanceC1                            // C1 balance after exchange
 	inv.T3BalanceC2 = i.BalanceC2                            // C2 balance after exchange
+	inv.Exposure = inv.exposure()                            // fraction of the portfolio value in C2 after exchange
+	inv.BestER = er                                          // the C2 is worth the most so far on the day it was bought
 	i.Investments = append(i.Investments, inv)               // add it to the list of investments
+	i.ExecCost += inv.T3C1 * (er - inv.ERT3) / er            // C1 value of the C2 the spread and slippage cost
 
 	if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
 		i.showBuy(&inv)
@@ -508,6 +617,12 @@ func (i *Investor) ExecuteBuy(T3 time.Time, pct float64) error {
 // err - any error encountered
 // -----------------------------------------------------------------------------
 func (i *Investor) ExecuteSell(T4 time.Time, pct float64) error {
+	return i.executeSell(T4, pct, ExitSell)
+}
+
+// executeSell is ExecuteSell. The chunks it sells are tagged with exit.
+// -----------------------------------------------------------------------------
+func (i *Investor) executeSell(T4 time.Time, pct float64, exit string) error {
 	//------------------------------------------
 	// Make sure we have something to sell...
 	//------------------------------------------
@@ -515,40 +630,46 @@ func (i *Investor) ExecuteSell(T4 time.Time, pct float64) error {
 		return nil
 	}
 	sellAmount := pct * i.BalanceC2 // the action was to sell pct * i.BalanceC2
-	i.settleInvestment(T4, sellAmount)
+	i.settleInvestment(T4, sellAmount, exit)
 
 	return nil
 }
 
 // PortfolioValue returns the value of the Investors portfolio at time t. The
 // portfolio value is returned in terms of C1 and it is the current BalanceC1
-// plus BalanceC2 converted to C1 at t.
+// plus BalanceC2 converted to C1 at t. The value of a portfolio Investor is
+// the sum of the values of its sleeves.
 // ------------------------------------------------------------------------------
 func (i *Investor) PortfolioValue(t time.Time) float64 {
+	if len(i.Sleeves) > 0 {
+		return i.portfolioValue(t)
+	}
 	if i.BalanceC2 == 0 {
 		return i.BalanceC1
 	}
-	s := i.factory.PrefixMetricC1C2("EXClose")
-	ss := []newdata.FieldSelector{}
-	ss = append(ss, s)
-	er, err := i.db.Select(t, ss) // exchange rate for C2 at time t
-	if err != nil {
-		log.Fatalf("Error getting exchange close rate")
-	}
-	if er == nil {
+	v, err := i.db.Value(i.exchangeRef(), t) // exchange rate for C2 at time t
+	switch err {
+	case nil:
+		C2 := i.BalanceC2 / v.Value // amount of C1 we get for BalanceC2 at this exchange rate
+		return i.BalanceC1 + C2
+	case newdata.ErrNoRecord:
 		fmt.Printf("Please check your database. EXClose value for %s not found\n", t.Format("1/2/2006"))
+	case newdata.ErrNoValue:
+		// no exchange rate on t, the portfolio cannot be valued
+	default:
+		log.Fatalf("Error getting exchange close rate")
 	}
-	a := s.FQMetric()
-	pv := float64(0.0)
-	if len(a) > 0 {
-		if v, ok := er.Fields[a]; ok {
-			C2 := i.BalanceC2 / v.Value // amount of C1 we get for BalanceC2 at this exchange rate
-			pv = i.BalanceC1 + C2
-		}
-	} else {
-		fmt.Printf("*** WARNING **** PortfolioValue: ExchangeRate Record for %s not found\n", t.Format("1/2/2006"))
+	return 0
+}
+
+// exchangeRef returns the reference to the C1C2 exchange rate, resolving it
+// on first use.
+// ------------------------------------------------------------------------------
+func (i *Investor) exchangeRef() *newdata.MetricRef {
+	if len(i.exRef.Field.Metric) == 0 {
+		i.exRef = newdata.NewMetricRef(i.exchangeSelector())
 	}
-	return pv
+	return &i.exRef
 }
 
 // settleInvestment - this code was moved to a method as it needed to be done
@@ -561,6 +682,7 @@ func (i *Investor) PortfolioValue(t time.Time) float64 {
 //	   t4         - sell date
 //	   sellAmount - the amount we're looking to sell.  Could be greater than, equal to,
 //		               or less than the amount of C2 we gained in this Investment.
+//	   exit       - why we're selling, it is saved in each chunk
 //
 // RETURNS
 //
@@ -568,15 +690,14 @@ func (i *Investor) PortfolioValue(t time.Time) float64 {
 //		  any critical error encountered
 //
 // -----------------------------------------------------------------------------
-func (i *Investor) settleInvestment(t4 time.Time, sellAmount float64) (float64, error) {
+func (i *Investor) settleInvestment(t4 time.Time, sellAmount float64, exit string) (float64, error) {
 	var err error
 	var thisSaleC2 float64
-	var thisSaleC1 float64
 
 	//-------------------------------------------------
 	// Save the exchange rate on the day of sale, t4
 	//-------------------------------------------------
-	s := i.factory.PrefixMetricC1C2("EXClose")
+	s := i.exchangeSelector()
 	ss := []newdata.FieldSelector{}
 	ss = append(ss, s)
 	er4, err := i.db.Select(t4, ss)
@@ -591,82 +712,105 @@ func (i *Investor) settleInvestment(t4 time.Time, sellAmount float64) (float64,
 	}
 
 	//-------------------------------------------------------------------
-	// Now that we have today's exchange rate... sort the investments
-	// by ERT4 decending.  We do this so that we sell everything we can
-	// at the greatest loss... per Joe, this gives us tax benefits. This
-	// is accomplished by processing the Investments slice sorted by
-	// ERT4 descending. Profitability is inversely proportional to T4 EXClose.
+	// Now that we have today's exchange rate... set ERT4 on every open
+	// Investment. Which of them we sell from first is decided by the
+	// LotSelection policy. By default it is the one with the greatest
+	// loss... per Joe, this gives us tax benefits.
 	//-------------------------------------------------------------------
+	er := er4.Fields[s.FQMetric()].Value // EXClose on T4
+	rate, err := i.executionRate(t4, er, false)
+	if err != nil {
+		return sellAmount, err
+	}
 	for j := 0; j < len(i.Investments); j++ {
 		if !i.Investments[j].Completed {
-			if er4.Fields[s.FQMetric()].Value < 0.0001 {
+			if er < 0.0001 {
 				log.Panicf("Invalid exchange rate on %s: %12.6f\n", er4.Date.Format("1/2/2006"), er4.Fields[s.Metric].Value)
 			}
-			i.Investments[j].ERT4 = er4.Fields[s.FQMetric()].Value // exchange rate on T4... just applies to this sale, we don't touch completed Investments
+			i.Investments[j].ERT4 = rate // exchange rate we get on T4... just applies to this sale, we don't touch completed Investments
 		}
 	}
-	i.sortInvestmentsDescending()
 
 	//-----------------------------------------------------------------
 	// Now spin through the investments selling "sellAmount" of C2
 	//-----------------------------------------------------------------
-	for j := 0; j < len(i.Investments) && sellAmount > rnderr; j++ {
-		if i.Investments[j].Completed {
-			continue // skip if already processed
+	for _, j := range i.lotOrder(rate) {
+		if sellAmount <= rnderr {
+			break
 		}
 
 		//---------------------------------------------------------------------------------
 		// If amount we're selling is greater than or equal to what's in this investment
 		// then we'll sell it all.  Otherwise we'll sell enough to cover sellAmount
 		//---------------------------------------------------------------------------------
-		remaining := i.Investments[j].T3C2Buy - i.Investments[j].T4C2Sold // remaining is how much C2 we bought in this Investment minus what we've already sold
+		remaining := i.Investments[j].remainingC2() // remaining is how much C2 we bought in this Investment, plus its interest, minus what we've already sold
 		if sellAmount >= remaining {
 			thisSaleC2 = remaining // sell everything we have left
 		} else {
 			thisSaleC2 = sellAmount // sellAmount is < what we have. So we'll sell a portion
 		}
-		sellAmount -= thisSaleC2                        // this will be what's left to sell, now that we know how much to sell in this exchange
-		thisSaleC1 = thisSaleC2 / i.Investments[j].ERT4 // This is the sell. The Amount of C1 we got back by selling "sellAmount"
-		fee := thisSaleC1 * i.cfg.TxnFeeFactor          // for each chunk, add the fee factor
-		i.Investments[j].T4C2Sold += thisSaleC2         // add what we're selling now to what's already been sold
-		i.Investments[j].T4C1 += thisSaleC1             // add the C1 we got back to the cumulative total for this investment
-		i.BalanceC1 += (thisSaleC1 - fee)               // we recovered this much C1...
-		i.BalanceC2 -= thisSaleC2                       // by selling this C2
-
-		chunkt3c1 := thisSaleC2 / i.Investments[j].ERT3 // amount of C1 in this transaction
-
-		//------------------------------------------------------------------------
-		// Create a new chunk for this investment to capture all relevant details
-		//------------------------------------------------------------------------
-		p := i.Investments[j].ERT4 < i.Investments[j].ERT3 // this is the profitability condition at its simplest
-		chunk := SellInfo{
-			T4:            t4,                        // date of exchange
-			ERT4:          i.Investments[j].ERT4,     // exchange rate used in the exchange
-			T4C2Sold:      thisSaleC2,                // how much was sold in this chunk
-			T4C2Remaining: i.Investments[j].T4C2Sold, // how much C2 remains from the original exchange
-			T4C1:          thisSaleC1,                // amount of C1 resulting from the exchange
-			Profitable:    p,                         // was this exchange profitable
-			ChunkProfit:   thisSaleC1 - chunkt3c1,    // how much profit
-			Fee:           fee,                       // cost of this transaction
-		}
-		i.Investments[j].Chunks = append(i.Investments[j].Chunks, chunk) // was this transaction profitable?  Save it in the list
-
-		i.Investments[j].Completed = (i.Investments[j].T4C2Sold+rnderr >= i.Investments[j].T3C2Buy) // we're completed when we've sold as much as we bought
+		sellAmount -= thisSaleC2 // this will be what's left to sell, now that we know how much to sell in this exchange
+		i.sellChunk(&i.Investments[j], t4, thisSaleC2, er, exit)
+	}
+	i.chargeFlatFee(t4)
 
-		i.Investments[j].T4BalanceC1 = i.BalanceC1 // amount of C1 after this exchange
-		i.Investments[j].T4BalanceC2 = i.BalanceC2 // amount of C2 after this exchange
-		i.Investments[j].T4 = t4                   // the date on which this particular sale was done (we don't save all dates of sale)
+	return sellAmount, nil
+}
 
-		//-------------------------------------------------------------
-		// Update each Influencer's predictions...
-		//-------------------------------------------------------------
-		for k := 0; k < len(i.Influencers); k++ {
-			i.Influencers[k].FinalizePrediction(i.Investments[j].T3, t4, p)
-		}
-		if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
-			i.showSell(&i.Investments[j], thisSaleC1, thisSaleC2, fee)
-		}
+// sellChunk sells thisSaleC2 of the C2 of Investment m at its ERT4 and saves
+// the details of the sale in a new chunk tagged with exit. er is EXClose on
+// t4, the difference to ERT4 is the cost of the execution.
+// -----------------------------------------------------------------------------
+func (i *Investor) sellChunk(m *Investment, t4 time.Time, thisSaleC2, er float64, exit string) {
+	thisSaleC1 := thisSaleC2 / m.ERT4      // This is the sell. The Amount of C1 we got back by selling "sellAmount"
+	fee := thisSaleC1 * i.cfg.TxnFeeFactor // for each chunk, add the fee factor
+	m.T4C2Sold += thisSaleC2               // add what we're selling now to what's already been sold
+	m.T4C1 += thisSaleC1                   // add the C1 we got back to the cumulative total for this investment
+	i.BalanceC1 += (thisSaleC1 - fee)      // we recovered this much C1...
+	i.BalanceC2 -= thisSaleC2              // by selling this C2
+
+	chunkt3c1 := thisSaleC2 / m.ERT3 // amount of C1 in this transaction
+
+	i.ExecCost += thisSaleC2/er - thisSaleC1 // C1 lost to the spread and slippage
+
+	//------------------------------------------------------------------------
+	// Create a new chunk for this investment to capture all relevant details
+	//------------------------------------------------------------------------
+	p := m.ERT4 < m.ERT3 // this is the profitability condition at its simplest
+	chunk := SellInfo{
+		T4:            t4,                     // date of exchange
+		ERT4:          m.ERT4,                 // exchange rate used in the exchange
+		T4C2Sold:      thisSaleC2,             // how much was sold in this chunk
+		T4C2Remaining: m.T4C2Sold,             // how much C2 remains from the original exchange
+		T4C1:          thisSaleC1,             // amount of C1 resulting from the exchange
+		Profitable:    p,                      // was this exchange profitable
+		ChunkProfit:   thisSaleC1 - chunkt3c1, // how much profit
+		Fee:           fee,                    // cost of this transaction
+		Exit:          exit,                   // why it was sold
+	}
+	m.Chunks = append(m.Chunks, chunk) // was this transaction profitable?  Save it in the list
+
+	m.Completed = (m.remainingC2() <= rnderr) // we're completed when we've sold as much as we bought plus the interest
+
+	m.T4BalanceC1 = i.BalanceC1 // amount of C1 after this exchange
+	m.T4BalanceC2 = i.BalanceC2 // amount of C2 after this exchange
+	m.T4 = t4                   // the date on which this particular sale was done (we don't save all dates of sale)
+
+	//-------------------------------------------------------------
+	// Update each Influencer's predictions...
+	//-------------------------------------------------------------
+	for k := 0; k < len(i.Influencers); k++ {
+		i.Influencers[k].FinalizePrediction(m.T3, t4, p)
 	}
+	if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
+		i.showSell(m, thisSaleC1, thisSaleC2, fee)
+	}
+}
+
+// chargeFlatFee charges the flat transaction fee, if there is one, for a
+// sale on t4
+// -----------------------------------------------------------------------------
+func (i *Investor) chargeFlatFee(t4 time.Time) {
 	// One final fee... if there is an flat-fee for the transaction, add it here
 	if i.cfg.TxnFee > 0 {
 		fee := Investment{
@@ -688,15 +832,12 @@ func (i *Investor) settleInvestment(t4 time.Time, sellAmount float64) (float64,
 		}
 		i.Investments = append(i.Investments, fee)
 	}
-
-	return sellAmount, nil
 }
 
-// sortInvestmentsDescending uses the E
-func (i *Investor) sortInvestmentsDescending() {
-	sort.Slice(i.Investments, func(j, k int) bool {
-		return i.Investments[j].ERT4 > i.Investments[k].ERT4
-	})
+// isFlatFee returns true if m is a record of a flat fee made by
+// chargeFlatFee rather than a buy of C2
+func (m *Investment) isFlatFee() bool {
+	return m.T3C1 == 0
 }
 
 // CalculateFitnessScore calculates the fitness score for an Investor.
@@ -725,41 +866,31 @@ func (i *Investor) sortInvestmentsDescending() {
 //	correct decisions, even if those decisions didn't necessarily lead
 //	to the highest profit.
 //
+// If cfg.FitnessMetric names one of the risk metrics, that metric is the score
+// instead. The Investor's RiskMetrics must already be set. Negative scores are
+// set to 0.
+//
 // ------------------------------------------------------------------------------------
 func (i *Investor) CalculateFitnessScore() float64 {
 	if i.FitnessCalculated {
 		return i.Fitness
 	}
 
-	//-------------------------------------------------------
-	// Calculate correctness.  This will always be >= 0
-	//-------------------------------------------------------
-	correct := 0
-	total := 0
-	jlen := len(i.Investments)
-	for j := 0; j < jlen; j++ {
-		if i.Investments[j].Completed {
-			pl := i.Investments[j].Chunks
-			for k := 0; k < len(pl); k++ {
-				total++
-				if pl[k].Profitable {
-					correct++
-				}
-			}
+	if len(i.cfg.FitnessMetric) > 0 && i.cfg.FitnessMetric != util.FitnessDefault {
+		i.Fitness = i.Risk.RiskFitness(i.cfg.FitnessMetric)
+	} else {
+		correctness := i.Correctness()
+		profit := i.PortfolioValueC1 - i.cfg.InitFunds
+		weightedProfit := float64(0)
+		if i.maxProfit > 0 {
+			weightedProfit = float64(i.W1 * profit / i.maxProfit)
 		}
+		weightedCorrectness := float64(i.W2 * correctness)
+		i.Fitness = weightedProfit + weightedCorrectness
 	}
-	correctness := float64(0)
-	if total > 0 && correct > 0 {
-		correctness = float64(float64(correct) / float64(total))
+	if i.Rules != nil {
+		i.Fitness -= i.cfg.RuleParsimony * float64(i.Rules.Size()) // bloat control, the larger tree must earn its keep
 	}
-
-	profit := i.PortfolioValueC1 - i.cfg.InitFunds
-	weightedProfit := float64(0)
-	if i.maxProfit > 0 {
-		weightedProfit = float64(i.W1 * profit / i.maxProfit)
-	}
-	weightedCorrectness := float64(i.W2 * correctness)
-	i.Fitness = weightedProfit + weightedCorrectness
 	if i.Fitness < 0 {
 		i.Fitness = 0
 	}
@@ -792,6 +923,30 @@ func (i *Investor) CalculateFitnessScore() float64 {
 	return i.Fitness
 }
 
+// Correctness returns the fraction of the chunks sold from completed
+// Investments that were profitable. This will always be >= 0
+// ------------------------------------------------------------------------------------
+func (i *Investor) Correctness() float64 {
+	correct := 0
+	total := 0
+	jlen := len(i.Investments)
+	for j := 0; j < jlen; j++ {
+		if i.Investments[j].Completed {
+			pl := i.Investments[j].Chunks
+			for k := 0; k < len(pl); k++ {
+				total++
+				if pl[k].Profitable {
+					correct++
+				}
+			}
+		}
+	}
+	if total > 0 && correct > 0 {
+		return float64(correct) / float64(total)
+	}
+	return 0
+}
+
 func fitnessBonus(ar float64) float64 {
 	if ar >= 0.1 && ar < 0.15 {
 		return 2 + ar*5
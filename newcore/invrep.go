@@ -3,6 +3,7 @@ package newcore
 import (
 	"fmt"
 	"os"
+	"strings"
 	"time"
 )
 
@@ -60,12 +61,13 @@ func (ir *InvestorReport) dumpTopInvestorsDetail() error {
 		if ir.CrucibleMode && len(ir.s.Cfg.TopInvestors[ir.Cru.idx].Name) > 0 {
 			name = ir.s.Cfg.TopInvestors[ir.Cru.idx].Name
 		}
-		fmt.Fprintf(file, "%d,%q,,,,,,,,,,,,,,,,%q\n", ir.s.GensCompleted, name, inv.DNA())
+		fmt.Fprintf(file, "%d,%q,,,,,,,,,,,,,,,,,,,,%q\n", ir.s.GensCompleted, name, inv.DNA())
 		for i := 0; i < len(inv.Investments); i++ {
 			m := inv.Investments[i]
 			//                   0  1      4      5             6      7
-			//                   t3        t3c1   buyc2   fee   balc1 balc2
-			fmt.Fprintf(file, ",,%s,%12.2f,%12.2f,%12.2f,%8.4f,%12.2f,%12.2f\n",
+			//                   t3        t3c1   buyc2   fee   balc1 balc2  exposure utilization carry
+			fmt.Fprintf(file, ",%s,%s,%12.2f,%12.2f,%12.2f,%8.4f,%12.2f,%12.2f,%.2f%%,%.2f%%,%12.2f\n",
+				m.Pair,                  // the pair, portfolio Investors only
 				m.T3.Format("1/2/2006"), // date on which purchase of C2 was made
 				m.ERT3,                  // the exchange rate on T3
 				m.T3C1,                  // amount of C1 exchanged for C2 on T3
@@ -73,12 +75,15 @@ func (ir *InvestorReport) dumpTopInvestorsDetail() error {
 				m.Fee,                   // fee to purchase
 				m.T3BalanceC1,           // C1 balance after exchange on T3
 				m.T3BalanceC2,           // C2 balance after exchange on T3
+				m.Exposure*100,          // share of the portfolio value in C2 after exchange on T3
+				m.Utilization*100,       // share of the C1 balance spent
+				m.CarryC2,               // interest earned by the C2 while it was held
 			)
 
 			runningTotal := float64(0)
 			for _, v := range m.Chunks {
 				runningTotal += v.T4C1
-				fmt.Fprintf(file, ",,,,,,,,,%s,%12.2f,%12.2f,%8.4f,%12.2f,%12.2f,%12.2f,%12.2f\n",
+				fmt.Fprintf(file, ",,,,,,,,,,,,%s,%12.2f,%12.2f,%8.4f,%12.2f,%12.2f,%12.2f,%12.2f,%s\n",
 					v.T4.Format("1/2/2006"), // T4
 					v.ERT4,                  // Exchange Rate on T4
 					v.T4C2Sold,              // how much C2 was sold in this transaction
@@ -87,6 +92,7 @@ func (ir *InvestorReport) dumpTopInvestorsDetail() error {
 					v.T4C1,                  // amount of C1 we were able to purchase on T4 at exchange rate ERT4
 					runningTotal,            // running total of C1 recovered by all exchanges
 					v.ChunkProfit,           // profit or loss
+					v.Exit,                  // why it was sold
 				)
 			}
 
@@ -111,13 +117,21 @@ func (ir *InvestorReport) dumpInvestmentReportHeader(file *os.File) {
 	// fmt.Fprintf(file, "\"Simulation Loop Count: %d\"\n", s.Cfg.LoopCount)
 	fmt.Fprintf(file, "\"C1: %s\"\n", ir.s.Cfg.C1)
 	fmt.Fprintf(file, "\"C2: %s\"\n", ir.s.Cfg.C2)
+	if len(ir.s.Cfg.Pairs) > 0 {
+		fmt.Fprintf(file, "\"Pairs: %s  (the pair of each Investment follows its Investor)\"\n", strings.Join(ir.s.Cfg.Pairs, ", "))
+	}
 	fmt.Fprintf(file, "\"Initial Funds: %10.2f\"\n", ir.s.Cfg.InitFunds)
 	fmt.Fprintf(file, "\"C1/C2 Initial Fund Split: %v\"\n", ir.s.Cfg.SplitInitFunds)
+	fmt.Fprintf(file, "\"Position Sizing: %s\"\n", sizingSummary(ir.s.Cfg))
+	fmt.Fprintf(file, "\"Exit Rules: %s\"\n", exitSummary(ir.s.Cfg))
+	fmt.Fprintf(file, "\"Carry Rates: %s\"\n", carrySummary(ir.s.Cfg))
+	fmt.Fprintf(file, "\"Execution Model: %s\"\n", executionSummary(ir.s.Cfg))
+	fmt.Fprintf(file, "\"Trading Calendar: %s\"\n", calendarSummary(ir.s.Cfg, ir.s.factory.cal))
 
 	// the header row
-	fmt.Fprintf(file, "%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q\n",
+	fmt.Fprintf(file, "%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q\n",
 		"Generation", "Investor",
 		"T3", "Exchange Rate (T3)", "Purchase Amount C1",
-		"Purchase Amount (C2)", "Fee", "BalanceC1 (T3)", "BalanceC2 (T3)", "T4", "Exch Rate",
-		"T4 C2", "Fee", "C2 Remaining", "C1", "Total C1", "Chunk Profit", "DNA")
+		"Purchase Amount (C2)", "Fee", "BalanceC1 (T3)", "BalanceC2 (T3)", "Exposure (T3)", "Utilization (T3)", "Carry C2", "T4", "Exch Rate",
+		"T4 C2", "Fee", "C2 Remaining", "C1", "Total C1", "Chunk Profit", "Exit", "DNA")
 }
@@ -0,0 +1,181 @@
+package newcore
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// This module has the tax lots. Each Investment is a lot of C2. A sale of C2
+// takes the C2 from the open Investments in the order of the LotSelection
+// policy, and each chunk sold is a realized gain or loss.
+
+// lotSelection returns the LotSelection policy of cfg
+func lotSelection(cfg *util.AppConfig) string {
+	if len(cfg.LotSelection) == 0 {
+		return util.LotHighestLoss
+	}
+	return cfg.LotSelection
+}
+
+// longTermDays returns the holding period, in days, beyond which a gain is
+// long-term
+func longTermDays(cfg *util.AppConfig) int {
+	if cfg.LongTermDays == 0 {
+		return util.DefaultLongTermDays
+	}
+	return cfg.LongTermDays
+}
+
+// ID returns the id of the Investment
+func (m *Investment) ID() string {
+	return m.id
+}
+
+// SelectLots names the Investments a sale takes its C2 from first when the
+// LotSelection policy is specificid, by id or by buy date, like SpecificLots
+// in the config file, which it overrides. Investments that are not named are
+// sold oldest first, after the named ones.
+// ------------------------------------------------------------------------------
+func (i *Investor) SelectLots(ids ...string) {
+	i.lotIDs = ids
+}
+
+// lotRank returns the position of the first of lots that names m, by its id
+// or by the date it was bought. The bool is false if m is not named.
+func (m *Investment) lotRank(lots []string) (int, bool) {
+	dt := m.T3.Format(util.LotDateFmt)
+	for k, s := range lots {
+		if s == m.id || s == dt {
+			return k, true
+		}
+	}
+	return 0, false
+}
+
+// lotOrder returns the indices of the open Investments in the order a sale
+// at the exchange rate rate takes their C2
+// ------------------------------------------------------------------------------
+func (i *Investor) lotOrder(rate float64) []int {
+	var order []int
+	for j := 0; j < len(i.Investments); j++ {
+		if !i.Investments[j].Completed {
+			order = append(order, j) // the Investments are in the order they were bought
+		}
+	}
+
+	policy := lotSelection(i.cfg)
+	if policy == util.LotSpecificID {
+		lots := i.lotIDs
+		if lots == nil {
+			lots = i.cfg.SpecificLots
+		}
+		rank := make(map[int]int, len(order))
+		for _, j := range order {
+			if k, ok := i.Investments[j].lotRank(lots); ok {
+				rank[j] = k
+			}
+		}
+		sort.SliceStable(order, func(a, b int) bool {
+			ka, oka := rank[order[a]]
+			kb, okb := rank[order[b]]
+			return oka && (!okb || ka < kb)
+		})
+		return order
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		x, y := &i.Investments[order[a]], &i.Investments[order[b]]
+		switch policy {
+		case util.LotFIFO:
+			return x.T3.Before(y.T3)
+		case util.LotLIFO:
+			return x.T3.After(y.T3)
+		case util.LotHIFO:
+			return x.ERT3 < y.ERT3 // the fewer C2 a unit of C1 bought, the higher the cost of each unit
+		default: // util.LotHighestLoss
+			return x.remainingC2()*(1/rate-1/x.ERT3) < y.remainingC2()*(1/rate-1/y.ERT3)
+		}
+	})
+	return order
+}
+
+// RealizedGain is a chunk of C2 sold, with the C1 values needed for taxes
+// ------------------------------------------------------------------------------
+type RealizedGain struct {
+	ID        string    // id of the Investment the C2 came from
+	Acquired  time.Time // date the C2 was bought, T3
+	Disposed  time.Time // date the C2 was sold, T4
+	C2Sold    float64   // amount of C2 sold
+	CostBasis float64   // C1 paid for the C2 sold, at ERT3
+	Proceeds  float64   // C1 received for the C2 sold, at ERT4
+	Fees      float64   // fee paid on the sale
+	Gain      float64   // Proceeds - CostBasis - Fees
+	LongTerm  bool      // true if the C2 was held longer than LongTermDays
+	Exit      string    // why the C2 was sold
+}
+
+// RealizedGainColumns are the column headers of RealizedGain.CSV
+var RealizedGainColumns = []string{"Investment", "Acquired", "Disposed", "Days Held", "Holding Period", "C2 Sold", "Cost Basis", "Proceeds", "Fees", "Gain", "Exit"}
+
+// Term returns "long" for a long-term gain and "short" for a short-term gain
+func (g *RealizedGain) Term() string {
+	if g.LongTerm {
+		return "long"
+	}
+	return "short"
+}
+
+// DaysHeld returns the number of days the C2 was held
+func (g *RealizedGain) DaysHeld() int {
+	return int(g.Disposed.Sub(g.Acquired).Hours() / 24)
+}
+
+// CSV returns the values of g in the order of RealizedGainColumns
+func (g *RealizedGain) CSV() string {
+	return fmt.Sprintf("%q,%s,%s,%d,%s,%.2f,%.2f,%.2f,%.2f,%.2f,%s",
+		g.ID, g.Acquired.Format("1/2/2006"), g.Disposed.Format("1/2/2006"), g.DaysHeld(), g.Term(),
+		g.C2Sold, g.CostBasis, g.Proceeds, g.Fees, g.Gain, g.Exit)
+}
+
+// RealizedGains returns every chunk of C2 the Investor has sold, in the
+// order of the sales
+// ------------------------------------------------------------------------------
+func (i *Investor) RealizedGains() []RealizedGain {
+	longTerm := longTermDays(i.cfg)
+	var gains []RealizedGain
+	for j := 0; j < len(i.Investments); j++ {
+		m := &i.Investments[j]
+		for _, c := range m.Chunks {
+			g := RealizedGain{
+				ID:        m.id,
+				Acquired:  m.T3,
+				Disposed:  c.T4,
+				C2Sold:    c.T4C2Sold,
+				CostBasis: c.T4C2Sold / m.ERT3,
+				Proceeds:  c.T4C1,
+				Fees:      c.Fee,
+				Exit:      c.Exit,
+			}
+			g.Gain = g.Proceeds - g.CostBasis - g.Fees
+			g.LongTerm = g.DaysHeld() > longTerm
+			gains = append(gains, g)
+		}
+	}
+	sort.SliceStable(gains, func(a, b int) bool { return gains[a].Disposed.Before(gains[b].Disposed) })
+	return gains
+}
+
+// summarizeGains returns the total short-term and long-term gains
+func summarizeGains(gains []RealizedGain) (short, long float64) {
+	for _, g := range gains {
+		if g.LongTerm {
+			long += g.Gain
+		} else {
+			short += g.Gain
+		}
+	}
+	return short, long
+}
@@ -0,0 +1,141 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// TestLotOrder checks the order in which each LotSelection policy sells
+// three open Investments
+func TestLotOrder(t *testing.T) {
+	f, _ := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	inv.Investments = []Investment{
+		{id: "a", T3: dt, ERT3: 100, T3C2Buy: 1000},                   // loses 0.74 C1 at 108
+		{id: "b", T3: dt.AddDate(0, 0, 1), ERT3: 110, T3C2Buy: 1100},  // gains 0.19 C1 at 108
+		{id: "c", T3: dt.AddDate(0, 0, 2), ERT3: 105, T3C2Buy: 5000},  // loses 1.32 C1 at 108
+		{id: "d", T3: dt.AddDate(0, 0, 3), ERT3: 90, Completed: true}, // never sold again
+	}
+	cases := map[string]string{
+		util.LotFIFO:        "abc",
+		util.LotLIFO:        "cba",
+		util.LotHIFO:        "acb",
+		util.LotHighestLoss: "cab",
+		util.LotSpecificID:  "bac",
+	}
+	inv.SelectLots("x", "b")
+	for policy, want := range cases {
+		f.cfg.LotSelection = policy
+		got := ""
+		for _, j := range inv.lotOrder(108) {
+			got += inv.Investments[j].ID()
+		}
+		if got != want {
+			t.Errorf("%s: expected %s, got %s", policy, want, got)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Without SelectLots the lots come from SpecificLots, by id or by
+	// buy date
+	//---------------------------------------------------------------
+	inv.SelectLots()
+	f.cfg.LotSelection = util.LotSpecificID
+	f.cfg.SpecificLots = []string{dt.AddDate(0, 0, 2).Format(util.LotDateFmt), "b"}
+	got := ""
+	for _, j := range inv.lotOrder(108) {
+		got += inv.Investments[j].ID()
+	}
+	if got != "cba" {
+		t.Errorf("SpecificLots %v: expected cba, got %s", f.cfg.SpecificLots, got)
+	}
+}
+
+// TestRealizedGains buys twice and sells everything oldest first. Only the
+// first buy is held long enough to be a long-term gain.
+func TestRealizedGains(t *testing.T) {
+	f, _ := taTestFactory(t)
+	f.cfg.LotSelection = util.LotFIFO
+	f.cfg.LongTermDays = 4
+	f.cfg.TxnFeeFactor = 0.001
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	inv.BalanceC1 = 1000
+	d0 := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	if err := inv.ExecuteBuy(d0, 0.5); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	if err := inv.ExecuteBuy(d0.AddDate(0, 0, 3), 0.5); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	if err := inv.ExecuteSell(d0.AddDate(0, 0, 5), 1); err != nil {
+		t.Fatalf("ExecuteSell returned error: %s", err)
+	}
+
+	gains := inv.RealizedGains()
+	if len(gains) != 2 || gains[0].ID != inv.Investments[0].ID() {
+		t.Fatalf("expected the oldest Investment sold first, got %+v", gains)
+	}
+	if !gains[0].LongTerm || gains[0].DaysHeld() != 5 || gains[1].LongTerm || gains[1].Term() != "short" {
+		t.Errorf("expected a long-term and a short-term gain, got %+v", gains)
+	}
+	total := float64(0)
+	for k, g := range gains {
+		m := inv.Investments[k]
+		if math.Abs(g.CostBasis-m.T3C1) > 1e-6 || math.Abs(g.Proceeds-m.T4C1) > 1e-6 || g.Fees <= 0 {
+			t.Errorf("gain %d: expected cost basis %f and proceeds %f, got %+v", k, m.T3C1, m.T4C1, g)
+		}
+		if math.Abs(g.Gain-(g.Proceeds-g.CostBasis-g.Fees)) > 1e-9 {
+			t.Errorf("gain %d: gain %f is not proceeds - cost basis - fees", k, g.Gain)
+		}
+		total += g.Gain
+	}
+	short, long := summarizeGains(gains)
+	if short != gains[1].Gain || long != gains[0].Gain || math.Abs(short+long-total) > 1e-9 {
+		t.Errorf("unexpected summary, short %f, long %f", short, long)
+	}
+}
+
+// TestRealizedGainsReport runs a simulation and checks the realized-gains
+// report
+func TestRealizedGainsReport(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.LotSelection = util.LotHIFO
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	var s Simulator
+	s.ResetSimulator()
+	s.SqltDB = openSimTestSqlt(t)
+	s.RealizedGainsReport = true
+	if err := s.Init(cfg, db, nil, false, false); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	s.Run()
+
+	b, err := os.ReadFile(cfg.GenerateFName("gains"))
+	if err != nil {
+		t.Fatalf("could not read the realized-gains report: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	if !strings.Contains(string(b), "Lot Selection: hifo") || !strings.Contains(string(b), `"Cost Basis","Proceeds","Fees","Gain"`) {
+		t.Errorf("expected the realized-gains header:\n%s", b)
+	}
+	n := 0
+	for _, l := range lines {
+		if strings.HasPrefix(l, "1,") || strings.HasPrefix(l, "2,") {
+			if c := strings.Count(l, ","); c != len(RealizedGainColumns)+1 {
+				t.Errorf("expected %d commas, got %d: %s", len(RealizedGainColumns)+1, c, l)
+			}
+			n++
+		}
+	}
+	if n == 0 {
+		t.Errorf("expected realized gains in the report:\n%s", b)
+	}
+}
@@ -3,6 +3,7 @@ package newcore
 import (
 	"fmt"
 	"log"
+	"strconv"
 	"time"
 
 	"github.com/stmansour/psim/newdata"
@@ -17,19 +18,40 @@ type LSMInfluencer struct {
 	Blocs      []string // list of associated countries. If associated with C1 & C2, blocs[0] must be associated with C1, blocs[1] with C2
 	LocaleType int      // how to handle locales
 	Predictor  int      // which predictor to use
+	Bloc       string   // LocaleBloc metrics only: the name of the bloc
+	Versus     string   // LocaleBloc metrics only: "C1" compares C1 to the bloc, "C2" compares the bloc to C2
+	Agg        string   // LocaleBloc metrics only: how the members' values are combined, one of newdata.BlocAggregates
+	Pair       string   // portfolio Investors only: the pair whose sleeve this Influencer advises
 	cfg        *util.AppConfig
 	Delta1     int
 	Delta2     int
 	// HoldWindowNeg       float64 // positive number defining negative hold space:  from 0 to -HoldWindowNeg should be treated as 0
 	// HoldWindowPos       float64 // defines positive hold space: from 0 to HoldWindowPos should be treated as 0
+	LookBack            int     // look-back of the rolling statistics, a gene only if the metric has MaxLookBack > 0, 0 means cfg.HoldWindowStatsLookBack
+	VarFactor           float64 // StdDevVariationFactor of this influencer, valid only if HasVarFactor
+	HasVarFactor        bool    // VarFactor is a gene, true only if the metric has MaxVarFactor > 0
 	ID                  string
 	FitnessIsCalculated bool
 	FitnessIsNormalized bool
 	Fitness             float64
 	MyPredictions       []Prediction
+	nJudged             int       // MyPredictions that have been judged
+	nCorrect            int       // judged MyPredictions that were correct
 	myInvestor          *Investor // my parent, the investor that holds me
 	flagpos             int
-	nilDataCount        int // how many times did we encounter nil data in research
+	nilDataCount        int                  // how many times did we encounter nil data in research
+	refs                [2]newdata.MetricRef // the metrics read for each prediction, resolved on first use
+	nrefs               int                  // number of entries in refs that are in use
+	bloc                *newdata.Bloc        // LocaleBloc metrics only: the bloc, resolved with refs
+	blocRefs            []newdata.MetricRef  // the metric for each member of bloc
+	blocSlot            int                  // the entry in refs that is replaced by the bloc's aggregate value
+	formula             *newdata.Formula     // CustomPredict only: the metric's prediction formula
+}
+
+// lsmValues holds the values of one metric at T1 and T2 of a prediction
+type lsmValues struct {
+	v1, v2 newdata.MetricInfo // values at T1 and T2
+	ok     bool               // false if either value does not exist
 }
 
 // GetNilDataCount returns the value for nilDataCount
@@ -78,6 +100,9 @@ func (p *LSMInfluencer) SetMyInvestor(inv *Investor) {
 // slice to the supplied value
 func (p *LSMInfluencer) SetMyPredictions(ps []Prediction) {
 	p.MyPredictions = ps
+	s := NewPredictionStats(ps)
+	p.nJudged, p.nCorrect = s.Judged, s.Correct
+	p.FitnessIsCalculated = false
 }
 
 // GetMyPredictions is used primarily for testing and returns MyPredictions
@@ -100,20 +125,24 @@ func (p *LSMInfluencer) AppendPrediction(pr Prediction) {
 	p.MyPredictions = append(p.MyPredictions, pr)
 }
 
-// FinalizePrediction - finalize the results of this prediction
+// FinalizePrediction - finalize the results of the prediction made on t3.
+// A "buy" was correct if the investment was profitable, a "sell" if it was not.
 func (p *LSMInfluencer) FinalizePrediction(t3, t4 time.Time, profitable bool) {
-	for i := 0; i < len(p.MyPredictions); i++ {
-		if p.MyPredictions[i].Completed {
-			continue
-		}
-		if t3.Equal(p.MyPredictions[i].T3) {
-			p.MyPredictions[i].Correct = profitable
-			p.MyPredictions[i].Completed = true
-			return
+	judged, correct := finalizePrediction(p.MyPredictions, t3, profitable)
+	if judged {
+		p.nJudged++
+		if correct {
+			p.nCorrect++
 		}
 	}
 }
 
+// Accuracy returns this Influencer's running accuracy in the current
+// generation. It is 0.5 until some of its predictions have been judged.
+func (p *LSMInfluencer) Accuracy() float64 {
+	return runningAccuracy(p.nCorrect, p.nJudged)
+}
+
 // GetID - get ID string
 func (p *LSMInfluencer) GetID() string {
 	return p.ID
@@ -146,7 +175,7 @@ func (p *LSMInfluencer) SetDelta2(d int) {
 
 // SetID - set ID
 func (p *LSMInfluencer) SetID() {
-	p.ID = util.GenerateRefNo()
+	p.ID = p.myInvestor.GenerateRefNo()
 }
 
 // Init - initializes a LSMInfluencer
@@ -167,22 +196,55 @@ func (p *LSMInfluencer) GetMetric() string {
 	return p.Metric
 }
 
+// GetPair - returns the pair whose sleeve this Influencer advises, empty if
+// the Investors are not portfolios
+func (p *LSMInfluencer) GetPair() string {
+	return p.Pair
+}
+
 // DNA - returns the DNA of this influencer.
 // A quick description of the type of Influencer and its key attributes.
 // ----------------------------------------------------------------------------
 func (p *LSMInfluencer) DNA() string {
-	return fmt.Sprintf("{%s,Delta1=%d,Delta2=%d,Metric=%s}", p.Subclass(), p.Delta1, p.Delta2, p.Metric)
+	// the genes are in alphabetical order, the same order crossoverInfluencerDNA writes them
+	dna := "{" + p.Subclass()
+	if len(p.Bloc) > 0 {
+		dna += fmt.Sprintf(",Agg=%s,Bloc=%s", p.Agg, p.Bloc)
+	}
+	dna += fmt.Sprintf(",Delta1=%d,Delta2=%d", p.Delta1, p.Delta2)
+	if p.LookBack > 0 {
+		dna += fmt.Sprintf(",LookBack=%d", p.LookBack)
+	}
+	dna += ",Metric=" + p.Metric
+	if len(p.Pair) > 0 {
+		dna += ",Pair=" + p.Pair
+	}
+	if p.HasVarFactor {
+		dna += ",VarFactor=" + strconv.FormatFloat(p.VarFactor, 'f', -1, 64)
+	}
+	if len(p.Bloc) > 0 {
+		dna += ",Versus=" + p.Versus
+	}
+	return dna + "}"
 }
 
-// calculateAndSetValues calculates and sets values based on the specified metric name (field name).
-// The field name is a string that uniquely identifies the metric in a record.
+// varFactor returns the StdDevVariationFactor this Influencer uses: its own
+// if it has one, otherwise the one from the config file.
+func (p *LSMInfluencer) varFactor() float64 {
+	if p.HasVarFactor {
+		return p.VarFactor
+	}
+	return p.cfg.StdDevVariationFactor
+}
+
+// calculateAndSetValues calculates and sets values based on the values of
+// one metric at T1 and T2.
 // ----------------------------------------------------------------------------------------------------
-func (p *LSMInfluencer) calculateAndSetValues(pred *Prediction, fieldName string) (float64, float64, float64, bool) {
-	val1, ok1 := pred.Recs[0].Fields[fieldName] // value at T1
-	val2, ok2 := pred.Recs[1].Fields[fieldName] // value at T2
-	if !ok1 || !ok2 {
+func (p *LSMInfluencer) calculateAndSetValues(pred *Prediction, v lsmValues) (float64, float64, float64, bool) {
+	if !v.ok {
 		return 0, 0, 0, false
 	}
+	val1, val2 := v.v1, v.v2 // values at T1 and T2
 
 	// TODO: explain this thoroughly
 	stdDevSquared := val2.StdDevSquared      // used by trace
@@ -190,8 +252,9 @@ func (p *LSMInfluencer) calculateAndSetValues(pred *Prediction, fieldName string
 	delta := val2.Value - val1.Value         // change over T1 to T2
 	da := delta / float64(p.Delta2-p.Delta1) // mean change between T1 and T2
 	pred.AvgDelta = da                       // Average change between T2 and T1, used for trace
-	x := p.cfg.StdDevVariationFactor         // notational simplification, use the factor from the config file
+	x := p.varFactor()                       // notational simplification, the factor from the DNA or the config file
 	res := da*da - x*x*stdDevSquared         // deltaAvg^2 - (x*stdDev)^2   if the result is positive, then we transact
+	pred.VarFactor = x                       // used in trace
 	pred.Val1 = val1.Value                   // used in trace
 	pred.Val2 = val2.Value                   // used in trace
 
@@ -230,7 +293,8 @@ func (p *LSMInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
 	pred.Delta1 = p.Delta1
 	pred.Delta2 = p.Delta2
 
-	if err := p.SetDataFields(&pred); err != nil {
+	vals, err := p.readValues(&pred)
+	if err != nil {
 		return &pred, err
 	}
 
@@ -239,7 +303,10 @@ func (p *LSMInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
 	pred.Weight = 1.0
 	switch p.Predictor {
 	case newdata.SingleValGT, newdata.SingleValLT:
-		val1, val2, res, ok := p.calculateAndSetValues(&pred, p.Metric)
+		if p.nrefs != 1 {
+			return &pred, nil // the metric has locales, there is no single value
+		}
+		val1, val2, res, ok := p.calculateAndSetValues(&pred, vals[0])
 		if !ok {
 			// Data for the given fieldName is not available.
 			return &pred, nil // Return immediately with pred.Action as "abstain".
@@ -254,18 +321,18 @@ func (p *LSMInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
 	case newdata.C1C2RatioGT, newdata.C1C2RatioLT:
 		pred.Probability = 1.0
 		pred.Weight = 1.0
-		if len(pred.Recs[0].Fields) != 2 || len(pred.Recs[1].Fields) != 2 {
+		if p.nrefs != 2 || !vals[0].ok || !vals[1].ok {
 			return &pred, nil // need to abstain, the data was not available
 		}
 
 		// val a -- is Fields[0] within the std dev?
-		valaT1, valaT2, res0, ok := p.calculateAndSetValues(&pred, p.cfg.C1+p.Metric)
+		valaT1, valaT2, res0, ok := p.calculateAndSetValues(&pred, vals[0])
 		if !ok {
 			// Data for the given fieldName is not available.
 			return &pred, nil // Return immediately with pred.Action as "abstain".
 		}
 		// val b -- is Fields[1] within the std dev?
-		valbT1, valbT2, res1, ok := p.calculateAndSetValues(&pred, p.cfg.C2+p.Metric)
+		valbT1, valbT2, res1, ok := p.calculateAndSetValues(&pred, vals[1])
 		if !ok {
 			// Data for the given fieldName is not available.
 			return &pred, nil // Return immediately with pred.Action as "abstain".
@@ -298,6 +365,9 @@ func (p *LSMInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
 
 		return &pred, nil
 
+	case newdata.CustomPredict:
+		return p.customPrediction(&pred, vals)
+
 	default:
 		log.Fatalf("Need to handle this case\n")
 	}
@@ -305,61 +375,145 @@ func (p *LSMInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
 	return &pred, nil
 }
 
-// SetDataFields files in the db record metric info for the Prediction
-func (p *LSMInfluencer) SetDataFields(pred *Prediction) error {
-	db := p.myInvestor.db
-	sc := p.myInvestor.db.Mim.MInfluencerSubclasses[p.Metric]
+// customPrediction makes a prediction with the formula of a CustomPredict
+// metric. It abstains if any of the values is missing.
+// ----------------------------------------------------------------------------------------------------
+func (p *LSMInfluencer) customPrediction(pred *Prediction, vals [2]lsmValues) (*Prediction, error) {
+	if p.formula == nil {
+		return pred, fmt.Errorf("metric %s has no prediction formula", p.Metric)
+	}
+	for j := 0; j < p.nrefs; j++ {
+		if !vals[j].ok {
+			return pred, nil // abstain
+		}
+	}
 
-	// the dates for data selection
-	t1 := pred.T3.AddDate(0, 0, pred.Delta1)
-	t2 := pred.T3.AddDate(0, 0, pred.Delta2)
+	v := newdata.FormulaVars{
+		Delta1:                float64(p.Delta1),
+		Delta2:                float64(p.Delta2),
+		StdDevVariationFactor: p.varFactor(),
+	}
+	pred.VarFactor = v.StdDevVariationFactor // used in trace
+	a := vals[0]
+	if p.nrefs == 1 {
+		v.Val1, v.Val2 = a.v1.Value, a.v2.Value
+		v.Mean, v.StdDevSquared = a.v2.Mean, a.v2.StdDevSquared
+	} else {
+		b := vals[1]
+		v.C1Val1, v.C1Val2, v.C1Mean, v.C1StdDevSquared = a.v1.Value, a.v2.Value, a.v2.Mean, a.v2.StdDevSquared
+		v.C2Val1, v.C2Val2, v.C2Mean, v.C2StdDevSquared = b.v1.Value, b.v2.Value, b.v2.Mean, b.v2.StdDevSquared
+		valbT1, valbT2 := v.C2Val1, v.C2Val2
+		if valbT1 == 0 {
+			valbT1 = 0.0000001
+		}
+		if valbT2 == 0 {
+			valbT2 = 0.0000001
+		}
+		v.Val1, v.Val2 = v.C1Val1/valbT1, v.C1Val2/valbT2
+	}
+
+	pred.Val1, pred.Val2 = v.Val1, v.Val2                          // used in trace
+	pred.StdDevSquared = a.v2.StdDevSquared                        // used in trace
+	pred.AvgDelta = (v.Val2 - v.Val1) / float64(p.Delta2-p.Delta1) // used in trace
+	pred.Action, pred.Probability = p.formula.Eval(&v)
+	return pred, nil
+}
 
-	// the fields for the Select
+// setMetricRefs resolves the metrics this influencer reads. It is done once,
+// the first time a prediction is made.
+func (p *LSMInfluencer) setMetricRefs() {
+	sc := p.myInvestor.db.Mim.MInfluencerSubclasses[p.Metric]
+	p.formula = sc.Expr
 	switch sc.LocaleType {
 	case newdata.LocaleNone:
-		pred.Fields = []newdata.FieldSelector{} // just the metric as-is
-		pred.Fields = append(pred.Fields, newdata.FieldSelector{Metric: p.Metric})
+		p.refs[0] = newdata.NewMetricRef(newdata.FieldSelector{Metric: p.Metric}) // just the metric as-is
+		p.nrefs = 1
 
 	case newdata.LocaleC1C2:
-		f1 := newdata.FieldSelector{Locale: p.MyInvestor().cfg.C1, Metric: p.Metric}
-		f2 := newdata.FieldSelector{Locale: p.MyInvestor().cfg.C2, Metric: p.Metric}
-		pred.Fields = []newdata.FieldSelector{f1, f2}
+		p.refs[0] = newdata.NewMetricRef(newdata.FieldSelector{Locale: p.MyInvestor().cfg.C1, Metric: p.Metric})
+		p.refs[1] = newdata.NewMetricRef(newdata.FieldSelector{Locale: p.MyInvestor().cfg.C2, Metric: p.Metric})
+		p.nrefs = 2
 
 	case newdata.LocaleBloc:
-		log.Fatalf("Need to implement this!")
+		//-------------------------------------------------------------------
+		// A single value predictor uses the bloc's value. A ratio predictor
+		// puts the bloc in the place of the currency it is not compared to:
+		// Versus C1 gives C1/bloc, Versus C2 gives bloc/C2.
+		//-------------------------------------------------------------------
+		b := p.myInvestor.db.Blocs[p.Bloc]
+		p.bloc = &b
+		p.blocRefs = b.BlocMetricRefs(p.Metric)
+		p.blocSlot = 0
+		p.nrefs = 1
+		if p.Predictor != newdata.SingleValGT && p.Predictor != newdata.SingleValLT {
+			p.nrefs = 2
+			if p.Versus == "C1" {
+				p.refs[0] = newdata.NewMetricRef(newdata.FieldSelector{Locale: p.MyInvestor().cfg.C1, Metric: p.Metric})
+				p.blocSlot = 1
+			} else {
+				p.refs[1] = newdata.NewMetricRef(newdata.FieldSelector{Locale: p.MyInvestor().cfg.C2, Metric: p.Metric})
+			}
+		}
+	}
+}
+
+// value returns the value of entry j of refs on dt with the rolling
+// statistics over this influencer's LookBack
+func (p *LSMInfluencer) value(j int, dt time.Time) (newdata.MetricInfo, error) {
+	if p.bloc != nil && j == p.blocSlot {
+		return p.myInvestor.db.BlocValue(p.bloc, p.blocRefs, p.Agg, dt, p.LookBack)
+	}
+	return p.myInvestor.db.WindowValue(&p.refs[j], dt, p.LookBack)
+}
+
+// readValues reads the values of this influencer's metrics at T1 and T2 of
+// the supplied prediction. A missing value is not an error, its lsmValues
+// will have ok set to false. A missing record is a nildata error.
+func (p *LSMInfluencer) readValues(pred *Prediction) ([2]lsmValues, error) {
+	var vals [2]lsmValues
+	if p.nrefs == 0 {
+		p.setMetricRefs()
 	}
 
-	// Do the Select(s)
-	var rec1, rec2 *newdata.EconometricsRecord
-	var err error
-	if sc.LocaleType == newdata.LocaleNone || sc.LocaleType == newdata.LocaleC1C2 {
-		rec1, err = db.Select(t1, pred.Fields)
-		if err != nil {
-			return err
+	// the dates for data selection
+	t1 := p.myInvestor.deltaDate(pred.T3, pred.Delta1)
+	t2 := p.myInvestor.deltaDate(pred.T3, pred.Delta2)
+
+	for j := 0; j < p.nrefs; j++ {
+		v1, err1 := p.value(j, t1)
+		if err := nildataErr(err1, t1); err != nil {
+			return vals, err
 		}
-		if rec1 == nil {
-			err := fmt.Errorf("nildata: newdata.EconometricsRecord for %s not found", t1.Format("1/2/2006"))
-			return err
+		v2, err2 := p.value(j, t2)
+		if err := nildataErr(err2, t2); err != nil {
+			return vals, err
 		}
-		pred.Recs = append(pred.Recs, rec1)
+		vals[j] = lsmValues{v1: v1, v2: v2, ok: err1 == nil && err2 == nil}
 	}
+	return vals, nil
+}
 
-	rec2, err = db.Select(t2, pred.Fields)
-	if err != nil {
-		return err
-	}
-	if rec2 == nil {
-		err := fmt.Errorf("nildata: newdata.EconometricsRecord for %s not found", t2.Format("1/2/2006"))
+// nildataErr converts an error from Database.Value to the error returned by
+// GetPrediction. A missing value is not an error, the influencer abstains.
+func nildataErr(err error, dt time.Time) error {
+	switch err {
+	case nil, newdata.ErrNoValue:
+		return nil
+	case newdata.ErrNoRecord:
+		return fmt.Errorf("nildata: newdata.EconometricsRecord for %s not found", dt.Format("1/2/2006"))
+	default:
 		return err
 	}
-	pred.Recs = append(pred.Recs, rec2)
-	return nil
 }
 
-// CalculateFitnessScore - See explanation in common.go calculateFitnessScore
+// CalculateFitnessScore - scores this Influencer from its finalized
+// predictions. See influencerFitness in inffitness.go
 //
 // RETURNS - the fitness score
 // ------------------------------------------------------------------------------------
 func (p *LSMInfluencer) CalculateFitnessScore() float64 {
-	return 1
+	if !p.FitnessIsCalculated {
+		p.SetFitnessScore(influencerFitness(p.myInvestor, p.Metric, p.MyPredictions))
+	}
+	return p.Fitness
 }
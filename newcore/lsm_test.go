@@ -0,0 +1,144 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+)
+
+// TestLSMInfluencerBloc makes DR a bloc metric and checks the genes and the
+// predictions of LSMInfluencers that compare a bloc to C1 and to C2.
+func TestLSMInfluencerBloc(t *testing.T) {
+	f, db := taTestFactory(t)
+	if _, err := f.NewInfluencer("{LSMInfluencer,Agg=mean,Bloc=Pair,Metric=DR,Versus=C1}"); err != nil {
+		t.Fatalf("bloc genes must be ignored for a metric that is not a bloc metric: %s", err)
+	}
+	mi := db.Mim.MInfluencerSubclasses["DR"]
+	mi.LocaleType = newdata.LocaleBloc
+	db.Mim.MInfluencerSubclasses["DR"] = mi
+	if _, err := f.NewInfluencer("{LSMInfluencer,Metric=DR}"); err == nil {
+		t.Errorf("expected an error when there are no blocs")
+	}
+
+	fname := filepath.Join(filepath.Dir(db.CSVDB.DBFname), "blocs.csv")
+	if err := os.WriteFile(fname, []byte("BID,Name,Members,Description\n1,Pair,USD:3;JPY:1,test bloc\n"), 0644); err != nil {
+		t.Fatalf("could not write %s: %s", fname, err)
+	}
+	if err := db.CSVDB.LoadBlocsCSV(); err != nil {
+		t.Fatalf("LoadBlocsCSV returned error: %s", err)
+	}
+
+	//---------------------------------------------------------------
+	// Random genes, DNA round trips and bad genes
+	//---------------------------------------------------------------
+	for k := 0; k < 10; k++ {
+		inf, err := f.NewInfluencer("{LSMInfluencer,Metric=DR}")
+		if err != nil {
+			t.Fatalf("NewInfluencer returned error: %s", err)
+		}
+		p := inf.(*LSMInfluencer)
+		if p.Bloc != "Pair" || (p.Versus != "C1" && p.Versus != "C2") || len(p.Agg) == 0 {
+			t.Errorf("unexpected bloc genes: %s", inf.DNA())
+		}
+		inf2, err := f.NewInfluencer(inf.DNA())
+		if err != nil || inf2.DNA() != inf.DNA() {
+			t.Errorf("DNA did not survive a round trip: %s", inf.DNA())
+		}
+	}
+	for _, dna := range []string{
+		"{LSMInfluencer,Bloc=G20,Metric=DR}",
+		"{LSMInfluencer,Metric=DR,Versus=C3}",
+		"{LSMInfluencer,Agg=max,Metric=DR}",
+	} {
+		if _, err := f.NewInfluencer(dna); err == nil {
+			t.Errorf("expected an error for %s", dna)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Versus C1 predicts from USD / bloc, Versus C2 from bloc / JPY
+	//---------------------------------------------------------------
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Agg=weighted,Bloc=Pair,Delta1=-30,Delta2=-5,Metric=DR,Versus=C1}|{LSMInfluencer,Agg=mean,Bloc=Pair,Delta1=-30,Delta2=-5,Metric=DR,Versus=C2}]}")
+	usd := newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "USD"})
+	jpy := newdata.NewMetricRef(newdata.FieldSelector{Metric: "DR", Locale: "JPY"})
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	t2 := dt.AddDate(0, 0, -5)
+	u, err := db.Value(&usd, t2)
+	if err != nil {
+		t.Fatalf("no USDDR on %s: %s", t2.Format("1/2/2006"), err)
+	}
+	j, err := db.Value(&jpy, t2)
+	if err != nil {
+		t.Fatalf("no JPYDR on %s: %s", t2.Format("1/2/2006"), err)
+	}
+	want := []float64{u.Value / (0.75*u.Value + 0.25*j.Value), (u.Value + j.Value) / 2 / j.Value}
+	for k, inf := range inv.Influencers {
+		pred, err := inf.GetPrediction(dt)
+		if err != nil {
+			t.Fatalf("GetPrediction returned error: %s", err)
+		}
+		if pred.Action == "abstain" || math.Abs(pred.Val2-want[k]) > 1e-9 {
+			t.Errorf("%s: expected a prediction from %f, got %s from %f", inf.DNA(), want[k], pred.Action, pred.Val2)
+		}
+	}
+}
+
+// TestLSMInfluencerCustomPredict checks that the predictions of CustomPredict
+// metrics come from their formulas
+func TestLSMInfluencerCustomPredict(t *testing.T) {
+	f, db := taTestFactory(t)
+	formulas := map[string]string{
+		"Gold": `if(Val2 > Val1, "sell", "buy"); if(Val2 > Val1, 0.25, 0.75)`,
+		"DR":   `if(C1Val2 - C1Val1 > C2Val2 - C2Val1, "sell", "buy"); Delta2 / Delta1`,
+	}
+	for metric, s := range formulas {
+		mi := db.Mim.MInfluencerSubclasses[metric]
+		mi.Predictor = newdata.CustomPredict
+		mi.Formula = s
+		if err := mi.Compile(); err != nil {
+			t.Fatalf("Compile returned error: %s", err)
+		}
+		db.Mim.MInfluencerSubclasses[metric] = mi
+	}
+
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}]}")
+	val := func(metric, locale string, dt time.Time) float64 {
+		ref := newdata.NewMetricRef(newdata.FieldSelector{Metric: metric, Locale: locale})
+		v, err := db.Value(&ref, dt)
+		if err != nil {
+			t.Fatalf("no %s%s on %s: %s", locale, metric, dt.Format("1/2/2006"), err)
+		}
+		return v.Value
+	}
+	for dt := time.Date(2020, time.February, 1, 0, 0, 0, 0, time.UTC); dt.Month() == time.February; dt = dt.AddDate(0, 0, 1) {
+		t1, t2 := dt.AddDate(0, 0, -30), dt.AddDate(0, 0, -5)
+		gold := "buy"
+		prob := 0.75
+		if val("Gold", "", t2) > val("Gold", "", t1) {
+			gold, prob = "sell", 0.25
+		}
+		dr := "buy"
+		if val("DR", "USD", t2)-val("DR", "USD", t1) > val("DR", "JPY", t2)-val("DR", "JPY", t1) {
+			dr = "sell"
+		}
+
+		want := map[string]struct {
+			action string
+			prob   float64
+		}{"Gold": {gold, prob}, "DR": {dr, 5.0 / 30}}
+		for _, inf := range inv.Influencers {
+			pred, err := inf.GetPrediction(dt)
+			if err != nil {
+				t.Fatalf("GetPrediction returned error: %s", err)
+			}
+			w := want[inf.GetMetric()]
+			if pred.Action != w.action || math.Abs(pred.Probability-w.prob) > 1e-9 {
+				t.Errorf("%s, %s: expected %s, %f got %s, %f", dt.Format("1/2/2006"), inf.GetMetric(), w.action, w.prob, pred.Action, pred.Probability)
+			}
+		}
+	}
+}
@@ -0,0 +1,269 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// Objectives are the scores of an Investor in multi-objective mode. Each
+// one is optimized separately rather than being folded into a single
+// fitness score with weights.
+// ------------------------------------------------------------------------------
+type Objectives struct {
+	AnnualizedReturn float64 // maximize
+	MaxDrawdown      float64 // minimize, the largest drop from a peak portfolio value, as a fraction of the peak
+	Trades           int     // maximize, the number of buys made this generation. Investors that never trade are not useful
+	Correctness      float64 // maximize, fraction of profitable sells
+}
+
+// Vector returns the objectives as a vector in which every element is to be
+// maximized.
+// ------------------------------------------------------------------------------
+func (o *Objectives) Vector() []float64 {
+	return []float64{o.AnnualizedReturn, -o.MaxDrawdown, float64(o.Trades), o.Correctness}
+}
+
+// CalculateObjectives sets the Investor's Objectives for the generation
+// that ran from dtStart to dtStop. The RiskMetrics must already be set.
+// ------------------------------------------------------------------------------
+func (i *Investor) CalculateObjectives(dtStart, dtStop time.Time) {
+	ar, err := util.AnnualizedReturn(i.cfg.InitFunds, i.PortfolioValueC1, dtStart, dtStop.AddDate(0, 0, 1))
+	if err != nil {
+		ar = 0
+	}
+	trades := 0
+	for k := range i.Investments {
+		m := &i.Investments[k]
+		if !m.isFlatFee() && !m.T3.Before(dtStart) && !m.T3.After(dtStop) {
+			trades++
+		}
+	}
+	i.Objectives = Objectives{
+		AnnualizedReturn: ar,
+		MaxDrawdown:      i.Risk.MaxDrawdown,
+		Trades:           trades,
+		Correctness:      i.Correctness(),
+	}
+}
+
+// dominates returns true if a is at least as good as b in every objective
+// and better in at least one.
+// ------------------------------------------------------------------------------
+func dominates(a, b []float64) bool {
+	better := false
+	for k := range a {
+		if a[k] < b[k] {
+			return false
+		}
+		if a[k] > b[k] {
+			better = true
+		}
+	}
+	return better
+}
+
+// NonDominatedSort sorts the population into Pareto fronts. Nothing in
+// front 0 is dominated by anything else. Nothing in front n is dominated by
+// anything outside of fronts 0 through n-1.
+//
+// INPUTS
+//
+//	obj - the objectives of each member of the population, every objective
+//	      is to be maximized
+//
+// RETURNS
+//
+//	the fronts, each is a list of indexes into obj
+//	the rank of each member of the population, that is, the front it is in
+//
+// ------------------------------------------------------------------------------
+func NonDominatedSort(obj [][]float64) ([][]int, []int) {
+	n := len(obj)
+	dominatedBy := make([]int, n) // number of members that dominate i
+	dominated := make([][]int, n) // the members that i dominates
+	rank := make([]int, n)
+	var front []int
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if dominates(obj[i], obj[j]) {
+				dominated[i] = append(dominated[i], j)
+				dominatedBy[j]++
+			} else if dominates(obj[j], obj[i]) {
+				dominated[j] = append(dominated[j], i)
+				dominatedBy[i]++
+			}
+		}
+	}
+	for i := 0; i < n; i++ {
+		if dominatedBy[i] == 0 {
+			front = append(front, i)
+		}
+	}
+
+	var fronts [][]int
+	for r := 0; len(front) > 0; r++ {
+		fronts = append(fronts, front)
+		var next []int
+		for _, i := range front {
+			rank[i] = r
+			for _, j := range dominated[i] {
+				dominatedBy[j]--
+				if dominatedBy[j] == 0 {
+					next = append(next, j)
+				}
+			}
+		}
+		front = next
+	}
+	return fronts, rank
+}
+
+// CrowdingDistance computes the crowding distance of the members of a
+// front. It is the sum over all objectives of the distance between the two
+// neighbors of a member, normalized by the range of the objective. The
+// members at the ends of the front get an infinite distance so that they
+// are always kept.
+//
+// INPUTS
+//
+//	obj   - the objectives of the whole population
+//	front - indexes into obj of the members of the front
+//	dist  - where to put the distances, it is indexed like obj
+//
+// ------------------------------------------------------------------------------
+func CrowdingDistance(obj [][]float64, front []int, dist []float64) {
+	for _, i := range front {
+		dist[i] = 0
+	}
+	if len(front) < 3 {
+		for _, i := range front {
+			dist[i] = math.Inf(1)
+		}
+		return
+	}
+	sorted := make([]int, len(front))
+	for k := 0; k < len(obj[front[0]]); k++ {
+		copy(sorted, front)
+		sort.SliceStable(sorted, func(a, b int) bool { return obj[sorted[a]][k] < obj[sorted[b]][k] })
+		lo := obj[sorted[0]][k]
+		hi := obj[sorted[len(sorted)-1]][k]
+		dist[sorted[0]] = math.Inf(1)
+		dist[sorted[len(sorted)-1]] = math.Inf(1)
+		if hi == lo {
+			continue
+		}
+		for j := 1; j < len(sorted)-1; j++ {
+			dist[sorted[j]] += (obj[sorted[j+1]][k] - obj[sorted[j-1]][k]) / (hi - lo)
+		}
+	}
+}
+
+// ParetoSelector selects parents the way NSGA-II does. The population is
+// sorted into Pareto fronts, then a binary tournament picks the parent. The
+// member in the lower front wins. If both are in the same front, the one
+// with the larger crowding distance wins, which keeps the population spread
+// out along the front.
+//
+// Objectives must be set before Prepare is called. The fitness scores
+// passed to Prepare are not used.
+// ------------------------------------------------------------------------------
+type ParetoSelector struct {
+	Objectives [][]float64 // the objectives of each Investor, all to be maximized
+	rank       []int
+	dist       []float64
+}
+
+// Name returns the name of the selection method
+func (p *ParetoSelector) Name() string {
+	return "pareto"
+}
+
+// Prepare computes the rank and crowding distance of each Investor
+func (p *ParetoSelector) Prepare(fitness []float64, picks int, rng *util.RandStream) {
+	var fronts [][]int
+	fronts, p.rank = NonDominatedSort(p.Objectives)
+	p.dist = make([]float64, len(p.Objectives))
+	for _, front := range fronts {
+		CrowdingDistance(p.Objectives, front, p.dist)
+	}
+}
+
+// Select runs a binary tournament using the crowded comparison operator
+func (p *ParetoSelector) Select(rng *util.RandStream, used int) int {
+	a := uniformSelect(len(p.rank), rng, used)
+	b := uniformSelect(len(p.rank), rng, used)
+	if p.rank[b] < p.rank[a] || (p.rank[b] == p.rank[a] && p.dist[b] > p.dist[a]) {
+		return b
+	}
+	return a
+}
+
+// CalculateAllObjectives sets the Objectives of every Investor for the
+// generation that ran from dtStart to dtStop.
+// ------------------------------------------------------------------------------
+func (s *Simulator) CalculateAllObjectives(dtStart, dtStop time.Time) {
+	for i := 0; i < len(s.Investors); i++ {
+		s.Investors[i].CalculateObjectives(dtStart, dtStop)
+	}
+}
+
+// dumpParetoFront writes the Investors on the Pareto front of the current
+// generation to paretofront.csv. The rows for each generation are appended
+// to the file.
+//
+// RETURNS
+//
+//	any error encountered
+//
+// ------------------------------------------------------------------------------
+func (s *Simulator) dumpParetoFront() error {
+	var file *os.File
+	var err error
+	fname := s.Cfg.GenerateFName("paretofront")
+	if s.GensCompleted == 1 {
+		file, err = os.Create(fname)
+	} else {
+		file, err = os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if s.GensCompleted == 1 {
+		fmt.Fprintf(file, "%q,%q,%q,%q,%q,%q,%q,%q\n", "Generation", "Portfolio Value", "Annualized Return", "Max Drawdown", "Trades", "Correctness", "Crowding Distance", "DNA")
+	}
+
+	obj := make([][]float64, len(s.Investors))
+	for i := range s.Investors {
+		obj[i] = s.Investors[i].Objectives.Vector()
+	}
+	fronts, _ := NonDominatedSort(obj)
+	if len(fronts) == 0 {
+		return nil
+	}
+	front := fronts[0]
+	dist := make([]float64, len(obj))
+	CrowdingDistance(obj, front, dist)
+	sort.SliceStable(front, func(a, b int) bool {
+		return s.Investors[front[a]].Objectives.AnnualizedReturn > s.Investors[front[b]].Objectives.AnnualizedReturn
+	})
+	for _, i := range front {
+		v := &s.Investors[i]
+		fmt.Fprintf(file, "%d,%9.2f,%.2f%%,%.2f%%,%d,%.4f,%.4f,%q\n",
+			s.GensCompleted,
+			v.PortfolioValueC1,
+			v.Objectives.AnnualizedReturn*100,
+			v.Objectives.MaxDrawdown*100,
+			v.Objectives.Trades,
+			v.Objectives.Correctness,
+			dist[i],
+			v.DNA())
+	}
+	return nil
+}
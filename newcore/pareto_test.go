@@ -0,0 +1,131 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+func TestNonDominatedSort(t *testing.T) {
+	obj := [][]float64{
+		{1, 5}, // 0: front 0
+		{2, 4}, // 1: front 0
+		{1, 4}, // 2: dominated by 0 and 1
+		{5, 1}, // 3: front 0
+		{0, 0}, // 4: dominated by everyone
+		{1, 3}, // 5: dominated by 2
+		{2, 4}, // 6: same as 1, neither dominates the other
+	}
+	fronts, rank := NonDominatedSort(obj)
+	want := [][]int{{0, 1, 3, 6}, {2}, {5}, {4}}
+	if !reflect.DeepEqual(fronts, want) {
+		t.Errorf("expected fronts %v, got %v", want, fronts)
+	}
+	wantRank := []int{0, 0, 1, 0, 3, 2, 0}
+	if !reflect.DeepEqual(rank, wantRank) {
+		t.Errorf("expected ranks %v, got %v", wantRank, rank)
+	}
+}
+
+func TestCrowdingDistance(t *testing.T) {
+	obj := [][]float64{{0, 4}, {1, 3}, {3, 1}, {4, 0}}
+	dist := make([]float64, len(obj))
+	CrowdingDistance(obj, []int{0, 1, 2, 3}, dist)
+	if !math.IsInf(dist[0], 1) || !math.IsInf(dist[3], 1) {
+		t.Errorf("expected the ends of the front to have infinite distance, got %v", dist)
+	}
+	// (3-0)/4 for each of the two objectives
+	if math.Abs(dist[1]-1.5) > 1e-9 || math.Abs(dist[2]-1.5) > 1e-9 {
+		t.Errorf("expected distance 1.5 for members 1 and 2, got %v", dist)
+	}
+}
+
+// TestParetoSelector verifies that the binary tournament favors the better
+// fronts.
+func TestParetoSelector(t *testing.T) {
+	p := ParetoSelector{Objectives: [][]float64{{3, 3}, {2, 2}, {1, 1}, {0, 0}}}
+	freq := selectionFrequencies(&p, make([]float64, 4), 100000)
+	// With a binary tournament, rank r of N wins with ((N-r)^2 - (N-r-1)^2) / N^2
+	want := []float64{7.0 / 16, 5.0 / 16, 3.0 / 16, 1.0 / 16}
+	checkFrequencies(t, "pareto", freq, want, 0.01)
+}
+
+// TestObjectivesTrades checks that only the buys made in the generation
+// count as trades, not flat fees or the Investments of another generation
+func TestObjectivesTrades(t *testing.T) {
+	f, _ := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	dtStart := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	dtStop := time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)
+	inv.Investments = []Investment{
+		{T3: dtStart.AddDate(0, 0, -3), T3C1: 100},               // an earlier generation
+		{T3: dtStart, T3C1: 100},                                 // a buy
+		{T3: dtStart.AddDate(0, 0, 9), T3C1: 0, Completed: true}, // a flat fee
+		{T3: dtStop, T3C1: 50},                                   // a buy
+	}
+	inv.CalculateObjectives(dtStart, dtStop)
+	if inv.Objectives.Trades != 2 {
+		t.Errorf("expected 2 trades, got %d", inv.Objectives.Trades)
+	}
+}
+
+// TestMultiObjectiveSimulation runs a simulation in multi-objective mode and
+// checks that the Pareto front report only contains Investors that are not
+// dominated.
+func TestMultiObjectiveSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 3)
+	cfg.MultiObjective = true
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	if _, ok := s.factory.selector.(*ParetoSelector); !ok {
+		t.Fatalf("expected a ParetoSelector, got %s", s.factory.selector.Name())
+	}
+
+	b, err := os.ReadFile(cfg.GenerateFName("paretofront"))
+	if err != nil {
+		t.Fatalf("could not read the Pareto front report: %s", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	gens := map[string]bool{}
+	for _, l := range lines[1:] {
+		gens[l[:strings.Index(l, ",")]] = true
+	}
+	if len(lines) < 2 || len(gens) != 3 {
+		t.Fatalf("expected Pareto front rows for 3 generations, got:\n%s", b)
+	}
+
+	//---------------------------------------------------------------
+	// The last generation is still in s.Investors
+	//---------------------------------------------------------------
+	obj := make([][]float64, len(s.Investors))
+	for i := range s.Investors {
+		obj[i] = s.Investors[i].Objectives.Vector()
+		if s.Investors[i].Risk.MaxDrawdown < 0 || s.Investors[i].Risk.MaxDrawdown >= 1 {
+			t.Errorf("Investor %d has MaxDrawdown %f", i, s.Investors[i].Risk.MaxDrawdown)
+		}
+	}
+	fronts, _ := NonDominatedSort(obj)
+	n := 0
+	for _, l := range lines[1:] {
+		if strings.HasPrefix(l, "3,") {
+			n++
+		}
+	}
+	if n != len(fronts[0]) {
+		t.Errorf("expected %d Investors on the front of generation 3, the report has %d", len(fronts[0]), n)
+	}
+	for _, i := range fronts[0] {
+		for j := range obj {
+			if dominates(obj[j], obj[i]) {
+				t.Errorf("Investor %d is on the front but is dominated by %d", i, j)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package newcore
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// This module has the portfolio Investor. When cfg.Pairs is set, every
+// Investor holds the home currency, C1, and the foreign currency of each of
+// the pairs. Each Influencer has a Pair gene and advises the Investor on that
+// pair only. The Investor trades each pair in a sleeve: an Investor of its
+// own, with the pair's C2, its own balances and Investments, and the
+// Influencers of the pair. The home currency is split equally among the
+// sleeves at the start of each generation, and the portfolio value is the
+// sum of the values of the sleeves.
+
+// PairResult is how one pair of a portfolio Investor did
+// ------------------------------------------------------------------------------
+type PairResult struct {
+	Pair           string  // the currency pair, like USDJPY
+	InitFunds      float64 // C1 the pair started the generation with
+	PortfolioValue float64 // C1 value of the pair's balances on the Investor's DtPortfolioValue
+	BalanceC1      float64 // the pair's C1 balance
+	BalanceC2      float64 // the pair's C2 balance, in the pair's foreign currency
+	Buys           int     // number of Investments made in the pair, not counting flat fees
+	ExecCost       float64 // C1 lost to the spread and slippage of the execution model
+}
+
+// String returns a short summary of the pair's results for the reports
+func (r *PairResult) String() string {
+	return fmt.Sprintf("%s %.2f (%.2f %s, %.2f %s, %d buys)", r.Pair, r.PortfolioValue, r.BalanceC1, r.Pair[:3], r.BalanceC2, r.Pair[3:], r.Buys)
+}
+
+// pairSummary returns the summaries of results separated by " | "
+func pairSummary(results []PairResult) string {
+	var list []string
+	for k := range results {
+		list = append(list, results[k].String())
+	}
+	return strings.Join(list, " | ")
+}
+
+// isPortfolio returns true if i trades several pairs in sleeves. Sleeves and
+// the Investors of a configuration without Pairs trade a single pair.
+func (i *Investor) isPortfolio() bool {
+	return len(i.cfg.Pairs) > 0
+}
+
+// exchangeSelector returns the FieldSelector of the exchange rate of the pair
+// the Investor trades
+func (i *Investor) exchangeSelector() newdata.FieldSelector {
+	return newdata.FieldSelector{Metric: "EXClose", Locale: i.cfg.C1, Locale2: i.cfg.C2}
+}
+
+// sleeveConfig returns the configuration of a sleeve. It is cfg with the
+// currencies of pair and funds of home currency.
+// ------------------------------------------------------------------------------
+func sleeveConfig(cfg *util.AppConfig, pair string, funds float64) *util.AppConfig {
+	c := *cfg
+	c.C1, c.C2 = pair[:3], pair[3:]
+	c.Pairs = nil
+	c.InitFunds = funds
+	c.DNALog = false // the portfolio saves the crucible stats, not its sleeves
+	return &c
+}
+
+// openSleeves creates a sleeve for each pair the Investor has Influencers
+// for, a rule tree Investor trades every pair with a copy of its rules. The
+// home currency is split equally among the sleeves.
+// ------------------------------------------------------------------------------
+func (i *Investor) openSleeves() {
+	var pairs []string
+	for _, pair := range i.cfg.Pairs {
+		if i.Rules != nil || len(i.pairInfluencers(pair)) > 0 {
+			pairs = append(pairs, pair)
+		}
+	}
+	i.Sleeves = make([]Investor, len(pairs))
+	for k, pair := range pairs {
+		sl := &i.Sleeves[k]
+		sl.cfg = sleeveConfig(i.cfg, pair, i.cfg.InitFunds/float64(len(pairs)))
+		sl.factory = i.factory
+		sl.db = i.db
+		sl.rng = i.rng
+		sl.ID = i.ID + "-" + pair
+		sl.IDGenerated = true
+		sl.CreatedByDNA = true
+		sl.W1, sl.W2 = i.W1, i.W2
+		sl.Strategy = i.Strategy
+		sl.StrategyParams = i.StrategyParams
+		sl.Sizing = i.Sizing
+		sl.lotIDs = i.lotIDs
+		sl.BalanceC1, sl.BalanceC2 = i.factory.fundsSplit(sl.cfg)
+		sl.StopLossThreshold = (1 - sl.cfg.StopLoss) * sl.BalanceC1
+		if i.Rules != nil {
+			sl.Rules = &RuleSet{Buy: i.Rules.Buy.copy(), Sell: i.Rules.Sell.copy()} // the nodes hold the pair's metrics
+		}
+		for _, inf := range i.pairInfluencers(pair) {
+			inf.SetMyInvestor(sl)
+			inf.SetAppConfig(sl.cfg)
+			sl.Influencers = append(sl.Influencers, inf)
+		}
+	}
+}
+
+// pairInfluencers returns the Influencers that advise on pair
+func (i *Investor) pairInfluencers(pair string) []Influencer {
+	var list []Influencer
+	for _, inf := range i.Influencers {
+		if inf.GetPair() == pair {
+			list = append(list, inf)
+		}
+	}
+	return list
+}
+
+// portfolioDailyRun is DailyRun for a portfolio Investor. Each sleeve does
+// its daily run, then the portfolio's balances are updated.
+// ------------------------------------------------------------------------------
+func (i *Investor) portfolioDailyRun(T3 time.Time, winddown bool) error {
+	if i.Sleeves == nil {
+		i.openSleeves()
+	}
+	for k := range i.Sleeves {
+		if err := i.Sleeves[k].DailyRun(T3, winddown); err != nil {
+			return err
+		}
+	}
+	i.syncSleeves()
+	if i.cfg.PredictionMode {
+		return nil
+	}
+	if i.cfg.CrucibleMode && i.cfg.DNALog {
+		i.SaveCrucibleStats(T3)
+	}
+	i.recordPV(T3)
+	return nil
+}
+
+// syncSleeves sets the balances and costs of the portfolio to the sums of
+// those of its sleeves. BalanceC2 and Carry.C2 add up amounts of different
+// currencies, they only tell whether any C2 is held or was earned. The
+// PairResults have them for each pair.
+// ------------------------------------------------------------------------------
+func (i *Investor) syncSleeves() {
+	i.BalanceC1, i.BalanceC2 = 0, 0
+	i.StopLossCount = 0
+	i.ExecCost = 0
+	i.Carry = Carry{}
+	for k := range i.Sleeves {
+		sl := &i.Sleeves[k]
+		i.BalanceC1 += sl.BalanceC1
+		i.BalanceC2 += sl.BalanceC2
+		i.StopLossCount += sl.StopLossCount
+		i.ExecCost += sl.ExecCost
+		i.Carry.C1 += sl.Carry.C1
+		i.Carry.C2 += sl.Carry.C2
+		i.Carry.Total += sl.Carry.Total
+	}
+}
+
+// closeSleeves is called at the end of a generation. The Investments of all
+// the sleeves, tagged with their pair, become the Investments of the
+// portfolio, in the order they were bought.
+// ------------------------------------------------------------------------------
+func (i *Investor) closeSleeves() {
+	if len(i.Sleeves) == 0 {
+		return
+	}
+	i.syncSleeves()
+	i.Investments = nil
+	for k := range i.Sleeves {
+		pair := i.Sleeves[k].cfg.C1 + i.Sleeves[k].cfg.C2
+		for _, m := range i.Sleeves[k].Investments {
+			m.Pair = pair
+			i.Investments = append(i.Investments, m)
+		}
+	}
+	sort.SliceStable(i.Investments, func(a, b int) bool { return i.Investments[a].T3.Before(i.Investments[b].T3) })
+}
+
+// portfolioValue returns the sum of the values of the sleeves on t, in C1
+func (i *Investor) portfolioValue(t time.Time) float64 {
+	pv := float64(0)
+	for k := range i.Sleeves {
+		pv += i.Sleeves[k].PortfolioValue(t)
+	}
+	return pv
+}
+
+// PairResults returns the results of each sleeve of a portfolio Investor,
+// valued on DtPortfolioValue. It returns nil if the Investor is not a
+// portfolio.
+// ------------------------------------------------------------------------------
+func (i *Investor) PairResults() []PairResult {
+	var results []PairResult
+	for k := range i.Sleeves {
+		sl := &i.Sleeves[k]
+		buys := 0
+		for j := range sl.Investments {
+			if !sl.Investments[j].isFlatFee() {
+				buys++
+			}
+		}
+		results = append(results, PairResult{
+			Pair:           sl.cfg.C1 + sl.cfg.C2,
+			InitFunds:      sl.cfg.InitFunds,
+			PortfolioValue: sl.PortfolioValue(i.DtPortfolioValue),
+			BalanceC1:      sl.BalanceC1,
+			BalanceC2:      sl.BalanceC2,
+			Buys:           buys,
+			ExecCost:       sl.ExecCost,
+		})
+	}
+	return results
+}
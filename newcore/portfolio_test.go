@@ -0,0 +1,171 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// openPortfolioTestDB opens a CSV database like openSimTestDB with a second
+// pair, USDEUR
+func openPortfolioTestDB(t *testing.T, cfg *util.AppConfig) *newdata.Database {
+	return openSimTestDBColumns(t, cfg, []parityColumn{
+		{"USDJPYEXClose", 110}, {"USDEUREXClose", 0.9}, {"USDDR", 1.5}, {"JPYDR", -0.1}, {"EURDR", -0.5}, {"Gold", 1800},
+	})
+}
+
+// portfolioTestCfg returns the simTestCfg configuration trading USDJPY and
+// USDEUR
+func portfolioTestCfg(dir string, generations int) *util.AppConfig {
+	cfg := simTestCfg(dir, generations)
+	cfg.Pairs = []string{"USDJPY", "USDEUR"}
+	if err := util.ValidatePairs(cfg); err != nil {
+		panic(err)
+	}
+	return cfg
+}
+
+// TestPairGene checks that the Pair gene survives a DNA round trip and that
+// it is rejected when the config has no Pairs
+func TestPairGene(t *testing.T) {
+	cfg := portfolioTestCfg(t.TempDir(), 1)
+	db := openPortfolioTestDB(t, cfg)
+	util.Init(41)
+	var f Factory
+	f.Init(cfg, db, nil, nil)
+
+	for _, dna := range []string{
+		"{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR,Pair=USDEUR}",
+		"{TAInfluencer,Delta2=-1,Indicator=Bollinger,Metric=EXClose,Pair=USDEUR,Period=5,Width=1.10}",
+	} {
+		inf, err := f.NewInfluencer(dna)
+		if err != nil {
+			t.Fatalf("NewInfluencer(%s) returned error: %s", dna, err)
+		}
+		if inf.GetPair() != "USDEUR" || inf.DNA() != dna {
+			t.Errorf("expected %s, got %s with pair %s", dna, inf.DNA(), inf.GetPair())
+		}
+	}
+	if _, err := f.NewInfluencer("{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR,Pair=USDGBP}"); err == nil {
+		t.Errorf("expected an error for a pair that is not in Pairs")
+	}
+	inf, err := f.NewInfluencer("{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}")
+	if err != nil || (inf.GetPair() != "USDJPY" && inf.GetPair() != "USDEUR") {
+		t.Errorf("expected a random pair from Pairs, got %v", err)
+	}
+
+	cfg.Pairs = nil
+	if _, err := f.NewInfluencer("{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR,Pair=USDEUR}"); err == nil {
+		t.Errorf("expected an error for a Pair gene without Pairs in the config")
+	}
+}
+
+// TestPortfolioSleeves runs an Investor with an Influencer for each pair
+// day by day. Each pair gets a sleeve with half the funds.
+func TestPortfolioSleeves(t *testing.T) {
+	cfg := portfolioTestCfg(t.TempDir(), 1)
+	db := openPortfolioTestDB(t, cfg)
+	util.Init(41)
+	var f Factory
+	f.Init(cfg, db, nil, nil)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR,Pair=USDEUR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold,Pair=USDJPY}]}")
+
+	dtStart, dtStop := time.Time(cfg.DtStart), time.Time(cfg.DtStop)
+	for dt := dtStart; !dt.After(dtStop); dt = dt.AddDate(0, 0, 1) {
+		if err := inv.DailyRun(dt, false); err != nil {
+			t.Fatalf("DailyRun(%s) returned error: %s", dt.Format("1/2/2006"), err)
+		}
+	}
+	inv.closeSleeves()
+	inv.DtPortfolioValue = dtStop
+
+	if len(inv.Sleeves) != 2 {
+		t.Fatalf("expected 2 sleeves, got %d", len(inv.Sleeves))
+	}
+	sum := float64(0)
+	for k, r := range inv.PairResults() {
+		if r.Pair != cfg.Pairs[k] || r.InitFunds != cfg.InitFunds/2 {
+			t.Errorf("sleeve %d: expected %s with %.2f, got %+v", k, cfg.Pairs[k], cfg.InitFunds/2, r)
+		}
+		if inv.Sleeves[k].cfg.C2 != cfg.Pairs[k][3:] {
+			t.Errorf("sleeve %d: expected C2 %s, got %s", k, cfg.Pairs[k][3:], inv.Sleeves[k].cfg.C2)
+		}
+		sum += r.PortfolioValue
+	}
+	if pv := inv.PortfolioValue(dtStop); math.Abs(pv-sum) > 1e-6 {
+		t.Errorf("portfolio value %f is not the sum of its pairs, %f", pv, sum)
+	}
+	for _, m := range inv.Investments {
+		if m.Pair != "USDJPY" && m.Pair != "USDEUR" {
+			t.Errorf("Investment %s has pair %q", m.ID(), m.Pair)
+		}
+	}
+	if n := len(inv.Investments); n != len(inv.Sleeves[0].Investments)+len(inv.Sleeves[1].Investments) {
+		t.Errorf("expected the Investments of both sleeves, got %d", n)
+	}
+
+	//---------------------------------------------------------------
+	// A flat fee is not a buy
+	//---------------------------------------------------------------
+	buys := inv.PairResults()[0].Buys
+	inv.Sleeves[0].Investments = append(inv.Sleeves[0].Investments, Investment{T3: dtStop, T4: dtStop, T3C1: 0, Completed: true})
+	if n := inv.PairResults()[0].Buys; n != buys {
+		t.Errorf("expected %d buys after a flat fee, got %d", buys, n)
+	}
+}
+
+// TestPortfolioInvestor runs a simulation of portfolio Investors. The value
+// of each Investor must be the sum of the values of its sleeves, and every
+// Investment must be tagged with the pair it traded.
+func TestPortfolioInvestor(t *testing.T) {
+	cfg := portfolioTestCfg(t.TempDir(), 2)
+	db := openPortfolioTestDB(t, cfg)
+
+	util.Init(77)
+	s := runSimTest(t, cfg, db, "")
+
+	pairs := map[string]bool{}
+	for k := range s.Investors {
+		inv := &s.Investors[k]
+		if len(inv.Sleeves) == 0 {
+			t.Fatalf("Investor %d has no sleeves", k)
+		}
+		sum := float64(0)
+		for _, r := range inv.PairResults() {
+			sum += r.PortfolioValue
+		}
+		if pv := inv.PortfolioValue(inv.DtPortfolioValue); math.Abs(pv-sum) > 1e-6 {
+			t.Errorf("Investor %d: portfolio value %f is not the sum of its pairs, %f", k, pv, sum)
+		}
+		for _, inf := range inv.Influencers {
+			if inf.GetPair() == "" {
+				t.Errorf("Investor %d: influencer %s has no pair", k, inf.DNA())
+			}
+		}
+		for _, m := range inv.Investments {
+			if m.Pair != "USDJPY" && m.Pair != "USDEUR" {
+				t.Errorf("Investor %d: Investment %s has pair %q", k, m.ID(), m.Pair)
+			}
+			pairs[m.Pair] = true
+		}
+	}
+	if len(pairs) == 0 {
+		t.Errorf("expected Investments in at least one pair")
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), `"Pairs"`) || !strings.Contains(string(b), "Pairs: USDJPY, USDEUR") {
+		t.Errorf("expected the pairs in the financial report:\n%s", b)
+	}
+}
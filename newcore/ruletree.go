@@ -0,0 +1,559 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// A rule tree Investor decides with two evolved boolean expression trees
+// rather than with the votes of Influencers. One tree says when to buy, the
+// other when to sell. Trees are built from these operations:
+//
+//	and(a,b), or(a,b)  - boolean a and b, boolean a or b
+//	gt(x,y), lt(x,y)   - compare two numeric nodes
+//	chg(M,n)           - relative change of feature M over the n days ending on T3-1
+//	z(M,n)             - z-score of feature M on T3-n, using its rolling Mean and StdDevSquared
+//	a number           - a threshold
+//
+// A feature is EXClose (the C1C2 exchange rate), the name of a metric that
+// has no locale, or C1:M or C2:M for a metric M of C1 or C2. For example:
+//
+//	Buy=and(gt(chg(EXClose,5),0.012),lt(z(C1:DR,1),-0.5))
+//
+// A rule tree Investor's DNA has Buy and Sell in place of Influencers.
+// ----------------------------------------------------------------------------
+
+// RuleTreeStrategy is the Strategy name in the DNA of a rule tree Investor
+const RuleTreeStrategy = "RuleTree"
+
+// ruleMaxLag is the most days a feature can look back
+const ruleMaxLag = 60
+
+// ruleThresholds are the ranges of the random thresholds compared to each
+// kind of feature
+var ruleThresholds = map[string][2]float64{
+	"chg": {-0.1, 0.1},
+	"z":   {-3, 3},
+}
+
+// RuleNode is a node of a rule tree
+// ----------------------------------------------------------------------------
+type RuleNode struct {
+	Op     string      // and, or, gt, lt, chg, z or const
+	Metric string      // chg, z: the feature
+	Lag    int         // chg, z: how many days back
+	Value  float64     // const: the value
+	Kids   []*RuleNode // and, or: two boolean nodes. gt, lt: two numeric nodes
+	ref    newdata.MetricRef
+	hasRef bool // ref has been set
+}
+
+// RuleSet is the genotype of a rule tree Investor
+// ----------------------------------------------------------------------------
+type RuleSet struct {
+	Buy  *RuleNode // buy when true and Sell is false
+	Sell *RuleNode // sell when true and Buy is false
+}
+
+// isBool returns true if the node evaluates to a boolean
+func (n *RuleNode) isBool() bool {
+	switch n.Op {
+	case "and", "or", "gt", "lt":
+		return true
+	}
+	return false
+}
+
+// String returns the DNA of the tree rooted at n
+// ----------------------------------------------------------------------------
+func (n *RuleNode) String() string {
+	switch n.Op {
+	case "const":
+		return strconv.FormatFloat(n.Value, 'f', -1, 64)
+	case "chg", "z":
+		return fmt.Sprintf("%s(%s,%d)", n.Op, n.Metric, n.Lag)
+	}
+	return fmt.Sprintf("%s(%s,%s)", n.Op, n.Kids[0], n.Kids[1])
+}
+
+// copy returns a deep copy of the tree rooted at n
+func (n *RuleNode) copy() *RuleNode {
+	c := RuleNode{Op: n.Op, Metric: n.Metric, Lag: n.Lag, Value: n.Value}
+	for _, k := range n.Kids {
+		c.Kids = append(c.Kids, k.copy())
+	}
+	return &c
+}
+
+// Size returns the number of nodes in the tree rooted at n
+func (n *RuleNode) Size() int {
+	s := 1
+	for _, k := range n.Kids {
+		s += k.Size()
+	}
+	return s
+}
+
+// Depth returns the number of levels in the tree rooted at n
+func (n *RuleNode) Depth() int {
+	d := 0
+	for _, k := range n.Kids {
+		if x := k.Depth(); x > d {
+			d = x
+		}
+	}
+	return d + 1
+}
+
+// slots returns a pointer to every link in the tree whose root is *root,
+// including root itself, in preorder. Replacing *slot replaces a subtree.
+func ruleSlots(root **RuleNode) []**RuleNode {
+	slots := []**RuleNode{root}
+	for j := range (*root).Kids {
+		slots = append(slots, ruleSlots(&(*root).Kids[j])...)
+	}
+	return slots
+}
+
+// Size returns the number of nodes in both rules
+func (r *RuleSet) Size() int {
+	return r.Buy.Size() + r.Sell.Size()
+}
+
+// copy returns a deep copy of the rules
+func (r *RuleSet) copy() *RuleSet {
+	return &RuleSet{Buy: r.Buy.copy(), Sell: r.Sell.copy()}
+}
+
+// ruleLimits returns the largest depth and number of nodes of a rule tree
+func ruleLimits(cfg *util.AppConfig) (int, int) {
+	depth, nodes := cfg.RuleMaxDepth, cfg.RuleMaxNodes
+	if depth <= 0 {
+		depth = util.DefaultRuleMaxDepth
+	}
+	if nodes <= 0 {
+		nodes = util.DefaultRuleMaxNodes
+	}
+	return depth, nodes
+}
+
+// ruleFeatures returns the names of every feature a rule tree may use
+// ----------------------------------------------------------------------------
+func (f *Factory) ruleFeatures() []string {
+	fs := []string{"EXClose"}
+	for _, m := range f.db.Mim.MInfluencerSubclassMetricNames {
+		switch {
+		case m == "EXClose":
+			// already there
+		case f.db.Mim.MInfluencerSubclasses[m].LocaleType == newdata.LocaleNone:
+			fs = append(fs, m)
+		default:
+			fs = append(fs, "C1:"+m, "C2:"+m)
+		}
+	}
+	return fs
+}
+
+//==============================================================================
+//  PARSING
+//==============================================================================
+
+// ParseRuleTree parses the DNA of a rule tree, for example the value of Buy
+// in a rule tree Investor's DNA. The tree must be boolean and use only known
+// features.
+// ----------------------------------------------------------------------------
+func (f *Factory) ParseRuleTree(s string) (*RuleNode, error) {
+	p := ruleParser{s: s}
+	n, err := p.node()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, fmt.Errorf("rule %q: unexpected %q at position %d", s, p.s[p.pos:], p.pos)
+	}
+	features := map[string]bool{}
+	for _, v := range f.ruleFeatures() {
+		features[v] = true
+	}
+	if err = checkRule(n, true, features); err != nil {
+		return nil, fmt.Errorf("rule %q: %s", s, err)
+	}
+	return n, nil
+}
+
+// checkRule checks that the node has the wanted kind, that its children have
+// the kinds its operation needs and that its features are known
+func checkRule(n *RuleNode, wantBool bool, features map[string]bool) error {
+	if n.isBool() != wantBool {
+		return fmt.Errorf("%s is in the place of a %s", n, map[bool]string{true: "boolean", false: "number"}[wantBool])
+	}
+	switch n.Op {
+	case "chg", "z":
+		if !features[n.Metric] {
+			return fmt.Errorf("unknown feature: %s", n.Metric)
+		}
+		if n.Lag < 1 || n.Lag > ruleMaxLag {
+			return fmt.Errorf("%s: the lag must be in the range 1 to %d", n, ruleMaxLag)
+		}
+	case "and", "or":
+		for _, k := range n.Kids {
+			if err := checkRule(k, true, features); err != nil {
+				return err
+			}
+		}
+	case "gt", "lt":
+		for _, k := range n.Kids {
+			if err := checkRule(k, false, features); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// ruleParser is a recursive descent parser for rule trees
+type ruleParser struct {
+	s   string
+	pos int
+}
+
+// token returns the text up to the next parenthesis or comma
+func (p *ruleParser) token() string {
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune("(),", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	return strings.TrimSpace(p.s[start:p.pos])
+}
+
+// expect consumes the character c
+func (p *ruleParser) expect(c byte) error {
+	if p.pos >= len(p.s) || p.s[p.pos] != c {
+		return fmt.Errorf("rule %q: expected %q at position %d", p.s, c, p.pos)
+	}
+	p.pos++
+	return nil
+}
+
+// node parses one node and its children
+func (p *ruleParser) node() (*RuleNode, error) {
+	tok := p.token()
+	if p.pos >= len(p.s) || p.s[p.pos] != '(' {
+		v, err := strconv.ParseFloat(tok, 64)
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: expected a number, found %q", p.s, tok)
+		}
+		return &RuleNode{Op: "const", Value: v}, nil
+	}
+	p.pos++ // the opening parenthesis
+	n := RuleNode{Op: tok}
+	switch tok {
+	case "and", "or", "gt", "lt":
+		for j := 0; j < 2; j++ {
+			if j > 0 {
+				if err := p.expect(','); err != nil {
+					return nil, err
+				}
+			}
+			k, err := p.node()
+			if err != nil {
+				return nil, err
+			}
+			n.Kids = append(n.Kids, k)
+		}
+	case "chg", "z":
+		n.Metric = p.token()
+		if err := p.expect(','); err != nil {
+			return nil, err
+		}
+		lag, err := strconv.Atoi(p.token())
+		if err != nil {
+			return nil, fmt.Errorf("rule %q: bad lag in %s(%s,...)", p.s, tok, n.Metric)
+		}
+		n.Lag = lag
+	default:
+		return nil, fmt.Errorf("rule %q: unknown operation %q", p.s, tok)
+	}
+	if err := p.expect(')'); err != nil {
+		return nil, err
+	}
+	return &n, nil
+}
+
+//==============================================================================
+//  EVALUATION
+//==============================================================================
+
+// ruleField returns the FieldSelector for a feature
+func (i *Investor) ruleField(name string) newdata.FieldSelector {
+	switch {
+	case name == "EXClose":
+		return newdata.FieldSelector{Metric: name, Locale: i.cfg.C1, Locale2: i.cfg.C2}
+	case strings.HasPrefix(name, "C1:"):
+		return newdata.FieldSelector{Metric: name[3:], Locale: i.cfg.C1}
+	case strings.HasPrefix(name, "C2:"):
+		return newdata.FieldSelector{Metric: name[3:], Locale: i.cfg.C2}
+	}
+	return newdata.FieldSelector{Metric: name}
+}
+
+// value returns the feature of the node n on dt. ok is false if the database
+// has no value for it.
+func (n *RuleNode) value(inv *Investor, dt time.Time) (m newdata.MetricInfo, ok bool, err error) {
+	if !n.hasRef {
+		n.ref = newdata.NewMetricRef(inv.ruleField(n.Metric))
+		n.hasRef = true
+	}
+	m, err = inv.db.Value(&n.ref, dt)
+	if err != nil {
+		return m, false, nildataErr(err, dt)
+	}
+	return m, true, nil
+}
+
+// number evaluates a numeric node for T3. ok is false if a feature it needs
+// has no value.
+func (n *RuleNode) number(inv *Investor, t3 time.Time) (float64, bool, error) {
+	switch n.Op {
+	case "const":
+		return n.Value, true, nil
+	case "chg":
+		dt := t3.AddDate(0, 0, -1)
+		m1, ok1, err := n.value(inv, dt)
+		if err != nil {
+			return 0, false, err
+		}
+		m0, ok0, err := n.value(inv, dt.AddDate(0, 0, -n.Lag))
+		if err != nil || !ok0 || !ok1 || m0.Value == 0 {
+			return 0, false, err
+		}
+		return (m1.Value - m0.Value) / math.Abs(m0.Value), true, nil
+	case "z":
+		m, ok, err := n.value(inv, t3.AddDate(0, 0, -n.Lag))
+		if err != nil || !ok || !m.StatsValid || m.StdDevSquared <= 0 {
+			return 0, false, err
+		}
+		return (m.Value - m.Mean) / math.Sqrt(m.StdDevSquared), true, nil
+	}
+	return 0, false, fmt.Errorf("%s is not a number", n)
+}
+
+// test evaluates a boolean node for T3. ok is false if a feature it needs has
+// no value. Both children are always evaluated.
+func (n *RuleNode) test(inv *Investor, t3 time.Time) (bool, bool, error) {
+	switch n.Op {
+	case "and", "or":
+		a, oka, err := n.Kids[0].test(inv, t3)
+		if err != nil {
+			return false, false, err
+		}
+		b, okb, err := n.Kids[1].test(inv, t3)
+		if err != nil {
+			return false, false, err
+		}
+		if n.Op == "and" {
+			return a && b, oka && okb, nil
+		}
+		return a || b, oka && okb, nil
+	case "gt", "lt":
+		x, okx, err := n.Kids[0].number(inv, t3)
+		if err != nil {
+			return false, false, err
+		}
+		y, oky, err := n.Kids[1].number(inv, t3)
+		if err != nil {
+			return false, false, err
+		}
+		if n.Op == "gt" {
+			return x > y, okx && oky, nil
+		}
+		return x < y, okx && oky, nil
+	}
+	return false, false, fmt.Errorf("%s is not boolean", n)
+}
+
+// ruleCourseOfAction decides the course of action of a rule tree Investor.
+// It buys when the buy rule is true and the sell rule is false, sells when
+// the reverse is true, and holds otherwise. If either rule needs a value the
+// database does not have, it abstains.
+// ----------------------------------------------------------------------------
+func (i *Investor) ruleCourseOfAction(T3 time.Time, coa CourseOfAction) (CourseOfAction, error) {
+	buy, okb, err := i.Rules.Buy.test(i, T3)
+	if err == nil {
+		var sell, oks bool
+		sell, oks, err = i.Rules.Sell.test(i, T3)
+		switch {
+		case err != nil || !okb || !oks:
+		case buy && !sell:
+			coa.Action, coa.BuyVotes = "buy", 1
+		case sell && !buy:
+			coa.Action, coa.SellVotes = "sell", 1
+		default:
+			coa.Action, coa.HoldVotes = "hold", 1
+		}
+		if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
+			fmt.Printf("\tBuy rule:  %-5v  %s\n", buy && okb, i.Rules.Buy)
+			fmt.Printf("\tSell rule: %-5v  %s\n", sell && oks, i.Rules.Sell)
+		}
+	}
+	if err != nil && !strings.Contains(err.Error(), "nildata") {
+		return coa, err
+	}
+	if coa.Action == "abstain" {
+		coa.Abstains = 1
+	} else {
+		coa.ActionPct = 1
+	}
+	coa.TotalVotes = coa.BuyVotes + coa.HoldVotes + coa.SellVotes
+	if (i.cfg.Trace && !i.cfg.CrucibleMode) || i.cfg.PredictionMode {
+		if i.COATrace.Event == nil {
+			i.COATrace.Event = &TEvent{Dt: T3}
+		}
+		i.FormatCOA(&coa)
+	}
+	return coa, nil
+}
+
+//==============================================================================
+//  GENETIC OPERATORS
+//==============================================================================
+
+// NewRuleSet returns random buy and sell rules. Random trees are at most 4
+// levels deep, they can grow deeper through crossover.
+// ----------------------------------------------------------------------------
+func (f *Factory) NewRuleSet(rng *util.RandStream) *RuleSet {
+	depth, _ := ruleLimits(f.cfg)
+	if depth > 4 {
+		depth = 4
+	}
+	features := f.ruleFeatures()
+	return &RuleSet{
+		Buy:  f.randomRule(rng, depth, features),
+		Sell: f.randomRule(rng, depth, features),
+	}
+}
+
+// randomRule returns a random boolean tree at most depth levels deep
+func (f *Factory) randomRule(rng *util.RandStream, depth int, features []string) *RuleNode {
+	if depth <= 2 || rng.Intn(3) == 0 {
+		return f.randomComparison(rng, features)
+	}
+	return &RuleNode{
+		Op:   []string{"and", "or"}[rng.Intn(2)],
+		Kids: []*RuleNode{f.randomRule(rng, depth-1, features), f.randomRule(rng, depth-1, features)},
+	}
+}
+
+// randomComparison returns a random feature compared to a random threshold
+func (f *Factory) randomComparison(rng *util.RandStream, features []string) *RuleNode {
+	x := RuleNode{
+		Op:     []string{"chg", "z"}[rng.Intn(2)],
+		Metric: features[rng.Intn(len(features))],
+		Lag:    rng.InRange(1, ruleMaxLag),
+	}
+	r := ruleThresholds[x.Op]
+	y := RuleNode{Op: "const", Value: fitGene(r[0]+rng.Float64()*(r[1]-r[0]), r[0], r[1], 4)}
+	return &RuleNode{
+		Op:   []string{"gt", "lt"}[rng.Intn(2)],
+		Kids: []*RuleNode{&x, &y},
+	}
+}
+
+// crossoverRuleSet returns the rules of a child of two parents. If only the
+// first parent has rules, the child gets a copy of them.
+// ----------------------------------------------------------------------------
+func (f *Factory) crossoverRuleSet(a, b *RuleSet) *RuleSet {
+	if b == nil {
+		return a.copy()
+	}
+	return &RuleSet{
+		Buy:  f.crossoverRule(a.Buy, b.Buy),
+		Sell: f.crossoverRule(a.Sell, b.Sell),
+	}
+}
+
+// crossoverRule performs subtree crossover. It returns a copy of a with a
+// random subtree replaced by a copy of a random subtree of b of the same
+// kind, boolean or numeric. A child that is deeper than RuleMaxDepth or has
+// more than RuleMaxNodes nodes is discarded and another is tried. If none of
+// the tries fit, the child is a copy of a.
+// ----------------------------------------------------------------------------
+func (f *Factory) crossoverRule(a, b *RuleNode) *RuleNode {
+	maxDepth, maxNodes := ruleLimits(f.cfg)
+	for try := 0; try < 5; try++ {
+		child := a.copy()
+		slots := ruleSlots(&child)
+		slot := slots[f.rng.Intn(len(slots))]
+		var donors []*RuleNode
+		for _, s := range ruleSlots(&b) {
+			if (*s).isBool() == (*slot).isBool() {
+				donors = append(donors, *s)
+			}
+		}
+		if len(donors) == 0 {
+			continue
+		}
+		*slot = donors[f.rng.Intn(len(donors))].copy()
+		if child.Depth() <= maxDepth && child.Size() <= maxNodes {
+			return child
+		}
+	}
+	return a.copy()
+}
+
+// mutateRule performs point mutation. It returns a copy of t with one node
+// changed: and and or swap, gt and lt swap, a feature changes its kind, its
+// metric or its lag, a threshold moves by mutateGene. The shape of the tree
+// does not change.
+// ----------------------------------------------------------------------------
+func (f *Factory) mutateRule(t *RuleNode) *RuleNode {
+	child := t.copy()
+	slots := ruleSlots(&child)
+	k := f.rng.Intn(len(slots))
+	n := *slots[k]
+	switch n.Op {
+	case "and":
+		n.Op = "or"
+	case "or":
+		n.Op = "and"
+	case "gt":
+		n.Op = "lt"
+	case "lt":
+		n.Op = "gt"
+	case "chg", "z":
+		switch f.rng.Intn(3) {
+		case 0:
+			n.Op = map[string]string{"chg": "z", "z": "chg"}[n.Op]
+		case 1:
+			features := f.ruleFeatures()
+			n.Metric = features[f.rng.Intn(len(features))]
+		default:
+			n.Lag = int(f.mutateGene(float64(n.Lag), 1, ruleMaxLag, 0))
+		}
+	case "const":
+		//----------------------------------------------------------------
+		// The range of a threshold depends on the feature it is compared
+		// to, which is its sibling
+		//----------------------------------------------------------------
+		r := ruleThresholds["chg"]
+		for _, s := range slots {
+			if kids := (*s).Kids; len(kids) == 2 && (kids[0] == n || kids[1] == n) {
+				sib := kids[0]
+				if sib == n {
+					sib = kids[1]
+				}
+				if x, ok := ruleThresholds[sib.Op]; ok {
+					r = x
+				}
+			}
+		}
+		n.Value = f.mutateGene(n.Value, math.Min(r[0], n.Value), math.Max(r[1], n.Value), 4)
+	}
+	return child
+}
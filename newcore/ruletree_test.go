@@ -0,0 +1,194 @@
+package newcore
+
+import (
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// TestParseRuleTree parses good and bad rules. A good rule must print back
+// exactly as it was written.
+func TestParseRuleTree(t *testing.T) {
+	f, _ := taTestFactory(t)
+	for _, s := range []string{
+		"gt(chg(EXClose,5),0.012)",
+		"and(gt(chg(EXClose,5),0.012),lt(z(C1:DR,1),-0.5))",
+		"or(lt(z(Gold,60),z(C2:DR,3)),and(gt(0,chg(C1:DR,1)),lt(chg(EXClose,2),-0.0005)))",
+	} {
+		n, err := f.ParseRuleTree(s)
+		if err != nil {
+			t.Fatalf("ParseRuleTree(%s) returned error: %s", s, err)
+		}
+		if n.String() != s {
+			t.Errorf("expected %s, got %s", s, n)
+		}
+	}
+	n, _ := f.ParseRuleTree("and(gt(chg(EXClose,5),0.012),lt(z(C1:DR,1),-0.5))")
+	if n.Size() != 7 || n.Depth() != 3 {
+		t.Errorf("expected 7 nodes and 3 levels, got %d and %d", n.Size(), n.Depth())
+	}
+
+	for _, bad := range []string{
+		"",
+		"chg(EXClose,5)",                  // not boolean
+		"gt(chg(EXClose,5),0.01",          // missing parenthesis
+		"gt(chg(EXClose,5),0.01))",        // extra parenthesis
+		"gt(chg(Unobtainium,5),0.01)",     // unknown feature
+		"gt(chg(EXClose,0),0.01)",         // lag too small
+		"gt(chg(EXClose,61),0.01)",        // lag too large
+		"gt(lt(z(Gold,1),0),0.01)",        // boolean in the place of a number
+		"and(gt(z(Gold,1),0),0.01)",       // number in the place of a boolean
+		"xor(gt(z(Gold,1),0),gt(0,0.01))", // unknown operation
+	} {
+		if _, err := f.ParseRuleTree(bad); err == nil {
+			t.Errorf("expected an error for %q", bad)
+		}
+	}
+}
+
+// TestRuleTreeInvestorDNA checks that a rule tree Investor's DNA round trips
+// through NewInvestorFromDNA and that its ID is the hash of its DNA, like
+// any other Investor.
+func TestRuleTreeInvestorDNA(t *testing.T) {
+	f, _ := taTestFactory(t)
+	dna := "{Investor;Strategy=RuleTree;InvW1=0.5000;InvW2=0.5000;Buy=and(gt(chg(EXClose,5),0.012),lt(z(C1:DR,1),-0.5));Sell=lt(chg(EXClose,10),-0.02)}"
+	inv := f.NewInvestorFromDNA(dna)
+	if inv.Rules == nil || len(inv.Influencers) != 0 {
+		t.Fatalf("expected a rule tree Investor, got %s", inv.DNA())
+	}
+	s := inv.DNA()
+	if want := strings.Replace(dna, "{Investor;", "{Investor;ID="+inv.ID+";", 1); s != want {
+		t.Errorf("expected %s, got %s", want, s)
+	}
+	if id := util.HashDNA(strings.TrimPrefix(dna, "{Investor;")); inv.ID != id {
+		t.Errorf("expected ID %s, got %s", id, inv.ID)
+	}
+	inv2 := f.NewInvestorFromDNA(s)
+	if inv2.DNA() != s {
+		t.Errorf("expected %s, got %s", s, inv2.DNA())
+	}
+	if HoldWindows(s) != "defaults" {
+		t.Errorf("expected defaults, got %s", HoldWindows(s))
+	}
+}
+
+// TestRuleTreeOperators breeds and mutates random rule trees. Every child
+// must parse, stay within the depth and node limits, and the rules must
+// change over the generations.
+func TestRuleTreeOperators(t *testing.T) {
+	f, _ := taTestFactory(t)
+	f.cfg.RuleMaxDepth = 5
+	f.cfg.RuleMaxNodes = 15
+	f.cfg.GeneMutationSigma = 0.2
+	pop := []*RuleSet{}
+	for k := 0; k < 20; k++ {
+		pop = append(pop, f.NewRuleSet(f.rng))
+	}
+	seen := map[string]bool{}
+	for gen := 0; gen < 50; gen++ {
+		next := []*RuleSet{}
+		for k := range pop {
+			r := f.crossoverRuleSet(pop[k], pop[(k+1)%len(pop)])
+			if k%2 == 0 {
+				r.Buy = f.mutateRule(r.Buy)
+			} else {
+				r.Sell = f.mutateRule(r.Sell)
+			}
+			for _, n := range []*RuleNode{r.Buy, r.Sell} {
+				if n.Depth() > 5 || n.Size() > 15 {
+					t.Fatalf("rule exceeds the limits: %s", n)
+				}
+				if _, err := f.ParseRuleTree(n.String()); err != nil {
+					t.Fatalf("child rule does not parse: %s", err)
+				}
+				seen[n.String()] = true
+			}
+			next = append(next, r)
+		}
+		pop = next
+	}
+	if len(seen) < 100 {
+		t.Errorf("expected many different rules, got %d", len(seen))
+	}
+
+	//---------------------------------------------------------------
+	// Mutation never changes the parent and keeps the shape
+	//---------------------------------------------------------------
+	n, _ := f.ParseRuleTree("and(gt(chg(EXClose,5),0.012),lt(z(C1:DR,1),-0.5))")
+	s := n.String()
+	for k := 0; k < 100; k++ {
+		m := f.mutateRule(n)
+		if n.String() != s {
+			t.Fatalf("mutateRule changed its argument: %s", n)
+		}
+		if m.Size() != n.Size() || m.Depth() != n.Depth() {
+			t.Fatalf("mutateRule changed the shape: %s", m)
+		}
+	}
+}
+
+// TestRuleCourseOfAction checks the decision of a rule tree Investor for
+// every combination of its rules. chg(EXClose,1) is always greater than -1.
+func TestRuleCourseOfAction(t *testing.T) {
+	f, _ := taTestFactory(t)
+	yes := "gt(chg(EXClose,1),-1)"
+	no := "lt(chg(EXClose,1),-1)"
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		buy, sell, action string
+		dt                time.Time
+	}{
+		{yes, no, "buy", dt},
+		{no, yes, "sell", dt},
+		{yes, yes, "hold", dt},
+		{no, no, "hold", dt},
+		{yes, no, "abstain", time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC)}, // no data before this date
+	} {
+		inv := f.NewInvestorFromDNA("{Investor;Strategy=RuleTree;InvW1=0.5000;InvW2=0.5000;Buy=" + c.buy + ";Sell=" + c.sell + "}")
+		coa, err := inv.DecideCourseOfAction(c.dt)
+		if err != nil {
+			t.Fatalf("DecideCourseOfAction returned error: %s", err)
+		}
+		if coa.Action != c.action {
+			t.Errorf("buy=%s sell=%s: expected %s, got %s", c.buy, c.sell, c.action, coa.Action)
+		}
+		if c.action != "abstain" && (coa.ActionPct != 1 || coa.TotalVotes != 1) {
+			t.Errorf("expected ActionPct 1 and 1 vote, got %f and %f", coa.ActionPct, coa.TotalVotes)
+		}
+	}
+}
+
+// TestRuleTreeSimulation runs a simulation of rule tree Investors only. The
+// Investors must keep their rules from generation to generation and show
+// up in the financial report.
+func TestRuleTreeSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 3)
+	cfg.RuleTreeInvestors = 1
+	cfg.RuleParsimony = 0.001
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	for _, inv := range s.Investors {
+		if inv.Rules == nil || len(inv.Influencers) != 0 {
+			t.Fatalf("expected a rule tree Investor, got %s", inv.DNA())
+		}
+		if depth, nodes := ruleLimits(cfg); inv.Rules.Buy.Depth() > depth || inv.Rules.Size() > 2*nodes {
+			t.Errorf("rules exceed the limits: %s", inv.DNA())
+		}
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), "Strategy=RuleTree") || !strings.Contains(string(b), "Rule Tree Investors: 100%") {
+		t.Errorf("expected rule tree Investors in the financial report:\n%s", b)
+	}
+}
@@ -0,0 +1,274 @@
+package newcore
+
+import (
+	"sort"
+
+	"github.com/stmansour/psim/util"
+)
+
+// Selector chooses the parents of the next generation from the Investors
+// of the generation that just finished.
+//
+// Prepare is called once per generation with the fitness score of every
+// Investor in the population, in population order, and the number of
+// parents that will be selected. Select then returns the index of a parent.
+// If used is a valid index, Select will not return it unless there is no
+// other choice.
+// ------------------------------------------------------------------------------
+type Selector interface {
+	Name() string
+	Prepare(fitness []float64, picks int, rng *util.RandStream)
+	Select(rng *util.RandStream, used int) int
+}
+
+// NewSelector returns the Selector for cfg.SelectionMethod. Roulette wheel
+// selection is used if no method was specified. In multi-objective mode the
+// SelectionMethod is ignored, the parents are chosen by Pareto rank.
+// ------------------------------------------------------------------------------
+func NewSelector(cfg *util.AppConfig) Selector {
+	if cfg.MultiObjective {
+		return &ParetoSelector{}
+	}
+	switch cfg.SelectionMethod {
+	case util.SelectTournament:
+		return &TournamentSelector{K: cfg.TournamentSize}
+	case util.SelectRank:
+		return &RankSelector{Pressure: DefaultRankPressure}
+	case util.SelectSUS:
+		return &SUSSelector{}
+	default:
+		return &RouletteSelector{}
+	}
+}
+
+// weightedSelect spins a roulette wheel where the size of each slot is
+// proportional to its weight. The slot at index used is left out. If all
+// weights are 0 every slot has the same chance.
+// ------------------------------------------------------------------------------
+func weightedSelect(weights []float64, rng *util.RandStream, used int) int {
+	n := len(weights)
+	if n == 0 {
+		return -1
+	}
+	total := float64(0)
+	for i, w := range weights {
+		if i != used && w > 0 {
+			total += w
+		}
+	}
+	if total <= 0 {
+		return uniformSelect(n, rng, used)
+	}
+	spin := rng.Float64() * total
+	runningSum := float64(0)
+	last := -1
+	for i, w := range weights {
+		if i == used || w <= 0 {
+			continue
+		}
+		runningSum += w
+		last = i
+		if runningSum > spin {
+			return i
+		}
+	}
+	return last // rounding errors
+}
+
+// uniformSelect returns a random index in [0,n) other than used
+// ------------------------------------------------------------------------------
+func uniformSelect(n int, rng *util.RandStream, used int) int {
+	if n < 2 || used < 0 || used >= n {
+		return rng.Intn(n)
+	}
+	i := rng.Intn(n - 1)
+	if i >= used {
+		i++
+	}
+	return i
+}
+
+// RouletteSelector implements "roulette wheel selection". Each Investor
+// gets a section of the wheel whose size is proportional to its fitness.
+// A random number in the range [0, SumOfFitnessScores) is the "spin" of the
+// wheel. The Investor whose section contains the spin is selected.
+// ------------------------------------------------------------------------------
+type RouletteSelector struct {
+	fitness []float64
+}
+
+// Name returns the name of the selection method
+func (r *RouletteSelector) Name() string {
+	return util.SelectRoulette
+}
+
+// Prepare saves the fitness scores of the population
+func (r *RouletteSelector) Prepare(fitness []float64, picks int, rng *util.RandStream) {
+	r.fitness = fitness
+}
+
+// Select spins the wheel
+func (r *RouletteSelector) Select(rng *util.RandStream, used int) int {
+	return weightedSelect(r.fitness, rng, used)
+}
+
+// TournamentSelector implements tournament selection. K Investors are
+// chosen at random and the one with the highest fitness wins. K = 1 is a
+// random selection, the selection pressure increases with K.
+// ------------------------------------------------------------------------------
+type TournamentSelector struct {
+	K       int // number of Investors in each tournament
+	fitness []float64
+}
+
+// Name returns the name of the selection method
+func (t *TournamentSelector) Name() string {
+	return util.SelectTournament
+}
+
+// Prepare saves the fitness scores of the population
+func (t *TournamentSelector) Prepare(fitness []float64, picks int, rng *util.RandStream) {
+	t.fitness = fitness
+}
+
+// Select runs a tournament
+func (t *TournamentSelector) Select(rng *util.RandStream, used int) int {
+	k := t.K
+	if k < 1 {
+		k = 1
+	}
+	best := -1
+	for j := 0; j < k; j++ {
+		i := uniformSelect(len(t.fitness), rng, used)
+		if best < 0 || t.fitness[i] > t.fitness[best] {
+			best = i
+		}
+	}
+	return best
+}
+
+// DefaultRankPressure is the selection pressure used by linear rank
+// selection. It is the expected number of times the best Investor is
+// selected per Investor in the population. It must be in the range 1 to 2.
+var DefaultRankPressure = float64(1.5)
+
+// RankSelector implements linear rank selection. The Investors are sorted
+// by fitness and the chance of being selected depends only on the rank, not
+// on the fitness score itself. With a population of N the Investor with
+// rank r (0 = lowest fitness) has the weight:
+//
+//	2 - Pressure + 2*(Pressure-1)*r/(N-1)
+//
+// This keeps a few very fit Investors from taking over the population, and
+// it still works when most fitness scores are 0.
+// ------------------------------------------------------------------------------
+type RankSelector struct {
+	Pressure float64 // selection pressure, 1 to 2
+	weights  []float64
+}
+
+// Name returns the name of the selection method
+func (r *RankSelector) Name() string {
+	return util.SelectRank
+}
+
+// Prepare ranks the population and computes the weight of each Investor
+func (r *RankSelector) Prepare(fitness []float64, picks int, rng *util.RandStream) {
+	n := len(fitness)
+	idx := make([]int, n)
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool { return fitness[idx[a]] < fitness[idx[b]] })
+
+	r.weights = make([]float64, n)
+	for rank, i := range idx {
+		r.weights[i] = 1
+		if n > 1 {
+			r.weights[i] = 2 - r.Pressure + 2*(r.Pressure-1)*float64(rank)/float64(n-1)
+		}
+	}
+}
+
+// Select spins a roulette wheel sized by rank
+func (r *RankSelector) Select(rng *util.RandStream, used int) int {
+	return weightedSelect(r.weights, rng, used)
+}
+
+// SUSSelector implements stochastic universal sampling. Rather than
+// spinning the roulette wheel once per parent, it spins it once per
+// generation with as many evenly spaced pointers as there are parents to
+// select. Every Investor is selected either the floor or the ceiling of its
+// expected number of times, so the selection has no spread from the
+// expected values.
+// ------------------------------------------------------------------------------
+type SUSSelector struct {
+	fitness []float64
+	picks   []int // the parents selected by Prepare, in random order
+	next    int   // the next entry in picks to hand out
+}
+
+// Name returns the name of the selection method
+func (s *SUSSelector) Name() string {
+	return util.SelectSUS
+}
+
+// Prepare selects all the parents for the generation
+func (s *SUSSelector) Prepare(fitness []float64, picks int, rng *util.RandStream) {
+	s.fitness = fitness
+	s.picks = s.picks[:0]
+	s.next = 0
+	n := len(fitness)
+	if n == 0 || picks < 1 {
+		return
+	}
+
+	total := float64(0)
+	for _, f := range fitness {
+		if f > 0 {
+			total += f
+		}
+	}
+	if total <= 0 {
+		for j := 0; j < picks; j++ {
+			s.picks = append(s.picks, j%n)
+		}
+	} else {
+		spacing := total / float64(picks)
+		pointer := rng.Float64() * spacing
+		runningSum := float64(0)
+		i := 0
+		for j := 0; j < picks; j++ {
+			for i < n-1 && (fitness[i] <= 0 || runningSum+fitness[i] <= pointer) {
+				if fitness[i] > 0 {
+					runningSum += fitness[i]
+				}
+				i++
+			}
+			s.picks = append(s.picks, i)
+			pointer += spacing
+		}
+	}
+
+	//------------------------------------------------------------------
+	// The pointers select the parents in population order. Shuffle them
+	// so that the pairs of parents are random.
+	//------------------------------------------------------------------
+	rng.Shuffle(len(s.picks), func(a, b int) {
+		s.picks[a], s.picks[b] = s.picks[b], s.picks[a]
+	})
+}
+
+// Select returns the next parent selected by Prepare. If it is used, the
+// first selection that is not is swapped in. When all the selections have
+// been handed out it falls back to roulette wheel selection.
+func (s *SUSSelector) Select(rng *util.RandStream, used int) int {
+	for j := s.next; j < len(s.picks); j++ {
+		if s.picks[j] != used {
+			s.picks[s.next], s.picks[j] = s.picks[j], s.picks[s.next]
+			s.next++
+			return s.picks[s.next-1]
+		}
+	}
+	return weightedSelect(s.fitness, rng, used)
+}
@@ -0,0 +1,163 @@
+package newcore
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stmansour/psim/util"
+)
+
+// selectionFrequencies prepares sel with fitness and returns how often each
+// index was selected in n selections.
+func selectionFrequencies(sel Selector, fitness []float64, n int) []float64 {
+	rng := util.NewRandStream(7)
+	sel.Prepare(fitness, n, rng)
+	counts := make([]float64, len(fitness))
+	for j := 0; j < n; j++ {
+		counts[sel.Select(rng, -1)]++
+	}
+	for i := range counts {
+		counts[i] /= float64(n)
+	}
+	return counts
+}
+
+// checkFrequencies compares observed selection frequencies with the
+// expected probabilities
+func checkFrequencies(t *testing.T, name string, got, want []float64, tolerance float64) {
+	t.Helper()
+	for i := range want {
+		if math.Abs(got[i]-want[i]) > tolerance {
+			t.Errorf("%s: index %d selected with frequency %.4f, expected %.4f", name, i, got[i], want[i])
+		}
+	}
+}
+
+// linearFitness returns the population 0, 1, 2, ... n-1
+func linearFitness(n int) []float64 {
+	fitness := make([]float64, n)
+	for i := range fitness {
+		fitness[i] = float64(i)
+	}
+	return fitness
+}
+
+func TestRouletteSelector(t *testing.T) {
+	fitness := linearFitness(10) // sums to 45
+	want := make([]float64, len(fitness))
+	for i := range want {
+		want[i] = fitness[i] / 45
+	}
+	checkFrequencies(t, "roulette", selectionFrequencies(&RouletteSelector{}, fitness, 200000), want, 0.005)
+
+	//---------------------------------------------------------------
+	// When all fitness scores are 0 everyone has the same chance,
+	// the last Investor is not favored.
+	//---------------------------------------------------------------
+	zeros := make([]float64, 10)
+	uniform := []float64{0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1, 0.1}
+	checkFrequencies(t, "roulette zeros", selectionFrequencies(&RouletteSelector{}, zeros, 200000), uniform, 0.005)
+}
+
+func TestTournamentSelector(t *testing.T) {
+	//---------------------------------------------------------------
+	// With distinct fitness scores, the Investor with rank r (0 is the
+	// lowest) wins a tournament of size k with probability
+	// ((r+1)/N)^k - (r/N)^k.
+	//---------------------------------------------------------------
+	n := 10
+	fitness := linearFitness(n)
+	for _, k := range []int{1, 2, 5} {
+		want := make([]float64, n)
+		for r := 0; r < n; r++ {
+			want[r] = math.Pow(float64(r+1)/float64(n), float64(k)) - math.Pow(float64(r)/float64(n), float64(k))
+		}
+		got := selectionFrequencies(&TournamentSelector{K: k}, fitness, 200000)
+		checkFrequencies(t, "tournament", got, want, 0.005)
+	}
+}
+
+func TestRankSelector(t *testing.T) {
+	//---------------------------------------------------------------
+	// Only the rank matters. Huge differences in fitness do not give
+	// the best Investor more than Pressure/N.
+	//---------------------------------------------------------------
+	n := 10
+	fitness := []float64{0, 0, 0, 1, 2, 3, 4, 5, 6, 1000000}
+	pressure := 1.8
+	want := make([]float64, n)
+	for r := 0; r < n; r++ {
+		want[r] = (2 - pressure + 2*(pressure-1)*float64(r)/float64(n-1)) / float64(n)
+	}
+	got := selectionFrequencies(&RankSelector{Pressure: pressure}, fitness, 200000)
+	checkFrequencies(t, "rank", got, want, 0.005)
+	if math.Abs(got[n-1]-pressure/float64(n)) > 0.005 {
+		t.Errorf("best Investor selected with frequency %.4f, expected %.4f", got[n-1], pressure/float64(n))
+	}
+}
+
+func TestSUSSelector(t *testing.T) {
+	//---------------------------------------------------------------
+	// Every Investor is selected the floor or the ceiling of its
+	// expected number of times, for any spin of the wheel.
+	//---------------------------------------------------------------
+	fitness := []float64{0, 3.5, 1, 0, 7.25, 2, 0.5, 11, 4, 0.75}
+	total := float64(0)
+	for _, f := range fitness {
+		total += f
+	}
+	picks := 40
+	for seed := int64(1); seed <= 50; seed++ {
+		rng := util.NewRandStream(seed)
+		var sel SUSSelector
+		sel.Prepare(fitness, picks, rng)
+		counts := make([]int, len(fitness))
+		for j := 0; j < picks; j++ {
+			counts[sel.Select(rng, -1)]++
+		}
+		for i, f := range fitness {
+			expected := f / total * float64(picks)
+			if float64(counts[i]) < math.Floor(expected) || float64(counts[i]) > math.Ceil(expected) {
+				t.Errorf("seed %d: index %d selected %d times, expected %.2f", seed, i, counts[i], expected)
+			}
+		}
+	}
+}
+
+// TestSelectorsAvoidUsed verifies that no selector returns the first parent
+// as the second parent when there is another choice.
+func TestSelectorsAvoidUsed(t *testing.T) {
+	fitness := []float64{0, 0, 100, 0.01}
+	for _, sel := range []Selector{&RouletteSelector{}, &TournamentSelector{K: 3}, &RankSelector{Pressure: 2}, &SUSSelector{}} {
+		rng := util.NewRandStream(3)
+		sel.Prepare(fitness, 1000, rng)
+		for j := 0; j < 1000; j++ {
+			if i := sel.Select(rng, 2); i == 2 || i < 0 || i >= len(fitness) {
+				t.Errorf("%s: Select returned %d", sel.Name(), i)
+				break
+			}
+		}
+	}
+}
+
+func TestNewSelector(t *testing.T) {
+	cfg := util.CreateTestingCFG()
+	for _, m := range util.SelectionMethods {
+		cfg.SelectionMethod = m
+		if err := util.ValidateSelectionMethod(cfg); err != nil {
+			t.Fatalf("%s: ValidateSelectionMethod returned error: %s", m, err)
+		}
+		if name := NewSelector(cfg).Name(); name != m {
+			t.Errorf("expected a %s selector, got %s", m, name)
+		}
+	}
+	cfg.SelectionMethod = "Tournament"
+	cfg.TournamentSize = 0
+	if err := util.ValidateSelectionMethod(cfg); err != nil || cfg.SelectionMethod != util.SelectTournament || cfg.TournamentSize != 3 {
+		t.Errorf("expected tournament with k = 3, got %s with k = %d, err = %v", cfg.SelectionMethod, cfg.TournamentSize, err)
+	}
+	cfg.SelectionMethod = "elitist"
+	if err := util.ValidateSelectionMethod(cfg); err == nil {
+		t.Errorf("expected an error for SelectionMethod elitist")
+	}
+}
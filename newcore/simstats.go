@@ -5,6 +5,7 @@ import (
 	"os"
 	"runtime"
 	"sort"
+	"strings"
 	"time"
 
 	"github.com/stmansour/psim/util"
@@ -36,6 +37,11 @@ func (s *Simulator) UpdateTopInvestors() {
 			DNA:            s.Investors[i].DNA(),
 			GenNo:          s.GensCompleted,
 			StopLossCount:  s.Investors[i].StopLossCount,
+			Risk:           s.Investors[i].Risk,
+			Exposure:       s.Investors[i].Exposure,
+			Carry:          s.Investors[i].Carry,
+			ExecCost:       s.Investors[i].ExecCost,
+			Pairs:          s.Investors[i].PairResults(),
 		}
 		newTopInvestors = append(newTopInvestors, newTopInvestor)
 	}
@@ -207,12 +213,60 @@ func (s *Simulator) dumpFitnessScores() error {
 	return nil
 }
 
+// dumpInfluencerReport writes the fitness of every Influencer of every
+// Investor in the current generation to infrep.csv
+// ----------------------------------------------------------------------------
+func (s *Simulator) dumpInfluencerReport() error {
+	var file *os.File
+	var err error
+	fname := s.Cfg.GenerateFName("infrep")
+	if s.GensCompleted == 1 {
+		file, err = os.Create(fname)
+	} else {
+		file, err = os.OpenFile(fname, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if s.GensCompleted == 1 {
+		fmt.Fprintf(file, "%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q\n", "Generation", "Investor", "Metric", "Subclass", "Predictions", "Active", "Judged", "Correct", "Correctness", "Activity", "Fitness", "DNA")
+	}
+
+	for i := range s.Investors {
+		v := &s.Investors[i]
+		id := v.GenerateInvestorID()
+		for _, inf := range v.Influencers {
+			ps := NewPredictionStats(inf.GetMyPredictions())
+			fmt.Fprintf(file, "%d,%q,%q,%q,%d,%d,%d,%d,%.4f,%.4f,%.4f,%q\n",
+				s.GensCompleted,
+				id,
+				inf.GetMetric(),
+				inf.Subclass(),
+				ps.Predictions,
+				ps.Active,
+				ps.Judged,
+				ps.Correct,
+				ps.Correctness(),
+				ps.Activity(),
+				inf.CalculateFitnessScore(),
+				inf.DNA())
+		}
+	}
+	return nil
+}
+
 // printNewPopStats - total up all the counts for different types of influencers
 // and print.
 func (s *Simulator) printNewPopStats(newpop []Investor) {
 	m := map[string]int{}
 	tot := 0
+	rules := 0
 	for _, v := range newpop {
+		if v.Rules != nil {
+			rules++
+		}
 		for _, inf := range v.Influencers {
 			m[inf.GetMetric()]++
 		}
@@ -221,6 +275,9 @@ func (s *Simulator) printNewPopStats(newpop []Investor) {
 	avg := float64(tot) / float64(len(newpop))
 	fmt.Printf("------------------------------\n")
 	fmt.Printf("New Population:  size: %d,  avg # Infl: %5.2f,   unique: %d\n", len(newpop), avg, len(m))
+	if rules > 0 {
+		fmt.Printf("Rule Tree Investors: %d\n", rules)
+	}
 
 	// Create a slice to hold the keys
 	keys := make([]string, 0, len(m))
@@ -343,6 +400,8 @@ func (s *Simulator) ReportHeader(file *os.File, bSim bool) {
 	if s.db.Datatype == "CSV" {
 		fmt.Fprintf(file, "\"Database: %s\"\n", s.db.CSVDB.DBFname)
 		fmt.Fprintf(file, "\"Nil data requests: %d\"\n", s.db.CSVDB.Nildata)
+	} else if s.db.Datatype == "SQLITE" {
+		fmt.Fprintf(file, "\"Database: %s  (SQLite)\"\n", s.db.SQLDB.DBFname)
 	} else {
 		fmt.Fprintf(file, "\"Database: %s  (SQL)\"\n", s.db.SQLDB.Name)
 	}
@@ -363,14 +422,49 @@ func (s *Simulator) ReportHeader(file *os.File, bSim bool) {
 	}
 	fmt.Fprintf(file, "\"C1: %s\"\n", s.Cfg.C1)
 	fmt.Fprintf(file, "\"C2: %s\"\n", s.Cfg.C2)
+	if len(s.Cfg.Pairs) > 0 {
+		fmt.Fprintf(file, "\"Pairs: %s  (portfolio Investors)\"\n", strings.Join(s.Cfg.Pairs, ", "))
+	}
 
 	fmt.Fprintf(file, "\"Population: %d\"\n", s.Cfg.PopulationSize)
 	fmt.Fprintf(file, "\"Influencers: min %d,  max %d\"\n", s.Cfg.MinInfluencers, s.Cfg.MaxInfluencers)
+	if len(s.Cfg.COAStrategies) > 0 {
+		fmt.Fprintf(file, "\"COA Strategies: %s\"\n", strings.Join(s.Cfg.COAStrategies, ", "))
+	}
+	if s.Cfg.RuleTreeInvestors > 0 {
+		depth, nodes := ruleLimits(s.Cfg)
+		fmt.Fprintf(file, "\"Rule Tree Investors: %.0f%%  (max depth %d, max nodes %d, parsimony %g)\"\n", s.Cfg.RuleTreeInvestors*100, depth, nodes, s.Cfg.RuleParsimony)
+	}
 	fmt.Fprintf(file, "\"Initial Funds: %.2f %s\"\n", s.Cfg.InitFunds, s.Cfg.C1)
 	fmt.Fprintf(file, "\"Initial Funds Split: %v\"\n", s.Cfg.SplitInitFunds)
 	fmt.Fprintf(file, "\"Standard Investment: %.2f %s\"\n", s.Cfg.StdInvestment, s.Cfg.C1)
+	if s.Cfg.EvolvePositionSizing || (len(s.Cfg.PositionSizing) > 0 && s.Cfg.PositionSizing != util.SizingStandard) {
+		fmt.Fprintf(file, "\"Position Sizing: %s\"\n", sizingSummary(s.Cfg))
+	}
 	fmt.Fprintf(file, "\"Stop Loss: %.2f%%\"\n", s.Cfg.StopLoss*100)
+	if exitRulesOn(s.Cfg) {
+		fmt.Fprintf(file, "\"Exit Rules: %s\"\n", exitSummary(s.Cfg))
+	}
+	if len(s.Cfg.ExecutionModel) > 0 && s.Cfg.ExecutionModel != util.ExecMid {
+		fmt.Fprintf(file, "\"Execution Model: %s\"\n", executionSummary(s.Cfg))
+	}
+	if len(s.Cfg.CarryRates) > 0 {
+		fmt.Fprintf(file, "\"Carry Rates: %s\"\n", carrySummary(s.Cfg))
+	}
+	if !s.factory.cal.everyDay() || s.Cfg.TradingDayDeltas {
+		fmt.Fprintf(file, "\"Trading Calendar: %s\"\n", calendarSummary(s.Cfg, s.factory.cal))
+	}
 	fmt.Fprintf(file, "\"Preserve Elite: %v  (%5.2f%%)\"\n", s.Cfg.PreserveElite, s.Cfg.PreserveElitePct)
+	if t, ok := s.factory.selector.(*TournamentSelector); ok {
+		fmt.Fprintf(file, "\"Selection Method: %s  (k = %d)\"\n", t.Name(), t.K)
+	} else if s.Cfg.MultiObjective {
+		fmt.Fprintf(file, "\"Selection Method: %s  (NSGA-II: annualized return, max drawdown, trades, correctness)\"\n", s.factory.selector.Name())
+	} else {
+		fmt.Fprintf(file, "\"Selection Method: %s\"\n", s.factory.selector.Name())
+	}
+	if !s.Cfg.MultiObjective && len(s.Cfg.FitnessMetric) > 0 {
+		fmt.Fprintf(file, "\"Fitness Metric: %s\"\n", s.Cfg.FitnessMetric)
+	}
 	fmt.Fprintf(file, "\"Transaction Fee: %.2f (flat rate)  %5.1f bps\"\n", s.Cfg.TxnFee, s.Cfg.TxnFeeFactor*10000)
 	fmt.Fprintf(file, "\"Investor Bonus Plan: %v\"\n", s.Cfg.InvestorBonusPlan)
 	fmt.Fprintf(file, "\"Gen 0 Elites: %v\"\n", s.Cfg.Gen0Elites)
@@ -36,13 +36,18 @@ type SimulationStatistics struct {
 // in order to generate the financial report.
 // ------------------------------------------------------------------------------------
 type TopInvestor struct {
-	DtPV           time.Time // the date all C2 was settled if settled after the simalation end date
-	PortfolioValue float64   // value of the Investor's funds on the day the simulation ended
-	DNA            string    // DNA string to recreate this Investor
-	GenNo          int       // which generation did this Investor come from
-	BalanceC1      float64   // Investor's C1 balance on simulation end date
-	BalanceC2      float64   // Investor's C2 balance on simulation end date
-	StopLossCount  int       // number of times the investor invoked StopLoss
+	DtPV           time.Time    // the date all C2 was settled if settled after the simalation end date
+	PortfolioValue float64      // value of the Investor's funds on the day the simulation ended
+	DNA            string       // DNA string to recreate this Investor
+	GenNo          int          // which generation did this Investor come from
+	BalanceC1      float64      // Investor's C1 balance on simulation end date
+	BalanceC2      float64      // Investor's C2 balance on simulation end date
+	StopLossCount  int          // number of times the investor invoked StopLoss
+	Risk           RiskMetrics  // risk-adjusted metrics for the generation
+	Exposure       Exposure     // how much of its capital the Investor put to work in the generation
+	Carry          Carry        // interest earned on the balances in the generation
+	ExecCost       float64      // C1 lost to the spread and slippage of the execution model in the generation
+	Pairs          []PairResult // portfolio Investors only: the results of each pair
 }
 
 // Simulator is a simulator object
@@ -71,6 +76,8 @@ type Simulator struct {
 	ReportTimestamp              string                 // use this timestamp in the filenames we generate
 	GenInfluencerDistribution    bool                   // show Influencer distribution for each generation
 	FitnessScores                bool                   // save the fitness scores for each generation to dbgFitnessScores.csv
+	InfluencerReport             bool                   // save the fitness of every Influencer for each generation to infrep.csv
+	RealizedGainsReport          bool                   // save every chunk of C2 sold by the top Investors for each generation to gains.csv
 	T3ForThreadPool              time.Time              // timestamp to be used by thread pool
 	WorkerThreads                int                    // number of worker threads in the thread pool
 	TraceTiming                  bool                   // show the timing of the various parts of the simulation
@@ -78,6 +85,8 @@ type Simulator struct {
 	TrackingGenStop              time.Time              // the stop time of the current generation
 	Simtalkport                  int                    // the port on which the simulator is listening for external commands
 	HashDuplicates               int64                  // the count of duplicate Investors encountered
+	ResumeFile                   string                 // if set, Init restores the simulation from this checkpoint instead of creating a population
+	resume                       *Checkpoint            // the checkpoint being resumed, cleared once Run has used it
 }
 
 // ResetSimulator is primarily to support tests. It resets the simulator
@@ -97,9 +106,13 @@ func (s *Simulator) ResetSimulator() {
 	s.maxProfitInvestor = 0
 	// s.maxFitnessScore = 0
 	s.GensCompleted = 0
+	s.LoopsCompleted = 0
+	s.TopInvestors = nil
 	s.GenStats = make([]SimulationStatistics, 0)
 	s.StopTimeSet = false
 	s.WindDownInProgress = false
+	s.ResumeFile = ""
+	s.resume = nil
 }
 
 // SetAppConfig simply sets the simulators pointer to the AppConfig struct
@@ -140,6 +153,9 @@ func (s *Simulator) Init(cfg *util.AppConfig, db *newdata.Database, crucible *Cr
 		s.crucible.DayByDay = DayByDay
 		s.crucible.ReportTopInvestorInvestments = ReportTopInvestorInvestments
 	}
+	if err := ValidateCOAStrategies(cfg); err != nil {
+		return err
+	}
 	s.ir = NewInvestorReport(s)
 	s.factory.Init(s.Cfg, db, s.SqltDB, s)
 	s.FinRpt = &FinRep{}
@@ -155,14 +171,15 @@ func (s *Simulator) Init(cfg *util.AppConfig, db *newdata.Database, crucible *Cr
 	// period of 5 days.
 	//-------------------------------------------------------------------------
 
-	dtStop := time.Date(s.db.CSVDB.DtStop.Year(), s.db.CSVDB.DtStop.Month(), s.db.CSVDB.DtStop.Day(), 0, 0, 0, 0, time.UTC)
+	_, dbDtStop := s.db.DataDateRange()
+	dtStop := time.Date(dbDtStop.Year(), dbDtStop.Month(), dbDtStop.Day(), 0, 0, 0, 0, time.UTC)
 	cfgDtStop := time.Date(time.Time(s.Cfg.DtStop).Year(), time.Time(s.Cfg.DtStop).Month(), time.Time(s.Cfg.DtStop).Day(), 0, 0, 0, 0, time.UTC)
 	if dtStop.Before(cfgDtStop) {
 		diff := cfgDtStop.Sub(dtStop)
 		diffhrs := diff.Abs().Hours()
 		days := int(diffhrs / 24)
 		if days > 0 {
-			fmt.Printf("Database info stops at %s, and this simulation's DtStop is %s.\n", s.db.CSVDB.DtStop.Format("2006-01-02"), time.Time(s.Cfg.DtStop).Format("2006-01-02"))
+			fmt.Printf("Database info stops at %s, and this simulation's DtStop is %s.\n", dbDtStop.Format("2006-01-02"), time.Time(s.Cfg.DtStop).Format("2006-01-02"))
 			fmt.Printf("The difference is %d days.\n", days)
 			fmt.Printf("The grace period for this run is %d days.\n", s.Cfg.GracePeriodDays)
 			if days > s.Cfg.GracePeriodDays {
@@ -170,8 +187,15 @@ func (s *Simulator) Init(cfg *util.AppConfig, db *newdata.Database, crucible *Cr
 				log.Fatalf("Please update the database or increase the grace period in the config file.")
 			}
 		}
-		s.Cfg.DtStop = util.CustomDate(s.db.CSVDB.DtStop)
-		fmt.Printf("Simulation will continue but the DtStop will be adjusted to %s.\n", s.db.CSVDB.DtStop.Format("2006-01-02"))
+		s.Cfg.DtStop = util.CustomDate(dbDtStop)
+		fmt.Printf("Simulation will continue but the DtStop will be adjusted to %s.\n", dbDtStop.Format("2006-01-02"))
+	}
+
+	//------------------------------------------------------------------------
+	// When resuming, the population comes from the checkpoint
+	//------------------------------------------------------------------------
+	if len(s.ResumeFile) > 0 {
+		return s.LoadCheckpoint(s.ResumeFile)
 	}
 
 	//------------------------------------------------------------------------
@@ -287,8 +311,7 @@ func (s *Simulator) NewPopulation() error {
 		// They may be elite, but they cannot carry their balance forward :-)
 		//---------------------------------------------------------------------
 		for k := 0; k < len(elite); k++ {
-			elite[k].BalanceC1, elite[k].BalanceC2 = s.factory.InitialFundsSplit()
-			elite[k].PortfolioValueC1 = 0
+			s.resetElite(&elite[k])
 		}
 		//--------------------------------------
 		// add the elites to the new population
@@ -313,6 +336,31 @@ func (s *Simulator) NewPopulation() error {
 	return nil
 }
 
+// resetElite prepares an elite Investor for the next generation. It starts
+// with fresh funds. With the default FitnessMetric it keeps its fitness
+// score. A risk metric is measured on the trades of a single generation, so
+// with one the elite is scored again.
+// ----------------------------------------------------------------------------
+func (s *Simulator) resetElite(v *Investor) {
+	v.BalanceC1, v.BalanceC2 = s.factory.InitialFundsSplit()
+	v.PortfolioValueC1 = 0
+	v.Investments = nil // its trades, and open lots, belong to the generation it made them in
+	v.StopLossCount = 0
+	v.PVSeries = nil
+	v.Risk = RiskMetrics{}
+	v.Exposure = Exposure{}
+	v.Carry = Carry{}
+	v.carry = carryState{}
+	v.ExecCost = 0
+	v.Sleeves = nil // a portfolio opens new sleeves with fresh funds
+	for j := 0; j < len(v.Influencers); j++ {
+		v.Influencers[j].SetMyPredictions(nil) // influencers are scored on this generation's predictions only
+	}
+	if len(s.Cfg.FitnessMetric) > 0 && s.Cfg.FitnessMetric != util.FitnessDefault {
+		v.FitnessCalculated = false // score it on the next generation
+	}
+}
+
 // SortInvestors calls on each investor to sort itself and its influencers
 // in a consistent order.
 // ----------------------------------------------------------------------------
@@ -352,6 +400,46 @@ func (s *Simulator) worker(tasks <-chan int, results chan<- error) {
 	}
 }
 
+// runInvestors has every Investor do its DailyRun for T3 in the worker pool
+// and waits until the last one has finished.
+// ----------------------------------------------------------------------------
+func (s *Simulator) runInvestors(T3 time.Time) {
+	//-------------------------------------------------
+	// worker pools setup for each day of simulation
+	//-------------------------------------------------
+	if len(s.Investors) < s.WorkerThreads {
+		s.WorkerThreads = len(s.Investors) // but not more than number of investors
+	}
+	tasks := make(chan int, len(s.Investors))     // Send indices of s.Investors to workers, the channel isbuffered to avoid blocking, enough space for every Investor
+	results := make(chan error, len(s.Investors)) // Collect errors or nil if successful
+
+	//---------------------------------------
+	// fire up the workers!
+	//---------------------------------------
+	for w := 0; w < s.WorkerThreads; w++ {
+		go s.worker(tasks, results)
+	}
+
+	//---------------------------------------------------------------
+	// Dispatch tasks (the intex of each Investor) to workers
+	//---------------------------------------------------------------
+	s.T3ForThreadPool = T3
+	for j := range s.Investors {
+		tasks <- j
+	}
+	close(tasks) // it can hold all the messages put in the channel, it will close when the last message has been handled
+
+	//-----------------------------------------------
+	// Wait until the last Investor has finished
+	//-----------------------------------------------
+	for a := 0; a < len(s.Investors); a++ {
+		err := <-results // each time this returns it means that an Investor has finished
+		if err != nil {
+			log.Printf("Investors.DailyRun() returned: %s\n", err.Error())
+		}
+	}
+}
+
 // Run loops through the simulation day by day, first handling any conversions
 // from C2 to C1 on that day, and then having each Investor consult its
 // Influencers and deciding whether or not to convert C1 to C2. At the end
@@ -367,11 +455,12 @@ func (s *Simulator) Run() {
 	s.SimStart = time.Now()
 	s.SetReportDirectory()
 	s.WorkerThreads = s.workerPoolSize() // for now, just use the number of CPU cores
+	s.preloadData()
 
 	//-------------------------------------
 	// ITERATE THROUGH THE LOOP COUNT...
 	//-------------------------------------
-	for lc := 0; lc < s.Cfg.LoopCount; lc++ {
+	for lc := s.LoopsCompleted; lc < s.Cfg.LoopCount; lc++ {
 		//---------------------------------
 		// DO WE STILL NEED THIS?
 		//---------------------------------
@@ -397,9 +486,21 @@ func (s *Simulator) Run() {
 		//-------------------------------------------------------------------------
 		// Iterate through the GENERATIONS
 		//-------------------------------------------------------------------------
+		//-------------------------------------------------------------------------
+		// If we're resuming, pick up with the generation after the checkpoint
+		//-------------------------------------------------------------------------
+		g0 := 0
+		if s.resume != nil {
+			g0 = s.resume.NextGen
+			if g0 > 0 {
+				genStart = s.resume.GenStart
+			}
+			s.resume = nil
+		}
+
 		var d time.Time
 		var dtGenEnd time.Time
-		for g := 0; g < s.Cfg.Generations; g++ {
+		for g := g0; g < s.Cfg.Generations; g++ {
 			dtGenStartTrace := time.Now()
 			T3 := genStart
 			if isGenDur {
@@ -431,38 +532,10 @@ func (s *Simulator) Run() {
 
 				//*********************** BEGIN SIMULATOR DAILY LOOP ***********************
 				//-------------------------------------------------
-				// worker pools setup for each day of simulation
+				// Investors only trade on trading days
 				//-------------------------------------------------
-				if len(s.Investors) < s.WorkerThreads {
-					s.WorkerThreads = len(s.Investors) // but not more than number of investors
-				}
-				tasks := make(chan int, len(s.Investors))     // Send indices of s.Investors to workers, the channel isbuffered to avoid blocking, enough space for every Investor
-				results := make(chan error, len(s.Investors)) // Collect errors or nil if successful
-
-				//---------------------------------------
-				// fire up the workers!
-				//---------------------------------------
-				for w := 0; w < s.WorkerThreads; w++ {
-					go s.worker(tasks, results)
-				}
-
-				//---------------------------------------------------------------
-				// Dispatch tasks (the intex of each Investor) to workers
-				//---------------------------------------------------------------
-				s.T3ForThreadPool = T3
-				for j := range s.Investors {
-					tasks <- j
-				}
-				close(tasks) // it can hold all the messages put in the channel, it will close when the last message has been handled
-
-				//-----------------------------------------------
-				// Wait until the last Investor has finished
-				//-----------------------------------------------
-				for a := 0; a < len(s.Investors); a++ {
-					err := <-results // each time this returns it means that an Investor has finished
-					if err != nil {
-						log.Printf("Investors.DailyRun() returned: %s\n", err.Error())
-					}
+				if s.factory.cal.IsTradingDay(T3) {
+					s.runInvestors(T3)
 				}
 
 				SettleC2 := 0 // if past simulation end date, we'll count the Investors that still have C2
@@ -526,6 +599,9 @@ func (s *Simulator) Run() {
 
 			T3 = T3.AddDate(0, 0, -1)
 			s.GensCompleted++ // we have just concluded another generation
+			for j := 0; j < len(s.Investors); j++ {
+				s.Investors[j].closeSleeves() // a portfolio gathers the Investments of its pairs
+			}
 			if g+1 == s.Cfg.Generations || !isGenDur {
 				d = T3
 			}
@@ -546,7 +622,11 @@ func (s *Simulator) Run() {
 			// Compute scores and stats
 			//----------------------------------------------------------------------
 			s.CalculateMaxVals(T3)
+			s.CalculateAllRiskMetrics(thisGenDtStart, thisGenDtEnd)
 			s.CalculateAllFitnessScores()
+			if s.Cfg.MultiObjective {
+				s.CalculateAllObjectives(thisGenDtStart, thisGenDtEnd)
+			}
 			s.SaveStats(thisGenDtStart, thisGenDtEnd, T3, EndOfDataReached)
 			s.UpdateTopInvestors() // NOTE: s.Investors is sorted by Portfolio value upon return
 
@@ -563,7 +643,27 @@ func (s *Simulator) Run() {
 			}
 			if s.Cfg.Trace && !s.Cfg.CrucibleMode {
 				for j := 0; j < len(s.Investors); j++ {
-					s.Investors[j].TraceWriteFile()
+					if len(s.Investors[j].Sleeves) == 0 {
+						s.Investors[j].TraceWriteFile()
+					}
+					for k := range s.Investors[j].Sleeves {
+						s.Investors[j].Sleeves[k].TraceWriteFile() // each pair has its own trace
+					}
+				}
+			}
+			if s.Cfg.MultiObjective && !s.Cfg.CrucibleMode {
+				if err := s.dumpParetoFront(); err != nil {
+					log.Printf("ERROR: dumpParetoFront returned: %s\n", err)
+				}
+			}
+			if s.InfluencerReport && !s.Cfg.CrucibleMode {
+				if err := s.dumpInfluencerReport(); err != nil {
+					log.Printf("ERROR: dumpInfluencerReport returned: %s\n", err)
+				}
+			}
+			if s.RealizedGainsReport && !s.Cfg.CrucibleMode {
+				if err := s.dumpRealizedGains(); err != nil {
+					log.Printf("ERROR: dumpRealizedGains returned: %s\n", err)
 				}
 			}
 
@@ -575,6 +675,15 @@ func (s *Simulator) Run() {
 					log.Panicf("*** PANIC ERROR *** NewPopulation returned error: %s\n", err)
 				}
 				s.maxPredictions = make(map[string]int, 0)
+				if !s.Cfg.CrucibleMode && !s.Cfg.WalkForwardMode {
+					nextLoop, nextGen := lc, g+1
+					if nextGen >= s.Cfg.Generations {
+						nextLoop, nextGen = lc+1, 0
+					}
+					if err := s.WriteCheckpoint(nextLoop, nextGen, genStart); err != nil {
+						log.Printf("*** WARNING *** WriteCheckpoint returned: %s\n", err)
+					}
+				}
 				dtNextGenCompleted := time.Now()
 				if s.TraceTiming {
 					log.Printf("<<<TRACE TIMING>>> next generation create time: %s\n", util.ElapsedTime(dtGenerationStop, dtNextGenCompleted))
@@ -598,6 +707,45 @@ func (s *Simulator) Run() {
 	s.StopTimeSet = true
 }
 
+// preloadData reads every metric the Influencers and Investors may need for
+// this simulation into the database's in-memory cache. The range starts early
+// enough to satisfy the largest look-back (MinDelta1) of any Influencer, in
+// open days with TradingDayDeltas, and extends through the end of the data
+// so that wind-down days are covered.
+// The CSV database is already in memory, so there is nothing to do for it.
+// ----------------------------------------------------------------------------------------
+func (s *Simulator) preloadData() {
+	if s.db.Datatype == "CSV" {
+		return
+	}
+	minDelta := 0
+	for _, v := range s.db.Mim.MInfluencerSubclasses {
+		if v.MinDelta1 < minDelta {
+			minDelta = v.MinDelta1
+		}
+	}
+	dt1 := time.Time(s.Cfg.DtStart).AddDate(0, 0, minDelta)
+	if s.Cfg.TradingDayDeltas {
+		dt1 = s.factory.cal.AddOpenDays(time.Time(s.Cfg.DtStart), minDelta)
+	}
+	dt2 := time.Time(s.Cfg.DtStop)
+	if _, dbStop := s.db.DataDateRange(); dbStop.After(dt2) {
+		dt2 = dbStop
+	}
+	if s.db.Cache != nil && !dt1.Before(s.db.Cache.DtStart) && !dt2.After(s.db.Cache.DtStop) {
+		return // already loaded
+	}
+
+	start := time.Now()
+	if err := s.db.PreloadCache(dt1, dt2); err != nil {
+		log.Printf("*** WARNING *** PreloadCache returned: %s. Continuing without the cache.\n", err)
+		return
+	}
+	if s.TraceTiming {
+		log.Printf("<<<TRACE TIMING>>> data preload time: %s\n", util.ElapsedTime(start, time.Now()))
+	}
+}
+
 // SetReportDirectory ensures that all the directory and file information for reports is
 // set in s.Cfg.
 // ----------------------------------------------------------------------------------------
@@ -684,6 +832,9 @@ func (s *Simulator) CalculateAllFitnessScores() {
 		if x > max {
 			max = x
 		}
+		for j := 0; j < len(s.Investors[i].Influencers); j++ {
+			s.Investors[i].Influencers[j].CalculateFitnessScore()
+		}
 	}
 }
 
@@ -758,6 +909,11 @@ func (s *Simulator) SetAllPortfolioValues(t time.Time) error {
 	}
 
 	for i := 0; i < len(s.Investors); i++ {
+		if len(s.Investors[i].Sleeves) > 0 {
+			s.Investors[i].PortfolioValueC1 = s.Investors[i].PortfolioValue(t) // each pair has its own exchange rate
+			s.Investors[i].DtPortfolioValue = t
+			continue
+		}
 		if s.Investors[i].BalanceC2 == 0 {
 			continue
 		}
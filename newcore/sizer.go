@@ -0,0 +1,287 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// This module decides how much C1 an Investor spends when it buys C2, and
+// measures how much of its capital an Investor puts to work.
+
+// PositionSizer decides the size of a buy
+// ------------------------------------------------------------------------------
+type PositionSizer interface {
+	Name() string
+
+	// Size returns the amount of C1 inv should spend on a buy on T3. pct is
+	// the ActionPct of the Investor's course of action. The amount may be
+	// more than inv.BalanceC1, ExecuteBuy limits it.
+	Size(inv *Investor, T3 time.Time, pct float64) (float64, error)
+}
+
+// NewPositionSizer returns the PositionSizer for the policy name. Settings
+// of the policy that are not set in cfg get their default values.
+// ------------------------------------------------------------------------------
+func NewPositionSizer(name string, cfg *util.AppConfig) PositionSizer {
+	switch name {
+	case util.SizingFractional:
+		return &FractionalSizer{Fraction: orDefault(cfg.SizingFraction, util.DefaultSizingFraction)}
+	case util.SizingVolatility:
+		return &VolatilitySizer{Target: orDefault(cfg.VolatilityTarget, util.DefaultVolatilityTarget)}
+	case util.SizingKelly:
+		n := cfg.KellyMinTrades
+		if n == 0 {
+			n = util.DefaultKellyMinTrades
+		}
+		return &KellySizer{Fraction: orDefault(cfg.KellyFraction, util.DefaultKellyFraction), MinTrades: n}
+	case util.SizingMaxExposure:
+		return &MaxExposureSizer{Max: orDefault(cfg.MaxExposure, util.DefaultMaxExposure)}
+	default:
+		return &StandardSizer{}
+	}
+}
+
+// sizingSummary describes the position sizing policy of cfg for the report
+// headers
+func sizingSummary(cfg *util.AppConfig) string {
+	if cfg.EvolvePositionSizing {
+		return "evolved"
+	}
+	switch p := NewPositionSizer(cfg.PositionSizing, cfg).(type) {
+	case *FractionalSizer:
+		return fmt.Sprintf("%s  (%.2f%% of portfolio value)", p.Name(), p.Fraction*100)
+	case *VolatilitySizer:
+		return fmt.Sprintf("%s  (%.2f%% of portfolio value per standard deviation)", p.Name(), p.Target*100)
+	case *KellySizer:
+		return fmt.Sprintf("%s  (%.2f Kelly, after %d trades)", p.Name(), p.Fraction, p.MinTrades)
+	case *MaxExposureSizer:
+		return fmt.Sprintf("%s  (at most %.2f%% in C2)", p.Name(), p.Max*100)
+	default:
+		return p.Name()
+	}
+}
+
+// orDefault returns x, or def if x is 0
+func orDefault(x, def float64) float64 {
+	if x == 0 {
+		return def
+	}
+	return x
+}
+
+// positionSizing returns the name of the Investor's sizing policy
+func (i *Investor) positionSizing() string {
+	if len(i.Sizing) > 0 {
+		return i.Sizing
+	}
+	return i.cfg.PositionSizing
+}
+
+// sizingDNA returns the DNA of the Investor's position sizing gene followed
+// by a semicolon, or "" if its policy is not a gene
+func (i *Investor) sizingDNA() string {
+	if len(i.Sizing) == 0 {
+		return ""
+	}
+	return "Sizing=" + i.Sizing + ";"
+}
+
+// StandardSizer spends StdInvestment * pct. If the Investor has less than
+// StdInvestment it spends everything it has.
+// ------------------------------------------------------------------------------
+type StandardSizer struct{}
+
+// Name returns the name of the policy
+func (s *StandardSizer) Name() string { return util.SizingStandard }
+
+// Size returns the amount of C1 to spend
+func (s *StandardSizer) Size(inv *Investor, T3 time.Time, pct float64) (float64, error) {
+	if inv.BalanceC1 < inv.cfg.StdInvestment {
+		return inv.BalanceC1, nil
+	}
+	return inv.cfg.StdInvestment * pct, nil
+}
+
+// FractionalSizer spends a fixed fraction of the portfolio value * pct, so
+// the investments grow and shrink with the portfolio
+// ------------------------------------------------------------------------------
+type FractionalSizer struct {
+	Fraction float64 // fraction of the portfolio value spent at a pct of 1
+}
+
+// Name returns the name of the policy
+func (s *FractionalSizer) Name() string { return util.SizingFractional }
+
+// Size returns the amount of C1 to spend
+func (s *FractionalSizer) Size(inv *Investor, T3 time.Time, pct float64) (float64, error) {
+	return s.Fraction * inv.PortfolioValue(T3) * pct, nil
+}
+
+// VolatilitySizer sizes a buy so that a one standard deviation move of the
+// exchange rate changes the portfolio value by Target. The standard deviation
+// is the rolling StdDevSquared of EXClose, relative to the rate on T3. The
+// quieter the market the larger the buy. If there are no valid statistics on
+// T3 it falls back to standard sizing.
+// ------------------------------------------------------------------------------
+type VolatilitySizer struct {
+	Target float64 // fraction of the portfolio value a one standard deviation move may cost
+}
+
+// Name returns the name of the policy
+func (s *VolatilitySizer) Name() string { return util.SizingVolatility }
+
+// Size returns the amount of C1 to spend
+func (s *VolatilitySizer) Size(inv *Investor, T3 time.Time, pct float64) (float64, error) {
+	m, err := inv.db.Value(inv.exchangeRef(), T3)
+	if err != nil || !m.StatsValid || m.StdDevSquared <= 0 || m.Value <= 0 {
+		return (&StandardSizer{}).Size(inv, T3, pct)
+	}
+	vol := math.Sqrt(m.StdDevSquared) / m.Value
+	return s.Target * inv.PortfolioValue(T3) / vol * pct, nil
+}
+
+// KellySizer bets Fraction of the Kelly criterion, W - (1-W)/R, where W is
+// the Investor's win rate and R its average win over its average loss on its
+// completed Investments. Until it has MinTrades completed Investments it
+// uses standard sizing. If the criterion is not positive it does not buy.
+// ------------------------------------------------------------------------------
+type KellySizer struct {
+	Fraction  float64 // fraction of the full Kelly bet
+	MinTrades int     // completed Investments needed to trust the statistics
+}
+
+// Name returns the name of the policy
+func (s *KellySizer) Name() string { return util.SizingKelly }
+
+// Size returns the amount of C1 to spend
+func (s *KellySizer) Size(inv *Investor, T3 time.Time, pct float64) (float64, error) {
+	k, n := inv.KellyCriterion()
+	if n < s.MinTrades || n == 0 {
+		return (&StandardSizer{}).Size(inv, T3, pct)
+	}
+	if k <= 0 {
+		return 0, nil
+	}
+	return s.Fraction * k * inv.PortfolioValue(T3) * pct, nil
+}
+
+// KellyCriterion returns the Kelly fraction computed from the completed
+// Investments, and the number of completed Investments it is based on. The
+// profit of an Investment is the profit of its chunks less all fees, as in
+// NewRiskMetrics. With no losing Investments it is the win rate.
+// ------------------------------------------------------------------------------
+func (i *Investor) KellyCriterion() (float64, int) {
+	wins, losses := 0, 0
+	won, lost := float64(0), float64(0)
+	for j := 0; j < len(i.Investments); j++ {
+		m := &i.Investments[j]
+		if !m.Completed || len(m.Chunks) == 0 {
+			continue
+		}
+		pl := -m.Fee
+		for k := 0; k < len(m.Chunks); k++ {
+			pl += m.Chunks[k].ChunkProfit - m.Chunks[k].Fee
+		}
+		if pl > 0 {
+			wins++
+			won += pl
+		} else {
+			losses++
+			lost -= pl
+		}
+	}
+	n := wins + losses
+	if n == 0 {
+		return 0, 0
+	}
+	w := float64(wins) / float64(n)
+	if losses == 0 || lost == 0 {
+		return w, n
+	}
+	if wins == 0 {
+		return 0, n
+	}
+	r := (won / float64(wins)) / (lost / float64(losses))
+	return w - (1-w)/r, n
+}
+
+// MaxExposureSizer spends StdInvestment * pct, but never so much that more
+// than Max of the portfolio value would be held in C2
+// ------------------------------------------------------------------------------
+type MaxExposureSizer struct {
+	Max float64 // largest fraction of the portfolio value that may be held in C2
+}
+
+// Name returns the name of the policy
+func (s *MaxExposureSizer) Name() string { return util.SizingMaxExposure }
+
+// Size returns the amount of C1 to spend
+func (s *MaxExposureSizer) Size(inv *Investor, T3 time.Time, pct float64) (float64, error) {
+	amt, _ := (&StandardSizer{}).Size(inv, T3, pct)
+	pv := inv.PortfolioValue(T3)
+	room := s.Max*pv - (pv - inv.BalanceC1) // pv - BalanceC1 is the C1 value of the C2 held
+	return math.Max(0, math.Min(amt, room)), nil
+}
+
+//==============================================================================
+//  EXPOSURE
+//==============================================================================
+
+// Exposure describes how much of its capital an Investor put to work during
+// a generation
+// ------------------------------------------------------------------------------
+type Exposure struct {
+	Avg         float64 // average fraction of the portfolio value held in C2 over the trading days
+	Max         float64 // largest fraction of the portfolio value held in C2 on a trading day
+	Utilization float64 // average fraction of the available C1 spent by a buy
+}
+
+// ExposureColumns are the column headers for Exposure in the csv reports, in
+// the order of the values written by CSV
+var ExposureColumns = []string{
+	"Avg Exposure",
+	"Max Exposure",
+	"Utilization",
+}
+
+// CSV returns the exposure as comma separated values, in the order of
+// ExposureColumns
+func (e *Exposure) CSV() string {
+	return fmt.Sprintf("%.2f%%,%.2f%%,%.2f%%", e.Avg*100, e.Max*100, e.Utilization*100)
+}
+
+// exposure returns the fraction of the portfolio value held in C2 just after
+// the exchange on T3
+func (m *Investment) exposure() float64 {
+	c2 := m.T3BalanceC2 / m.ERT3 // C1 value of the C2 balance
+	return c2 / (m.T3BalanceC1 + c2)
+}
+
+// NewExposure computes the exposure from the daily series and the
+// Investments of a generation
+// ------------------------------------------------------------------------------
+func NewExposure(series []PVSample, investments []Investment) Exposure {
+	var e Exposure
+	for _, v := range series {
+		e.Avg += v.Exposure
+		e.Max = math.Max(e.Max, v.Exposure)
+	}
+	if len(series) > 0 {
+		e.Avg /= float64(len(series))
+	}
+	buys := 0
+	for j := 0; j < len(investments); j++ {
+		if investments[j].isFlatFee() {
+			continue // a fee did not put any capital to work
+		}
+		e.Utilization += investments[j].Utilization
+		buys++
+	}
+	if buys > 0 {
+		e.Utilization /= float64(buys)
+	}
+	return e
+}
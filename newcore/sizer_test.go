@@ -0,0 +1,194 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// sizerTestInfs are the weights and Influencers of the Investors in the
+// position sizing tests
+const sizerTestInfs = "InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}"
+
+// completedInvestment returns a completed Investment with one chunk that
+// made profit pl
+func completedInvestment(pl float64) Investment {
+	return Investment{Completed: true, Chunks: []SellInfo{{ChunkProfit: pl}}}
+}
+
+// TestPositionSizers checks the amount each sizing policy spends
+func TestPositionSizers(t *testing.T) {
+	f, _ := taTestFactory(t)
+	dt := time.Date(2020, time.February, 3, 0, 0, 0, 0, time.UTC)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	inv.BalanceC1 = 1000
+	pv := inv.PortfolioValue(dt)
+
+	near := func(name string, got, want float64) {
+		if math.Abs(got-want) > 1e-6 {
+			t.Errorf("%s: expected %.4f, got %.4f", name, want, got)
+		}
+	}
+	size := func(s PositionSizer, pct float64) float64 {
+		amt, err := s.Size(&inv, dt, pct)
+		if err != nil {
+			t.Fatalf("%s: Size returned error: %s", s.Name(), err)
+		}
+		return amt
+	}
+
+	near("standard", size(&StandardSizer{}, 0.5), f.cfg.StdInvestment*0.5)
+	near("fractional", size(&FractionalSizer{Fraction: 0.2}, 0.5), 0.2*pv*0.5)
+
+	m, err := f.db.Value(inv.exchangeRef(), dt)
+	if err != nil {
+		t.Fatalf("Value returned error: %s", err)
+	}
+	if m.StatsValid && m.StdDevSquared > 0 {
+		near("volatility", size(&VolatilitySizer{Target: 0.01}, 1), 0.01*pv*m.Value/math.Sqrt(m.StdDevSquared))
+	} else {
+		near("volatility", size(&VolatilitySizer{Target: 0.01}, 1), f.cfg.StdInvestment)
+	}
+
+	//---------------------------------------------------------------
+	// Kelly: 3 wins of 10 and 1 loss of 5. W = 0.75, R = 2, so the
+	// criterion is 0.75 - 0.25/2 = 0.625
+	//---------------------------------------------------------------
+	inv.Investments = []Investment{completedInvestment(10), completedInvestment(-5), completedInvestment(10), completedInvestment(10), {}}
+	k, n := inv.KellyCriterion()
+	if n != 4 {
+		t.Errorf("expected 4 completed Investments, got %d", n)
+	}
+	near("kelly criterion", k, 0.625)
+	near("kelly", size(&KellySizer{Fraction: 0.5, MinTrades: 4}, 1), 0.5*0.625*pv)
+	near("kelly too few trades", size(&KellySizer{Fraction: 0.5, MinTrades: 5}, 1), f.cfg.StdInvestment)
+	inv.Investments = []Investment{completedInvestment(-10), completedInvestment(-5), completedInvestment(1)}
+	near("kelly losing", size(&KellySizer{Fraction: 0.5, MinTrades: 1}, 1), 0)
+	inv.Investments = nil
+
+	//---------------------------------------------------------------
+	// The exposure cap limits the buy once C2 is held
+	//---------------------------------------------------------------
+	near("maxexposure", size(&MaxExposureSizer{Max: 0.5}, 1), f.cfg.StdInvestment)
+	if err := inv.ExecuteBuy(dt, 1); err != nil {
+		t.Fatalf("ExecuteBuy returned error: %s", err)
+	}
+	pv = inv.PortfolioValue(dt)
+	near("maxexposure capped", size(&MaxExposureSizer{Max: 0.15}, 1), 0.15*pv-(pv-inv.BalanceC1))
+	near("maxexposure full", size(&MaxExposureSizer{Max: 0.05}, 1), 0)
+
+	//---------------------------------------------------------------
+	// ExecuteBuy records utilization and exposure
+	//---------------------------------------------------------------
+	m3 := inv.Investments[0]
+	near("utilization", m3.Utilization, f.cfg.StdInvestment/1000)
+	if m3.Exposure <= 0 || m3.Exposure >= 1 {
+		t.Errorf("expected an exposure between 0 and 1, got %f", m3.Exposure)
+	}
+}
+
+// TestExposureUtilization checks that flat fees are not averaged into the
+// utilization of the buys
+func TestExposureUtilization(t *testing.T) {
+	investments := []Investment{
+		{T3C1: 100, Utilization: 0.2},
+		{T3C1: 0, Completed: true}, // a flat fee
+		{T3C1: 300, Utilization: 0.6},
+	}
+	e := NewExposure(nil, investments)
+	if math.Abs(e.Utilization-0.4) > 1e-9 {
+		t.Errorf("expected Utilization 0.4, got %f", e.Utilization)
+	}
+}
+
+// TestSizingGene checks that the sizing policy is written to and read from
+// Investor DNA, and that it is inherited and mutated when it evolves
+func TestSizingGene(t *testing.T) {
+	f, _ := taTestFactory(t)
+	dna := "{Investor;Strategy=MajorityRules;Sizing=kelly;" + sizerTestInfs
+	inv := f.NewInvestorFromDNA(dna)
+	if s := inv.DNA(); s != strings.Replace(dna, "{Investor;", "{Investor;ID="+inv.ID+";", 1) {
+		t.Errorf("DNA did not round trip, got %s", s)
+	}
+	if inv.positionSizing() != util.SizingKelly {
+		t.Errorf("expected kelly, got %s", inv.positionSizing())
+	}
+	inv = f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;" + sizerTestInfs)
+	if strings.Contains(inv.DNA(), "Sizing=") || inv.positionSizing() != f.cfg.PositionSizing {
+		t.Errorf("expected no sizing gene, got %s", inv.DNA())
+	}
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Errorf("expected a panic for an unknown sizing policy")
+			}
+		}()
+		f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;Sizing=martingale;" + sizerTestInfs)
+	}()
+
+	//---------------------------------------------------------------
+	// Breeding and mutation
+	//---------------------------------------------------------------
+	f.cfg.EvolvePositionSizing = true
+	f.cfg.MutationRate = 100
+	pop := []Investor{
+		f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;Sizing=kelly;" + sizerTestInfs),
+		f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;Sizing=volatility;" + sizerTestInfs),
+	}
+	valid := map[string]bool{}
+	for _, name := range util.PositionSizings {
+		valid[name] = true
+	}
+	seen := map[string]bool{}
+	for k := 0; k < 100; k++ {
+		child := f.BreedNewInvestor(&pop, 0, 1)
+		if !valid[child.Sizing] {
+			t.Fatalf("unexpected sizing policy %q", child.Sizing)
+		}
+		seen[child.Sizing] = true
+		if again := f.NewInvestorFromDNA(child.DNA()); again.DNA() != child.DNA() {
+			t.Fatalf("expected %s, got %s", child.DNA(), again.DNA())
+		}
+	}
+	if len(seen) < 3 {
+		t.Errorf("expected mutation to reach other policies, got %v", seen)
+	}
+}
+
+// TestPositionSizingSimulation runs a simulation with evolved sizing
+// policies and checks the exposure columns of the financial report
+func TestPositionSizingSimulation(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.EvolvePositionSizing = true
+	db := openSimTestDB(t, cfg)
+
+	util.Init(55)
+	s := runSimTest(t, cfg, db, "")
+	for _, inv := range s.Investors {
+		if len(inv.Sizing) == 0 {
+			t.Fatalf("expected a sizing gene, got %s", inv.DNA())
+		}
+	}
+	for _, ti := range s.TopInvestors {
+		e := ti.Exposure
+		if e.Avg < 0 || e.Avg > e.Max || e.Max > 1 || e.Utilization < 0 || e.Utilization > 1 {
+			t.Errorf("unexpected exposure %+v", e)
+		}
+	}
+
+	if err := s.FinRpt.GenerateFinRep(s, cfg.ReportDirectory); err != nil {
+		t.Fatalf("GenerateFinRep returned error: %s", err)
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("finrep"))
+	if err != nil {
+		t.Fatalf("could not read the financial report: %s", err)
+	}
+	if !strings.Contains(string(b), `"Avg Exposure","Max Exposure","Utilization"`) || !strings.Contains(string(b), "Position Sizing: evolved") {
+		t.Errorf("expected exposure columns in the financial report:\n%s", b)
+	}
+}
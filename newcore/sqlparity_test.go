@@ -0,0 +1,424 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// parityColumn is a column of the synthetic CSV database and the value its
+// random walk starts at
+type parityColumn struct {
+	Name  string
+	Start float64
+}
+
+// parityColumns are the columns of the synthetic CSV database for USDJPY
+var parityColumns = []parityColumn{{"USDJPYEXClose", 110}, {"USDDR", 1.5}, {"JPYDR", -0.1}, {"Gold", 1800}}
+
+// writeParityCSVDB writes a small, synthetic CSV database with the columns
+// cols into dir and returns the name of the platodb.csv file. With gaps some
+// cells are left empty on purpose so that the rolling statistics have gaps
+// to deal with.
+func writeParityCSVDB(t testing.TB, dir string, dtStart, dtStop time.Time, cols []parityColumn, gaps bool) string {
+	files := map[string]string{
+		"misubclasses.csv": "MID,Name,Metric,BlocType,LocaleType,Predictor,Subclass,MinDelta1,MaxDelta1,MinDelta2,MaxDelta2,FitnessW1,FitnessW2,MetricType\n" +
+			"1,Discount Rate,DR,0,LocaleC1C2,C1C2RatioGT,LSMInfluencer,-60,-10,-9,-1,0.5,0.5,1\n" +
+			"2,Gold,Gold,0,LocaleNone,SingleValGT,LSMInfluencer,-60,-10,-9,-1,0.5,0.5,1\n",
+		"metricssources.csv": "MSID,LastUpdate,URL,Name\n1,05/03/2024,file://platodb.csv,CSV File\n",
+		"msm.csv":            "Metric,CSV File\nGold,\n",
+	}
+	for k, v := range files {
+		if err := os.WriteFile(filepath.Join(dir, k), []byte(v), 0644); err != nil {
+			t.Fatalf("could not write %s: %s", k, err)
+		}
+	}
+
+	r := rand.New(rand.NewSource(17))
+	s := "Date"
+	vals := make([]float64, len(cols))
+	for i, c := range cols {
+		s += "," + c.Name
+		vals[i] = c.Start
+	}
+	s += "\n"
+	for dt := dtStart; !dt.After(dtStop); dt = dt.AddDate(0, 0, 1) {
+		s += dt.Format("1/2/2006")
+		for i := 0; i < len(vals); i++ {
+			vals[i] += (r.Float64() - 0.5) * 0.02 * (1 + vals[i]*vals[i]/1000)
+			if gaps && r.Intn(10) == 0 {
+				s += "," // a gap in the data
+				continue
+			}
+			s += fmt.Sprintf(",%.6f", vals[i])
+		}
+		s += "\n"
+	}
+	fname := filepath.Join(dir, "platodb.csv")
+	if err := os.WriteFile(fname, []byte(s), 0644); err != nil {
+		t.Fatalf("could not write platodb.csv: %s", err)
+	}
+	return fname
+}
+
+// copyCSVToSQLite creates a SQLite database in dir and copies everything from
+// csvdb into it, the same way csvtosql does.
+func copyCSVToSQLite(t *testing.T, cfg *util.AppConfig, csvdb *newdata.Database, dir string) *newdata.Database {
+	db, err := newdata.NewDatabase("SQLITE", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	db.SetSQLiteFilename(filepath.Join(dir, "plato.db"))
+	if err = db.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	t.Cleanup(func() { db.SQLDB.DB.Close() })
+	db.SQLDB.ParentDB = db
+	if err = db.CreateDatabaseTables(); err != nil {
+		t.Fatalf("CreateDatabaseTables returned error: %s", err)
+	}
+	for _, l := range []newdata.Locale{
+		{Name: "NON", Currency: "NON", Country: "No locale association"},
+		{Name: "JPN", Currency: "JPY", Country: "Japan"},
+		{Name: "USA", Currency: "USD", Country: "United States"},
+	} {
+		if _, err = db.InsertLocale(&l); err != nil {
+			t.Fatalf("InsertLocale returned error: %s", err)
+		}
+	}
+	if err = db.SQLDB.LoadLocaleCache(); err != nil {
+		t.Fatalf("LoadLocaleCache returned error: %s", err)
+	}
+	for _, v := range csvdb.Mim.MInfluencerSubclasses {
+		if err = db.InsertMInfluencer(&v); err != nil {
+			t.Fatalf("InsertMInfluencer returned error: %s", err)
+		}
+	}
+	if err = db.WriteMetricsSources(csvdb.CSVDB.MetricSrcCache); err != nil {
+		t.Fatalf("WriteMetricsSources returned error: %s", err)
+	}
+	db.Mim.ParentDB = db
+	if err = db.Mim.LoadMInfluencerSubclasses(); err != nil {
+		t.Fatalf("LoadMInfluencerSubclasses returned error: %s", err)
+	}
+	for dt := csvdb.CSVDB.DtStart; !dt.After(csvdb.CSVDB.DtStop); dt = dt.AddDate(0, 0, 1) {
+		rec, err := csvdb.Select(dt, nil)
+		if err != nil {
+			t.Fatalf("csv Select returned error: %s", err)
+		}
+		if err = db.Insert(rec); err != nil {
+			t.Fatalf("Insert returned error: %s", err)
+		}
+	}
+
+	//--------------------------------------------------------------
+	// Now reopen it the way the simulator would
+	//--------------------------------------------------------------
+	db.Mim = newdata.NewInfluencerManager()
+	if err = db.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	return db
+}
+
+// parityPredictions returns the predictions made by each DNA for every day
+// in the range [dt1, dt2] using the supplied database.
+func parityPredictions(t *testing.T, cfg *util.AppConfig, db *newdata.Database, dnas []string, dt1, dt2 time.Time) []Prediction {
+	var f Factory
+	f.Init(cfg, db, nil, nil)
+	inv := Investor{cfg: cfg, factory: &f, db: db}
+	var preds []Prediction
+	for _, dna := range dnas {
+		inf, err := f.NewInfluencer(dna)
+		if err != nil {
+			t.Fatalf("NewInfluencer(%s) returned error: %s", dna, err)
+		}
+		inf.SetMyInvestor(&inv)
+		for dt := dt1; !dt.After(dt2); dt = dt.AddDate(0, 0, 1) {
+			pred, err := inf.GetPrediction(dt)
+			if err != nil {
+				t.Fatalf("%s: GetPrediction(%s) returned error: %s", dna, dt.Format("2006-01-02"), err)
+			}
+			preds = append(preds, *pred)
+		}
+	}
+	return preds
+}
+
+// TestCSVSQLParity runs the same Influencer DNA against a CSV database and a
+// SQL (SQLite) database holding identical data and verifies that every
+// prediction, including the rolling statistics, is identical.
+func TestCSVSQLParity(t *testing.T) {
+	util.Init(1)
+	dir := t.TempDir()
+	dtStart := time.Date(2019, time.July, 1, 0, 0, 0, 0, time.UTC) // crosses a decade shard boundary
+	dtStop := time.Date(2020, time.June, 30, 0, 0, 0, 0, time.UTC)
+
+	cfg := util.CreateTestingCFG()
+	cfg.HoldWindowStatsLookBack = 20
+	cfg.StdDevVariationFactor = 0.05
+
+	csvdb, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	csvdb.SetCSVFilename(writeParityCSVDB(t, dir, dtStart, dtStop, parityColumns, true))
+	if err = csvdb.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if err = csvdb.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	sqldb := copyCSVToSQLite(t, cfg, csvdb, dir)
+
+	//--------------------------------------------------------------
+	// A SQL database may have a row with a NULL value where a CSV
+	// database has an empty cell. Give Gold one for each of its gaps.
+	//--------------------------------------------------------------
+	gold := newdata.NewMetricRef(newdata.FieldSelector{Metric: "Gold"})
+	nulls := 0
+	for dt := dtStart; !dt.After(dtStop); dt = dt.AddDate(0, 0, 1) {
+		if _, err := csvdb.Value(&gold, dt); err != newdata.ErrNoValue {
+			continue
+		}
+		var f newdata.FieldSelector
+		sqldb.SQLDB.FieldSelectorFromCSVColName("Gold", &f)
+		sqldb.SQLDB.GetShardInfo(dt, &f)
+		query := fmt.Sprintf(`INSERT INTO %s (Date,MID,LID,MSID,MetricValue) VALUES (?,?,?,NULL,NULL)`, f.Table)
+		if _, err = sqldb.SQLDB.DB.Exec(query, dt.Format("2006-01-02"), f.MID, f.LID); err != nil {
+			t.Fatalf("could not insert a NULL Gold for %s: %s", dt.Format("2006-01-02"), err)
+		}
+		nulls++
+	}
+	if nulls == 0 {
+		t.Fatalf("expected gaps in Gold")
+	}
+
+	dnas := []string{
+		"{LSMInfluencer,Delta1=-20,Delta2=-3,Metric=DR}",
+		"{LSMInfluencer,Delta1=-12,Delta2=-1,Metric=Gold}",
+	}
+	dt1 := dtStart.AddDate(0, 0, 30)
+	csvPreds := parityPredictions(t, cfg, csvdb, dnas, dt1, dtStop)
+	sqlPreds := parityPredictions(t, cfg, sqldb, dnas, dt1, dtStop)
+	if len(csvPreds) != len(sqlPreds) {
+		t.Fatalf("prediction counts differ: CSV %d, SQL %d", len(csvPreds), len(sqlPreds))
+	}
+
+	actions := map[string]int{}
+	for i := 0; i < len(csvPreds); i++ {
+		c, s := csvPreds[i], sqlPreds[i]
+		actions[c.Action]++
+		if c.Action != s.Action || c.Val1 != s.Val1 || c.Val2 != s.Val2 || c.StdDevSquared != s.StdDevSquared || c.AvgDelta != s.AvgDelta {
+			t.Errorf("%s: CSV and SQL predictions differ:\n  CSV: %s %f %f sd2=%g\n  SQL: %s %f %f sd2=%g",
+				c.T3.Format("2006-01-02"), c.Action, c.Val1, c.Val2, c.StdDevSquared, s.Action, s.Val1, s.Val2, s.StdDevSquared)
+		}
+	}
+
+	//--------------------------------------------------------------
+	// make sure the test actually exercised the hold window
+	//--------------------------------------------------------------
+	if actions["hold"] == 0 || actions["buy"]+actions["sell"] == 0 {
+		t.Errorf("expected both hold and buy/sell predictions, got %v", actions)
+	}
+
+	//--------------------------------------------------------------
+	// Same again, but with the SQL data preloaded into the cache
+	//--------------------------------------------------------------
+	if err = sqldb.PreloadCache(dtStart, dtStop); err != nil {
+		t.Fatalf("PreloadCache returned error: %s", err)
+	}
+	cachedPreds := parityPredictions(t, cfg, sqldb, dnas, dt1, dtStop)
+	for i := 0; i < len(csvPreds); i++ {
+		c, s := csvPreds[i], cachedPreds[i]
+		if c.Action != s.Action || c.Val1 != s.Val1 || c.Val2 != s.Val2 || c.StdDevSquared != s.StdDevSquared || c.AvgDelta != s.AvgDelta {
+			t.Errorf("%s: CSV and cached SQL predictions differ:\n  CSV: %s %f %f sd2=%g\n  SQL: %s %f %f sd2=%g",
+				c.T3.Format("2006-01-02"), c.Action, c.Val1, c.Val2, c.StdDevSquared, s.Action, s.Val1, s.Val2, s.StdDevSquared)
+		}
+	}
+}
+
+// TestSelectRange verifies that SelectRange returns exactly what a Select for
+// each individual day returns, for both the CSV and SQL backends.
+func TestSelectRange(t *testing.T) {
+	util.Init(1)
+	dir := t.TempDir()
+	dtStart := time.Date(2019, time.October, 1, 0, 0, 0, 0, time.UTC)
+	dtStop := time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC)
+	cfg := util.CreateTestingCFG()
+	cfg.HoldWindowStatsLookBack = 10
+
+	csvdb, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	csvdb.SetCSVFilename(writeParityCSVDB(t, dir, dtStart, dtStop, parityColumns, true))
+	if err = csvdb.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if err = csvdb.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	sqldb := copyCSVToSQLite(t, cfg, csvdb, dir)
+
+	fields := sqldb.AllFieldSelectors()
+	if len(fields) != 4 {
+		t.Fatalf("expected 4 field selectors, got %d", len(fields))
+	}
+	dt1 := dtStart.AddDate(0, 0, 5)
+	for _, db := range []*newdata.Database{csvdb, sqldb} {
+		series, err := db.SelectRange(dt1, dtStop, nil)
+		if err != nil {
+			t.Fatalf("%s: SelectRange returned error: %s", db.Datatype, err)
+		}
+		if series.Days != int(dtStop.Sub(dt1).Hours()/24)+1 {
+			t.Errorf("%s: unexpected number of days: %d", db.Datatype, series.Days)
+		}
+		for dt := dt1; !dt.After(dtStop); dt = dt.AddDate(0, 0, 1) {
+			rec, err := db.Select(dt, fields)
+			if err != nil {
+				t.Fatalf("%s: Select returned error: %s", db.Datatype, err)
+			}
+			got, ok := series.Select(dt, fields)
+			if !ok {
+				t.Fatalf("%s: series could not answer Select for %s", db.Datatype, dt.Format("2006-01-02"))
+			}
+			if len(rec.Fields) != len(got.Fields) {
+				t.Errorf("%s %s: Select has %d fields, SelectRange has %d", db.Datatype, dt.Format("2006-01-02"), len(rec.Fields), len(got.Fields))
+			}
+			for k, v := range rec.Fields {
+				g := got.Fields[k]
+				if v.Value != g.Value || v.Mean != g.Mean || v.StdDevSquared != g.StdDevSquared || v.StatsValid != g.StatsValid {
+					t.Errorf("%s %s %s: Select = %v, SelectRange = %v", db.Datatype, dt.Format("2006-01-02"), k, v, g)
+				}
+			}
+		}
+	}
+}
+
+// TestSelectRangeRecords checks that a SQL cache has no record for a day
+// without rows, like the CSV database, and that it only reads the values
+// before the start of the range that the rolling statistics need.
+func TestSelectRangeRecords(t *testing.T) {
+	util.Init(1)
+	dir := t.TempDir()
+	dtStart := time.Date(2019, time.October, 1, 0, 0, 0, 0, time.UTC)
+	dtStop := time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC)
+	cfg := util.CreateTestingCFG()
+	cfg.HoldWindowStatsLookBack = 10
+
+	csvdb, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	csvdb.SetCSVFilename(writeParityCSVDB(t, dir, dtStart, dtStop, parityColumns, true))
+	if err = csvdb.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if err = csvdb.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	sqldb := copyCSVToSQLite(t, cfg, csvdb, dir)
+
+	gap := time.Date(2020, time.January, 15, 0, 0, 0, 0, time.UTC)
+	tables := []string{"ExchangeRate"}
+	for b := 0; b < newdata.GlobalSQLSettings.BucketCount; b++ {
+		tables = append(tables, fmt.Sprintf("Metrics_%d_2020", b))
+	}
+	for _, table := range tables {
+		if _, err = sqldb.SQLDB.DB.Exec("DELETE FROM "+table+" WHERE Date=?", gap.Format("2006-01-02")); err != nil {
+			t.Fatalf("could not delete the rows of %s from %s: %s", gap.Format("2006-01-02"), table, err)
+		}
+	}
+
+	dt1 := dtStart.AddDate(0, 0, 40)
+	if err = sqldb.PreloadCache(dt1, dtStop); err != nil {
+		t.Fatalf("PreloadCache returned error: %s", err)
+	}
+	fields := sqldb.AllFieldSelectors()
+	rec, err := sqldb.Select(gap, fields)
+	if err != nil || rec != nil {
+		t.Errorf("expected no record for %s, got %v, err = %v", gap.Format("2006-01-02"), rec, err)
+	}
+	ref := newdata.NewMetricRef(newdata.FieldSelector{Metric: "Gold"})
+	if _, err = sqldb.Value(&ref, gap); err != newdata.ErrNoRecord {
+		t.Errorf("expected ErrNoRecord for %s, got %v", gap.Format("2006-01-02"), err)
+	}
+	if rec, err = sqldb.Select(gap.AddDate(0, 0, 1), fields); err != nil || rec == nil || len(rec.Fields) == 0 {
+		t.Errorf("expected a record for the day after %s, got %v, err = %v", gap.Format("2006-01-02"), rec, err)
+	}
+	for _, c := range sqldb.Cache.Columns {
+		if len(c.Prior) != cfg.HoldWindowStatsLookBack {
+			t.Errorf("%s: expected %d values before %s, got %d", c.Name, cfg.HoldWindowStatsLookBack, dt1.Format("2006-01-02"), len(c.Prior))
+		}
+	}
+}
+
+// TestWindowValue checks that the rolling statistics for look-backs other
+// than cfg.HoldWindowStatsLookBack are the same from the CSV database, from
+// SQL and from a SQL cache that starts after the first value.
+func TestWindowValue(t *testing.T) {
+	util.Init(1)
+	dir := t.TempDir()
+	dtStart := time.Date(2019, time.October, 1, 0, 0, 0, 0, time.UTC)
+	dtStop := time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC)
+	cfg := util.CreateTestingCFG()
+	cfg.HoldWindowStatsLookBack = 10
+
+	csvdb, err := newdata.NewDatabase("CSV", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	csvdb.SetCSVFilename(writeParityCSVDB(t, dir, dtStart, dtStop, parityColumns, true))
+	if err = csvdb.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	if err = csvdb.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	sqldb := copyCSVToSQLite(t, cfg, csvdb, dir)
+	cached := copyCSVToSQLite(t, cfg, csvdb, t.TempDir())
+	dt1 := dtStart.AddDate(0, 0, 40)
+	gold := cached.Mim.MInfluencerSubclasses["Gold"]
+	gold.MinLookBack, gold.MaxLookBack = 2, 30 // the cache reads enough values before dt1 for the longest look-back
+	cached.Mim.MInfluencerSubclasses["Gold"] = gold
+	if err = cached.PreloadCache(dt1, dtStop); err != nil {
+		t.Fatalf("PreloadCache returned error: %s", err)
+	}
+
+	f := newdata.FieldSelector{Metric: "Gold"}
+	for _, n := range []int{0, 7, 10, 30} {
+		differs := false
+		refs := []newdata.MetricRef{newdata.NewMetricRef(f), newdata.NewMetricRef(f), newdata.NewMetricRef(f)}
+		for dt := dt1; !dt.After(dtStop); dt = dt.AddDate(0, 0, 1) {
+			want, err := csvdb.WindowValue(&refs[0], dt, n)
+			if err == newdata.ErrNoValue {
+				continue
+			}
+			if err != nil {
+				t.Fatalf("CSV WindowValue returned error: %s", err)
+			}
+			for k, db := range []*newdata.Database{sqldb, cached} {
+				got, err := db.WindowValue(&refs[k+1], dt, n)
+				if err != nil {
+					t.Fatalf("SQL WindowValue returned error: %s", err)
+				}
+				if want.Value != got.Value || math.Abs(want.Mean-got.Mean) > 1e-9 || math.Abs(want.StdDevSquared-got.StdDevSquared) > 1e-9 || want.StatsValid != got.StatsValid {
+					t.Errorf("look-back %d, %s: CSV = %v, SQL (cached=%v) = %v", n, dt.Format("2006-01-02"), want, k == 1, got)
+				}
+			}
+			m, _ := csvdb.Value(&refs[0], dt)
+			differs = differs || m.StdDevSquared != want.StdDevSquared
+		}
+		if (n == 7 || n == 30) && !differs {
+			t.Errorf("look-back %d: expected statistics that differ from a look-back of 10", n)
+		}
+	}
+}
@@ -0,0 +1,615 @@
+package newcore
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// TAInfluencer makes its predictions from the C1C2 exchange rate itself
+// using one of the technical analysis indicators in TAIndicators. The
+// indicator and its parameters are genes, so they are created, crossed over
+// and mutated by the Factory like the Deltas of an LSMInfluencer.
+//
+// An indicator that expects the exchange rate to fall predicts "buy", C2 will
+// be cheaper to sell back. One that expects it to rise predicts "sell".
+type TAInfluencer struct {
+	Metric              string  // always TAMetric
+	Indicator           string  // one of TAIndicators
+	Fast                int     // SMACross, EMACross, MACD: period of the fast average
+	Slow                int     // SMACross, EMACross, MACD: period of the slow average
+	Signal              int     // MACD: period of the signal line
+	Period              int     // RSI, Bollinger, ROC: look-back period
+	Level               int     // RSI: overbought level, oversold is 100 - Level
+	Width               float64 // Bollinger: band width in standard deviations
+	Threshold           float64 // ROC: percent change needed to predict
+	Pair                string  // portfolio Investors only: the pair whose sleeve this Influencer advises
+	cfg                 *util.AppConfig
+	Delta1              int // first day of exchange rates read, derived from the indicator's periods
+	Delta2              int // last day of exchange rates read
+	ID                  string
+	FitnessIsCalculated bool
+	FitnessIsNormalized bool
+	Fitness             float64
+	MyPredictions       []Prediction
+	nJudged             int       // MyPredictions that have been judged
+	nCorrect            int       // judged MyPredictions that were correct
+	myInvestor          *Investor // my parent, the investor that holds me
+	flagpos             int
+	nilDataCount        int               // how many times did we encounter nil data in research
+	ref                 newdata.MetricRef // the exchange rate, resolved on first use
+}
+
+// TAMetric is the metric of every TAInfluencer. An Investor can have only one
+// Influencer per metric, so it has at most one TAInfluencer.
+const TAMetric = "EXClose"
+
+// TAIndicators are the indicators a TAInfluencer can use
+var TAIndicators = []string{
+	"SMACross",  // fast simple moving average crosses the slow one
+	"EMACross",  // fast exponential moving average crosses the slow one
+	"MACD",      // MACD line crosses its signal line
+	"RSI",       // relative strength index is overbought or oversold
+	"Bollinger", // exchange rate breaks out of the Bollinger bands
+	"ROC",       // rate of change exceeds the threshold
+}
+
+// taIndicatorGenes are the parameters each indicator uses
+var taIndicatorGenes = map[string][]string{
+	"SMACross":  {"Fast", "Slow"},
+	"EMACross":  {"Fast", "Slow"},
+	"MACD":      {"Fast", "Slow", "Signal"},
+	"RSI":       {"Period", "Level"},
+	"Bollinger": {"Period", "Width"},
+	"ROC":       {"Period", "Threshold"},
+}
+
+// taGeneRanges are the smallest and largest value of each parameter
+var taGeneRanges = map[string][2]float64{
+	"Fast":      {3, 20},
+	"Slow":      {10, 60},
+	"Signal":    {3, 15},
+	"Period":    {5, 50},
+	"Level":     {55, 85},
+	"Width":     {1, 3},
+	"Threshold": {0.25, 5},
+}
+
+// taMaxLookBack is the most days before Delta2 that any indicator reads. It
+// covers the samples needed by the longest MACD, allowing for weekends and
+// holidays.
+const taMaxLookBack = 240
+
+// TAMetricInfo returns the definition of TAMetric used to register the
+// TAInfluencer subclass with the MetricInfluencerManager
+// ------------------------------------------------------------------------------
+func TAMetricInfo() newdata.MInfluencerSubclass {
+	return newdata.MInfluencerSubclass{
+		Name:       "Exchange Rate Technical Analysis",
+		Metric:     TAMetric,
+		LocaleType: newdata.LocaleC1C2,
+		Predictor:  newdata.CustomPredict,
+		MinDelta1:  -5 - taMaxLookBack,
+		MaxDelta1:  -6,
+		MinDelta2:  -5,
+		MaxDelta2:  -1,
+		FitnessW1:  0.5,
+		FitnessW2:  0.5,
+	}
+}
+
+// newTAInfluencer creates a TAInfluencer from its DNA. Genes that are not
+// present are generated randomly. Genes that the indicator does not use are
+// ignored, they may come from a parent with a different indicator.
+// ------------------------------------------------------------------------------
+func (f *Factory) newTAInfluencer(metric, pair string, Delta2 int, DNA map[string]interface{}) (Influencer, error) {
+	x := TAInfluencer{
+		Metric: metric,
+		Pair:   pair,
+		Delta2: Delta2,
+		cfg:    f.cfg,
+	}
+	if val, ok := DNA["Indicator"].(string); ok {
+		if _, ok = taIndicatorGenes[val]; !ok {
+			return nil, fmt.Errorf("unknown indicator: %s", val)
+		}
+		x.Indicator = val
+	} else {
+		x.Indicator = TAIndicators[f.rng.Intn(len(TAIndicators))]
+	}
+
+	for _, gene := range taIndicatorGenes[x.Indicator] {
+		val, err := f.taGene(DNA, gene)
+		if err != nil {
+			return nil, err
+		}
+		switch gene {
+		case "Fast":
+			x.Fast = int(val)
+		case "Slow":
+			x.Slow = int(val)
+		case "Signal":
+			x.Signal = int(val)
+		case "Period":
+			x.Period = int(val)
+		case "Level":
+			x.Level = int(val)
+		case "Width":
+			x.Width = val
+		case "Threshold":
+			x.Threshold = val
+		}
+	}
+
+	//----------------------------------------------------------------------
+	// Crossover can give a fast period that is not shorter than the slow
+	//----------------------------------------------------------------------
+	if x.Fast > x.Slow {
+		x.Fast, x.Slow = x.Slow, x.Fast
+	}
+	if x.Fast > 0 && x.Fast == x.Slow {
+		x.Slow++
+	}
+	x.Delta1 = x.Delta2 - x.window()
+	return &x, nil
+}
+
+// taGene returns the value of the named gene from DNA or a random value if it
+// is not present. Floating point genes are kept to 2 decimal places, that is
+// how they appear in the DNA.
+// ------------------------------------------------------------------------------
+func (f *Factory) taGene(DNA map[string]interface{}, gene string) (float64, error) {
+	r := taGeneRanges[gene]
+	var x float64
+	switch v := DNA[gene].(type) {
+	case int:
+		x = float64(v)
+	case float64:
+		x = v
+	default:
+		if gene == "Width" || gene == "Threshold" {
+			return math.Round((r[0]+f.rng.Float64()*(r[1]-r[0]))*100) / 100, nil
+		}
+		return float64(f.rng.InRange(int(r[0]), int(r[1]))), nil
+	}
+	if x < r[0] || x > r[1] {
+		return 0, fmt.Errorf("invalid %s value: %v, it must be in the range %v to %v", gene, x, r[0], r[1])
+	}
+	return x, nil
+}
+
+// samples returns the number of exchange rates the indicator needs
+func (p *TAInfluencer) samples() int {
+	switch p.Indicator {
+	case "SMACross":
+		return p.Slow + 1
+	case "EMACross":
+		return 2*p.Slow + 1
+	case "MACD":
+		return 2*p.Slow + 2*p.Signal
+	case "RSI":
+		return 2*p.Period + 1
+	case "Bollinger":
+		return p.Period
+	case "ROC":
+		return p.Period + 1
+	}
+	return 0
+}
+
+// window returns the number of days before Delta2 that are searched for the
+// samples. There is no exchange rate on weekends and holidays.
+func (p *TAInfluencer) window() int {
+	w := p.samples()*7/5 + 10
+	if w > taMaxLookBack {
+		w = taMaxLookBack
+	}
+	return w
+}
+
+// GetNilDataCount returns the value for nilDataCount
+func (p *TAInfluencer) GetNilDataCount() int {
+	return p.nilDataCount
+}
+
+// IncNilDataCount the bit position of the valid data flag for this Influencer
+func (p *TAInfluencer) IncNilDataCount() {
+	p.nilDataCount++
+}
+
+// GetFlagPos the bit position of the valid data flag for this Influencer
+func (p *TAInfluencer) GetFlagPos() int {
+	return p.flagpos
+}
+
+// GetFitnessScore returns the current value of Fitness
+func (p *TAInfluencer) GetFitnessScore() float64 {
+	return p.Fitness
+}
+
+// SetFitnessScore sets this objects FitnessScore to the supplied value
+func (p *TAInfluencer) SetFitnessScore(x float64) {
+	p.Fitness = x
+	p.FitnessIsCalculated = true
+}
+
+// IsFitnessCalculated returns the boolean FitnessIsCalculated indicating whether
+// or not we have a valid value for Fitness.
+func (p *TAInfluencer) IsFitnessCalculated() bool {
+	return p.FitnessIsCalculated
+}
+
+// MyInvestor returns a pointer to the investor object that holds this influencer
+func (p *TAInfluencer) MyInvestor() *Investor {
+	return p.myInvestor
+}
+
+// SetMyInvestor returns a pointer to the investor object that holds this influencer
+func (p *TAInfluencer) SetMyInvestor(inv *Investor) {
+	p.myInvestor = inv
+}
+
+// SetMyPredictions is used primarily for testing and sets the Prediction
+// slice to the supplied value
+func (p *TAInfluencer) SetMyPredictions(ps []Prediction) {
+	p.MyPredictions = ps
+	s := NewPredictionStats(ps)
+	p.nJudged, p.nCorrect = s.Judged, s.Correct
+	p.FitnessIsCalculated = false
+}
+
+// GetMyPredictions is used primarily for testing and returns MyPredictions
+func (p *TAInfluencer) GetMyPredictions() []Prediction {
+	return p.MyPredictions
+}
+
+// GetAppConfig - return cfg struct
+func (p *TAInfluencer) GetAppConfig() *util.AppConfig {
+	return p.cfg
+}
+
+// GetLenMyPredictions - add a new buy prediction
+func (p *TAInfluencer) GetLenMyPredictions() int {
+	return len(p.MyPredictions)
+}
+
+// AppendPrediction - append a new prediction to the list of buy predictions
+func (p *TAInfluencer) AppendPrediction(pr Prediction) {
+	p.MyPredictions = append(p.MyPredictions, pr)
+}
+
+// FinalizePrediction - finalize the results of the prediction made on t3.
+// A "buy" was correct if the investment was profitable, a "sell" if it was not.
+func (p *TAInfluencer) FinalizePrediction(t3, t4 time.Time, profitable bool) {
+	judged, correct := finalizePrediction(p.MyPredictions, t3, profitable)
+	if judged {
+		p.nJudged++
+		if correct {
+			p.nCorrect++
+		}
+	}
+}
+
+// Accuracy returns this Influencer's running accuracy in the current
+// generation. It is 0.5 until some of its predictions have been judged.
+func (p *TAInfluencer) Accuracy() float64 {
+	return runningAccuracy(p.nCorrect, p.nJudged)
+}
+
+// GetID - get ID string
+func (p *TAInfluencer) GetID() string {
+	return p.ID
+}
+
+// SetAppConfig - set cfg
+func (p *TAInfluencer) SetAppConfig(cfg *util.AppConfig) {
+	p.cfg = cfg
+}
+
+// GetDelta1 - get Delta1
+func (p *TAInfluencer) GetDelta1() int {
+	return p.Delta1
+}
+
+// SetDelta1 - set Delta1
+func (p *TAInfluencer) SetDelta1(d int) {
+	p.Delta1 = d
+}
+
+// GetDelta2 - get Delta2
+func (p *TAInfluencer) GetDelta2() int {
+	return p.Delta2
+}
+
+// SetDelta2 - set Delta2, Delta1 moves with it
+func (p *TAInfluencer) SetDelta2(d int) {
+	p.Delta2 = d
+	p.Delta1 = d - p.window()
+}
+
+// SetID - set ID
+func (p *TAInfluencer) SetID() {
+	p.ID = p.myInvestor.GenerateRefNo()
+}
+
+// Init - initializes a TAInfluencer
+func (p *TAInfluencer) Init(i *Investor, cfg *util.AppConfig) {
+	p.myInvestor = i
+	p.cfg = cfg
+	p.SetID()
+}
+
+// Subclass - a method that returns the Influencer subclass of this object
+func (p *TAInfluencer) Subclass() string {
+	return "TAInfluencer"
+}
+
+// GetMetric - a method that returns the Influencer subclass of this object
+func (p *TAInfluencer) GetMetric() string {
+	return p.Metric
+}
+
+// GetPair - returns the pair whose sleeve this Influencer advises, empty if
+// the Investors are not portfolios
+func (p *TAInfluencer) GetPair() string {
+	return p.Pair
+}
+
+// DNA - returns the DNA of this influencer. Only the parameters used by the
+// indicator are included.
+// ----------------------------------------------------------------------------
+func (p *TAInfluencer) DNA() string {
+	genes := map[string]string{
+		"Delta2":    fmt.Sprintf("%d", p.Delta2),
+		"Indicator": p.Indicator,
+		"Metric":    p.Metric,
+	}
+	if len(p.Pair) > 0 {
+		genes["Pair"] = p.Pair
+	}
+	for _, gene := range taIndicatorGenes[p.Indicator] {
+		switch gene {
+		case "Fast":
+			genes[gene] = fmt.Sprintf("%d", p.Fast)
+		case "Slow":
+			genes[gene] = fmt.Sprintf("%d", p.Slow)
+		case "Signal":
+			genes[gene] = fmt.Sprintf("%d", p.Signal)
+		case "Period":
+			genes[gene] = fmt.Sprintf("%d", p.Period)
+		case "Level":
+			genes[gene] = fmt.Sprintf("%d", p.Level)
+		case "Width":
+			genes[gene] = fmt.Sprintf("%.2f", p.Width)
+		case "Threshold":
+			genes[gene] = fmt.Sprintf("%.2f", p.Threshold)
+		}
+	}
+	keys := make([]string, 0, len(genes))
+	for k := range genes {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	s := "{" + p.Subclass()
+	for _, k := range keys {
+		s += "," + k + "=" + genes[k]
+	}
+	return s + "}"
+}
+
+// GetPrediction - using the supplied date, it computes the indicator from the
+// exchange rates up to T3 + Delta2 and makes a prediction.
+//
+// RETURNS
+//
+//	action     -  "buy" or "hold" or "sell" or "abstain"
+//	prediction - probability of correctness - most valid for "buy" action
+//	error      - nil on success, error encountered otherwise
+//
+// ---------------------------------------------------------------------------
+func (p *TAInfluencer) GetPrediction(t3 time.Time) (*Prediction, error) {
+	var pred Prediction
+	pred.Action = "abstain" // Default action
+	pred.T3 = t3
+	pred.Delta1 = p.Delta1
+	pred.Delta2 = p.Delta2
+	pred.Probability = 1.0
+	pred.Weight = 1.0
+
+	x := p.readRates(t3)
+	if x == nil {
+		return &pred, nil // not enough data, abstain
+	}
+	trend, ref, val := p.evaluate(x)
+	pred.Val1 = ref // the level the indicator is compared to, used in trace
+	pred.Val2 = val // the value of the indicator, used in trace
+	switch {
+	case trend < 0:
+		pred.Action = "buy"
+	case trend > 0:
+		pred.Action = "sell"
+	default:
+		pred.Action = "hold"
+	}
+	return &pred, nil
+}
+
+// readRates returns the exchange rates the indicator needs, oldest first,
+// ending on the last day with a rate on or before T3 + Delta2. It returns nil
+// if there are not enough rates between T3 + Delta1 and T3 + Delta2.
+// ---------------------------------------------------------------------------
+func (p *TAInfluencer) readRates(t3 time.Time) []float64 {
+	if len(p.ref.Field.Metric) == 0 {
+		p.ref = newdata.NewMetricRef(newdata.FieldSelector{Metric: p.Metric, Locale: p.cfg.C1, Locale2: p.cfg.C2})
+	}
+	db := p.myInvestor.db
+	t1 := p.myInvestor.deltaDate(t3, p.Delta1)
+	n := p.samples()
+	x := make([]float64, n)
+	for dt := p.myInvestor.deltaDate(t3, p.Delta2); n > 0 && !dt.Before(t1); dt = dt.AddDate(0, 0, -1) {
+		v, err := db.Value(&p.ref, dt)
+		if err != nil || v.Value <= 0 {
+			continue // weekend, holiday or before the start of the data
+		}
+		n--
+		x[n] = v.Value
+	}
+	if n > 0 {
+		return nil
+	}
+	return x
+}
+
+// evaluate computes the indicator over the exchange rates in x, oldest first.
+//
+// RETURNS
+//
+//	trend - 1 if the indicator expects the rate to rise, -1 if it expects it
+//	        to fall, 0 otherwise
+//	ref   - the level the indicator is compared to
+//	val   - the value of the indicator
+//
+// ---------------------------------------------------------------------------
+func (p *TAInfluencer) evaluate(x []float64) (int, float64, float64) {
+	n := len(x)
+	switch p.Indicator {
+	case "SMACross":
+		prev := taSMA(x[:n-1], p.Fast) - taSMA(x[:n-1], p.Slow)
+		slow := taSMA(x, p.Slow)
+		fast := taSMA(x, p.Fast)
+		return taCross(prev, fast-slow), slow, fast
+
+	case "EMACross":
+		fast := taEMA(x, p.Fast)
+		slow := taEMA(x, p.Slow)
+		return taCross(fast[n-2]-slow[n-2], fast[n-1]-slow[n-1]), slow[n-1], fast[n-1]
+
+	case "MACD":
+		fast := taEMA(x, p.Fast)
+		slow := taEMA(x, p.Slow)
+		macd := make([]float64, n-p.Slow+1)
+		for k := range macd {
+			macd[k] = fast[k+p.Slow-1] - slow[k+p.Slow-1]
+		}
+		signal := taEMA(macd, p.Signal)
+		m := len(macd)
+		return taCross(macd[m-2]-signal[m-2], macd[m-1]-signal[m-1]), signal[m-1], macd[m-1]
+
+	case "RSI":
+		rsi := taRSI(x, p.Period)
+		switch {
+		case rsi > float64(p.Level):
+			return -1, float64(p.Level), rsi // overbought
+		case rsi < float64(100-p.Level):
+			return 1, float64(p.Level), rsi // oversold
+		}
+		return 0, float64(p.Level), rsi
+
+	case "Bollinger":
+		mean := taSMA(x, p.Period)
+		sd := float64(0)
+		for _, v := range x[n-p.Period:] {
+			sd += (v - mean) * (v - mean)
+		}
+		sd = math.Sqrt(sd / float64(p.Period))
+		switch {
+		case x[n-1] > mean+p.Width*sd:
+			return 1, mean, x[n-1]
+		case x[n-1] < mean-p.Width*sd:
+			return -1, mean, x[n-1]
+		}
+		return 0, mean, x[n-1]
+
+	case "ROC":
+		roc := (x[n-1]/x[n-1-p.Period] - 1) * 100
+		switch {
+		case roc > p.Threshold:
+			return 1, p.Threshold, roc
+		case roc < -p.Threshold:
+			return -1, p.Threshold, roc
+		}
+		return 0, p.Threshold, roc
+	}
+	return 0, 0, 0
+}
+
+// taCross returns 1 if a difference went from <= 0 to > 0, -1 if it went from
+// >= 0 to < 0, and 0 otherwise
+func taCross(prev, cur float64) int {
+	switch {
+	case prev <= 0 && cur > 0:
+		return 1
+	case prev >= 0 && cur < 0:
+		return -1
+	}
+	return 0
+}
+
+// taSMA returns the mean of the last n values of x
+func taSMA(x []float64, n int) float64 {
+	sum := float64(0)
+	for _, v := range x[len(x)-n:] {
+		sum += v
+	}
+	return sum / float64(n)
+}
+
+// taEMA returns the exponential moving average of x with period n. The
+// average starts as the mean of the first n values, the entries before it are
+// 0.
+// ---------------------------------------------------------------------------
+func taEMA(x []float64, n int) []float64 {
+	ema := make([]float64, len(x))
+	if len(x) < n {
+		return ema
+	}
+	ema[n-1] = taSMA(x[:n], n)
+	k := 2 / float64(n+1)
+	for j := n; j < len(x); j++ {
+		ema[j] = x[j]*k + ema[j-1]*(1-k)
+	}
+	return ema
+}
+
+// taRSI returns Wilder's relative strength index of x with period n. The
+// average gain and loss start as the means of the first n changes and are
+// smoothed over the rest.
+// ---------------------------------------------------------------------------
+func taRSI(x []float64, n int) float64 {
+	gain := float64(0)
+	loss := float64(0)
+	for j := 1; j < len(x); j++ {
+		d := x[j] - x[j-1]
+		g, l := math.Max(d, 0), math.Max(-d, 0)
+		if j <= n {
+			gain += g / float64(n)
+			loss += l / float64(n)
+			continue
+		}
+		gain = (gain*float64(n-1) + g) / float64(n)
+		loss = (loss*float64(n-1) + l) / float64(n)
+	}
+	if loss == 0 {
+		if gain == 0 {
+			return 50
+		}
+		return 100
+	}
+	return 100 - 100/(1+gain/loss)
+}
+
+// CalculateFitnessScore - scores this Influencer from its finalized
+// predictions. See influencerFitness in inffitness.go
+//
+// RETURNS - the fitness score
+// ------------------------------------------------------------------------------------
+func (p *TAInfluencer) CalculateFitnessScore() float64 {
+	if !p.FitnessIsCalculated {
+		p.SetFitnessScore(influencerFitness(p.myInvestor, p.Metric, p.MyPredictions))
+	}
+	return p.Fitness
+}
@@ -0,0 +1,163 @@
+package newcore
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/util"
+)
+
+// taTestFactory returns a Factory using the simulation test database
+func taTestFactory(t *testing.T) (*Factory, *newdata.Database) {
+	cfg := simTestCfg(t.TempDir(), 1)
+	cfg.MutationRate = 0
+	db := openSimTestDB(t, cfg)
+	util.Init(41)
+	var f Factory
+	f.Init(cfg, db, nil, nil)
+	return &f, db
+}
+
+func TestTAIndicators(t *testing.T) {
+	x := []float64{1, 2, 3, 4, 5}
+	if v := taSMA(x, 3); v != 4 {
+		t.Errorf("expected SMA 4, got %f", v)
+	}
+	ema := taEMA(x, 3)
+	if ema[2] != 2 || ema[3] != 3 || ema[4] != 4 {
+		t.Errorf("expected EMA 2, 3, 4 got %v", ema[2:])
+	}
+	if v := taRSI(x, 2); v != 100 {
+		t.Errorf("expected RSI 100 for a rising series, got %f", v)
+	}
+	if v := taRSI([]float64{3, 3, 3}, 2); v != 50 {
+		t.Errorf("expected RSI 50 for a flat series, got %f", v)
+	}
+	// gains and losses average 0.5 over the first 2 changes, then are smoothed
+	if v := taRSI([]float64{1, 2, 1, 2, 1}, 2); math.Abs(v-37.5) > 1e-9 {
+		t.Errorf("expected RSI 37.5, got %f", v)
+	}
+
+	//---------------------------------------------------------------
+	// Rising indicators predict "sell", falling ones "buy"
+	//---------------------------------------------------------------
+	cases := []struct {
+		p     TAInfluencer
+		x     []float64
+		trend int
+	}{
+		{TAInfluencer{Indicator: "SMACross", Fast: 2, Slow: 3}, []float64{5, 4, 3, 6}, 1},
+		{TAInfluencer{Indicator: "SMACross", Fast: 2, Slow: 3}, []float64{3, 4, 5, 2}, -1},
+		{TAInfluencer{Indicator: "SMACross", Fast: 2, Slow: 3}, []float64{1, 2, 3, 4}, 0},
+		{TAInfluencer{Indicator: "RSI", Period: 2, Level: 70}, []float64{1, 2, 3, 4, 5}, -1},
+		{TAInfluencer{Indicator: "RSI", Period: 2, Level: 70}, []float64{5, 4, 3, 2, 1}, 1},
+		{TAInfluencer{Indicator: "Bollinger", Period: 4, Width: 1}, []float64{1, 1, 1, 2}, 1},
+		{TAInfluencer{Indicator: "Bollinger", Period: 4, Width: 2}, []float64{1, 1, 1, 2}, 0},
+		{TAInfluencer{Indicator: "ROC", Period: 2, Threshold: 5}, []float64{100, 99, 94}, -1},
+		{TAInfluencer{Indicator: "ROC", Period: 2, Threshold: 5}, []float64{100, 99, 104}, 0},
+	}
+	for k, c := range cases {
+		if trend, _, _ := c.p.evaluate(c.x); trend != c.trend {
+			t.Errorf("case %d, %s: expected trend %d, got %d", k, c.p.Indicator, c.trend, trend)
+		}
+	}
+}
+
+// TestTAInfluencerDNA checks the registration of the subclass and that its
+// genes survive creation, DNA round trips and crossover.
+func TestTAInfluencerDNA(t *testing.T) {
+	f, db := taTestFactory(t)
+	f.Init(f.cfg, db, nil, nil) // registering again must not add it twice
+	n := 0
+	for _, v := range db.Mim.InfluencerSubclasses {
+		if v == "TAInfluencer" {
+			n++
+		}
+	}
+	names := db.Mim.MInfluencerSubclassMetricNames
+	if n != 1 || len(names) != 3 || !sort.StringsAreSorted(names) || db.Mim.MInfluencerSubclasses[TAMetric].Subclass != "TAInfluencer" {
+		t.Fatalf("unexpected registration: %v, %v", db.Mim.InfluencerSubclasses, names)
+	}
+
+	for _, ind := range TAIndicators {
+		inf, err := f.NewInfluencer("{TAInfluencer,Indicator=" + ind + ",Metric=EXClose}")
+		if err != nil {
+			t.Fatalf("NewInfluencer returned error for %s: %s", ind, err)
+		}
+		p := inf.(*TAInfluencer)
+		if p.Delta1 >= p.Delta2 || p.Delta2-p.Delta1 > taMaxLookBack {
+			t.Errorf("%s: unexpected deltas %d, %d", ind, p.Delta1, p.Delta2)
+		}
+		dna := inf.DNA()
+		inf2, err := f.NewInfluencer(dna)
+		if err != nil || inf2.DNA() != dna {
+			t.Errorf("%s: DNA did not survive a round trip: %s", ind, dna)
+		}
+	}
+	if _, err := f.NewInfluencer("{TAInfluencer,Fast=2,Indicator=SMACross,Metric=EXClose,Slow=30}"); err == nil {
+		t.Errorf("expected an error for Fast = 2")
+	}
+	if _, err := f.NewInfluencer("{TAInfluencer,Indicator=Stochastic,Metric=EXClose}"); err == nil {
+		t.Errorf("expected an error for an unknown indicator")
+	}
+
+	//---------------------------------------------------------------
+	// Parents with different indicators still produce a valid child
+	//---------------------------------------------------------------
+	pop := []Investor{
+		f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{TAInfluencer,Delta2=-1,Indicator=RSI,Level=70,Metric=EXClose,Period=14}]}"),
+		f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{TAInfluencer,Delta2=-2,Fast=12,Indicator=MACD,Metric=EXClose,Signal=9,Slow=26}]}"),
+	}
+	for k := 0; k < 20; k++ {
+		child := f.BreedNewInvestor(&pop, 0, 1)
+		if len(child.Influencers) != 1 || child.Influencers[0].Subclass() != "TAInfluencer" || strings.Contains(child.DNA(), "nil") {
+			t.Fatalf("unexpected child: %s", child.DNA())
+		}
+	}
+
+	//---------------------------------------------------------------
+	// The Factory picks the subclass that goes with the metric
+	//---------------------------------------------------------------
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=MajorityRules;InvW1=0.5000;InvW2=0.5000;Influencers=[{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=DR}|{LSMInfluencer,Delta1=-30,Delta2=-5,Metric=Gold}]}")
+	if subclass, metric := f.RandomUnusedSubclassAndMetric(&inv); subclass != "TAInfluencer" || metric != TAMetric {
+		t.Errorf("expected TAInfluencer and %s, got %s and %s", TAMetric, subclass, metric)
+	}
+}
+
+// TestTAInfluencerPredictions checks the predictions of a moving average
+// crossover against the exchange rates in the database.
+func TestTAInfluencerPredictions(t *testing.T) {
+	f, db := taTestFactory(t)
+	inv := f.NewInvestorFromDNA("{Investor;Strategy=DistributedDecision;InvW1=0.5000;InvW2=0.5000;Influencers=[{TAInfluencer,Delta2=-1,Fast=3,Indicator=SMACross,Metric=EXClose,Slow=10}]}")
+	p := inv.Influencers[0].(*TAInfluencer)
+	ref := newdata.NewMetricRef(f.PrefixMetricC1C2("EXClose"))
+
+	votes := map[string]int{}
+	for dt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC); dt.Month() < time.May; dt = dt.AddDate(0, 0, 1) {
+		pred, err := p.GetPrediction(dt)
+		if err != nil {
+			t.Fatalf("GetPrediction returned error: %s", err)
+		}
+		votes[pred.Action]++
+
+		// the test database has a rate every day
+		sum := float64(0)
+		for k := 1; k <= 3; k++ {
+			v, err := db.Value(&ref, dt.AddDate(0, 0, -k))
+			if err != nil {
+				t.Fatalf("no exchange rate on %s", dt.AddDate(0, 0, -k))
+			}
+			sum += v.Value
+		}
+		if math.Abs(pred.Val2-sum/3) > 1e-9 {
+			t.Errorf("%s: expected the fast average %f, got %f", dt.Format("1/2/2006"), sum/3, pred.Val2)
+		}
+	}
+	if votes["buy"] == 0 || votes["sell"] == 0 || votes["hold"] == 0 || votes["abstain"] != 0 {
+		t.Errorf("expected buy, sell and hold predictions, got %v", votes)
+	}
+}
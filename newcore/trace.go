@@ -35,6 +35,7 @@ type BSEvent struct {
 	Gains               int
 	Losses              int
 	InvestmentsAffected int
+	Exit                string // sells only: why it was sold, see ExitSell
 }
 
 // TEvent represents a single event in the trace
@@ -67,6 +68,16 @@ func (i *Investor) TraceInit() {
 	i.COATrace.Event = nil
 }
 
+// traceEvent returns the current Event, creating it for T3 if it doesn't
+// exist. Sells can happen before the Influencers vote.
+func (i *Investor) traceEvent(T3 time.Time) *TEvent {
+	if i.COATrace.Event == nil {
+		i.COATrace.Event = &TEvent{}
+		i.COATrace.Event.Dt = T3
+	}
+	return i.COATrace.Event
+}
+
 // SaveTrace adds the current Event to the trace Events list
 func (i *Investor) SaveTrace() {
 	i.COATrace.Events = append(i.COATrace.Events, i.COATrace.Event)
@@ -119,6 +130,7 @@ func (i *Investor) TraceWriteFile() error {
 		{Label: "InvestmentsAffected", Fmt: "%d"},
 		{Label: "Gains", Fmt: "%d"},
 		{Label: "Losses", Fmt: "%d"},
+		{Label: "Exit", Fmt: "%q"},
 		{Label: "Investor ID", Fmt: "%q"},
 		{Label: "C1bal", Fmt: "%.4f"},
 		{Label: "C2bal", Fmt: "%.4f"},
@@ -211,6 +223,7 @@ func (i *Investor) TraceWriteFile() error {
 					{Label: "InvestmentsAffected", Val: bs.InvestmentsAffected},
 					{Label: "Gains", Val: bs.Gains},
 					{Label: "Losses", Val: bs.Losses},
+					{Label: "Exit", Val: bs.Exit},
 				}
 				p = formater.Row(cd)
 				fmt.Fprintf(f, "%s", p+"\n")
@@ -238,14 +251,15 @@ func (i *Investor) FormatPrediction(p *Prediction, T3 time.Time) {
 	//-----------------------------------------------
 	// create the current Event if it doesn't exist
 	//-----------------------------------------------
-	if i.COATrace.Event == nil {
-		i.COATrace.Event = &TEvent{}
-		i.COATrace.Event.Dt = T3
-	}
+	i.traceEvent(T3)
 
-	T1 := T3.AddDate(0, 0, int(p.Delta1))
-	T2 := T3.AddDate(0, 0, int(p.Delta2))
+	T1 := i.deltaDate(T3, int(p.Delta1))
+	T2 := i.deltaDate(T3, int(p.Delta2))
 	stdDev := math.Sqrt(p.StdDevSquared)
+	factor := p.VarFactor
+	if factor == 0 {
+		factor = i.cfg.StdDevVariationFactor
+	}
 
 	fmt.Printf("\t%s:  %s   (T1 %s [%4.2f] -  T2 %s [%4.2f]   AvgDelta: %.4f  StdDev: %.4f,  Factor: %.4f, Trigger: %.4f)\n",
 		p.Metric,
@@ -256,8 +270,8 @@ func (i *Investor) FormatPrediction(p *Prediction, T3 time.Time) {
 		p.Val2,
 		p.AvgDelta,
 		stdDev,
-		i.cfg.StdDevVariationFactor,
-		i.cfg.StdDevVariationFactor*stdDev,
+		factor,
+		factor*stdDev,
 	)
 
 	// add this Influencer's prediction
@@ -269,8 +283,8 @@ func (i *Investor) FormatPrediction(p *Prediction, T3 time.Time) {
 		Val2:     p.Val2,
 		AvgDelta: p.AvgDelta,
 		StdDev:   stdDev,
-		Factor:   i.cfg.StdDevVariationFactor,
-		Trigger:  i.cfg.StdDevVariationFactor * stdDev,
+		Factor:   factor,
+		Trigger:  factor * stdDev,
 		Metric:   p.Metric,
 	}
 
@@ -309,7 +323,8 @@ func (i *Investor) showBuy(inv *Investment) {
 	bse.T3C2Buy = inv.T3C2Buy // amount of C2 purchased for T3C1
 	bse.Sell = false          // false - this is a buy
 	bse.Fee = inv.Fee         // calculated fee for this purchase
-	i.COATrace.Event.BSEvents = append(i.COATrace.Event.BSEvents, bse)
+	e := i.traceEvent(inv.T3)
+	e.BSEvents = append(e.BSEvents, bse)
 	fmt.Printf("        *** BUY ***   %8.2f %s (%8.2f %s, fee = %6.2f)\n", inv.T3C1, i.cfg.C1, inv.T3C2Buy, i.cfg.C2, inv.Fee)
 
 }
@@ -340,7 +355,11 @@ func (i *Investor) showSell(inv *Investment, tsc1, tsc2, fee float64) {
 	bse.InvestmentsAffected = n
 	bse.Gains = gains
 	bse.Losses = losses
+	if n > 0 {
+		bse.Exit = inv.Chunks[n-1].Exit
+	}
 
-	i.COATrace.Event.BSEvents = append(i.COATrace.Event.BSEvents, bse)
-	fmt.Printf("        *** SELL ***  %8.2f %s (fee: %6.2f), [%8.2f %s], investments affected: %d -->  %d profited, %d lost\n", tsc1, i.cfg.C1, fee, tsc2, i.cfg.C2, n, gains, losses)
+	e := i.traceEvent(inv.T4)
+	e.BSEvents = append(e.BSEvents, bse)
+	fmt.Printf("        *** SELL ***  %8.2f %s (fee: %6.2f), [%8.2f %s], investments affected: %d -->  %d profited, %d lost, exit: %s\n", tsc1, i.cfg.C1, fee, tsc2, i.cfg.C2, n, gains, losses, bse.Exit)
 }
@@ -0,0 +1,389 @@
+package newcore
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/stmansour/psim/newdata"
+	"github.com/stmansour/psim/sqlt"
+	"github.com/stmansour/psim/util"
+)
+
+// WalkForwardWindow is one step of a walk-forward optimization. A population
+// is evolved on the training window, then the top Investors it produced are
+// run on the test window that immediately follows.
+// ------------------------------------------------------------------------------
+type WalkForwardWindow struct {
+	TrainStart     time.Time  // first day of the training (in-sample) window
+	TrainStop      time.Time  // last day of the training window
+	TestStart      time.Time  // first day of the test (out-of-sample) window
+	TestStop       time.Time  // last day of the test window
+	DNA            []string   // DNA of the top Investors from the training window
+	ISReturn       float64    // mean annualized return of the top Investors on the training window
+	OOSReturn      float64    // mean annualized return of the same Investors on the test window
+	ISSharpe       float64    // mean Sharpe ratio on the training window
+	OOSSharpe      float64    // mean Sharpe ratio on the test window
+	OOSMaxDrawdown float64    // max drawdown of Series
+	Series         []PVSample // mean portfolio value of the top Investors on each trading day of the test window
+}
+
+// Degradation returns how much of the in-sample annualized return was lost
+// on the test window. It is in the same units as the returns.
+// ------------------------------------------------------------------------------
+func (w *WalkForwardWindow) Degradation() float64 {
+	return w.ISReturn - w.OOSReturn
+}
+
+// Efficiency returns the out-of-sample annualized return as a fraction of
+// the in-sample annualized return. It is 0 if the in-sample return was not
+// positive.
+// ------------------------------------------------------------------------------
+func (w *WalkForwardWindow) Efficiency() float64 {
+	if w.ISReturn <= 0 {
+		return 0
+	}
+	return w.OOSReturn / w.ISReturn
+}
+
+// WalkForward runs a walk-forward optimization. It replaces the manual
+// process of running a simulation, copying its TopInvestors into a config
+// file, and running a crucible on a later period.
+//
+// The first training window starts on DtStart. Each test window starts the
+// day after its training window ends. Both windows are moved forward by
+// WalkForwardStep until a test window would start after DtStop. GenDurSpec
+// is not used, each training run evolves Generations generations over the
+// whole training window.
+// ------------------------------------------------------------------------------
+type WalkForward struct {
+	cfg     *util.AppConfig   // the config used by the simulator, it is changed for each run
+	base    util.AppConfig    // the config as it was loaded, restored before each run
+	db      *newdata.Database // where to get the data
+	sim     *Simulator        // runs the training and the test simulations
+	Windows []WalkForwardWindow
+	Equity  []PVSample // the stitched out-of-sample equity curve
+}
+
+// NewWalkForward returns a pointer to a new WalkForward object
+func NewWalkForward() *WalkForward {
+	return &WalkForward{}
+}
+
+// WalkForwardWindows computes the training and test windows for cfg
+//
+// RETURNS
+//
+//	the windows, the results are not yet filled in
+//	any error encountered
+//
+// ------------------------------------------------------------------------------
+func WalkForwardWindows(cfg *util.AppConfig) ([]WalkForwardWindow, error) {
+	var windows []WalkForwardWindow
+	dtStop := time.Time(cfg.DtStop)
+	trainStart := time.Time(cfg.DtStart)
+	for {
+		testStart, err := util.AddDuration(cfg.WalkForwardTrain, trainStart)
+		if err != nil {
+			return nil, err
+		}
+		if testStart.After(dtStop) {
+			break
+		}
+		testEnd, err := util.AddDuration(cfg.WalkForwardTest, testStart)
+		if err != nil {
+			return nil, err
+		}
+		testStop := testEnd.AddDate(0, 0, -1)
+		if testStop.After(dtStop) {
+			testStop = dtStop
+		}
+		windows = append(windows, WalkForwardWindow{
+			TrainStart: trainStart,
+			TrainStop:  testStart.AddDate(0, 0, -1),
+			TestStart:  testStart,
+			TestStop:   testStop,
+		})
+		if trainStart, err = util.AddDuration(cfg.WalkForwardStep, trainStart); err != nil {
+			return nil, err
+		}
+	}
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("%s - %s is too short for a %s training window followed by a test window",
+			time.Time(cfg.DtStart).Format("1/2/2006"), dtStop.Format("1/2/2006"), cfg.WalkForwardTrain)
+	}
+	return windows, nil
+}
+
+// Init initializes the walk-forward object
+//
+// RETURNS
+//
+//	any error encountered
+//
+// ------------------------------------------------------------------------------
+func (w *WalkForward) Init(cfg *util.AppConfig, db *newdata.Database, sim *Simulator) error {
+	var err error
+	if err = util.ValidateWalkForward(cfg); err != nil {
+		return err
+	}
+	if w.Windows, err = WalkForwardWindows(cfg); err != nil {
+		return err
+	}
+	cfg.WalkForwardMode = true
+	cfg.GenDurSpec = ""
+	cfg.GenDur = nil
+	w.cfg = cfg
+	w.db = db
+	w.sim = sim
+	w.sim.Cfg = cfg // required for generateFName
+	w.sim.SetReportDirectory()
+	w.base = *cfg
+	return nil
+}
+
+// Run trains and tests on every window, then writes the reports
+//
+// RETURNS
+//
+//	any error encountered
+//
+// ------------------------------------------------------------------------------
+func (w *WalkForward) Run() error {
+	for k := range w.Windows {
+		win := &w.Windows[k]
+		fmt.Printf("Walk-forward window %d of %d: train %s - %s, test %s - %s\n", k+1, len(w.Windows),
+			win.TrainStart.Format("Jan _2, 2006"), win.TrainStop.Format("Jan _2, 2006"),
+			win.TestStart.Format("Jan _2, 2006"), win.TestStop.Format("Jan _2, 2006"))
+		if err := w.train(win); err != nil {
+			return err
+		}
+		if err := w.test(win); err != nil {
+			return err
+		}
+	}
+	w.stitch()
+
+	*w.cfg = w.base
+	if err := w.writeReport(); err != nil {
+		return err
+	}
+	if err := w.writeEquity(); err != nil {
+		return err
+	}
+	fmt.Printf("Walk-forward run completed\n")
+	fmt.Printf("Walk-forward report is: %s\n", w.cfg.GenerateFName("wfrep"))
+	return nil
+}
+
+// train evolves a population on the training window of win and saves the
+// DNA of its top Investors.
+// ------------------------------------------------------------------------------
+func (w *WalkForward) train(win *WalkForwardWindow) error {
+	*w.cfg = w.base
+	w.cfg.DtStart = util.CustomDate(win.TrainStart)
+	w.cfg.DtStop = util.CustomDate(win.TrainStop)
+
+	//---------------------------------------------------------------------
+	// Each training run is a new simulation. Investors created for an
+	// earlier window are not duplicates.
+	//---------------------------------------------------------------------
+	if !w.cfg.AllowDuplicateInvestors {
+		if err := sqlt.ReplaceHashes(w.sim.SqltDB, nil); err != nil {
+			return err
+		}
+	}
+	w.sim.ResetSimulator()
+	if err := w.sim.Init(w.cfg, w.db, nil, false, false); err != nil {
+		return err
+	}
+	w.sim.Run()
+
+	n := w.cfg.WalkForwardTopN
+	if n > len(w.sim.TopInvestors) {
+		n = len(w.sim.TopInvestors)
+	}
+	win.DNA = make([]string, 0, n)
+	win.ISReturn = 0
+	win.ISSharpe = 0
+	for _, t := range w.sim.TopInvestors[:n] {
+		ar, err := util.AnnualizedReturn(w.cfg.InitFunds, t.PortfolioValue, win.TrainStart, win.TrainStop.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		win.DNA = append(win.DNA, t.DNA)
+		win.ISReturn += ar
+		win.ISSharpe += t.Risk.Sharpe
+	}
+	if n > 0 {
+		win.ISReturn /= float64(n)
+		win.ISSharpe /= float64(n)
+	}
+	return nil
+}
+
+// test runs each of the top Investors of win on its test window. The
+// Investors are run with EnforceStopDate so that the test windows do not
+// overlap.
+// ------------------------------------------------------------------------------
+func (w *WalkForward) test(win *WalkForwardWindow) error {
+	win.OOSReturn = 0
+	win.OOSSharpe = 0
+	win.Series = nil
+	for _, dna := range win.DNA {
+		*w.cfg = w.base
+		w.cfg.DtStart = util.CustomDate(win.TestStart)
+		w.cfg.DtStop = util.CustomDate(win.TestStop)
+		w.cfg.SingleInvestorMode = true
+		w.cfg.SingleInvestorDNA = dna
+		w.cfg.PopulationSize = 1
+		w.cfg.LoopCount = 1
+		w.cfg.Generations = 1
+		w.cfg.PreserveElite = false
+		w.cfg.EnforceStopDate = true
+		w.cfg.AllowDuplicateInvestors = true
+		w.sim.ResetSimulator()
+		if err := w.sim.Init(w.cfg, w.db, nil, false, false); err != nil {
+			return err
+		}
+		w.sim.Run()
+
+		v := &w.sim.Investors[0]
+		ar, err := util.AnnualizedReturn(w.cfg.InitFunds, v.PortfolioValueC1, win.TestStart, win.TestStop.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		win.OOSReturn += ar
+		win.OOSSharpe += v.Risk.Sharpe
+
+		//------------------------------------------------------------------
+		// Every Investor has the same trading days, so the series line up
+		//------------------------------------------------------------------
+		if win.Series == nil {
+			win.Series = make([]PVSample, len(v.PVSeries))
+			copy(win.Series, v.PVSeries)
+		} else {
+			if len(v.PVSeries) < len(win.Series) {
+				win.Series = win.Series[:len(v.PVSeries)]
+			}
+			for j := range win.Series {
+				win.Series[j].PV += v.PVSeries[j].PV
+			}
+		}
+	}
+	if n := len(win.DNA); n > 0 {
+		win.OOSReturn /= float64(n)
+		win.OOSSharpe /= float64(n)
+		for j := range win.Series {
+			win.Series[j].PV /= float64(n)
+		}
+	}
+	r := NewRiskMetrics(win.Series, nil, win.OOSReturn)
+	win.OOSMaxDrawdown = r.MaxDrawdown
+	return nil
+}
+
+// stitch joins the test window series into a single equity curve. Each
+// test run starts with InitFunds, so each window is scaled to start where
+// the previous one ended. If the test windows overlap, a window is only used
+// up to the start of the next one.
+// ------------------------------------------------------------------------------
+func (w *WalkForward) stitch() {
+	w.Equity = nil
+	equity := w.base.InitFunds
+	for k := range w.Windows {
+		scale := equity / w.base.InitFunds
+		for _, p := range w.Windows[k].Series {
+			if k+1 < len(w.Windows) && !p.Dt.Before(w.Windows[k+1].TestStart) {
+				break
+			}
+			w.Equity = append(w.Equity, PVSample{Dt: p.Dt, PV: p.PV * scale})
+		}
+		if len(w.Equity) > 0 {
+			equity = w.Equity[len(w.Equity)-1].PV
+		}
+	}
+}
+
+// writeReport writes the per-window results to wfrep.csv
+// ------------------------------------------------------------------------------
+func (w *WalkForward) writeReport() error {
+	fname := w.cfg.GenerateFName("wfrep")
+	file, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "%q\n", "PLATO Walk-Forward Report")
+	w.sim.ReportHeader(file, false)
+	fmt.Fprintf(file, "\"Training Window: %s\"\n", w.cfg.WalkForwardTrain)
+	fmt.Fprintf(file, "\"Test Window: %s\"\n", w.cfg.WalkForwardTest)
+	fmt.Fprintf(file, "\"Step: %s\"\n", w.cfg.WalkForwardStep)
+	fmt.Fprintf(file, "\"Top Investors Tested: %d\"\n", w.cfg.WalkForwardTopN)
+
+	if len(w.Equity) > 0 {
+		first := w.Windows[0].TestStart
+		last := w.Equity[len(w.Equity)-1]
+		ar, err := util.AnnualizedReturn(w.base.InitFunds, last.PV, first, last.Dt.AddDate(0, 0, 1))
+		if err != nil {
+			return err
+		}
+		r := NewRiskMetrics(w.Equity, nil, ar)
+		fmt.Fprintf(file, "\"Out-of-Sample Equity: %.2f %s on %s\"\n", last.PV, w.cfg.C1, last.Dt.Format("1/2/2006"))
+		fmt.Fprintf(file, "\"Out-of-Sample Annualized Return: %.2f%%\"\n", ar*100)
+		fmt.Fprintf(file, "\"Out-of-Sample Sharpe: %.4f\"\n", r.Sharpe)
+		fmt.Fprintf(file, "\"Out-of-Sample Max Drawdown: %.2f%%  (%s - %s)\"\n", r.MaxDrawdown*100, formatRiskDate(r.DtPeak), formatRiskDate(r.DtTrough))
+	}
+	fmt.Fprintf(file, "\n")
+
+	fmt.Fprintf(file, "%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q,%q\n",
+		"Window", "Train Start", "Train Stop", "Test Start", "Test Stop", "Investors",
+		"IS Annualized Return", "OOS Annualized Return", "Degradation", "Efficiency",
+		"IS Sharpe", "OOS Sharpe", "OOS Max Drawdown", "Top DNA")
+	for k := range w.Windows {
+		win := &w.Windows[k]
+		dna := ""
+		if len(win.DNA) > 0 {
+			dna = win.DNA[0]
+		}
+		fmt.Fprintf(file, "%d,%s,%s,%s,%s,%d,%.2f%%,%.2f%%,%.2f%%,%.4f,%.4f,%.4f,%.2f%%,%q\n",
+			k+1,
+			win.TrainStart.Format("1/2/2006"),
+			win.TrainStop.Format("1/2/2006"),
+			win.TestStart.Format("1/2/2006"),
+			win.TestStop.Format("1/2/2006"),
+			len(win.DNA),
+			win.ISReturn*100,
+			win.OOSReturn*100,
+			win.Degradation()*100,
+			win.Efficiency(),
+			win.ISSharpe,
+			win.OOSSharpe,
+			win.OOSMaxDrawdown*100,
+			dna)
+	}
+	return nil
+}
+
+// writeEquity writes the stitched out-of-sample equity curve to
+// wfequity.csv
+// ------------------------------------------------------------------------------
+func (w *WalkForward) writeEquity() error {
+	fname := w.cfg.GenerateFName("wfequity")
+	file, err := os.Create(fname)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	fmt.Fprintf(file, "%q,%q,%q\n", "Date", "Window", "Equity")
+	k := 0
+	for _, p := range w.Equity {
+		for k+1 < len(w.Windows) && !p.Dt.Before(w.Windows[k+1].TestStart) {
+			k++
+		}
+		fmt.Fprintf(file, "%s,%d,%.2f\n", p.Dt.Format("1/2/2006"), k+1, p.PV)
+	}
+	return nil
+}
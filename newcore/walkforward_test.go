@@ -0,0 +1,129 @@
+package newcore
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+func TestWalkForwardWindows(t *testing.T) {
+	cfg := util.CreateTestingCFG()
+	cfg.DtStart = util.CustomDate(time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC))
+	cfg.DtStop = util.CustomDate(time.Date(2020, time.December, 31, 0, 0, 0, 0, time.UTC))
+	cfg.WalkForwardTrain = "6m"
+	cfg.WalkForwardTest = "2m"
+	if err := util.ValidateWalkForward(cfg); err != nil {
+		t.Fatalf("ValidateWalkForward returned error: %s", err)
+	}
+	if cfg.WalkForwardStep != "2m" || cfg.WalkForwardTopN != 5 {
+		t.Errorf("expected the defaults step = 2m, top = 5, got %s and %d", cfg.WalkForwardStep, cfg.WalkForwardTopN)
+	}
+	windows, err := WalkForwardWindows(cfg)
+	if err != nil {
+		t.Fatalf("WalkForwardWindows returned error: %s", err)
+	}
+	d := func(m time.Month, day int) time.Time { return time.Date(2020, m, day, 0, 0, 0, 0, time.UTC) }
+	want := []WalkForwardWindow{
+		{TrainStart: d(1, 1), TrainStop: d(6, 30), TestStart: d(7, 1), TestStop: d(8, 31)},
+		{TrainStart: d(3, 1), TrainStop: d(8, 31), TestStart: d(9, 1), TestStop: d(10, 31)},
+		{TrainStart: d(5, 1), TrainStop: d(10, 31), TestStart: d(11, 1), TestStop: d(12, 31)},
+	}
+	if len(windows) != len(want) {
+		t.Fatalf("expected %d windows, got %d", len(want), len(windows))
+	}
+	for k := range want {
+		w := windows[k]
+		if !w.TrainStart.Equal(want[k].TrainStart) || !w.TrainStop.Equal(want[k].TrainStop) || !w.TestStart.Equal(want[k].TestStart) || !w.TestStop.Equal(want[k].TestStop) {
+			t.Errorf("window %d: expected %v, got %v", k, want[k], w)
+		}
+	}
+
+	cfg.WalkForwardTrain = "1y"
+	if _, err = WalkForwardWindows(cfg); err == nil {
+		t.Errorf("expected an error when there is no room for a test window")
+	}
+	cfg.WalkForwardStep = "0d"
+	if err = util.ValidateWalkForward(cfg); err == nil {
+		t.Errorf("expected an error for a step of 0 days")
+	}
+}
+
+// TestWalkForward runs a short walk-forward optimization and checks that
+// the out-of-sample equity is stitched from the test windows.
+func TestWalkForward(t *testing.T) {
+	cfg := simTestCfg(t.TempDir(), 2)
+	cfg.DtStop = util.CustomDate(time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC))
+	cfg.WalkForwardTrain = "1m"
+	cfg.WalkForwardTest = "2w"
+	cfg.WalkForwardTopN = 3
+	db := openSimTestDB(t, cfg)
+	util.Init(77)
+
+	var s Simulator
+	s.SqltDB = openSimTestSqlt(t)
+	wf := NewWalkForward()
+	if err := wf.Init(cfg, db, &s); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	if err := wf.Run(); err != nil {
+		t.Fatalf("Run returned error: %s", err)
+	}
+	if len(wf.Windows) != 5 {
+		t.Fatalf("expected 5 windows, got %d", len(wf.Windows))
+	}
+
+	//---------------------------------------------------------------
+	// Each window's series starts at InitFunds, so the first point of
+	// the next window is scaled by the equity at the end of the last.
+	// Months differ in length, so a test window can overlap the next
+	// one. Only its days before the next window are kept.
+	//---------------------------------------------------------------
+	n := 0
+	for k := range wf.Windows {
+		win := &wf.Windows[k]
+		if len(win.DNA) != 3 || len(win.Series) == 0 {
+			t.Fatalf("window %d: expected 3 DNA and a series, got %d and %d", k, len(win.DNA), len(win.Series))
+		}
+		if win.Series[0].Dt.Before(win.TestStart) || win.Series[len(win.Series)-1].Dt.After(win.TestStop) {
+			t.Errorf("window %d: the series is outside of the test window", k)
+		}
+		scale := 1.0
+		if n > 0 {
+			scale = wf.Equity[n-1].PV / cfg.InitFunds
+		}
+		if math.Abs(wf.Equity[n].PV-win.Series[0].PV*scale) > 1e-6 {
+			t.Errorf("window %d: stitched equity %f, expected %f", k, wf.Equity[n].PV, win.Series[0].PV*scale)
+		}
+		for _, p := range win.Series {
+			if k+1 < len(wf.Windows) && !p.Dt.Before(wf.Windows[k+1].TestStart) {
+				break
+			}
+			n++
+		}
+	}
+	if n != len(wf.Equity) {
+		t.Errorf("expected %d days of equity, got %d", n, len(wf.Equity))
+	}
+
+	if time.Time(cfg.DtStop) != time.Date(2020, time.March, 31, 0, 0, 0, 0, time.UTC) || cfg.SingleInvestorMode {
+		t.Errorf("expected the config to be restored after the run")
+	}
+	b, err := os.ReadFile(cfg.GenerateFName("wfrep"))
+	if err != nil {
+		t.Fatalf("could not read wfrep: %s", err)
+	}
+	if !strings.Contains(string(b), "Out-of-Sample Annualized Return") || strings.Count(string(b), "\n5,") != 1 {
+		t.Errorf("unexpected walk-forward report:\n%s", b)
+	}
+	if _, err = os.Stat(cfg.GenerateFName("wfequity")); err != nil {
+		t.Errorf("expected the equity report: %s", err)
+	}
+	if _, err = os.Stat(filepath.Join(cfg.ReportDirectory, CheckpointFileName)); err == nil {
+		t.Errorf("expected no checkpoint in walk-forward mode")
+	}
+}
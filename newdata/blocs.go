@@ -0,0 +1,398 @@
+package newdata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Bloc is a named group of locales, for example the G7. An Influencer for a
+// metric with LocaleType LocaleBloc compares the value of the metric
+// aggregated over the members of a bloc with its value for C1 or C2.
+type Bloc struct {
+	BID         int64
+	Name        string
+	Description string
+	Members     []BlocMember
+}
+
+// BlocMember is one locale of a Bloc
+type BlocMember struct {
+	Locale string  // currency of the locale, as used in FieldSelector.Locale
+	Weight float64 // weight of this member in the weighted aggregate, for example its GDP
+}
+
+// BlocAggregates are the ways the values of a Bloc's members can be combined
+var BlocAggregates = []string{
+	"mean",     // the mean of the member values
+	"weighted", // the mean weighted by the member Weights
+	"median",   // the median of the member values
+}
+
+// FormatBlocMembers returns the members of a bloc in the form used in
+// blocs.csv:  USD:27.36;JPY:4.21;...
+// --------------------------------------------------------------------------------
+func FormatBlocMembers(members []BlocMember) string {
+	s := make([]string, len(members))
+	for i, m := range members {
+		s[i] = m.Locale + ":" + strconv.FormatFloat(m.Weight, 'f', -1, 64)
+	}
+	return strings.Join(s, ";")
+}
+
+// ParseBlocMembers parses the members of a bloc in the form written by
+// FormatBlocMembers. A member with no weight has a weight of 1.
+// --------------------------------------------------------------------------------
+func ParseBlocMembers(s string) ([]BlocMember, error) {
+	var members []BlocMember
+	for _, tok := range strings.Split(s, ";") {
+		tok = strings.TrimSpace(tok)
+		if len(tok) == 0 {
+			continue
+		}
+		m := BlocMember{Locale: tok, Weight: 1}
+		if i := strings.Index(tok, ":"); i >= 0 {
+			m.Locale = strings.TrimSpace(tok[:i])
+			w, err := strconv.ParseFloat(strings.TrimSpace(tok[i+1:]), 64)
+			if err != nil || w < 0 {
+				return nil, fmt.Errorf("bad weight for bloc member %q", tok)
+			}
+			m.Weight = w
+		}
+		members = append(members, m)
+	}
+	if len(members) == 0 {
+		return nil, fmt.Errorf("a bloc must have at least one member")
+	}
+	return members, nil
+}
+
+// checkBlocName returns an error if name cannot be used in Influencer DNA
+func checkBlocName(name string) error {
+	if len(name) == 0 || strings.ContainsAny(name, ",;|={}[]") {
+		return fmt.Errorf("invalid bloc name %q, it must not be empty or contain any of ,;|={}[]", name)
+	}
+	return nil
+}
+
+// setBlocs saves the bloc definitions and the sorted list of their names
+func (p *Database) setBlocs(blocs map[string]Bloc) {
+	p.Blocs = blocs
+	p.BlocNames = p.BlocNames[:0]
+	for k := range blocs {
+		p.BlocNames = append(p.BlocNames, k)
+	}
+	sort.Strings(p.BlocNames) // same order every run, a seed must reproduce the simulation
+}
+
+// BlocMetricRefs returns a MetricRef to metric for each member of the bloc,
+// in the order of b.Members
+// --------------------------------------------------------------------------------
+func (b *Bloc) BlocMetricRefs(metric string) []MetricRef {
+	refs := make([]MetricRef, len(b.Members))
+	for i, m := range b.Members {
+		refs[i] = NewMetricRef(FieldSelector{Metric: metric, Locale: m.Locale})
+	}
+	return refs
+}
+
+// BlocValue returns the value of a metric on dt aggregated over the members
+// of a bloc. The statistics are aggregated the same way as the values.
+// Members with no value on dt are left out.
+//
+// INPUTS
+//
+//	b        - the bloc
+//	refs     - the metric for each member, from b.BlocMetricRefs
+//	agg      - one of BlocAggregates
+//	dt       - the date
+//	lookBack - the look-back of the members' rolling statistics, see
+//	           WindowValue. 0 uses cfg.HoldWindowStatsLookBack
+//
+// RETURNS
+//
+//	the aggregated value
+//	ErrNoRecord if there is no record for dt, ErrNoValue if no member has a
+//	value, or any other error encountered
+//
+// --------------------------------------------------------------------------------
+func (p *Database) BlocValue(b *Bloc, refs []MetricRef, agg string, dt time.Time, lookBack int) (MetricInfo, error) {
+	var vals, means, sds, weights []float64
+	statsValid := true
+	for i := 0; i < len(refs); i++ {
+		m, err := p.WindowValue(&refs[i], dt, lookBack)
+		switch err {
+		case nil:
+		case ErrNoValue:
+			continue
+		default:
+			return MetricInfo{}, err
+		}
+		vals = append(vals, m.Value)
+		means = append(means, m.Mean)
+		sds = append(sds, m.StdDevSquared)
+		weights = append(weights, b.Members[i].Weight)
+		statsValid = statsValid && m.StatsValid
+	}
+	if len(vals) == 0 {
+		return MetricInfo{}, ErrNoValue
+	}
+
+	var r MetricInfo
+	switch agg {
+	case "mean":
+		r.Value, r.Mean, r.StdDevSquared = mean(vals, nil), mean(means, nil), mean(sds, nil)
+	case "weighted":
+		r.Value, r.Mean, r.StdDevSquared = mean(vals, weights), mean(means, weights), mean(sds, weights)
+	case "median":
+		r.Value, r.Mean, r.StdDevSquared = median(vals), median(means), median(sds)
+	default:
+		return MetricInfo{}, fmt.Errorf("unknown bloc aggregate: %s", agg)
+	}
+	r.StatsValid = statsValid
+	return r, nil
+}
+
+// mean returns the mean of x weighted by w, or unweighted if w is nil. If all
+// the weights are 0 the unweighted mean is returned.
+func mean(x, w []float64) float64 {
+	sum, n := float64(0), float64(0)
+	for i := range x {
+		wi := float64(1)
+		if w != nil {
+			wi = w[i]
+		}
+		sum += x[i] * wi
+		n += wi
+	}
+	if n == 0 {
+		return mean(x, nil)
+	}
+	return sum / n
+}
+
+// median returns the median of x, x is not changed
+func median(x []float64) float64 {
+	s := append([]float64(nil), x...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// InsertBloc inserts a new bloc into the database
+// --------------------------------------------------------------------------------
+func (p *Database) InsertBloc(b *Bloc) (int64, error) {
+	switch p.Datatype {
+	case "CSV":
+		return 0, fmt.Errorf("this operation is net yet supported for CSV databases")
+	case "SQL", "SQLITE":
+		return p.SQLDB.InsertBloc(b)
+	default:
+		return 0, fmt.Errorf("unknown database type: %s", p.Datatype)
+	}
+}
+
+// InsertBloc inserts a new Bloc into the Blocs table and its members into
+// BlocMembers. The LocaleCache must be loaded.
+// --------------------------------------------------------------------------------
+func (p *DatabaseSQL) InsertBloc(b *Bloc) (int64, error) {
+	if err := checkBlocName(b.Name); err != nil {
+		return 0, err
+	}
+	for _, m := range b.Members {
+		if _, ok := p.LocaleCache[m.Locale]; !ok {
+			return 0, fmt.Errorf("bloc %s: unknown locale %s", b.Name, m.Locale)
+		}
+	}
+	res, err := p.DB.Exec("INSERT INTO Blocs(Name, Description) VALUES(?, ?)", b.Name, b.Description)
+	if err != nil {
+		return 0, err
+	}
+	bid, err := res.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	for _, m := range b.Members {
+		if _, err = p.DB.Exec("INSERT INTO BlocMembers(BID, LID, Weight) VALUES(?, ?, ?)", bid, p.LocaleCache[m.Locale].LID, m.Weight); err != nil {
+			return 0, err
+		}
+	}
+	return bid, nil
+}
+
+// LoadBlocCache reads the bloc definitions into ParentDB.Blocs. Databases
+// created before blocs were added do not have the tables, they have no blocs.
+// --------------------------------------------------------------------------------
+func (p *DatabaseSQL) LoadBlocCache() error {
+	blocs := map[string]Bloc{}
+	names := map[int64]string{}
+	rows, err := p.DB.Query("SELECT BID, Name, Description FROM Blocs")
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") || strings.Contains(err.Error(), "doesn't exist") {
+			p.ParentDB.setBlocs(blocs)
+			return nil
+		}
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var b Bloc
+		var desc *string
+		if err = rows.Scan(&b.BID, &b.Name, &desc); err != nil {
+			return err
+		}
+		if desc != nil {
+			b.Description = *desc
+		}
+		blocs[b.Name] = b
+		names[b.BID] = b.Name
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	mrows, err := p.DB.Query("SELECT m.BID, l.Currency, m.Weight FROM BlocMembers m JOIN Locales l ON l.LID = m.LID ORDER BY m.BID, l.Currency")
+	if err != nil {
+		return err
+	}
+	defer mrows.Close()
+	for mrows.Next() {
+		var bid int64
+		var m BlocMember
+		if err = mrows.Scan(&bid, &m.Locale, &m.Weight); err != nil {
+			return err
+		}
+		b, ok := blocs[names[bid]]
+		if !ok {
+			return fmt.Errorf("BlocMembers references unknown bloc %d", bid)
+		}
+		b.Members = append(b.Members, m)
+		blocs[b.Name] = b
+	}
+	if err = mrows.Err(); err != nil {
+		return err
+	}
+	p.ParentDB.setBlocs(blocs)
+	return nil
+}
+
+// LoadBlocsCSV reads the bloc definitions from blocs.csv in the same directory
+// as the database. If there is no blocs.csv there are no blocs.
+// --------------------------------------------------------------------------------
+func (d *DatabaseCSV) LoadBlocsCSV() error {
+	blocs := map[string]Bloc{}
+	filename := filepath.Join(filepath.Dir(d.DBFname), "blocs.csv")
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.ParentDB.setBlocs(blocs)
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	colIndices := make(map[string]int)
+	for i, col := range header {
+		colIndices[strings.ReplaceAll(HandleUTF8FileChars(col), " ", "")] = i
+	}
+
+	line := 1 // we've already read line 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line++
+
+		var b Bloc
+		for colName, index := range colIndices {
+			switch colName {
+			case "BID":
+				if b.BID, err = strconv.ParseInt(record[index], 10, 64); err != nil {
+					return fmt.Errorf("%s, line %d: bad BID: %q", filename, line, record[index])
+				}
+			case "Name":
+				b.Name = record[index]
+			case "Description":
+				b.Description = record[index]
+			case "Members":
+				if b.Members, err = ParseBlocMembers(record[index]); err != nil {
+					return fmt.Errorf("%s, line %d: %s", filename, line, err)
+				}
+			}
+		}
+		if err = checkBlocName(b.Name); err != nil {
+			return fmt.Errorf("%s, line %d: %s", filename, line, err)
+		}
+		blocs[b.Name] = b
+	}
+	d.ParentDB.setBlocs(blocs)
+	return nil
+}
+
+// WriteBlocsToCSV writes the bloc definitions to blocs.csv
+// --------------------------------------------------------------------------------
+func (d *DatabaseCSV) WriteBlocsToCSV(blocs map[string]Bloc) error {
+	file, err := os.Create(filepath.Join(d.DBPath, "blocs.csv"))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	if err = writer.Write([]string{"BID", "Name", "Members", "Description"}); err != nil {
+		return fmt.Errorf("error writing header to CSV file: %v", err)
+	}
+	names := make([]string, 0, len(blocs))
+	for k := range blocs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b := blocs[k]
+		record := []string{fmt.Sprintf("%d", b.BID), b.Name, FormatBlocMembers(b.Members), b.Description}
+		if err = writer.Write(record); err != nil {
+			return fmt.Errorf("error writing record to CSV file: %v", err)
+		}
+	}
+
+	writer.Flush()
+	if err = writer.Error(); err != nil {
+		return fmt.Errorf("error flushing data to CSV file: %v", err)
+	}
+	return nil
+}
+
+// blocLocales returns the locales of every member of every bloc, sorted
+func (p *Database) blocLocales() []string {
+	m := map[string]bool{}
+	for _, b := range p.Blocs {
+		for _, v := range b.Members {
+			m[v.Locale] = true
+		}
+	}
+	locs := make([]string, 0, len(m))
+	for k := range m {
+		locs = append(locs, k)
+	}
+	sort.Strings(locs)
+	return locs
+}
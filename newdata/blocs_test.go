@@ -0,0 +1,155 @@
+package newdata
+
+import (
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestParseBlocMembers(t *testing.T) {
+	m, err := ParseBlocMembers("USD:27.36; JPY:4.21;GBP")
+	if err != nil {
+		t.Fatalf("ParseBlocMembers returned error: %s", err)
+	}
+	want := []BlocMember{{"USD", 27.36}, {"JPY", 4.21}, {"GBP", 1}}
+	if len(m) != len(want) {
+		t.Fatalf("expected %d members, got %d", len(want), len(m))
+	}
+	for i := range want {
+		if m[i] != want[i] {
+			t.Errorf("member %d: expected %v, got %v", i, want[i], m[i])
+		}
+	}
+	if s := FormatBlocMembers(m); s != "USD:27.36;JPY:4.21;GBP:1" {
+		t.Errorf("unexpected format: %s", s)
+	}
+	for _, s := range []string{"", "USD:x", "USD:-1"} {
+		if _, err = ParseBlocMembers(s); err == nil {
+			t.Errorf("expected an error for %q", s)
+		}
+	}
+}
+
+// TestSQLiteBlocs stores a bloc, reloads it and aggregates its members'
+// values. CAD has no value, it is left out of the aggregates.
+func TestSQLiteBlocs(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	if _, err := db.InsertLocale(&Locale{Name: "CAN", Currency: "CAD", Country: "Canada", Description: "Canada, Canadian Dollar"}); err != nil {
+		t.Fatalf("InsertLocale returned error: %s", err)
+	}
+	if err := db.SQLDB.LoadLocaleCache(); err != nil {
+		t.Fatalf("LoadLocaleCache returned error: %s", err)
+	}
+	b := Bloc{Name: "Test", Description: "test bloc", Members: []BlocMember{{"USD", 3}, {"JPY", 1}, {"CAD", 2}}}
+	if _, err := db.InsertBloc(&b); err != nil {
+		t.Fatalf("InsertBloc returned error: %s", err)
+	}
+	if _, err := db.InsertBloc(&Bloc{Name: "Bad", Members: []BlocMember{{"XYZ", 1}}}); err == nil {
+		t.Errorf("expected an error for an unknown locale")
+	}
+	if _, err := db.InsertBloc(&Bloc{Name: "A,B", Members: []BlocMember{{"USD", 1}}}); err == nil {
+		t.Errorf("expected an error for a name that cannot be used in DNA")
+	}
+
+	db.Mim.ParentDB = db
+	if err := db.Mim.LoadMInfluencerSubclasses(); err != nil {
+		t.Fatalf("LoadMInfluencerSubclasses returned error: %s", err)
+	}
+	dt := time.Date(2022, time.March, 15, 0, 0, 0, 0, time.UTC)
+	rec := EconometricsRecord{
+		Date: dt,
+		Fields: map[string]MetricInfo{
+			"USDDR":         {Value: 2},
+			"JPYDR":         {Value: -1},
+			"USDJPYEXClose": {Value: 118.75},
+		},
+	}
+	if err := db.Insert(&rec); err != nil {
+		t.Fatalf("Insert returned error: %s", err)
+	}
+	prev := EconometricsRecord{
+		Date:   dt.AddDate(0, 0, -1),
+		Fields: map[string]MetricInfo{"USDDR": {Value: 4}, "JPYDR": {Value: 1}},
+	}
+	if err := db.Insert(&prev); err != nil {
+		t.Fatalf("Insert returned error: %s", err)
+	}
+	db.Mim = NewInfluencerManager()
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+
+	got, ok := db.Blocs["Test"]
+	if !ok || len(db.BlocNames) != 1 || got.Description != "test bloc" || len(got.Members) != 3 {
+		t.Fatalf("unexpected blocs after reload: %v", db.Blocs)
+	}
+	if FormatBlocMembers(got.Members) != "CAD:2;JPY:1;USD:3" {
+		t.Errorf("unexpected members: %s", FormatBlocMembers(got.Members))
+	}
+
+	refs := got.BlocMetricRefs("DR")
+	cases := map[string]float64{"mean": 0.5, "weighted": 1.25, "median": 0.5}
+	for agg, want := range cases {
+		v, err := db.BlocValue(&got, refs, agg, dt, 0)
+		if err != nil {
+			t.Fatalf("%s: BlocValue returned error: %s", agg, err)
+		}
+		if math.Abs(v.Value-want) > 1e-9 {
+			t.Errorf("%s: expected %f, got %f", agg, want, v.Value)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// over two days the mean DR is 3 for USD and 0 for JPY
+	//---------------------------------------------------------------
+	means := map[string]float64{"mean": 1.5, "weighted": 2.25, "median": 1.5}
+	for agg, want := range means {
+		v, err := db.BlocValue(&got, refs, agg, dt, 2)
+		if err != nil {
+			t.Fatalf("%s: BlocValue returned error: %s", agg, err)
+		}
+		if math.Abs(v.Mean-want) > 1e-9 || !v.StatsValid {
+			t.Errorf("%s: expected mean %f, got %f (valid %t)", agg, want, v.Mean, v.StatsValid)
+		}
+	}
+	if _, err := db.BlocValue(&got, refs, "max", dt, 0); err == nil {
+		t.Errorf("expected an error for an unknown aggregate")
+	}
+	if _, err := db.BlocValue(&got, refs, "mean", dt.AddDate(0, 0, 1), 0); err == nil {
+		t.Errorf("expected an error for a date with no data")
+	}
+}
+
+// TestCSVBlocs writes bloc definitions to blocs.csv and reads them back
+func TestCSVBlocs(t *testing.T) {
+	dir := t.TempDir()
+	var db Database
+	db.CSVDB = &DatabaseCSV{DBPath: dir, DBFname: filepath.Join(dir, "platodb.csv"), ParentDB: &db}
+	if err := db.CSVDB.LoadBlocsCSV(); err != nil || len(db.Blocs) != 0 {
+		t.Fatalf("expected no blocs and no error without blocs.csv, got %d, %v", len(db.Blocs), err)
+	}
+
+	blocs := map[string]Bloc{
+		"G7":   {BID: 1, Name: "G7", Description: "Group of Seven, by GDP", Members: []BlocMember{{"USD", 27.36}, {"JPY", 4.21}}},
+		"Asia": {BID: 2, Name: "Asia", Members: []BlocMember{{"JPY", 1}, {"CNY", 4}}},
+	}
+	if err := db.CSVDB.WriteBlocsToCSV(blocs); err != nil {
+		t.Fatalf("WriteBlocsToCSV returned error: %s", err)
+	}
+	if err := db.CSVDB.LoadBlocsCSV(); err != nil {
+		t.Fatalf("LoadBlocsCSV returned error: %s", err)
+	}
+	if len(db.BlocNames) != 2 || db.BlocNames[0] != "Asia" {
+		t.Fatalf("unexpected bloc names: %v", db.BlocNames)
+	}
+	for k, b := range blocs {
+		got := db.Blocs[k]
+		if got.BID != b.BID || got.Description != b.Description || FormatBlocMembers(got.Members) != FormatBlocMembers(b.Members) {
+			t.Errorf("%s: expected %v, got %v", k, b, got)
+		}
+	}
+	if l := db.blocLocales(); len(l) != 3 || l[0] != "CNY" || l[2] != "USD" {
+		t.Errorf("unexpected bloc locales: %v", l)
+	}
+}
@@ -0,0 +1,150 @@
+package newdata
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// ClosedDay is a day on which the market is closed, a holiday for example.
+// It is the trading calendar of the database.
+type ClosedDay struct {
+	Date        time.Time
+	Pair        string // the currency pair closed, like USDJPY, or a single currency, like JPY, which closes every pair it is in. Empty closes every pair
+	Description string
+}
+
+// ClosesPair returns true if c closes the market of the currency pair c1c2
+func (c *ClosedDay) ClosesPair(c1, c2 string) bool {
+	return len(c.Pair) == 0 || c.Pair == c1+c2 || c.Pair == c1 || c.Pair == c2
+}
+
+// setClosedDays saves the closed days, sorted by date
+func (p *Database) setClosedDays(days []ClosedDay) {
+	sort.SliceStable(days, func(i, j int) bool { return days[i].Date.Before(days[j].Date) })
+	p.ClosedDays = days
+}
+
+// InsertClosedDay adds a closed day to the trading calendar of the database
+// --------------------------------------------------------------------------------
+func (p *Database) InsertClosedDay(c *ClosedDay) error {
+	switch p.Datatype {
+	case "CSV":
+		return fmt.Errorf("this operation is net yet supported for CSV databases")
+	case "SQL", "SQLITE":
+		return p.SQLDB.InsertClosedDay(c)
+	default:
+		return fmt.Errorf("unknown database type: %s", p.Datatype)
+	}
+}
+
+// InsertClosedDay inserts a closed day into the ClosedDays table
+// --------------------------------------------------------------------------------
+func (p *DatabaseSQL) InsertClosedDay(c *ClosedDay) error {
+	_, err := p.DB.Exec("INSERT INTO ClosedDays(Date, Pair, Description) VALUES(?, ?, ?)", p.dateValue(c.Date), strings.ToUpper(c.Pair), c.Description)
+	return err
+}
+
+// LoadClosedDayCache reads the trading calendar into ParentDB.ClosedDays.
+// Databases created before the calendar was added do not have the table,
+// the market is never closed for them.
+// --------------------------------------------------------------------------------
+func (p *DatabaseSQL) LoadClosedDayCache() error {
+	var days []ClosedDay
+	rows, err := p.DB.Query("SELECT Date, Pair, Description FROM ClosedDays ORDER BY Date")
+	if err != nil {
+		if strings.Contains(err.Error(), "no such table") || strings.Contains(err.Error(), "doesn't exist") {
+			p.ParentDB.setClosedDays(days)
+			return nil
+		}
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c ClosedDay
+		var desc *string
+		if err = rows.Scan(&c.Date, &c.Pair, &desc); err != nil {
+			return err
+		}
+		if desc != nil {
+			c.Description = *desc
+		}
+		days = append(days, c)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	p.ParentDB.setClosedDays(days)
+	return nil
+}
+
+// LoadCalendarCSV reads the trading calendar from calendar.csv in the same
+// directory as the database. Its columns are Date, Pair and Description. If
+// there is no calendar.csv the market is never closed.
+// --------------------------------------------------------------------------------
+func (d *DatabaseCSV) LoadCalendarCSV() error {
+	var days []ClosedDay
+	filename := filepath.Join(filepath.Dir(d.DBFname), "calendar.csv")
+	file, err := os.Open(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.ParentDB.setClosedDays(days)
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1 // Pair and Description are optional
+	header, err := reader.Read()
+	if err != nil {
+		return err
+	}
+	colIndices := make(map[string]int)
+	for i, col := range header {
+		colIndices[strings.ReplaceAll(HandleUTF8FileChars(col), " ", "")] = i
+	}
+	if _, ok := colIndices["Date"]; !ok {
+		return fmt.Errorf("%s: there is no Date column", filename)
+	}
+
+	line := 1 // we've already read line 1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		line++
+
+		var c ClosedDay
+		for colName, index := range colIndices {
+			if index >= len(record) {
+				continue
+			}
+			switch colName {
+			case "Date":
+				if c.Date, err = util.StringToDate(record[index]); err != nil {
+					return fmt.Errorf("%s, line %d: bad Date: %q", filename, line, record[index])
+				}
+			case "Pair":
+				c.Pair = strings.ToUpper(strings.TrimSpace(record[index]))
+			case "Description":
+				c.Description = record[index]
+			}
+		}
+		days = append(days, c)
+	}
+	d.ParentDB.setClosedDays(days)
+	return nil
+}
@@ -0,0 +1,62 @@
+package newdata
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// TestSQLiteClosedDays stores closed days and reloads them sorted by date
+func TestSQLiteClosedDays(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	d1 := time.Date(2022, time.January, 3, 0, 0, 0, 0, time.UTC)
+	d2 := time.Date(2021, time.December, 24, 0, 0, 0, 0, time.UTC)
+	if err := db.InsertClosedDay(&ClosedDay{Date: d1, Pair: "jpy", Description: "Bank holiday"}); err != nil {
+		t.Fatalf("InsertClosedDay returned error: %s", err)
+	}
+	if err := db.InsertClosedDay(&ClosedDay{Date: d2}); err != nil {
+		t.Fatalf("InsertClosedDay returned error: %s", err)
+	}
+	if err := db.SQLDB.LoadClosedDayCache(); err != nil {
+		t.Fatalf("LoadClosedDayCache returned error: %s", err)
+	}
+	if len(db.ClosedDays) != 2 || !db.ClosedDays[0].Date.Equal(d2) || !db.ClosedDays[1].Date.Equal(d1) {
+		t.Fatalf("unexpected closed days: %v", db.ClosedDays)
+	}
+	c := db.ClosedDays[1]
+	if c.Pair != "JPY" || c.Description != "Bank holiday" {
+		t.Errorf("unexpected closed day: %v", c)
+	}
+	if !c.ClosesPair("USD", "JPY") || c.ClosesPair("USD", "EUR") || !db.ClosedDays[0].ClosesPair("USD", "EUR") {
+		t.Errorf("unexpected pairs closed by %v", db.ClosedDays)
+	}
+}
+
+// TestCSVClosedDays reads the trading calendar from calendar.csv
+func TestCSVClosedDays(t *testing.T) {
+	dir := t.TempDir()
+	var db Database
+	db.CSVDB = &DatabaseCSV{DBPath: dir, DBFname: filepath.Join(dir, "platodb.csv"), ParentDB: &db}
+	if err := db.CSVDB.LoadCalendarCSV(); err != nil || len(db.ClosedDays) != 0 {
+		t.Fatalf("expected no closed days and no error without calendar.csv, got %d, %v", len(db.ClosedDays), err)
+	}
+
+	csv := "Date,Pair,Description\n2020-12-25,,Christmas\n2020-01-01,USDJPY\n"
+	if err := os.WriteFile(filepath.Join(dir, "calendar.csv"), []byte(csv), 0644); err != nil {
+		t.Fatalf("could not write calendar.csv: %s", err)
+	}
+	if err := db.CSVDB.LoadCalendarCSV(); err != nil {
+		t.Fatalf("LoadCalendarCSV returned error: %s", err)
+	}
+	if len(db.ClosedDays) != 2 || db.ClosedDays[0].Pair != "USDJPY" || db.ClosedDays[1].Description != "Christmas" {
+		t.Errorf("unexpected closed days: %v", db.ClosedDays)
+	}
+
+	if err := os.WriteFile(filepath.Join(dir, "calendar.csv"), []byte("Date\nnot a date\n"), 0644); err != nil {
+		t.Fatalf("could not write calendar.csv: %s", err)
+	}
+	if err := db.CSVDB.LoadCalendarCSV(); err == nil {
+		t.Errorf("expected an error for a bad date")
+	}
+}
@@ -6,8 +6,8 @@ import (
 	"log"
 	"os"
 	"path/filepath"
-	"sort"
 	"strconv"
+	"time"
 
 	"github.com/stmansour/psim/util"
 )
@@ -82,6 +82,32 @@ func (d *DatabaseCSV) LoadCsvDB() error {
 	// #################### END DATABASE FILE HANDLING #######################
 	//-------------------------------------------------------------------------
 
+	if len(lines) < 2 {
+		return fmt.Errorf("%s contains no data", fname)
+	}
+
+	//----------------------------------------------------------------------
+	// The data is kept in columnar form, one column per metric indexed by
+	// day. Read the dates first so that the columns can be sized.
+	//----------------------------------------------------------------------
+	dates := make([]time.Time, len(lines))
+	for i := 1; i < len(lines); i++ {
+		dates[i], err = util.StringToDate(lines[i][0])
+		if err != nil {
+			fmt.Printf("*** ERROR *** on line %d, date = %q", i, lines[i][0])
+			fmt.Println(err)
+			return err
+		}
+		if i == 1 || dates[i].Before(d.DtStart) {
+			d.DtStart = dates[i]
+		}
+		if i == 1 || dates[i].After(d.DtStop) {
+			d.DtStop = dates[i]
+		}
+	}
+	d.Series = NewEconometricsSeries(d.DtStart, d.DtStop)
+	d.Series.Rows = make([]bool, d.Series.Days)
+
 	rollingStatsMap := make(map[string]*RollingStats) // this is where we keep the rolling window of values used to calculate stats
 
 	//----------------------------------------------------------------------
@@ -92,7 +118,7 @@ func (d *DatabaseCSV) LoadCsvDB() error {
 	for k := 0; k < len(d.DTypes); k++ {
 		d.CSVMap[d.DTypes[k]] = -1 // haven't located this column yet
 	}
-	records := EconometricsRecords{}
+	var cols []*MetricSeries // the series column for each CSV column
 
 	for i, line := range lines {
 		if i == 0 {
@@ -102,6 +128,7 @@ func (d *DatabaseCSV) LoadCsvDB() error {
 				log.Panicf("Problem with %s, column 1 is labelled %q, it should be %q\n", PLATODB, line[0], "Date")
 			}
 			d.ColIdx = append(d.ColIdx, "Date")
+			cols = append(cols, nil)
 			//----------------------------------------------------------------------------
 			// Save the column names for multiple ways to index
 			//----------------------------------------------------------------------------
@@ -109,21 +136,14 @@ func (d *DatabaseCSV) LoadCsvDB() error {
 				s := util.Stripchars(line[j], " ")
 				d.CSVMap[s] = j
 				d.ColIdx = append(d.ColIdx, s)
+				cols = append(cols, d.Series.Column(s))
 			}
 			d.NumMetricFields = len(d.ColIdx)
 			continue // remaining rows are data, code below handles data, continue to the next line now
 		}
 
-		rec := EconometricsRecord{
-			Fields: make(map[string]MetricInfo, d.NumMetricFields),
-		}
-
-		rec.Date, err = util.StringToDate(line[0])
-		if err != nil {
-			fmt.Printf("*** ERROR *** on line %d, date = %q", i, line[0])
-			fmt.Println(err)
-			return err
-		}
+		day, _ := d.Series.DayIndex(dates[i])
+		d.Series.Rows[day] = true
 
 		for j := 1; j < len(line); j++ {
 			if len(line[j]) == 0 {
@@ -142,25 +162,14 @@ func (d *DatabaseCSV) LoadCsvDB() error {
 				rollingStatsMap[metricName] = NewRollingStats(d.ParentDB.cfg.HoldWindowStatsLookBack)
 			}
 			mean, stdDevSquared, statsValid := rollingStatsMap[metricName].AddValue(x)
-			mi := MetricInfo{
-				Value:         x,
-				Mean:          mean,
-				StdDevSquared: stdDevSquared,
-				StatsValid:    statsValid,
-			}
-			rec.Fields[metricName] = mi
-			// if math.IsNaN(mean) {
-			// 	fmt.Printf("ERROR: Mean is NaN for %s, value = %f\n", metricName, mean)
-			// }
+			c := cols[j]
+			c.Values[day] = x
+			c.Mean[day] = mean
+			c.StdDevSquared[day] = stdDevSquared
+			c.StatsValid[day] = statsValid
+			c.Present[day] = true
 		}
-		records = append(records, rec)
 	}
-
-	d.DBRecs = records
-	sort.Sort(d.DBRecs)
-	l := d.DBRecs.Len()
-	d.DtStart = d.DBRecs[0].Date
-	d.DtStop = d.DBRecs[l-1].Date
 	return nil
 }
 
@@ -17,7 +17,7 @@ import (
 type DatabaseCSV struct {
 	DBFname         string              // the csv file used as a database
 	DBPath          string              // path where DB files are kept
-	DBRecs          EconometricsRecords // all records... temporary, until we have database
+	Series          *EconometricsSeries // all the data, in columnar form, one column per metric
 	DtStart         time.Time           // earliest date with data
 	DtStop          time.Time           // latest date with data
 	DTypes          []string            // the list of Influencers, each has their own data type
@@ -98,6 +98,12 @@ func (d *DatabaseCSV) CSVInit() error {
 	if err := d.ParentDB.Mim.Init(d.ParentDB); err != nil {
 		return err
 	}
+	if err := d.LoadBlocsCSV(); err != nil {
+		return err
+	}
+	if err := d.LoadCalendarCSV(); err != nil {
+		return err
+	}
 	if err := d.LoadMetricsSourceCache(); err != nil {
 		return err
 	}
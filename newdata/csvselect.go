@@ -12,79 +12,50 @@ func (d *DatabaseCSV) IncrementNildata() {
 	atomic.AddInt64(&d.Nildata, 1)
 }
 
-// Select does the select function for CSV databases
+// Select does the select function for CSV databases. It returns nil if the
+// CSV file had no record for dt. When fields is empty, every metric with a
+// value on dt is returned.
+//
+// Select builds a new map for every call. Code that reads the same metrics
+// over and over should use Database.Value with a MetricRef instead.
 // ----------------------------------------------------------------------------
 func (d *DatabaseCSV) Select(dt time.Time, fields []FieldSelector) (*EconometricsRecord, error) {
-	dayInNanoseconds := int64(24 * 60 * 60 * 1000 * 1000 * 1000) // 36 hours in nanoseconds
-	left := 0
-	right := len(d.DBRecs) - 1
-
-	// get the date with no tz offset...
-	dty := dt.Year()
-	dtm := dt.Month()
-	dtd := dt.Day()
-	dtt := time.Date(dty, dtm, dtd, 0, 0, 0, 0, time.UTC)
-
-	// Pre-calculate the UnixNano representation of dt for comparison.
-	dtUnixNano := dtt.UnixNano()
-
-	// Binary search the record index
-	for left <= right {
-		mid := left + (right-left)/2
-		recordUnixNano := d.DBRecs[mid].Date.UnixNano()
-
-		// are we within a day?
-		if abs(dtUnixNano-recordUnixNano) < dayInNanoseconds {
-			if d.DBRecs[mid].Date.Year() == dty && d.DBRecs[mid].Date.Month() == dtm && d.DBRecs[mid].Date.Day() == dtd { // Further verify that the exact calendar date matches.
-				rec := d.mapSubset(&d.DBRecs[mid], fields)
-				if len(rec.Fields) == 0 {
-					d.IncrementNildata()
-				}
-				return rec, nil
-			} else if d.DBRecs[mid].Date.Before(dt) {
-				left = mid + 1
-			} else {
-				right = mid - 1
-			}
-		} else if recordUnixNano < dtUnixNano {
-			left = mid + 1
-		} else {
-			right = mid - 1
-		}
+	s := d.Series
+	if s == nil {
+		return nil, nil
 	}
-	return nil, nil
-}
-
-// Helper function for absolute value calculation
-func abs(x int64) int64 {
-	if x < 0 {
-		return -x
+	i, ok := s.DayIndex(dt)
+	if !ok || !s.HasRecord(i) {
+		return nil, nil
 	}
-	return x
-}
-
-// mapSubset is a utility function to populate a map with only the fields
-// the caller requested.
-// When len(fs) == 0, the entire record is returned. The assumption here is
-// that the caller always uses this data in a read-only manner. So it is safe
-// to return the entire record.
-// ----------------------------------------------------------------------------
-func (d *DatabaseCSV) mapSubset(rec *EconometricsRecord, fs []FieldSelector) *EconometricsRecord {
-	nr := EconometricsRecord{
-		Date: rec.Date,
+	rec := EconometricsRecord{
+		Date: s.Date(i),
 	}
-	if len(fs) > 0 {
-		nr.Fields = make(map[string]MetricInfo, len(fs))
-		for _, selector := range fs {
-			key := selector.FQMetric()
-			if value, exists := rec.Fields[key]; exists {
-				nr.Fields[key] = value
-			} else {
-				d.Nildata++
+	if len(fields) == 0 {
+		rec.Fields = make(map[string]MetricInfo, len(s.Columns))
+		for h := range s.Columns {
+			if m, ok := s.At(MetricHandle(h), i); ok {
+				rec.Fields[s.Columns[h].Name] = m
 			}
 		}
 	} else {
-		nr.Fields = rec.Fields
+		rec.Fields = make(map[string]MetricInfo, len(fields))
+	}
+	for _, selector := range fields {
+		key := selector.FQMetric()
+		h := s.Handle(key)
+		if h == NoMetricHandle {
+			d.IncrementNildata()
+			continue
+		}
+		if m, ok := s.At(h, i); ok {
+			rec.Fields[key] = m
+		} else {
+			d.IncrementNildata()
+		}
+	}
+	if len(rec.Fields) == 0 {
+		d.IncrementNildata()
 	}
-	return &nr
+	return &rec, nil
 }
@@ -178,7 +178,8 @@ func (d *DatabaseCSV) WriteMISubclassesToCSV(subclassesMap map[string]MInfluence
 	header := []string{
 		"MID", "Name", "Metric", "BlocType", "LocaleType", "Predictor", "Subclass",
 		"MinDelta1", "MaxDelta1", "MinDelta2", "MaxDelta2",
-		"FitnessW1", "FitnessW2", /*"HoldWindowPos", "HoldWindowNeg",*/
+		"FitnessW1", "FitnessW2" /*"HoldWindowPos", "HoldWindowNeg",*/, "Formula",
+		"MinLookBack", "MaxLookBack", "MinVarFactor", "MaxVarFactor",
 	}
 	if err := writer.Write(header); err != nil {
 		return fmt.Errorf("error writing header to CSV file: %v", err)
@@ -202,6 +203,11 @@ func (d *DatabaseCSV) WriteMISubclassesToCSV(subclassesMap map[string]MInfluence
 			fmt.Sprintf("%f", subclass.FitnessW2),
 			// fmt.Sprintf("%f", subclass.HoldWindowPos),
 			// fmt.Sprintf("%f", subclass.HoldWindowNeg),
+			subclass.Formula,
+			fmt.Sprintf("%d", subclass.MinLookBack),
+			fmt.Sprintf("%d", subclass.MaxLookBack),
+			fmt.Sprintf("%f", subclass.MinVarFactor),
+			fmt.Sprintf("%f", subclass.MaxVarFactor),
 		}
 
 		if err := writer.Write(record); err != nil {
@@ -306,6 +312,20 @@ func (d *DatabaseCSV) CopySQLRecsToCSV(sqldb *Database) error {
 			fld = field2.Locale + v.Metric
 			fmt.Fprintf(file, ",%q", fld)
 			s = append(s, fld)
+		case LocaleBloc: // a column for C1, C2 and every locale that is a member of a bloc
+			locs := []string{d.ParentDB.cfg.C1, d.ParentDB.cfg.C2}
+			for _, l := range d.ParentDB.blocLocales() {
+				if l != locs[0] && l != locs[1] {
+					locs = append(locs, l)
+				}
+			}
+			for _, l := range locs {
+				field := FieldSelector{Metric: v.Metric, Locale: l}
+				fields = append(fields, field)
+				fld := l + v.Metric
+				fmt.Fprintf(file, ",%q", fld)
+				s = append(s, fld)
+			}
 		default:
 			return fmt.Errorf("unrecognized LocaleType on metric %s: %d", v.Metric, v.LocaleType)
 		}
@@ -31,13 +31,17 @@ type MetricSourceMap map[string]string
 
 // Database is the abstraction for the data source
 type Database struct {
-	cfg      *util.AppConfig            // application configuration info
-	extres   *util.ExternalResources    // the db may require secrets
-	Datatype string                     // "CSV", "MYSQL"
-	CSVDB    *DatabaseCSV               // valid when Datatype is "CSV"
-	SQLDB    *DatabaseSQL               // valid when Datatype is "SQL"
-	Mim      *MetricInfluencerManager   // metrics manager
-	MSMap    map[string]MetricSourceMap // metric name to metric source api name: example MSMap["TradingEconomics"]["gold"] = "XAUUSD:CUR"
+	cfg        *util.AppConfig            // application configuration info
+	extres     *util.ExternalResources    // the db may require secrets
+	Datatype   string                     // "CSV", "SQL", "SQLITE"
+	CSVDB      *DatabaseCSV               // valid when Datatype is "CSV"
+	SQLDB      *DatabaseSQL               // valid when Datatype is "SQL" or "SQLITE"
+	Mim        *MetricInfluencerManager   // metrics manager
+	MSMap      map[string]MetricSourceMap // metric name to metric source api name: example MSMap["TradingEconomics"]["gold"] = "XAUUSD:CUR"
+	Cache      *EconometricsSeries        // if non-nil, Select is answered from here whenever possible. See PreloadCache
+	Blocs      map[string]Bloc            // bloc definitions by name
+	BlocNames  []string                   // names of the blocs, sorted
+	ClosedDays []ClosedDay                // the days the market is closed, sorted by date
 }
 
 // EconometricsRecord is the basic structure of discount rate data
@@ -84,7 +88,7 @@ func GetMetricBucketCore(s string) int {
 }
 
 // NewDatabase creates a new database structure
-// dtype: "CSV", "MYSQL"
+// dtype: "CSV", "SQL", "SQLITE"
 // ------------------------------------------------------------
 func NewDatabase(dtype string, cfg *util.AppConfig, ex *util.ExternalResources) (*Database, error) {
 	switch dtype {
@@ -104,11 +108,26 @@ func NewDatabase(dtype string, cfg *util.AppConfig, ex *util.ExternalResources)
 		}
 		db.SQLDB = &DatabaseSQL{
 			Name:        "plato",
+			Driver:      "mysql",
 			BucketCount: GlobalSQLSettings.BucketCount, // we will adjust as needed
 		}
 		db.SQLDB.MetricIDCache = make(map[string]int)
 		return &db, nil
 
+	case "SQLITE":
+		db := Database{
+			cfg:      cfg,
+			Datatype: "SQLITE",
+			extres:   ex,
+		}
+		db.SQLDB = &DatabaseSQL{
+			Name:        "plato",
+			Driver:      SQLiteDriver,
+			BucketCount: GlobalSQLSettings.BucketCount,
+		}
+		db.SQLDB.MetricIDCache = make(map[string]int)
+		return &db, nil
+
 	default:
 		return nil, fmt.Errorf("unrecognized database type: %s", dtype)
 	}
@@ -118,10 +137,15 @@ func NewDatabase(dtype string, cfg *util.AppConfig, ex *util.ExternalResources)
 // ----------------------------------------------------------------------------
 func (p *Database) Select(dt time.Time, fields []FieldSelector) (*EconometricsRecord, error) {
 	var err error
+	if p.Cache != nil {
+		if rec, ok := p.Cache.Select(dt, fields); ok {
+			return rec, nil
+		}
+	}
 	switch p.Datatype {
 	case "CSV":
 		return p.CSVDB.Select(dt, fields)
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.Select(dt, fields)
 	default:
 		err = fmt.Errorf("unrecognized data source: %s", p.Datatype)
@@ -129,12 +153,27 @@ func (p *Database) Select(dt time.Time, fields []FieldSelector) (*EconometricsRe
 	}
 }
 
+// DataDateRange returns the earliest and latest dates for which the database
+// has data.
+// ----------------------------------------------------------------------------
+func (p *Database) DataDateRange() (time.Time, time.Time) {
+	switch p.Datatype {
+	case "CSV":
+		return p.CSVDB.DtStart, p.CSVDB.DtStop
+	default:
+		return p.SQLDB.DtStart, p.SQLDB.DtStop
+	}
+}
+
 // DropDatabase deletes the sql database.  Use this with caution
 // ---------------------------------------------------------------------------------
 func (p *Database) DropDatabase() error {
 	if p.Datatype == "CSV" {
 		return nil
 	}
+	if p.Datatype == "SQLITE" {
+		return p.SQLDB.dropSQLiteTables()
+	}
 	if p.Datatype != "SQL" {
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
 	}
@@ -184,8 +223,8 @@ func (p *Database) ensureDatabase() error {
 	return nil
 }
 
-// Open opens the database for use. It creates the SQL DATABASE if needed,
-// but it does not create any TABLES.
+// Open opens the database for use. It creates the SQL DATABASE (or SQLite
+// file) if needed, but it does not create any TABLES.
 // ------------------------------------------------------------------------------
 func (p *Database) Open() error {
 	var err error
@@ -216,6 +255,8 @@ func (p *Database) Open() error {
 			}
 		}
 		return err
+	case "SQLITE":
+		return p.SQLDB.openSQLite()
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
 	}
@@ -228,7 +269,7 @@ func (p *Database) CreateDatabaseTables() error {
 	switch p.Datatype {
 	case "CSV":
 		return nil
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.CreateDatabaseTables()
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -243,7 +284,7 @@ func (p *Database) Init() error {
 	case "CSV":
 		p.MSMap = make(map[string]MetricSourceMap, 3)
 		return p.CSVDB.CSVInit()
-	case "SQL":
+	case "SQL", "SQLITE":
 		p.MSMap = make(map[string]MetricSourceMap, 3)
 		p.SQLDB.ParentDB = p
 		return p.SQLDB.SQLInit()
@@ -259,7 +300,7 @@ func (p *Database) Insert(rec *EconometricsRecord) error {
 	switch p.Datatype {
 	case "CSV":
 		return fmt.Errorf("this function is not valid for database type: %s", p.Datatype)
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.Insert(rec)
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -272,7 +313,7 @@ func (p *Database) Update(rec *EconometricsRecord) error {
 	switch p.Datatype {
 	case "CSV":
 		return fmt.Errorf("this function is not valid for database type: %s", p.Datatype)
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.Update(rec)
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -286,7 +327,7 @@ func (p *Database) WriteMetricsSources(locations []MetricsSource) error {
 	switch p.Datatype {
 	case "CSV":
 		return p.CSVDB.WriteMetricsSourcesToCSV(locations)
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.WriteMetricsSourcesToSQL(locations)
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -300,7 +341,7 @@ func (p *Database) LoadMetricSourcesMap() error {
 	switch p.Datatype {
 	case "CSV":
 		return p.CSVDB.LoadMetricSourceMapFromCSV()
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.LoadMetricSourceMapFromSQL()
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
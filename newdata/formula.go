@@ -0,0 +1,543 @@
+package newdata
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Formula is the compiled prediction formula of a CustomPredict metric. The
+// source has the form:
+//
+//	action [; probability]
+//
+// action is an expression that evaluates to one of "buy", "sell", "hold" or
+// "abstain". probability is a numeric expression, it is clamped to [0,1]. If
+// it is omitted the probability is 1. For example:
+//
+//	if(abs(Val2-Val1) < StdDevVariationFactor*sqrt(StdDevSquared), "hold",
+//	   if(Val2 > Val1, "sell", "buy")); min(1, abs(Val2-Val1)/Mean)
+//
+// Expressions are built from numbers, the variables in FormulaVars, the
+// operators + - * / < <= > >= == != && || ! and parentheses, and the functions
+// abs(x), sqrt(x), min(x,y), max(x,y) and if(condition,a,b). A formula has no
+// loops and no side effects, it always terminates.
+type Formula struct {
+	Source string // the formula as written in the misubclasses table
+	action formulaNode
+	prob   *formulaNode // nil means a probability of 1
+}
+
+// FormulaVars are the values a Formula can use. For a metric with LocaleNone
+// Val1, Val2, Mean and StdDevSquared are the metric's values. For metrics with
+// two locales Val1 and Val2 are the C1/C2 ratios, and C1... and C2... are the
+// values for each locale. Mean and StdDevSquared are those at T2.
+type FormulaVars struct {
+	Val1, Val2, Mean, StdDevSquared         float64
+	C1Val1, C1Val2, C1Mean, C1StdDevSquared float64
+	C2Val1, C2Val2, C2Mean, C2StdDevSquared float64
+	Delta1, Delta2                          float64 // the influencer's Delta1 and Delta2
+	StdDevVariationFactor                   float64 // from the config file
+}
+
+// formulaVarsNone are the variables available to metrics with LocaleNone,
+// formulaVarsLocale those available to metrics with two locales
+var (
+	formulaVarsNone   = []string{"Val1", "Val2", "Mean", "StdDevSquared"}
+	formulaVarsLocale = []string{"Val1", "Val2", "C1Val1", "C1Val2", "C1Mean", "C1StdDevSquared", "C2Val1", "C2Val2", "C2Mean", "C2StdDevSquared"}
+	formulaVarsAll    = []string{"Delta1", "Delta2", "StdDevVariationFactor"}
+)
+
+// formulaActions are the values of an action expression
+var formulaActions = []string{"buy", "sell", "hold", "abstain"}
+
+// the types of a formula expression
+const (
+	fNum = iota
+	fBool
+	fAction
+)
+
+var formulaTypeNames = []string{"number", "condition", "action"}
+
+// formulaNode is a compiled expression. Only the function for its type is set.
+type formulaNode struct {
+	typ int
+	num func(*FormulaVars) float64
+	b   func(*FormulaVars) bool
+	act func(*FormulaVars) string
+}
+
+// CompileFormula parses and type checks a prediction formula for a metric
+// with the supplied LocaleType.
+// --------------------------------------------------------------------------------
+func CompileFormula(src string, localeType int) (*Formula, error) {
+	p := formulaParser{src: src, vars: map[string]bool{}}
+	for _, v := range formulaVarsAll {
+		p.vars[v] = true
+	}
+	locVars := formulaVarsLocale
+	if localeType == LocaleNone {
+		locVars = formulaVarsNone
+	}
+	for _, v := range locVars {
+		p.vars[v] = true
+	}
+	if err := p.lex(); err != nil {
+		return nil, err
+	}
+
+	f := Formula{Source: src}
+	n, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	if n.typ != fAction {
+		return nil, p.errorf(0, "the formula must evaluate to an action, found a %s", formulaTypeNames[n.typ])
+	}
+	f.action = n
+	if t := p.peek(); t.isOp(";") {
+		p.next()
+		n, err = p.expr()
+		if err != nil {
+			return nil, err
+		}
+		if n.typ != fNum {
+			return nil, p.errorf(0, "the probability must be a number, found a %s", formulaTypeNames[n.typ])
+		}
+		f.prob = &n
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %q", t.s)
+	}
+	return &f, nil
+}
+
+// Eval evaluates the formula. If the probability is not a number the action
+// is "abstain".
+// --------------------------------------------------------------------------------
+func (f *Formula) Eval(v *FormulaVars) (string, float64) {
+	action := f.action.act(v)
+	prob := float64(1)
+	if f.prob != nil {
+		prob = f.prob.num(v)
+	}
+	if math.IsNaN(prob) {
+		return "abstain", 0
+	}
+	return action, math.Max(0, math.Min(1, prob))
+}
+
+// formulaVar returns the function that reads the named variable
+func formulaVar(name string) func(*FormulaVars) float64 {
+	switch name {
+	case "Val1":
+		return func(v *FormulaVars) float64 { return v.Val1 }
+	case "Val2":
+		return func(v *FormulaVars) float64 { return v.Val2 }
+	case "Mean":
+		return func(v *FormulaVars) float64 { return v.Mean }
+	case "StdDevSquared":
+		return func(v *FormulaVars) float64 { return v.StdDevSquared }
+	case "C1Val1":
+		return func(v *FormulaVars) float64 { return v.C1Val1 }
+	case "C1Val2":
+		return func(v *FormulaVars) float64 { return v.C1Val2 }
+	case "C1Mean":
+		return func(v *FormulaVars) float64 { return v.C1Mean }
+	case "C1StdDevSquared":
+		return func(v *FormulaVars) float64 { return v.C1StdDevSquared }
+	case "C2Val1":
+		return func(v *FormulaVars) float64 { return v.C2Val1 }
+	case "C2Val2":
+		return func(v *FormulaVars) float64 { return v.C2Val2 }
+	case "C2Mean":
+		return func(v *FormulaVars) float64 { return v.C2Mean }
+	case "C2StdDevSquared":
+		return func(v *FormulaVars) float64 { return v.C2StdDevSquared }
+	case "Delta1":
+		return func(v *FormulaVars) float64 { return v.Delta1 }
+	case "Delta2":
+		return func(v *FormulaVars) float64 { return v.Delta2 }
+	case "StdDevVariationFactor":
+		return func(v *FormulaVars) float64 { return v.StdDevVariationFactor }
+	}
+	return nil
+}
+
+//-------------------------------------------------------------------------
+// The parser. It is a plain recursive descent parser, the grammar is:
+//
+//	expr    := and { "||" and }
+//	and     := cmp { "&&" cmp }
+//	cmp     := sum [ ("<" | "<=" | ">" | ">=" | "==" | "!=") sum ]
+//	sum     := product { ("+" | "-") product }
+//	product := unary { ("*" | "/") unary }
+//	unary   := ("-" | "!") unary | primary
+//	primary := number | string | name | name "(" expr { "," expr } ")" | "(" expr ")"
+//-------------------------------------------------------------------------
+
+const (
+	tokEOF = iota
+	tokNum
+	tokString
+	tokName
+	tokOp
+)
+
+type formulaToken struct {
+	kind int
+	s    string
+	num  float64
+	pos  int // byte offset in the source, used in errors
+}
+
+type formulaParser struct {
+	src  string
+	toks []formulaToken
+	i    int
+	vars map[string]bool // the variables that can be used
+}
+
+// isOp returns true if t is the operator or punctuation op. A string
+// literal with the same text is not.
+func (t formulaToken) isOp(op string) bool {
+	return t.kind == tokOp && t.s == op
+}
+
+func (p *formulaParser) errorf(pos int, format string, a ...interface{}) error {
+	return fmt.Errorf("formula %q, position %d: %s", p.src, pos+1, fmt.Sprintf(format, a...))
+}
+
+func (p *formulaParser) peek() formulaToken { return p.toks[p.i] }
+
+func (p *formulaParser) next() formulaToken {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+// lex splits the source into tokens
+func (p *formulaParser) lex() error {
+	s := p.src
+	for i := 0; i < len(s); {
+		c := rune(s[i])
+		switch {
+		case unicode.IsSpace(c):
+			i++
+		case unicode.IsDigit(c) || c == '.':
+			j := i
+			for j < len(s) && (unicode.IsDigit(rune(s[j])) || s[j] == '.' || s[j] == 'e' || s[j] == 'E' ||
+				((s[j] == '-' || s[j] == '+') && (s[j-1] == 'e' || s[j-1] == 'E'))) {
+				j++
+			}
+			x, err := strconv.ParseFloat(s[i:j], 64)
+			if err != nil {
+				return p.errorf(i, "bad number %q", s[i:j])
+			}
+			p.toks = append(p.toks, formulaToken{kind: tokNum, s: s[i:j], num: x, pos: i})
+			i = j
+		case unicode.IsLetter(c) || c == '_':
+			j := i
+			for j < len(s) && (unicode.IsLetter(rune(s[j])) || unicode.IsDigit(rune(s[j])) || s[j] == '_') {
+				j++
+			}
+			p.toks = append(p.toks, formulaToken{kind: tokName, s: s[i:j], pos: i})
+			i = j
+		case c == '"':
+			j := strings.IndexByte(s[i+1:], '"')
+			if j < 0 {
+				return p.errorf(i, "unterminated string")
+			}
+			p.toks = append(p.toks, formulaToken{kind: tokString, s: s[i+1 : i+1+j], pos: i})
+			i += j + 2
+		default:
+			op := string(c)
+			if i+1 < len(s) {
+				switch s[i : i+2] {
+				case "<=", ">=", "==", "!=", "&&", "||":
+					op = s[i : i+2]
+				}
+			}
+			if !strings.Contains("+-*/<>!(),;", op) && len(op) == 1 {
+				return p.errorf(i, "unexpected character %q", op)
+			}
+			p.toks = append(p.toks, formulaToken{kind: tokOp, s: op, pos: i})
+			i += len(op)
+		}
+	}
+	p.toks = append(p.toks, formulaToken{kind: tokEOF, s: "end of formula", pos: len(s)})
+	return nil
+}
+
+// binary parses a left associative sequence of operands separated by any of
+// ops. combine type checks and builds the node for one operator.
+func (p *formulaParser) binary(operand func() (formulaNode, error), ops []string, combine func(op string, pos int, a, b formulaNode) (formulaNode, error)) (formulaNode, error) {
+	a, err := operand()
+	if err != nil {
+		return a, err
+	}
+	for {
+		t := p.peek()
+		found := false
+		for _, op := range ops {
+			found = found || t.isOp(op)
+		}
+		if !found {
+			return a, nil
+		}
+		p.next()
+		b, err := operand()
+		if err != nil {
+			return b, err
+		}
+		if a, err = combine(t.s, t.pos, a, b); err != nil {
+			return a, err
+		}
+	}
+}
+
+func (p *formulaParser) expr() (formulaNode, error) {
+	return p.binary(p.and, []string{"||"}, p.logical)
+}
+
+func (p *formulaParser) and() (formulaNode, error) {
+	return p.binary(p.cmp, []string{"&&"}, p.logical)
+}
+
+func (p *formulaParser) logical(op string, pos int, a, b formulaNode) (formulaNode, error) {
+	if a.typ != fBool || b.typ != fBool {
+		return a, p.errorf(pos, "%s needs conditions on both sides", op)
+	}
+	fa, fb := a.b, b.b
+	if op == "||" {
+		return formulaNode{typ: fBool, b: func(v *FormulaVars) bool { return fa(v) || fb(v) }}, nil
+	}
+	return formulaNode{typ: fBool, b: func(v *FormulaVars) bool { return fa(v) && fb(v) }}, nil
+}
+
+func (p *formulaParser) cmp() (formulaNode, error) {
+	a, err := p.sum()
+	if err != nil {
+		return a, err
+	}
+	t := p.peek()
+	if t.kind != tokOp {
+		return a, nil
+	}
+	switch t.s {
+	case "<", "<=", ">", ">=", "==", "!=":
+	default:
+		return a, nil
+	}
+	p.next()
+	b, err := p.sum()
+	if err != nil {
+		return b, err
+	}
+	if a.typ != fNum || b.typ != fNum {
+		return a, p.errorf(t.pos, "%s needs numbers on both sides", t.s)
+	}
+	fa, fb := a.num, b.num
+	var f func(x, y float64) bool
+	switch t.s {
+	case "<":
+		f = func(x, y float64) bool { return x < y }
+	case "<=":
+		f = func(x, y float64) bool { return x <= y }
+	case ">":
+		f = func(x, y float64) bool { return x > y }
+	case ">=":
+		f = func(x, y float64) bool { return x >= y }
+	case "==":
+		f = func(x, y float64) bool { return x == y }
+	case "!=":
+		f = func(x, y float64) bool { return x != y }
+	}
+	return formulaNode{typ: fBool, b: func(v *FormulaVars) bool { return f(fa(v), fb(v)) }}, nil
+}
+
+func (p *formulaParser) sum() (formulaNode, error) {
+	return p.binary(p.product, []string{"+", "-"}, p.arithmetic)
+}
+
+func (p *formulaParser) product() (formulaNode, error) {
+	return p.binary(p.unary, []string{"*", "/"}, p.arithmetic)
+}
+
+func (p *formulaParser) arithmetic(op string, pos int, a, b formulaNode) (formulaNode, error) {
+	if a.typ != fNum || b.typ != fNum {
+		return a, p.errorf(pos, "%s needs numbers on both sides", op)
+	}
+	fa, fb := a.num, b.num
+	var f func(*FormulaVars) float64
+	switch op {
+	case "+":
+		f = func(v *FormulaVars) float64 { return fa(v) + fb(v) }
+	case "-":
+		f = func(v *FormulaVars) float64 { return fa(v) - fb(v) }
+	case "*":
+		f = func(v *FormulaVars) float64 { return fa(v) * fb(v) }
+	case "/":
+		f = func(v *FormulaVars) float64 { return fa(v) / fb(v) }
+	}
+	return formulaNode{typ: fNum, num: f}, nil
+}
+
+func (p *formulaParser) unary() (formulaNode, error) {
+	t := p.peek()
+	if t.isOp("-") || t.isOp("!") {
+		p.next()
+		a, err := p.unary()
+		if err != nil {
+			return a, err
+		}
+		if t.s == "-" {
+			if a.typ != fNum {
+				return a, p.errorf(t.pos, "- needs a number")
+			}
+			fa := a.num
+			return formulaNode{typ: fNum, num: func(v *FormulaVars) float64 { return -fa(v) }}, nil
+		}
+		if a.typ != fBool {
+			return a, p.errorf(t.pos, "! needs a condition")
+		}
+		fa := a.b
+		return formulaNode{typ: fBool, b: func(v *FormulaVars) bool { return !fa(v) }}, nil
+	}
+	return p.primary()
+}
+
+func (p *formulaParser) primary() (formulaNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNum:
+		x := t.num
+		return formulaNode{typ: fNum, num: func(*FormulaVars) float64 { return x }}, nil
+	case tokString:
+		for _, a := range formulaActions {
+			if a == t.s {
+				s := t.s
+				return formulaNode{typ: fAction, act: func(*FormulaVars) string { return s }}, nil
+			}
+		}
+		return formulaNode{}, p.errorf(t.pos, "unknown action %q, use one of %s", t.s, strings.Join(formulaActions, ", "))
+	case tokName:
+		if p.peek().isOp("(") {
+			return p.call(t)
+		}
+		if !p.vars[t.s] {
+			if formulaVar(t.s) != nil {
+				return formulaNode{}, p.errorf(t.pos, "%s cannot be used with this metric's LocaleType", t.s)
+			}
+			return formulaNode{}, p.errorf(t.pos, "unknown variable %s", t.s)
+		}
+		return formulaNode{typ: fNum, num: formulaVar(t.s)}, nil
+	case tokOp:
+		if t.isOp("(") {
+			n, err := p.expr()
+			if err != nil {
+				return n, err
+			}
+			if c := p.next(); !c.isOp(")") {
+				return n, p.errorf(c.pos, "expected ), found %q", c.s)
+			}
+			return n, nil
+		}
+	}
+	return formulaNode{}, p.errorf(t.pos, "unexpected %q", t.s)
+}
+
+// call parses the arguments of a function call and type checks them
+func (p *formulaParser) call(name formulaToken) (formulaNode, error) {
+	p.next() // the (
+	var args []formulaNode
+	for {
+		a, err := p.expr()
+		if err != nil {
+			return a, err
+		}
+		args = append(args, a)
+		t := p.next()
+		if t.isOp(")") {
+			break
+		}
+		if !t.isOp(",") {
+			return a, p.errorf(t.pos, "expected , or ), found %q", t.s)
+		}
+	}
+
+	nargs := map[string]int{"abs": 1, "sqrt": 1, "min": 2, "max": 2, "if": 3}
+	n, ok := nargs[name.s]
+	if !ok {
+		return formulaNode{}, p.errorf(name.pos, "unknown function %s", name.s)
+	}
+	if len(args) != n {
+		return formulaNode{}, p.errorf(name.pos, "%s takes %d arguments, found %d", name.s, n, len(args))
+	}
+	if name.s == "if" {
+		return p.ifCall(name, args)
+	}
+	for _, a := range args {
+		if a.typ != fNum {
+			return formulaNode{}, p.errorf(name.pos, "the arguments of %s must be numbers", name.s)
+		}
+	}
+	var f func(*FormulaVars) float64
+	a0 := args[0].num
+	switch name.s {
+	case "abs":
+		f = func(v *FormulaVars) float64 { return math.Abs(a0(v)) }
+	case "sqrt":
+		f = func(v *FormulaVars) float64 { return math.Sqrt(a0(v)) }
+	case "min":
+		a1 := args[1].num
+		f = func(v *FormulaVars) float64 { return math.Min(a0(v), a1(v)) }
+	case "max":
+		a1 := args[1].num
+		f = func(v *FormulaVars) float64 { return math.Max(a0(v), a1(v)) }
+	}
+	return formulaNode{typ: fNum, num: f}, nil
+}
+
+// ifCall builds if(condition,a,b). a and b must have the same type.
+func (p *formulaParser) ifCall(name formulaToken, args []formulaNode) (formulaNode, error) {
+	c, a, b := args[0], args[1], args[2]
+	if c.typ != fBool {
+		return formulaNode{}, p.errorf(name.pos, "the first argument of if must be a condition")
+	}
+	if a.typ != b.typ {
+		return formulaNode{}, p.errorf(name.pos, "the branches of if must have the same type, found a %s and a %s", formulaTypeNames[a.typ], formulaTypeNames[b.typ])
+	}
+	fc := c.b
+	switch a.typ {
+	case fNum:
+		fa, fb := a.num, b.num
+		return formulaNode{typ: fNum, num: func(v *FormulaVars) float64 {
+			if fc(v) {
+				return fa(v)
+			}
+			return fb(v)
+		}}, nil
+	case fBool:
+		fa, fb := a.b, b.b
+		return formulaNode{typ: fBool, b: func(v *FormulaVars) bool {
+			if fc(v) {
+				return fa(v)
+			}
+			return fb(v)
+		}}, nil
+	default:
+		fa, fb := a.act, b.act
+		return formulaNode{typ: fAction, act: func(v *FormulaVars) string {
+			if fc(v) {
+				return fa(v)
+			}
+			return fb(v)
+		}}, nil
+	}
+}
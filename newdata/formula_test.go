@@ -0,0 +1,159 @@
+package newdata
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stmansour/psim/util"
+)
+
+func TestFormulaEval(t *testing.T) {
+	v := FormulaVars{Val1: 10, Val2: 12, Mean: 11, StdDevSquared: 4, Delta1: -30, Delta2: -5, StdDevVariationFactor: 0.5}
+	cases := []struct {
+		src    string
+		action string
+		prob   float64
+	}{
+		{`"buy"`, "buy", 1},
+		{`if(Val2 > Val1, "sell", "buy")`, "sell", 1},
+		{`if(abs(Val2-Val1) < StdDevVariationFactor*sqrt(StdDevSquared), "hold", "buy"); 0.25`, "buy", 0.25},
+		{`if(Val2 - Val1 > 1 && !(Mean < 0) || Val1 == 0, "hold", "abstain"); (Val2-Val1)/Mean*10`, "hold", 1},
+		{`if(-Val1 + 2*3 >= -4 && Delta2 - Delta1 != 25, "buy", if(Val1 <= 1e1, "sell", "hold")); max(min(0.4, 1), 0.1)`, "sell", 0.4},
+		{`"buy"; -1`, "buy", 0},
+		{`"buy"; 0/0`, "abstain", 0},
+		{`if(Val1 > 5, "buy", "sell"); if(Val1 > 5, .5, 0.1)`, "buy", 0.5},
+	}
+	for _, c := range cases {
+		f, err := CompileFormula(c.src, LocaleNone)
+		if err != nil {
+			t.Errorf("%s: CompileFormula returned error: %s", c.src, err)
+			continue
+		}
+		if action, prob := f.Eval(&v); action != c.action || prob != c.prob {
+			t.Errorf("%s: expected %s, %f got %s, %f", c.src, c.action, c.prob, action, prob)
+		}
+	}
+
+	f, err := CompileFormula(`if(C1Val2/C1Val1 > C2Val2/C2Val1, "sell", "buy"); min(1, abs(Val2-Val1)/Val1)`, LocaleC1C2)
+	if err != nil {
+		t.Fatalf("CompileFormula returned error: %s", err)
+	}
+	v = FormulaVars{C1Val1: 1, C1Val2: 2, C2Val1: 1, C2Val2: 1, Val1: 1, Val2: 2}
+	if action, prob := f.Eval(&v); action != "sell" || prob != 1 {
+		t.Errorf("expected sell, 1 got %s, %f", action, prob)
+	}
+}
+
+func TestFormulaErrors(t *testing.T) {
+	cases := []struct {
+		src        string
+		localeType int
+		err        string
+	}{
+		{`Val1`, LocaleNone, "must evaluate to an action"},
+		{`"buy"; Val1 > 0`, LocaleNone, "probability must be a number"},
+		{`"purchase"`, LocaleNone, "position 1: unknown action"},
+		{`if(Val1 > Val2, "buy", 1)`, LocaleNone, "same type"},
+		{`if(Val1, "buy", "sell")`, LocaleNone, "must be a condition"},
+		{`if(Foo > 0, "buy", "sell")`, LocaleNone, "position 4: unknown variable Foo"},
+		{`if(C1Val1 > 0, "buy", "sell")`, LocaleNone, "C1Val1 cannot be used"},
+		{`if(Mean > 0, "buy", "sell")`, LocaleC1C2, "Mean cannot be used"},
+		{`if(log(Val1) > 0, "buy", "sell")`, LocaleNone, "unknown function log"},
+		{`if(min(Val1) > 0, "buy", "sell")`, LocaleNone, "min takes 2 arguments"},
+		{`if(Val1 > 0, "buy", "sell") "hold"`, LocaleNone, "position 29: unexpected \"hold\""},
+		{`if(Val1 > 0, "buy", "sell"`, LocaleNone, "expected , or )"},
+		{`if(Val1 # 0, "buy", "sell")`, LocaleNone, "position 9: unexpected character"},
+		{`if(Val1 > 0 + (Val2 > 1), "buy", "sell")`, LocaleNone, "+ needs numbers"},
+		{`"buy`, LocaleNone, "unterminated string"},
+		{`"buy"; 1.2.3`, LocaleNone, "bad number"},
+		{`if(Val1 "<" 0, "buy", "sell")`, LocaleNone, "expected , or ), found \"<\""}, // a string is not an operator
+		{`if(Val1 > 0, "buy", "sell" ")"`, LocaleNone, "expected , or ), found \")\""},
+		{`("buy" ")"`, LocaleNone, "expected ), found \")\""},
+		{`abs "(" Val1)`, LocaleNone, "unknown variable abs"},
+	}
+	for _, c := range cases {
+		_, err := CompileFormula(c.src, c.localeType)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: expected an error containing %q, got %v", c.src, c.err, err)
+		}
+	}
+}
+
+// TestFormulaCSVLine checks that a bad formula in misubclasses.csv is reported
+// with its line number, and that good formulas are compiled when loaded.
+func TestFormulaCSVLine(t *testing.T) {
+	dir := t.TempDir()
+	fname := filepath.Join(dir, "misubclasses.csv")
+	header := "MID,Name,Metric,BlocType,LocaleType,Predictor,Subclass,MinDelta1,MaxDelta1,MinDelta2,MaxDelta2,FitnessW1,FitnessW2,MetricType,Formula\n"
+	good := "1,Gold,Gold,0,LocaleNone,CustomPredict,LSMInfluencer,-60,-10,-9,-1,0.5,0.5,1,\"if(Val2 > Val1, \"\"sell\"\", \"\"buy\"\")\"\n"
+	bad := "2,Discount Rate,DR,0,LocaleC1C2,CustomPredict,LSMInfluencer,-60,-10,-9,-1,0.5,0.5,1,\"if(Val2 > Mean, \"\"sell\"\", \"\"buy\"\")\"\n"
+
+	load := func(s string) (*MetricInfluencerManager, error) {
+		if err := os.WriteFile(fname, []byte(s), 0644); err != nil {
+			t.Fatalf("could not write %s: %s", fname, err)
+		}
+		db, err := NewDatabase("CSV", util.CreateTestingCFG(), nil)
+		if err != nil {
+			t.Fatalf("NewDatabase returned error: %s", err)
+		}
+		db.SetCSVFilename(filepath.Join(dir, "platodb.csv"))
+		m := NewInfluencerManager()
+		return m, m.Init(db)
+	}
+
+	m, err := load(header + good)
+	if err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	if mi := m.MInfluencerSubclasses["Gold"]; mi.Expr == nil || mi.Formula != `if(Val2 > Val1, "sell", "buy")` {
+		t.Errorf("expected a compiled formula, got %q", mi.Formula)
+	}
+	if _, err = load(header + good + bad); err == nil || !strings.Contains(err.Error(), "line 3") || !strings.Contains(err.Error(), "Mean cannot be used") {
+		t.Errorf("expected an error on line 3, got %v", err)
+	}
+	if _, err = load(header + strings.Replace(good, "CustomPredict", "SingleValGT", 1)); err == nil {
+		t.Errorf("expected an error for a formula with SingleValGT")
+	}
+	if _, err = load(header + strings.Replace(good, "\"if(Val2 > Val1, \"\"sell\"\", \"\"buy\"\")\"", "", 1)); err == nil {
+		t.Errorf("expected an error for CustomPredict without a formula")
+	}
+}
+
+// TestSQLiteFormula stores a formula in MISubclasses and reloads it
+func TestSQLiteFormula(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	mi := MInfluencerSubclass{
+		Name:       "Gold",
+		Metric:     "Gold",
+		Subclass:   "LSMInfluencer",
+		LocaleType: LocaleNone,
+		Predictor:  CustomPredict,
+		MinDelta1:  -30,
+		MaxDelta1:  -2,
+		MinDelta2:  -1,
+		MaxDelta2:  0,
+		FitnessW1:  0.5,
+		FitnessW2:  0.5,
+		MetricType: 1,
+		Formula:    `if(Val2 > Val1, "sell", "buy"); 0.75`,
+	}
+	if err := db.InsertMInfluencer(&mi); err != nil {
+		t.Fatalf("InsertMInfluencer returned error: %s", err)
+	}
+	db.Mim.ParentDB = db
+	if err := db.Mim.LoadMInfluencerSubclasses(); err != nil {
+		t.Fatalf("LoadMInfluencerSubclasses returned error: %s", err)
+	}
+	got := db.Mim.MInfluencerSubclasses["Gold"]
+	if got.Formula != mi.Formula || got.Expr == nil {
+		t.Fatalf("expected the formula %q to be loaded and compiled, got %q", mi.Formula, got.Formula)
+	}
+	if action, prob := got.Expr.Eval(&FormulaVars{Val1: 2, Val2: 1}); action != "buy" || prob != 0.75 {
+		t.Errorf("expected buy, 0.75 got %s, %f", action, prob)
+	}
+	if db.Mim.MInfluencerSubclasses["DR"].Formula != "" {
+		t.Errorf("expected no formula for DR")
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
@@ -63,20 +64,29 @@ var PredictoryStringList = []string{
 
 // MInfluencerSubclass is the struct that defines a metric-based influencer
 type MInfluencerSubclass struct {
-	MID        int     // Metric ID in the case of SQL db
-	Name       string  // name of this type of influencer, if blank in the database it will be set to the Metric
-	Metric     string  // data type of subclass - THIS IS THE TABLE NAME
-	BlocType   int     // bloc type, only type LocaleBloc reads values from Blocs
-	LocaleType int     // how to handle locales
-	MetricType int     // 1 = econometric, 2 = linguistic
-	Predictor  int     // which predictor to use
-	Subclass   string  // What subclass is the container for this metric-influencer
-	MinDelta1  int     // furthest back from t3 that t1 can be
-	MaxDelta1  int     // closest to t3 that t1 can be
-	MinDelta2  int     // furthest back from t3 that t2 can be
-	MaxDelta2  int     // closest to t3 that t2 can be
-	FitnessW1  float64 // weight for correctness
-	FitnessW2  float64 // weight for activity
+	MID        int      // Metric ID in the case of SQL db
+	Name       string   // name of this type of influencer, if blank in the database it will be set to the Metric
+	Metric     string   // data type of subclass - THIS IS THE TABLE NAME
+	BlocType   int      // bloc type, only type LocaleBloc reads values from Blocs
+	LocaleType int      // how to handle locales
+	MetricType int      // 1 = econometric, 2 = linguistic
+	Predictor  int      // which predictor to use
+	Subclass   string   // What subclass is the container for this metric-influencer
+	MinDelta1  int      // furthest back from t3 that t1 can be
+	MaxDelta1  int      // closest to t3 that t1 can be
+	MinDelta2  int      // furthest back from t3 that t2 can be
+	MaxDelta2  int      // closest to t3 that t2 can be
+	FitnessW1  float64  // weight for correctness
+	FitnessW2  float64  // weight for activity
+	Formula    string   // CustomPredict only: the prediction formula, see Formula
+	Expr       *Formula // the compiled Formula, set when the subclasses are loaded
+	// The bounds of the optional hold window genes of an LSMInfluencer. A gene
+	// is evolved only if its maximum is greater than 0, otherwise the value in
+	// the config file is used.
+	MinLookBack  int     // fewest values in the rolling window for Mean and StdDevSquared
+	MaxLookBack  int     // most values in the rolling window, 0 = use cfg.HoldWindowStatsLookBack
+	MinVarFactor float64 // smallest StdDevVariationFactor
+	MaxVarFactor float64 // largest StdDevVariationFactor, 0 = use cfg.StdDevVariationFactor
 	// HoldWindowPos float64 // positive hold area
 	// HoldWindowNeg float64 // negative hold area
 	// Blocs         []string // list of associated countries. If associated with C1 & C2, blocs[0] must be associated with C1, blocs[1] with C2
@@ -88,7 +98,7 @@ type MetricInfluencerManager struct {
 	ParentDB                       *Database                      // the parent database that holds me
 	MInfluencerSubclasses          map[string]MInfluencerSubclass // enables access to MInfluencer records by metric name
 	MInfluencerSubclassMetricNames []string                       // a list of metric names only
-	InfluencerSubclasses           []string                       // subclasses of the Influencer interface, just LSMIntluencer at this time
+	InfluencerSubclasses           []string                       // subclasses of the Influencer interface, LSMInfluencer plus those added by RegisterInfluencerSubclass
 	initialized                    bool                           // prevents reinit
 }
 
@@ -105,19 +115,43 @@ func (m *MetricInfluencerManager) Init(db *Database) error {
 	}
 	m.ParentDB = db
 	m.MInfluencerSubclasses = map[string]MInfluencerSubclass{}
-	m.LoadMInfluencerSubclasses()
+	if err := m.LoadMInfluencerSubclasses(); err != nil {
+		return err
+	}
 	m.InfluencerSubclasses = append(m.InfluencerSubclasses, "LSMInfluencer")
 	m.initialized = true
 	return nil
 }
 
+// RegisterInfluencerSubclass adds an Influencer subclass that is implemented
+// in code along with the metrics it makes predictions from. The metrics are
+// not stored in the MISubclasses table. Registering a subclass that is
+// already known does nothing.
+// --------------------------------------------------------------------------------
+func (m *MetricInfluencerManager) RegisterInfluencerSubclass(subclass string, metrics ...MInfluencerSubclass) {
+	for _, v := range m.InfluencerSubclasses {
+		if v == subclass {
+			return
+		}
+	}
+	m.InfluencerSubclasses = append(m.InfluencerSubclasses, subclass)
+	for _, mi := range metrics {
+		mi.Subclass = subclass
+		if _, ok := m.MInfluencerSubclasses[mi.Metric]; !ok {
+			m.MInfluencerSubclassMetricNames = append(m.MInfluencerSubclassMetricNames, mi.Metric)
+		}
+		m.MInfluencerSubclasses[mi.Metric] = mi
+	}
+	sort.Strings(m.MInfluencerSubclassMetricNames) // same order every run, a seed must reproduce the simulation
+}
+
 // InsertMInfluencer inserts a new metric influencer into the sql table
 // --------------------------------------------------------------------------------
 func (p *Database) InsertMInfluencer(m *MInfluencerSubclass) error {
 	switch p.Datatype {
 	case "CSV":
 		return fmt.Errorf("this operation is net yet supported for CSV databases")
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.InsertMInfluencerSubclass(m)
 	default:
 		return fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -132,6 +166,44 @@ func (p *MInfluencerSubclass) GetName() string {
 	return p.Name
 }
 
+// Compile compiles the prediction formula of a CustomPredict metric. An
+// LSMInfluencer metric that uses CustomPredict must have a formula, other
+// predictors must not.
+// --------------------------------------------------------------------------------
+func (p *MInfluencerSubclass) Compile() error {
+	p.Expr = nil
+	if p.Predictor != CustomPredict {
+		if len(p.Formula) > 0 {
+			return fmt.Errorf("metric %s: a Formula can only be used with the CustomPredict predictor", p.Metric)
+		}
+		return nil
+	}
+	if len(p.Formula) == 0 {
+		if p.Subclass == "LSMInfluencer" {
+			return fmt.Errorf("metric %s: the CustomPredict predictor needs a Formula", p.Metric)
+		}
+		return nil // the subclass makes its own predictions
+	}
+	f, err := CompileFormula(p.Formula, p.LocaleType)
+	if err != nil {
+		return fmt.Errorf("metric %s: %s", p.Metric, err)
+	}
+	p.Expr = f
+	return nil
+}
+
+// CheckHoldWindowBounds checks the bounds of the LookBack and VarFactor genes
+// --------------------------------------------------------------------------------
+func (p *MInfluencerSubclass) CheckHoldWindowBounds() error {
+	if p.MaxLookBack > 0 && (p.MinLookBack < 2 || p.MinLookBack > p.MaxLookBack) {
+		return fmt.Errorf("metric %s: MinLookBack (%d) must be at least 2 and no more than MaxLookBack (%d)", p.Metric, p.MinLookBack, p.MaxLookBack)
+	}
+	if p.MaxVarFactor > 0 && (p.MinVarFactor < 0 || p.MinVarFactor > p.MaxVarFactor) {
+		return fmt.Errorf("metric %s: MinVarFactor (%g) must be in the range 0 to MaxVarFactor (%g)", p.Metric, p.MinVarFactor, p.MaxVarFactor)
+	}
+	return nil
+}
+
 // LoadMInfluencerSubclasses reads the definitions of Metric Influencer subclasses
 // from in a table (or a CSV file) so that we don't have to create a Go
 // file for every one. It loads them into the MSInfluencer
@@ -140,7 +212,7 @@ func (m *MetricInfluencerManager) LoadMInfluencerSubclasses() error {
 	switch m.ParentDB.Datatype {
 	case "CSV":
 		return m.loadMInfluencerSubclassesCSV()
-	case "SQL":
+	case "SQL", "SQLITE":
 		return m.loadMInfluencerSubclassesSQL()
 	default:
 		return fmt.Errorf("unrecognized database type: %s", m.ParentDB.Datatype)
@@ -151,8 +223,17 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesSQL() error {
 	query :=
 		`SELECT MID, Name, Metric, Subclass, LocaleType, Predictor,
         MinDelta1, MaxDelta1, MinDelta2, MaxDelta2,
-		FitnessW1, FitnessW2, /*HoldWindowPos, HoldWindowNeg,*/ MetricType FROM MISubclasses`
-	rows, err := m.ParentDB.SQLDB.DB.Query(query)
+		FitnessW1, FitnessW2, /*HoldWindowPos, HoldWindowNeg,*/ MetricType, %s FROM MISubclasses`
+	missingColumn := func(err error) bool {
+		return err != nil && (strings.Contains(err.Error(), "no such column") || strings.Contains(err.Error(), "Unknown column"))
+	}
+	rows, err := m.ParentDB.SQLDB.DB.Query(fmt.Sprintf(query, "Formula, MinLookBack, MaxLookBack, MinVarFactor, MaxVarFactor"))
+	if missingColumn(err) {
+		rows, err = m.ParentDB.SQLDB.DB.Query(fmt.Sprintf(query, "Formula, 0, 0, 0, 0")) // created before the hold window genes were added
+	}
+	if missingColumn(err) {
+		rows, err = m.ParentDB.SQLDB.DB.Query(fmt.Sprintf(query, "NULL, 0, 0, 0, 0")) // created before formulas were added
+	}
 	if err != nil {
 		return err
 	}
@@ -162,15 +243,17 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesSQL() error {
 
 	for rows.Next() {
 		var mi MInfluencerSubclass
-		var name sql.NullString // Use sql.NullString for nullable strings
+		var name, formula sql.NullString // Use sql.NullString for nullable strings
 		var loc, pred uint
 
 		// Scan each row's columns into the struct
 		if err := rows.Scan(&mi.MID, &name, &mi.Metric, &mi.Subclass, &loc, &pred,
 			&mi.MinDelta1, &mi.MaxDelta1, &mi.MinDelta2, &mi.MaxDelta2,
-			&mi.FitnessW1, &mi.FitnessW2 /*&mi.HoldWindowPos, &mi.HoldWindowNeg,*/, &mi.MetricType); err != nil {
+			&mi.FitnessW1, &mi.FitnessW2 /*&mi.HoldWindowPos, &mi.HoldWindowNeg,*/, &mi.MetricType, &formula,
+			&mi.MinLookBack, &mi.MaxLookBack, &mi.MinVarFactor, &mi.MaxVarFactor); err != nil {
 			return err
 		}
+		mi.Formula = formula.String
 		mi.LocaleType = int(loc)
 		mi.Predictor = int(pred)
 
@@ -180,6 +263,12 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesSQL() error {
 		} else {
 			mi.Name = ""
 		}
+		if err := mi.Compile(); err != nil {
+			return fmt.Errorf("MISubclasses, MID %d: %s", mi.MID, err)
+		}
+		if err := mi.CheckHoldWindowBounds(); err != nil {
+			return fmt.Errorf("MISubclasses, MID %d: %s", mi.MID, err)
+		}
 
 		subclasses[mi.Metric] = mi
 	}
@@ -192,6 +281,7 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesSQL() error {
 	for k := range m.MInfluencerSubclasses {
 		m.MInfluencerSubclassMetricNames = append(m.MInfluencerSubclassMetricNames, k)
 	}
+	sort.Strings(m.MInfluencerSubclassMetricNames) // same order every run, a seed must reproduce the simulation
 
 	return nil
 }
@@ -276,8 +366,32 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesCSV() error {
 			*/
 			case "MetricType":
 				inf.MetricType = m.parseAndCheckInt(record[index], filename, line)
+			case "Formula":
+				inf.Formula = strings.TrimSpace(record[index])
+			case "MinLookBack": // the hold window genes are optional, an empty cell means 0
+				if len(record[index]) > 0 {
+					inf.MinLookBack = m.parseAndCheckInt(record[index], filename, line)
+				}
+			case "MaxLookBack":
+				if len(record[index]) > 0 {
+					inf.MaxLookBack = m.parseAndCheckInt(record[index], filename, line)
+				}
+			case "MinVarFactor":
+				if len(record[index]) > 0 {
+					inf.MinVarFactor = m.parseAndCheckFloat64(record[index], filename, line)
+				}
+			case "MaxVarFactor":
+				if len(record[index]) > 0 {
+					inf.MaxVarFactor = m.parseAndCheckFloat64(record[index], filename, line)
+				}
 			}
 		}
+		if err := inf.Compile(); err != nil {
+			return fmt.Errorf("%s, line %d: %s", filename, line, err)
+		}
+		if err := inf.CheckHoldWindowBounds(); err != nil {
+			return fmt.Errorf("%s, line %d: %s", filename, line, err)
+		}
 		m.MInfluencerSubclasses[inf.Metric] = inf
 	}
 
@@ -287,6 +401,7 @@ func (m *MetricInfluencerManager) loadMInfluencerSubclassesCSV() error {
 	for k := range m.MInfluencerSubclasses {
 		m.MInfluencerSubclassMetricNames = append(m.MInfluencerSubclassMetricNames, k)
 	}
+	sort.Strings(m.MInfluencerSubclassMetricNames) // same order every run, a seed must reproduce the simulation
 
 	return nil
 }
@@ -314,9 +429,13 @@ func (m *MetricInfluencerManager) parseAndCheckFloat64(s, filename string, line
 // InsertMInfluencerSubclass inserts a new MInfluencerSubclass into the database
 func (p *DatabaseSQL) InsertMInfluencerSubclass(m *MInfluencerSubclass) error {
 	query := `
-INSERT INTO MISubclasses (Name, Metric, LocaleType, Predictor, Subclass, MinDelta1, MaxDelta1, MinDelta2, MaxDelta2, FitnessW1, FitnessW2, /*HoldWindowPos, HoldWindowNeg,*/ MetricType) 
-VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, /*?, ?,*/ ?)`
-	_, err := p.DB.Exec(query, m.Name, m.Metric, m.LocaleType, m.Predictor, m.Subclass, m.MinDelta1, m.MaxDelta1, m.MinDelta2, m.MaxDelta2, m.FitnessW1, m.FitnessW2 /*m.HoldWindowPos, m.HoldWindowNeg,*/, m.MetricType)
+INSERT INTO MISubclasses (Name, Metric, LocaleType, Predictor, Subclass, MinDelta1, MaxDelta1, MinDelta2, MaxDelta2, FitnessW1, FitnessW2, /*HoldWindowPos, HoldWindowNeg,*/ MetricType, Formula, MinLookBack, MaxLookBack, MinVarFactor, MaxVarFactor) 
+VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, /*?, ?,*/ ?, ?, ?, ?, ?, ?)`
+	var formula interface{} // NULL unless there is a formula
+	if len(m.Formula) > 0 {
+		formula = m.Formula
+	}
+	_, err := p.DB.Exec(query, m.Name, m.Metric, m.LocaleType, m.Predictor, m.Subclass, m.MinDelta1, m.MaxDelta1, m.MinDelta2, m.MaxDelta2, m.FitnessW1, m.FitnessW2 /*m.HoldWindowPos, m.HoldWindowNeg,*/, m.MetricType, formula, m.MinLookBack, m.MaxLookBack, m.MinVarFactor, m.MaxVarFactor)
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,525 @@
+package newdata
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// MetricHandle identifies a column in an EconometricsSeries. Resolve it once
+// with EconometricsSeries.Handle and use it for every subsequent read; this
+// avoids building the FQMetric string and hashing it for every value.
+type MetricHandle int
+
+// NoMetricHandle is the handle returned for a metric that is not in the series
+const NoMetricHandle = MetricHandle(-1)
+
+// ErrNoRecord is returned by Database.Value when the database has no record
+// at all for the requested date.
+var ErrNoRecord = errors.New("nildata: no record for the requested date")
+
+// ErrNoValue is returned by Database.Value when the record for the requested
+// date exists but has no value for the requested metric.
+var ErrNoValue = errors.New("nildata: no value for the requested metric")
+
+// MetricSeries is a dense, day-indexed column of values for one metric.
+// Index i holds the value for EconometricsSeries.DtStart + i days. Present[i]
+// is false when the database had no value for that day. Prior holds the
+// values the database has before DtStart, oldest first; they seed the rolling
+// statistics of look-back windows other than cfg.HoldWindowStatsLookBack.
+// ------------------------------------------------------------------------------
+type MetricSeries struct {
+	Name          string // fully qualified metric name
+	Values        []float64
+	Mean          []float64
+	StdDevSquared []float64
+	StatsValid    []bool
+	Present       []bool
+	Prior         []float64
+
+	mu      sync.RWMutex
+	windows map[int]*windowStats // rolling statistics by look-back, computed on first use
+}
+
+// maxWindows is the number of look-back windows a MetricSeries keeps. Each
+// one is as large as the series itself. A population can evolve many more
+// look-backs than this, the statistics of the others are computed for the
+// requested day only.
+const maxWindows = 8
+
+// windowStats are the rolling statistics of a MetricSeries computed over a
+// look-back window other than cfg.HoldWindowStatsLookBack. They are indexed
+// like the series values.
+type windowStats struct {
+	Mean          []float64
+	StdDevSquared []float64
+	StatsValid    []bool
+}
+
+// windowStat returns the rolling statistics of the series over the n values
+// up to and including day index i. The first maxWindows look-backs requested
+// are computed for the whole series and kept for later use, any other
+// look-back is computed from the n values before day i. It is safe to call
+// from multiple goroutines.
+// ------------------------------------------------------------------------------
+func (c *MetricSeries) windowStat(n, i int) (mean, stdDevSquared float64, statsValid bool) {
+	c.mu.RLock()
+	w, full := c.windows[n], len(c.windows) >= maxWindows
+	c.mu.RUnlock()
+	if w == nil && !full {
+		w = c.window(n)
+	}
+	if w != nil {
+		return w.Mean[i], w.StdDevSquared[i], w.StatsValid[i]
+	}
+	if !c.Present[i] {
+		return 0, 0, false
+	}
+
+	//----------------------------------------------------------------------
+	// collect the n values that end on day i, newest first
+	//----------------------------------------------------------------------
+	vals := make([]float64, 0, n)
+	for j := i; j >= 0 && len(vals) < n; j-- {
+		if c.Present[j] {
+			vals = append(vals, c.Values[j])
+		}
+	}
+	for j := len(c.Prior) - 1; j >= 0 && len(vals) < n; j-- {
+		vals = append(vals, c.Prior[j])
+	}
+	if len(vals) < n {
+		return 0, 0, false
+	}
+	rs := NewRollingStats(n)
+	for j := len(vals) - 1; j >= 0; j-- {
+		mean, stdDevSquared, statsValid = rs.AddValue(vals[j]) // oldest first, like window
+	}
+	return mean, stdDevSquared, statsValid
+}
+
+// window returns the rolling statistics of the series over the last n values
+// for every day, computing and keeping them if there are fewer than
+// maxWindows look-backs kept already. It returns nil if there are not.
+// ------------------------------------------------------------------------------
+func (c *MetricSeries) window(n int) *windowStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if w := c.windows[n]; w != nil || len(c.windows) >= maxWindows {
+		return w
+	}
+	w := &windowStats{
+		Mean:          make([]float64, len(c.Values)),
+		StdDevSquared: make([]float64, len(c.Values)),
+		StatsValid:    make([]bool, len(c.Values)),
+	}
+	rs := NewRollingStats(n)
+	prior := c.Prior
+	if len(prior) > n {
+		prior = prior[len(prior)-n:]
+	}
+	for _, x := range prior {
+		rs.AddValue(x)
+	}
+	for i := range c.Values {
+		if c.Present[i] {
+			w.Mean[i], w.StdDevSquared[i], w.StatsValid[i] = rs.AddValue(c.Values[i])
+		}
+	}
+	if c.windows == nil {
+		c.windows = map[int]*windowStats{}
+	}
+	c.windows[n] = w
+	return w
+}
+
+// EconometricsSeries is the columnar in-memory form of the database. It holds
+// one MetricSeries per fully qualified metric name (FieldSelector.FQMetric),
+// each covering every day from DtStart through DtStop inclusive. It is what
+// SelectRange returns, what the CSV database keeps in memory, and what the
+// Database cache holds.
+// ------------------------------------------------------------------------------
+type EconometricsSeries struct {
+	DtStart time.Time               // first day in the series
+	DtStop  time.Time               // last day in the series
+	Days    int                     // number of days, DtStop - DtStart + 1
+	Columns []*MetricSeries         // the columns, indexed by MetricHandle
+	Handles map[string]MetricHandle // fully qualified metric name to its column
+	Rows    []bool                  // nil if every day has a record, else Rows[i] is true if the source had a record for day i
+}
+
+// truncateToDay returns dt with the time of day removed, in UTC
+func truncateToDay(dt time.Time) time.Time {
+	return time.Date(dt.Year(), dt.Month(), dt.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+// NewEconometricsSeries returns an empty series covering dtStart through dtStop
+// ------------------------------------------------------------------------------
+func NewEconometricsSeries(dtStart, dtStop time.Time) *EconometricsSeries {
+	s := EconometricsSeries{
+		DtStart: truncateToDay(dtStart),
+		DtStop:  truncateToDay(dtStop),
+		Handles: map[string]MetricHandle{},
+	}
+	s.Days = int(s.DtStop.Sub(s.DtStart).Hours()/24+0.5) + 1
+	if s.Days < 0 {
+		s.Days = 0
+	}
+	return &s
+}
+
+// DayIndex returns the index into the series columns for dt. The bool is false
+// if dt is outside the range of the series.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) DayIndex(dt time.Time) (int, bool) {
+	d := truncateToDay(dt)
+	if d.Before(s.DtStart) || d.After(s.DtStop) {
+		return 0, false
+	}
+	return int(d.Sub(s.DtStart).Hours()/24 + 0.5), true
+}
+
+// Date returns the date of day index i
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) Date(i int) time.Time {
+	return s.DtStart.AddDate(0, 0, i)
+}
+
+// HasRecord returns true if the source database had a record for day index i.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) HasRecord(i int) bool {
+	return s.Rows == nil || s.Rows[i]
+}
+
+// SetRecord marks day dt as having a record in the source database. Once it
+// has been called, days that were never marked have no record.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) SetRecord(dt time.Time) {
+	i, ok := s.DayIndex(dt)
+	if !ok {
+		return
+	}
+	if s.Rows == nil {
+		s.Rows = make([]bool, s.Days)
+	}
+	s.Rows[i] = true
+}
+
+// Handle returns the handle for the fully qualified metric name, or
+// NoMetricHandle if the series has no such column.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) Handle(name string) MetricHandle {
+	if h, ok := s.Handles[name]; ok {
+		return h
+	}
+	return NoMetricHandle
+}
+
+// Column returns the column for the fully qualified metric name, creating an
+// empty one if it does not exist yet.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) Column(name string) *MetricSeries {
+	if h, ok := s.Handles[name]; ok {
+		return s.Columns[h]
+	}
+	c := MetricSeries{
+		Name:          name,
+		Values:        make([]float64, s.Days),
+		Mean:          make([]float64, s.Days),
+		StdDevSquared: make([]float64, s.Days),
+		StatsValid:    make([]bool, s.Days),
+		Present:       make([]bool, s.Days),
+	}
+	s.Handles[name] = MetricHandle(len(s.Columns))
+	s.Columns = append(s.Columns, &c)
+	return &c
+}
+
+// At returns the value of metric h on day index i. The bool is false if there
+// is no value. It does not allocate.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) At(h MetricHandle, i int) (MetricInfo, bool) {
+	c := s.Columns[h]
+	if !c.Present[i] {
+		return MetricInfo{}, false
+	}
+	return MetricInfo{
+		Value:         c.Values[i],
+		Mean:          c.Mean[i],
+		StdDevSquared: c.StdDevSquared[i],
+		StatsValid:    c.StatsValid[i],
+	}, true
+}
+
+// Set stores m for the named metric on day dt. Values outside the range of
+// the series are ignored.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) Set(name string, dt time.Time, m MetricInfo) {
+	i, ok := s.DayIndex(dt)
+	if !ok {
+		return
+	}
+	c := s.Column(name)
+	c.Values[i] = m.Value
+	c.Mean[i] = m.Mean
+	c.StdDevSquared[i] = m.StdDevSquared
+	c.StatsValid[i] = m.StatsValid
+	c.Present[i] = true
+}
+
+// Select answers a Database.Select from the series. The bool is false if
+// the series cannot answer it: dt is out of range, all fields were requested,
+// or one of the requested metrics was never loaded. The caller must then go
+// to the database. If the source had no record for dt, the record returned
+// is nil.
+// ------------------------------------------------------------------------------
+func (s *EconometricsSeries) Select(dt time.Time, fields []FieldSelector) (*EconometricsRecord, bool) {
+	i, ok := s.DayIndex(dt)
+	if !ok || len(fields) == 0 {
+		return nil, false
+	}
+	hs := make([]MetricHandle, len(fields))
+	for j := range fields {
+		if hs[j] = s.Handle(fields[j].FQMetric()); hs[j] == NoMetricHandle {
+			return nil, false
+		}
+	}
+	if !s.HasRecord(i) {
+		return nil, true
+	}
+	rec := EconometricsRecord{
+		Date:   dt,
+		Fields: make(map[string]MetricInfo, len(fields)),
+	}
+	for _, h := range hs {
+		if m, ok := s.At(h, i); ok {
+			rec.Fields[s.Columns[h].Name] = m
+		}
+	}
+	return &rec, true
+}
+
+// MetricRef is a FieldSelector bound to a column of a Database's columnar
+// store. The column handle is resolved on first use and again only if the
+// store changes, so a MetricRef should be kept and reused by its owner. A
+// MetricRef must not be shared between goroutines.
+// ------------------------------------------------------------------------------
+type MetricRef struct {
+	Field  FieldSelector       // the metric this reference reads
+	store  *EconometricsSeries // the store handle was resolved against
+	handle MetricHandle
+}
+
+// NewMetricRef returns an unresolved reference to the metric f
+// ------------------------------------------------------------------------------
+func NewMetricRef(f FieldSelector) MetricRef {
+	return MetricRef{Field: f, handle: NoMetricHandle}
+}
+
+// Columnar returns the in-memory columnar store for this database, or nil if
+// it does not have one. A CSV database is always columnar. SQL databases are
+// columnar after PreloadCache.
+// ----------------------------------------------------------------------------
+func (p *Database) Columnar() *EconometricsSeries {
+	if p.Cache != nil {
+		return p.Cache
+	}
+	if p.Datatype == "CSV" && p.CSVDB != nil {
+		return p.CSVDB.Series
+	}
+	return nil
+}
+
+// Value returns the value of the metric referenced by r on dt. When the
+// columnar store covers dt this does not allocate. Otherwise it falls back
+// to Select.
+//
+// RETURNS
+//
+//	MetricInfo - the value, valid only when error is nil
+//	error      - ErrNoRecord if there is no record for dt, ErrNoValue if the
+//	             record has no value for the metric, any other error from
+//	             the database
+//
+// ----------------------------------------------------------------------------
+func (p *Database) Value(r *MetricRef, dt time.Time) (MetricInfo, error) {
+	if s := p.Columnar(); s != nil {
+		if r.store != s {
+			r.store = s
+			r.handle = s.Handle(r.Field.FQMetric())
+		}
+		if i, ok := s.DayIndex(dt); ok && r.handle != NoMetricHandle {
+			if !s.HasRecord(i) {
+				return MetricInfo{}, ErrNoRecord
+			}
+			m, ok := s.At(r.handle, i)
+			if !ok {
+				if p.Datatype == "CSV" {
+					p.CSVDB.IncrementNildata()
+				}
+				return MetricInfo{}, ErrNoValue
+			}
+			return m, nil
+		}
+	}
+
+	rec, err := p.Select(dt, []FieldSelector{r.Field})
+	if err != nil {
+		return MetricInfo{}, err
+	}
+	if rec == nil {
+		return MetricInfo{}, ErrNoRecord
+	}
+	m, ok := rec.Fields[r.Field.FQMetric()]
+	if !ok {
+		return MetricInfo{}, ErrNoValue
+	}
+	return m, nil
+}
+
+// WindowValue is Value with the rolling Mean and StdDevSquared computed over
+// the last lookBack values of the metric rather than the last
+// cfg.HoldWindowStatsLookBack values. Influencers that evolve their own hold
+// window look-back use it. If lookBack is less than 1 it is the same as Value.
+// ----------------------------------------------------------------------------
+func (p *Database) WindowValue(r *MetricRef, dt time.Time, lookBack int) (MetricInfo, error) {
+	m, err := p.Value(r, dt)
+	if err != nil || lookBack < 1 || (p.cfg != nil && lookBack == p.cfg.HoldWindowStatsLookBack) {
+		return m, err
+	}
+	if s := p.Columnar(); s != nil && r.store == s && r.handle != NoMetricHandle {
+		if i, ok := s.DayIndex(dt); ok {
+			m.Mean, m.StdDevSquared, m.StatsValid = s.Columns[r.handle].windowStat(lookBack, i)
+			return m, nil
+		}
+	}
+
+	switch p.Datatype {
+	case "SQL", "SQLITE":
+		rec, err := p.SQLDB.selectWindow(dt, []FieldSelector{r.Field}, lookBack)
+		if err != nil {
+			return MetricInfo{}, err
+		}
+		w, ok := rec.Fields[r.Field.FQMetric()]
+		if !ok {
+			return MetricInfo{}, ErrNoValue
+		}
+		m.Mean, m.StdDevSquared, m.StatsValid = w.Mean, w.StdDevSquared, w.StatsValid
+	default:
+		m.Mean, m.StdDevSquared, m.StatsValid = 0, 0, false // the CSV store covers every date it has
+	}
+	return m, nil
+}
+
+// AllFieldSelectors returns a FieldSelector for every metric an Influencer
+// may request using the C1 and C2 of the current configuration, plus the
+// C1C2 exchange rate. If the configuration has Pairs, the exchange rate and
+// the metrics of the foreign currency of each pair are requested too. Bloc
+// metrics are also requested for every locale that is a member of a bloc.
+// ------------------------------------------------------------------------------
+func (p *Database) AllFieldSelectors() []FieldSelector {
+	c2s := []string{p.cfg.C2}
+	for _, pair := range p.cfg.Pairs {
+		if c2 := pair[3:]; c2 != p.cfg.C2 {
+			c2s = append(c2s, c2)
+		}
+	}
+	var ss []FieldSelector
+	for _, c2 := range c2s {
+		ss = append(ss, FieldSelector{Metric: "EXClose", Locale: p.cfg.C1, Locale2: c2})
+	}
+	for _, v := range p.Mim.MInfluencerSubclasses {
+		if v.Metric == "EXClose" {
+			continue // Influencers that read the exchange rate use the ones above
+		}
+		switch v.LocaleType {
+		case LocaleC1C2:
+			ss = append(ss, FieldSelector{Metric: v.Metric, Locale: p.cfg.C1})
+			for _, c2 := range c2s {
+				ss = append(ss, FieldSelector{Metric: v.Metric, Locale: c2})
+			}
+		case LocaleBloc:
+			locs := map[string]bool{p.cfg.C1: true}
+			ss = append(ss, FieldSelector{Metric: v.Metric, Locale: p.cfg.C1})
+			for _, c2 := range c2s {
+				ss = append(ss, FieldSelector{Metric: v.Metric, Locale: c2})
+				locs[c2] = true
+			}
+			for _, l := range p.blocLocales() {
+				if !locs[l] {
+					ss = append(ss, FieldSelector{Metric: v.Metric, Locale: l})
+				}
+			}
+		default:
+			ss = append(ss, FieldSelector{Metric: v.Metric})
+		}
+	}
+	return ss
+}
+
+// SelectRange reads the requested fields for every day from dtStart through
+// dtStop and returns them as a dense series. If fields is empty, every metric
+// returned by AllFieldSelectors is read.
+// ----------------------------------------------------------------------------
+func (p *Database) SelectRange(dtStart, dtStop time.Time, fields []FieldSelector) (*EconometricsSeries, error) {
+	if len(fields) == 0 {
+		fields = p.AllFieldSelectors()
+	}
+	switch p.Datatype {
+	case "CSV":
+		return p.CSVDB.SelectRange(dtStart, dtStop, fields)
+	case "SQL", "SQLITE":
+		return p.SQLDB.SelectRange(dtStart, dtStop, fields)
+	default:
+		return nil, fmt.Errorf("unrecognized data source: %s", p.Datatype)
+	}
+}
+
+// PreloadCache reads every metric for dtStart through dtStop into an in-memory
+// cache. Subsequent calls to Select are answered from the cache whenever
+// possible.
+// ----------------------------------------------------------------------------
+func (p *Database) PreloadCache(dtStart, dtStop time.Time) error {
+	s, err := p.SelectRange(dtStart, dtStop, nil)
+	if err != nil {
+		return err
+	}
+	p.Cache = s
+	return nil
+}
+
+// SelectRange returns the requested fields for dtStart through dtStop. The
+// values, including their rolling statistics, are copied from the columnar
+// store built by LoadCsvDB. The values before dtStart are copied to each
+// column's Prior.
+// ----------------------------------------------------------------------------
+func (d *DatabaseCSV) SelectRange(dtStart, dtStop time.Time, fields []FieldSelector) (*EconometricsSeries, error) {
+	s := NewEconometricsSeries(dtStart, dtStop)
+	src := d.Series
+	for j := range fields {
+		c := s.Column(fields[j].FQMetric())
+		h := src.Handle(c.Name)
+		if h == NoMetricHandle {
+			continue
+		}
+		for k := 0; k < src.Days && src.Date(k).Before(s.DtStart); k++ {
+			if m, ok := src.At(h, k); ok {
+				c.Prior = append(c.Prior, m.Value)
+			}
+		}
+		for i := 0; i < s.Days; i++ {
+			if k, ok := src.DayIndex(s.Date(i)); ok {
+				if m, ok := src.At(h, k); ok {
+					s.Set(c.Name, s.Date(i), m)
+				}
+			}
+		}
+	}
+	for i := 0; i < s.Days; i++ {
+		if k, ok := src.DayIndex(s.Date(i)); ok && src.HasRecord(k) {
+			s.SetRecord(s.Date(i))
+		}
+	}
+	return s, nil
+}
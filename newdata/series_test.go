@@ -0,0 +1,59 @@
+package newdata
+
+import (
+	"testing"
+)
+
+// windowTestSeries returns a MetricSeries of days values with a gap every
+// eleventh day and three prior values
+func windowTestSeries(days int) *MetricSeries {
+	c := MetricSeries{
+		Values:  make([]float64, days),
+		Present: make([]bool, days),
+		Prior:   []float64{1, 2, 3},
+	}
+	for i := range c.Values {
+		c.Values[i] = float64(i%7) + 0.5
+		c.Present[i] = i%11 != 5
+	}
+	return &c
+}
+
+// TestWindowCache checks that a MetricSeries keeps at most maxWindows
+// look-backs and that the statistics of the other look-backs, computed for
+// a single day, are the same as those of a kept window
+func TestWindowCache(t *testing.T) {
+	c := windowTestSeries(100)
+	for n := 1; n <= 3*maxWindows; n++ {
+		c.windowStat(n, 50)
+	}
+	if len(c.windows) != maxWindows {
+		t.Fatalf("expected %d windows, got %d", maxWindows, len(c.windows))
+	}
+	for n := maxWindows + 1; n <= 3*maxWindows; n++ {
+		if c.windows[n] != nil {
+			t.Errorf("expected look-back %d not to be kept", n)
+		}
+		kept := windowTestSeries(100).window(n)
+		for i := range c.Values {
+			mean, sdsq, valid := c.windowStat(n, i)
+			if mean != kept.Mean[i] || sdsq != kept.StdDevSquared[i] || valid != kept.StatsValid[i] {
+				t.Errorf("look-back %d, day %d: expected %f %f %t, got %f %f %t", n, i,
+					kept.Mean[i], kept.StdDevSquared[i], kept.StatsValid[i], mean, sdsq, valid)
+			}
+		}
+	}
+}
+
+// BenchmarkWindowStat reads the statistics of a population's worth of
+// look-backs, more than maxWindows, for every day of a series
+func BenchmarkWindowStat(b *testing.B) {
+	c := windowTestSeries(3650)
+	for k := 0; k < b.N; k++ {
+		for n := 5; n < 45; n++ {
+			for i := 0; i < len(c.Values); i += 7 {
+				c.windowStat(n, i)
+			}
+		}
+	}
+}
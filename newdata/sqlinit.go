@@ -1,7 +1,6 @@
 package newdata
 
 import (
-	"database/sql"
 	"fmt"
 	"time"
 )
@@ -15,6 +14,12 @@ func (p *DatabaseSQL) SQLInit() error {
 	if err = p.LoadLocaleCache(); err != nil {
 		return err
 	}
+	if err = p.LoadBlocCache(); err != nil {
+		return err
+	}
+	if err = p.LoadClosedDayCache(); err != nil {
+		return err
+	}
 	p.MetricIDCache = make(map[string]int, 10) // enough to get it started
 	if err = p.GetMinMaxDates(); err != nil {
 		return err
@@ -34,9 +39,7 @@ func (p *DatabaseSQL) GetMinMaxDates() (err error) {
 	queryMin := "SELECT MIN(Date) FROM Metrics_0_2020"
 	queryMax := "SELECT MAX(Date) FROM Metrics_0_2020"
 
-	var dt sql.NullTime
-
-	err = p.DB.QueryRow(queryMin).Scan(&dt)
+	dt, err := p.scanAggregateDate(queryMin)
 	if err != nil {
 		return fmt.Errorf("error getting minimum date: %w", err)
 	}
@@ -47,7 +50,7 @@ func (p *DatabaseSQL) GetMinMaxDates() (err error) {
 		p.DtStart = time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
 	}
 
-	err = p.DB.QueryRow(queryMax).Scan(&dt)
+	dt, err = p.scanAggregateDate(queryMax)
 	if err != nil {
 		return fmt.Errorf("error getting maximum date: %w", err)
 	}
@@ -0,0 +1,256 @@
+package newdata
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/stmansour/psim/util"
+
+	// Register the SQLite driver
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// PLATOSQLITEDB is the default SQLite file used when DBSource is "SQLITE"
+var PLATOSQLITEDB = string("data/plato.db")
+
+// SQLiteDriver is the database/sql driver name used for SQLite databases
+const SQLiteDriver = "sqlite3"
+
+// SetSQLiteFilename sets the SQLite database filename. If it is never set
+// (or set to ""), the default data/plato.db is used.
+// ---------------------------------------------------------------------------------
+func (d *Database) SetSQLiteFilename(f string) {
+	d.SQLDB.DBFname = f
+}
+
+// IsSQLite returns true if this sql database is backed by SQLite rather than MySQL
+func (p *DatabaseSQL) IsSQLite() bool {
+	return p.Driver == SQLiteDriver
+}
+
+// openSQLite opens (creating if necessary) the SQLite database file. It does
+// not create any tables.
+//
+// The file name is resolved in this order:
+//  1. p.DBFname if it has been set
+//  2. data/plato.db in the current directory, if it exists
+//  3. data/plato.db in the directory of the executable, if it exists
+//  4. data/plato.db in the current directory (it will be created)
+//
+// ---------------------------------------------------------------------------------
+func (p *DatabaseSQL) openSQLite() error {
+	var err error
+	fname := p.DBFname
+	if len(fname) == 0 {
+		fname = PLATOSQLITEDB
+		if _, err = os.Stat(fname); os.IsNotExist(err) {
+			dir, err := util.GetExecutableDir()
+			if err == nil {
+				if _, err = os.Stat(filepath.Join(dir, PLATOSQLITEDB)); err == nil {
+					fname = filepath.Join(dir, PLATOSQLITEDB)
+				}
+			}
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(fname), 0755); err != nil {
+		return err
+	}
+	p.DBFname = fname
+
+	//---------------------------------------------------------------------
+	// WAL journaling lets the simulator's worker threads read concurrently
+	// and keeps bulk loads (csvtosql) from fsyncing on every insert.
+	//---------------------------------------------------------------------
+	dsn := fmt.Sprintf("file:%s?_journal=WAL&_sync=NORMAL&_busy_timeout=5000", fname)
+	if p.DB, err = sql.Open(SQLiteDriver, dsn); err != nil {
+		return err
+	}
+	return p.DB.Ping()
+}
+
+// dropSQLiteTables removes all tables from the SQLite database. It is the
+// SQLite equivalent of dropping the MySQL database.
+// ---------------------------------------------------------------------------------
+func (p *DatabaseSQL) dropSQLiteTables() error {
+	rows, err := p.DB.Query("SELECT name FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		return err
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+	for i := 0; i < len(tables); i++ {
+		if _, err = p.DB.Exec("DROP TABLE IF EXISTS " + tables[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// createSQLiteTables creates the same schema as CreateDatabaseTables does for
+// MySQL. The differences are syntactic only: SQLite uses AUTOINCREMENT and
+// separate CREATE INDEX statements.
+// ---------------------------------------------------------------------------------
+func (p *DatabaseSQL) createSQLiteTables() error {
+	cmds := []string{
+		"DROP TABLE IF EXISTS ClosedDays",
+		"DROP TABLE IF EXISTS BlocMembers",
+		"DROP TABLE IF EXISTS Blocs",
+		"DROP TABLE IF EXISTS Locales",
+		`CREATE TABLE Locales (
+			LID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Name VARCHAR(80) NOT NULL,
+			Country VARCHAR(80) NOT NULL,
+			Currency VARCHAR(80) NOT NULL,
+			Description TEXT
+		);`,
+		`CREATE TABLE Blocs (
+			BID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Name VARCHAR(80) NOT NULL,
+			Description TEXT
+		);`,
+		`CREATE TABLE BlocMembers (
+			BID INT NOT NULL,                  -- this bloc...
+			LID INT NOT NULL,                  -- ...includes this locale...
+			Weight DOUBLE NOT NULL,            -- ...with this weight in the weighted aggregate
+			CONSTRAINT fk_BlocMembers_Blocs FOREIGN KEY (BID) REFERENCES Blocs(BID),
+			CONSTRAINT fk_BlocMembers_Locales FOREIGN KEY (LID) REFERENCES Locales(LID)
+		);`,
+		`CREATE TABLE ClosedDays (
+			CDID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Date DATETIME NOT NULL,
+			Pair VARCHAR(12) NOT NULL DEFAULT '',  -- USDJPY, or JPY to close every JPY pair, or '' to close every pair
+			Description TEXT
+		);`,
+		`CREATE TABLE IF NOT EXISTS MISubclasses (
+			MID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Name VARCHAR(128) NOT NULL,
+			Metric VARCHAR(80) NOT NULL,
+			Subclass VARCHAR(80) NOT NULL,
+			LocaleType TINYINT NOT NULL,
+			MetricType TINYINT NOT NULL,  -- 1 = econometric, 2 = linguistic
+			Predictor TINYINT NOT NULL,
+			MinDelta1 INT NOT NULL,
+			MaxDelta1 INT NOT NULL,
+			MinDelta2 INT NOT NULL,
+			MaxDelta2 INT NOT NULL,
+			FitnessW1 DECIMAL(13,6) NOT NULL,
+			FitnessW2 DECIMAL(13,6) NOT NULL,
+			Formula TEXT,                 -- CustomPredict only: the prediction formula
+			MinLookBack INT NOT NULL DEFAULT 0,                -- bounds of the LookBack gene, 0 if it is not evolved
+			MaxLookBack INT NOT NULL DEFAULT 0,
+			MinVarFactor DECIMAL(13,6) NOT NULL DEFAULT 0,     -- bounds of the VarFactor gene, 0 if it is not evolved
+			MaxVarFactor DECIMAL(13,6) NOT NULL DEFAULT 0
+		);`,
+		`CREATE TABLE IF NOT EXISTS MetricsSources (
+			MSID INTEGER PRIMARY KEY AUTOINCREMENT,
+			LastUpdate DATETIME NOT NULL,
+			URL VARCHAR(255) NOT NULL,
+			Name VARCHAR(80) NOT NULL
+		);`,
+		`CREATE TABLE IF NOT EXISTS ExchangeRate (
+			XID INTEGER PRIMARY KEY AUTOINCREMENT,
+			Date DATETIME NOT NULL,
+			LID INT NOT NULL,
+			LID2 INT NOT NULL,
+			MSID INT NOT NULL,
+			EXClose DOUBLE NOT NULL,
+			CONSTRAINT fk_ExchangeRate_Locales1 FOREIGN KEY (LID) REFERENCES Locales(LID),
+			CONSTRAINT fk_ExchangeRate_Locales2 FOREIGN KEY (LID2) REFERENCES Locales(LID),
+			CONSTRAINT fk_ExchangeRate_MetricsSources FOREIGN KEY (MSID) REFERENCES MetricsSources(MSID)
+		);`,
+		"CREATE INDEX IF NOT EXISTS idx_ExchangeRate_Date ON ExchangeRate(Date)",
+		`CREATE TABLE IF NOT EXISTS MetricSourcesMapping (
+			MSID INT NOT NULL,                 -- this metricsSource...
+			MID INT NOT NULL,                  -- ...maps to this metric...
+			MetricName VARCHAR(80) NOT NULL,   -- ...with this name
+			CONSTRAINT fk_MetricSourcesMapping_MetricsSources FOREIGN KEY (MSID) REFERENCES MetricsSources(MSID),
+			CONSTRAINT fk_MetricSourcesMapping_Metrics FOREIGN KEY (MID) REFERENCES MISubclasses(MID)
+		);`,
+	}
+
+	for i := 0; i < len(cmds); i++ {
+		if _, err := p.DB.Exec(cmds[i]); err != nil {
+			return err
+		}
+	}
+
+	for decade := 2000; decade <= 2020; decade += 10 {
+		for shardIndex := 0; shardIndex < GlobalSQLSettings.BucketCount; shardIndex++ {
+			tableName := fmt.Sprintf("Metrics_%d_%d", shardIndex, decade)
+			stmts := []string{
+				fmt.Sprintf(`
+CREATE TABLE IF NOT EXISTS %s (
+    MEID INTEGER PRIMARY KEY AUTOINCREMENT,
+    Date DATETIME NOT NULL,
+	MID INT NOT NULL,  -- which metric
+	LID INT NOT NULL,  -- locale associated with this metric
+	MSID INT,  -- metric source - the provider for this metric
+    MetricValue DOUBLE,
+	CONSTRAINT fk_Metrics_%d_%d_MISubclasses FOREIGN KEY (MID) REFERENCES MISubclasses(MID),
+    CONSTRAINT fk_Metrics_%d_%d_Locales FOREIGN KEY (LID) REFERENCES Locales(LID),
+    CONSTRAINT fk_Metrics_%d_%d_MetricsSources FOREIGN KEY (MSID) REFERENCES MetricsSources(MSID)
+);`, tableName, shardIndex, decade, shardIndex, decade, shardIndex, decade),
+				fmt.Sprintf("CREATE INDEX IF NOT EXISTS idx_%s_Date ON %s(Date)", tableName, tableName),
+			}
+			for _, stmt := range stmts {
+				if _, err := p.DB.Exec(stmt); err != nil {
+					log.Fatalf("Failed to process sharded tables: failed to create table %s: %v", tableName, err)
+				}
+			}
+			fmt.Printf("Table %s created successfully.\n", tableName)
+		}
+	}
+	return nil
+}
+
+// dateValue returns the value to bind for a Date column. MySQL is handed the
+// time.Time directly. SQLite stores dates as text, so we store exactly the
+// "2006-01-02" form that Select uses in its WHERE clauses.
+// ---------------------------------------------------------------------------------
+func (p *DatabaseSQL) dateValue(dt time.Time) interface{} {
+	if p.IsSQLite() {
+		return dt.Format("2006-01-02")
+	}
+	return dt
+}
+
+// scanAggregateDate runs a query that returns a single MIN/MAX(Date) value.
+// SQLite returns aggregates of a DATETIME column as plain text, so it needs
+// to be parsed here rather than scanned into a sql.NullTime.
+// ---------------------------------------------------------------------------------
+func (p *DatabaseSQL) scanAggregateDate(query string) (sql.NullTime, error) {
+	var dt sql.NullTime
+	if !p.IsSQLite() {
+		err := p.DB.QueryRow(query).Scan(&dt)
+		return dt, err
+	}
+	var s sql.NullString
+	if err := p.DB.QueryRow(query).Scan(&s); err != nil {
+		return dt, err
+	}
+	if !s.Valid {
+		return dt, nil
+	}
+	t, err := time.Parse("2006-01-02", s.String)
+	if err != nil {
+		return dt, err
+	}
+	dt.Time = t
+	dt.Valid = true
+	return dt, nil
+}
@@ -0,0 +1,208 @@
+package newdata
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stmansour/psim/util"
+)
+
+// newTestSQLiteDB creates a SQLite database in a temporary directory with the
+// full schema, a few locales, one MISubclass (DR) and one metrics source.
+func newTestSQLiteDB(t *testing.T) *Database {
+	cfg := util.CreateTestingCFG()
+	db, err := NewDatabase("SQLITE", cfg, nil)
+	if err != nil {
+		t.Fatalf("NewDatabase returned error: %s", err)
+	}
+	db.SetSQLiteFilename(filepath.Join(t.TempDir(), "plato.db"))
+	if err = db.Open(); err != nil {
+		t.Fatalf("Open returned error: %s", err)
+	}
+	t.Cleanup(func() { db.SQLDB.DB.Close() })
+	db.SQLDB.ParentDB = db
+	if err = db.CreateDatabaseTables(); err != nil {
+		t.Fatalf("CreateDatabaseTables returned error: %s", err)
+	}
+
+	locales := []Locale{
+		{Name: "NON", Currency: "NON", Country: "No locale association", Description: "No locale association"},
+		{Name: "JPN", Currency: "JPY", Country: "Japan", Description: "Japan, Japanese Yen"},
+		{Name: "USA", Currency: "USD", Country: "United States", Description: "United States of America, US Dollar"},
+	}
+	for i := 0; i < len(locales); i++ {
+		if _, err = db.InsertLocale(&locales[i]); err != nil {
+			t.Fatalf("InsertLocale returned error: %s", err)
+		}
+	}
+	if err = db.SQLDB.LoadLocaleCache(); err != nil {
+		t.Fatalf("LoadLocaleCache returned error: %s", err)
+	}
+
+	mi := MInfluencerSubclass{
+		Name:       "Discount Rate",
+		Metric:     "DR",
+		Subclass:   "LSMInfluencer",
+		LocaleType: LocaleC1C2,
+		Predictor:  C1C2RatioGT,
+		MinDelta1:  -30,
+		MaxDelta1:  -2,
+		MinDelta2:  -1,
+		MaxDelta2:  0,
+		FitnessW1:  0.5,
+		FitnessW2:  0.5,
+		MetricType: 1,
+	}
+	if err = db.InsertMInfluencer(&mi); err != nil {
+		t.Fatalf("InsertMInfluencer returned error: %s", err)
+	}
+	if err = db.WriteMetricsSources([]MetricsSource{{URL: "file://platodb.csv", Name: "CSVFile"}}); err != nil {
+		t.Fatalf("WriteMetricsSources returned error: %s", err)
+	}
+	return db
+}
+
+func TestSQLiteInsertSelect(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	db.Mim.ParentDB = db
+	if err := db.Mim.LoadMInfluencerSubclasses(); err != nil {
+		t.Fatalf("LoadMInfluencerSubclasses returned error: %s", err)
+	}
+
+	dt := time.Date(2022, time.March, 15, 0, 0, 0, 0, time.UTC)
+	rec := EconometricsRecord{
+		Date: dt,
+		Fields: map[string]MetricInfo{
+			"USDDR":         {Value: 1.25},
+			"JPYDR":         {Value: -0.1},
+			"USDJPYEXClose": {Value: 118.75},
+		},
+	}
+	if err := db.Insert(&rec); err != nil {
+		t.Fatalf("Insert returned error: %s", err)
+	}
+	if db.SQLDB.InsertCount != 3 {
+		t.Errorf("expected 3 inserts, got %d", db.SQLDB.InsertCount)
+	}
+
+	//---------------------------------------------------------------
+	// Init reloads everything from the SQLite file, just as the
+	// simulator does.
+	//---------------------------------------------------------------
+	db.Mim = NewInfluencerManager()
+	if err := db.Init(); err != nil {
+		t.Fatalf("Init returned error: %s", err)
+	}
+	if len(db.SQLDB.MetricSrcCache) != 1 {
+		t.Errorf("expected 1 metrics source, got %d", len(db.SQLDB.MetricSrcCache))
+	}
+
+	ss := []FieldSelector{
+		{Metric: "DR", Locale: "USD"},
+		{Metric: "DR", Locale: "JPY"},
+		{Metric: "EXClose", Locale: "USD", Locale2: "JPY"},
+	}
+	got, err := db.Select(dt, ss)
+	if err != nil {
+		t.Fatalf("Select returned error: %s", err)
+	}
+	for k, v := range rec.Fields {
+		if got.Fields[k].Value != v.Value {
+			t.Errorf("%s: expected %f, got %f", k, v.Value, got.Fields[k].Value)
+		}
+	}
+
+	//---------------------------------------------------------------
+	// Nothing was written for the following day
+	//---------------------------------------------------------------
+	got, err = db.Select(dt.AddDate(0, 0, 1), ss)
+	if err != nil {
+		t.Fatalf("Select returned error: %s", err)
+	}
+	if len(got.Fields) != 0 {
+		t.Errorf("expected no fields, got %d", len(got.Fields))
+	}
+
+	//---------------------------------------------------------------
+	// Update and reread
+	//---------------------------------------------------------------
+	upd := EconometricsRecord{Date: dt, Fields: map[string]MetricInfo{}}
+	v, err := db.Select(dt, ss[:1])
+	if err != nil {
+		t.Fatalf("Select returned error: %s", err)
+	}
+	mi := v.Fields["USDDR"]
+	mi.Value = 1.5
+	upd.Fields["USDDR"] = mi
+	if err = db.Update(&upd); err != nil {
+		t.Fatalf("Update returned error: %s", err)
+	}
+	if v, err = db.Select(dt, ss[:1]); err != nil {
+		t.Fatalf("Select returned error: %s", err)
+	}
+	if v.Fields["USDDR"].Value != 1.5 {
+		t.Errorf("expected updated value 1.5, got %f", v.Fields["USDDR"].Value)
+	}
+}
+
+func TestSQLiteDropDatabase(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	if err := db.DropDatabase(); err != nil {
+		t.Fatalf("DropDatabase returned error: %s", err)
+	}
+	var n int
+	if err := db.SQLDB.DB.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type='table' AND name NOT LIKE 'sqlite_%'").Scan(&n); err != nil {
+		t.Fatalf("count tables: %s", err)
+	}
+	if n != 0 {
+		t.Errorf("expected no tables after DropDatabase, found %d", n)
+	}
+}
+
+// TestSQLiteHoldWindowBounds stores the bounds of the hold window genes in
+// MISubclasses and reloads them
+func TestSQLiteHoldWindowBounds(t *testing.T) {
+	db := newTestSQLiteDB(t)
+	mi := MInfluencerSubclass{
+		Name:         "Gold",
+		Metric:       "Gold",
+		Subclass:     "LSMInfluencer",
+		LocaleType:   LocaleNone,
+		Predictor:    SingleValGT,
+		MinDelta1:    -30,
+		MaxDelta1:    -2,
+		MinDelta2:    -1,
+		MaxDelta2:    0,
+		FitnessW1:    0.5,
+		FitnessW2:    0.5,
+		MetricType:   1,
+		MinLookBack:  30,
+		MaxLookBack:  365,
+		MinVarFactor: 0.25,
+		MaxVarFactor: 1.5,
+	}
+	if err := db.InsertMInfluencer(&mi); err != nil {
+		t.Fatalf("InsertMInfluencer returned error: %s", err)
+	}
+	db.Mim.ParentDB = db
+	if err := db.Mim.LoadMInfluencerSubclasses(); err != nil {
+		t.Fatalf("LoadMInfluencerSubclasses returned error: %s", err)
+	}
+	got := db.Mim.MInfluencerSubclasses["Gold"]
+	if got.MinLookBack != 30 || got.MaxLookBack != 365 || got.MinVarFactor != 0.25 || got.MaxVarFactor != 1.5 {
+		t.Errorf("unexpected hold window bounds: %d %d %f %f", got.MinLookBack, got.MaxLookBack, got.MinVarFactor, got.MaxVarFactor)
+	}
+	if dr := db.Mim.MInfluencerSubclasses["DR"]; dr.MaxLookBack != 0 || dr.MaxVarFactor != 0 {
+		t.Errorf("expected no hold window bounds for DR")
+	}
+
+	mi.MinLookBack = 1
+	if err := mi.CheckHoldWindowBounds(); err == nil {
+		t.Errorf("expected an error for MinLookBack < 2")
+	}
+	mi.MinLookBack, mi.MinVarFactor = 30, 2
+	if err := mi.CheckHoldWindowBounds(); err == nil {
+		t.Errorf("expected an error for MinVarFactor > MaxVarFactor")
+	}
+}
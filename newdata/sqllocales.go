@@ -19,7 +19,7 @@ func (p *Database) InsertLocale(m *Locale) (int64, error) {
 	switch p.Datatype {
 	case "CSV":
 		return 0, fmt.Errorf("this operation is net yet supported for CSV databases")
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.InsertLocale(m)
 	default:
 		return 0, fmt.Errorf("unknown database type: %s", p.Datatype)
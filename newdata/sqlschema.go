@@ -15,6 +15,8 @@ import (
 type DatabaseSQL struct {
 	DB             *sql.DB
 	Name           string            // database name
+	Driver         string            // database/sql driver: "mysql" or "sqlite3"
+	DBFname        string            // the SQLite file, only valid when Driver is "sqlite3"
 	BucketCount    int               // number of shards by metric name
 	MetricIDCache  map[string]int    // metric name to bucket number
 	LocaleCache    map[string]Locale // locale name to LID
@@ -53,9 +55,15 @@ func (p *DatabaseSQL) GetBucketForString(s string) int {
 // creates a new one.
 // ---------------------------------------------------------------------
 func (p *DatabaseSQL) CreateDatabaseTables() error {
+	if p.IsSQLite() {
+		return p.createSQLiteTables()
+	}
 	cmds := []string{
 		"CREATE DATABASE IF NOT EXISTS plato",
 		"USE plato",
+		"DROP TABLE IF EXISTS ClosedDays",
+		"DROP TABLE IF EXISTS BlocMembers",
+		"DROP TABLE IF EXISTS Blocs",
 		"DROP TABLE IF EXISTS Locales",
 		`CREATE TABLE Locales (
 			LID INT AUTO_INCREMENT PRIMARY KEY,
@@ -64,6 +72,24 @@ func (p *DatabaseSQL) CreateDatabaseTables() error {
 			Currency VARCHAR(80) NOT NULL,
 			Description TEXT
 		);`,
+		`CREATE TABLE Blocs (
+			BID INT AUTO_INCREMENT PRIMARY KEY,
+			Name VARCHAR(80) NOT NULL,
+			Description TEXT
+		);`,
+		`CREATE TABLE BlocMembers (
+			BID INT NOT NULL,                  -- this bloc...
+			LID INT NOT NULL,                  -- ...includes this locale...
+			Weight DOUBLE NOT NULL,            -- ...with this weight in the weighted aggregate
+			CONSTRAINT fk_BlocMembers_Blocs FOREIGN KEY (BID) REFERENCES Blocs(BID),
+			CONSTRAINT fk_BlocMembers_Locales FOREIGN KEY (LID) REFERENCES Locales(LID)
+		);`,
+		`CREATE TABLE ClosedDays (
+			CDID INT AUTO_INCREMENT PRIMARY KEY,
+			Date DATETIME NOT NULL,
+			Pair VARCHAR(12) NOT NULL DEFAULT '',  -- USDJPY, or JPY to close every JPY pair, or '' to close every pair
+			Description TEXT
+		);`,
 		`CREATE TABLE MISubclasses (
 			MID INT AUTO_INCREMENT PRIMARY KEY,
 			Name VARCHAR(128) NOT NULL,
@@ -77,7 +103,12 @@ func (p *DatabaseSQL) CreateDatabaseTables() error {
 			MinDelta2 INT NOT NULL,
 			MaxDelta2 INT NOT NULL,
 			FitnessW1 DECIMAL(13,6) NOT NULL,
-			FitnessW2 DECIMAL(13,6) NOT NULL /*,
+			FitnessW2 DECIMAL(13,6) NOT NULL,
+			Formula TEXT,
+			MinLookBack INT NOT NULL DEFAULT 0,
+			MaxLookBack INT NOT NULL DEFAULT 0,
+			MinVarFactor DECIMAL(13,6) NOT NULL DEFAULT 0,
+			MaxVarFactor DECIMAL(13,6) NOT NULL DEFAULT 0 /*,
 			HoldWindowPos DECIMAL(13,6) NOT NULL,
 			HoldWindowNeg DECIMAL(13,6) NOT NULL*/
 		);`,
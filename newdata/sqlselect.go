@@ -3,6 +3,7 @@ package newdata
 import (
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -71,12 +72,12 @@ func (p *DatabaseSQL) Insert(rec *EconometricsRecord) error {
 		//--------------------------------------------------------------------
 		if f.LID2 != noLocale && f.MID == -1 {
 			query := `INSERT INTO ExchangeRate (Date,LID,LID2,MSID,EXClose) VALUES (?,?,?,?,?)`
-			if _, err = p.DB.Exec(query, m.Date, m.LID, m.LID2, m.MSID, m.MetricValue.Value); err != nil {
+			if _, err = p.DB.Exec(query, p.dateValue(m.Date), m.LID, m.LID2, m.MSID, m.MetricValue.Value); err != nil {
 				return err
 			}
 		} else {
 			query := fmt.Sprintf(`INSERT INTO %s (Date,MID,LID,MSID,MetricValue) VALUES (?,?,?,?,?)`, f.Table)
-			if _, err = p.DB.Exec(query, m.Date, m.MID, m.LID, m.MSID, m.MetricValue.Value); err != nil {
+			if _, err = p.DB.Exec(query, p.dateValue(m.Date), m.MID, m.LID, m.MSID, m.MetricValue.Value); err != nil {
 				return err
 			}
 		}
@@ -117,12 +118,12 @@ func (p *DatabaseSQL) Update(rec *EconometricsRecord) error {
 		}
 		if f.LID2 != noLocale && f.MID == -1 {
 			query := `UPDATE ExchangeRate SET Date=?, LID=?, LID2=?, MSID=?, EXClose=? WHERE XID=?`
-			if _, err = p.DB.Exec(query, m.Date, m.LID, m.LID2, m.MSID, m.MetricValue.Value, m.MetricValue.ID); err != nil {
+			if _, err = p.DB.Exec(query, p.dateValue(m.Date), m.LID, m.LID2, m.MSID, m.MetricValue.Value, m.MetricValue.ID); err != nil {
 				return err
 			}
 		} else {
 			query := fmt.Sprintf(`UPDATE %s SET Date=?, MID=?, LID=?, MSID=?, MetricValue=? WHERE MEID=?`, f.Table)
-			if _, err = p.DB.Exec(query, m.Date, m.MID, m.LID, m.MSID, m.MetricValue.Value, m.MetricValue.ID); err != nil {
+			if _, err = p.DB.Exec(query, p.dateValue(m.Date), m.MID, m.LID, m.MSID, m.MetricValue.Value, m.MetricValue.ID); err != nil {
 				return err
 			}
 		}
@@ -134,9 +135,20 @@ func (p *DatabaseSQL) Update(rec *EconometricsRecord) error {
 
 // Select reads the requested fields from the sql database.
 // If ss is nil or zero length then it uses all known metrics
+//
+// Each returned MetricInfo also has its rolling Mean and StdDevSquared set,
+// computed over the last cfg.HoldWindowStatsLookBack values of the metric
+// exactly as DatabaseCSV.LoadCsvDB does, so that Influencers behave the same
+// regardless of which backend supplies the data.
 // --------------------------------------------------------------------
 func (p *DatabaseSQL) Select(dt time.Time, ss []FieldSelector) (*EconometricsRecord, error) {
-	var err error
+	return p.selectWindow(dt, ss, p.statsLookBack())
+}
+
+// selectWindow is Select with the rolling statistics computed over the last
+// n values of each metric. If n is 0 no statistics are computed.
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) selectWindow(dt time.Time, ss []FieldSelector, n int) (*EconometricsRecord, error) {
 	rec := EconometricsRecord{
 		Date:   dt,
 		Fields: map[string]MetricInfo{},
@@ -145,39 +157,309 @@ func (p *DatabaseSQL) Select(dt time.Time, ss []FieldSelector) (*EconometricsRec
 	for _, v := range ss {
 		p.FieldSelectorFromCSVColName(v.Metric, &v)
 		p.GetShardInfo(dt, &v)
-		var m MetricRecord
 
-		// Considering date precision in SQL DATETIME(6), it's important to format the time in a supported layout
-		// SQL DATETIME(6) format: "2006-01-02 15:04:05.999999"
-		dateStr := dt.Format("2006-01-02")
+		recs, err := p.selectLookBack(dt, &v, n)
+		if err != nil {
+			return nil, err
+		}
+		if len(recs) == 0 || !sameDate(recs[0].Date, dt) {
+			continue // nothing to store in Fields
+		}
+		m := recs[0].MetricValue
+		if v.Metric != "EXClose" && recs[0].MSID > 0 {
+			v.MSID = recs[0].MSID
+			m.MSID = recs[0].MSID
+		}
+
+		//-------------------------------------------------------------------
+		// recs is newest first. Feed RollingStats oldest first so that the
+		// arithmetic is identical to what the CSV loader does.
+		//-------------------------------------------------------------------
+		if n > 0 && len(recs) == n {
+			rs := NewRollingStats(n)
+			for i := len(recs) - 1; i >= 0; i-- {
+				m.Mean, m.StdDevSquared, m.StatsValid = rs.AddValue(recs[i].MetricValue.Value)
+			}
+		}
+		rec.Fields[v.FQMetric()] = m
+	}
+	return &rec, nil
+}
+
+// statsLookBack returns the number of values used for the rolling statistics
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) statsLookBack() int {
+	if p.ParentDB == nil || p.ParentDB.cfg == nil {
+		return 0
+	}
+	return p.ParentDB.cfg.HoldWindowStatsLookBack
+}
+
+// sameDate returns true if a and b fall on the same calendar day
+func sameDate(a, b time.Time) bool {
+	return a.Year() == b.Year() && a.Month() == b.Month() && a.Day() == b.Day()
+}
+
+// selectLookBack returns up to n values (at least 1) of the metric described
+// by v with a Date on or before dt, newest first. Rows with a NULL value are
+// skipped, like the empty cells of a CSV database. Metrics tables are sharded
+// by decade, so if the current decade does not have enough values the
+// previous decades are searched as well.
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) selectLookBack(dt time.Time, v *FieldSelector, n int) ([]MetricRecord, error) {
+	if n < 1 {
+		n = 1
+	}
+	// SQL DATETIME(6) format: "2006-01-02 15:04:05.999999", we only need the date
+	dateStr := dt.Format("2006-01-02")
+	recs := []MetricRecord{}
+
+	if v.Metric == "EXClose" {
+		query := `SELECT XID,Date,LID,LID2,EXClose FROM ExchangeRate WHERE Date<=? AND LID=? AND LID2=? AND EXClose IS NOT NULL ORDER BY Date DESC LIMIT ?`
+		rows, err := p.DB.Query(query, dateStr, v.LID, v.LID2, n)
+		if err != nil {
+			return nil, err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m MetricRecord
+			if err = rows.Scan(&m.MetricValue.ID, &m.Date, &m.LID, &m.LID2, &m.MetricValue.Value); err != nil {
+				return nil, err
+			}
+			recs = append(recs, m)
+		}
+		return recs, rows.Err()
+	}
+
+	for decade := (dt.Year() / 10) * 10; decade >= 2000 && len(recs) < n; decade -= 10 {
+		table := fmt.Sprintf("Metrics_%d_%d", v.BucketNumber, decade)
+		query := fmt.Sprintf(`SELECT MEID,Date,MID,LID,MSID,MetricValue FROM %s WHERE Date<=? AND MID=? AND LID=? AND MetricValue IS NOT NULL ORDER BY Date DESC LIMIT ?`, table)
+		rows, err := p.DB.Query(query, dateStr, v.MID, v.LID, n-len(recs))
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var m MetricRecord
+			var nullint sql.NullInt64
+			if err = rows.Scan(&m.MetricValue.ID, &m.Date, &m.MID, &m.LID, &nullint, &m.MetricValue.Value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			if nullint.Valid {
+				m.MSID = int(nullint.Int64)
+			}
+			recs = append(recs, m)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return recs, nil
+}
+
+// priorCount returns the number of values before the start of a range that
+// SelectRange reads for each metric: enough for the rolling statistics of
+// the longest look-back any metric may use.
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) priorCount() int {
+	n := p.statsLookBack()
+	if p.ParentDB != nil && p.ParentDB.Mim != nil {
+		for _, mi := range p.ParentDB.Mim.MInfluencerSubclasses {
+			if mi.MaxLookBack > n {
+				n = mi.MaxLookBack
+			}
+		}
+	}
+	return n
+}
 
+// selectPrior returns up to n values of the metric described by v with a
+// Date before dt, oldest first. Like selectLookBack, it searches the
+// previous decades if the current one does not have enough values.
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) selectPrior(dt time.Time, v *FieldSelector, n int) ([]MetricRecord, error) {
+	dateStr := dt.Format("2006-01-02")
+	recs := []MetricRecord{}
+	scan := func(query string, args ...interface{}) error {
+		rows, err := p.DB.Query(query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		for rows.Next() {
+			var m MetricRecord
+			if err = rows.Scan(&m.Date, &m.MetricValue.Value); err != nil {
+				return err
+			}
+			recs = append(recs, m)
+		}
+		return rows.Err()
+	}
+
+	if v.Metric == "EXClose" {
+		if err := scan(`SELECT Date,EXClose FROM ExchangeRate WHERE Date<? AND LID=? AND LID2=? AND EXClose IS NOT NULL ORDER BY Date DESC LIMIT ?`, dateStr, v.LID, v.LID2, n); err != nil {
+			return nil, err
+		}
+	} else {
+		for decade := (dt.Year() / 10) * 10; decade >= 2000 && len(recs) < n; decade -= 10 {
+			table := fmt.Sprintf("Metrics_%d_%d", v.BucketNumber, decade)
+			query := fmt.Sprintf(`SELECT Date,MetricValue FROM %s WHERE Date<? AND MID=? AND LID=? AND MetricValue IS NOT NULL ORDER BY Date DESC LIMIT ?`, table)
+			if err := scan(query, dateStr, v.MID, v.LID, n-len(recs)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	for i, j := 0, len(recs)-1; i < j; i, j = i+1, j-1 {
+		recs[i], recs[j] = recs[j], recs[i]
+	}
+	return recs, nil
+}
+
+// SelectRange reads the requested fields for every day from dtStart through
+// dtStop. Rather than one query per field per day, it issues one query for
+// the ExchangeRate table and one query per Metrics shard table. Before that,
+// the last priorCount values of each field before dtStart are read so that
+// the rolling statistics match Select. They are kept in each column's Prior
+// so that the statistics for other look-back windows can be computed as
+// well. A day has a record if any of the fields has a value on that day.
+// --------------------------------------------------------------------
+func (p *DatabaseSQL) SelectRange(dtStart, dtStop time.Time, ss []FieldSelector) (*EconometricsSeries, error) {
+	type metricKey struct {
+		MID int
+		LID int
+	}
+	series := NewEconometricsSeries(dtStart, dtStop)
+	series.Rows = make([]bool, series.Days) // no records until the rows are read
+	n := p.statsLookBack()
+	stats := map[string]*RollingStats{}
+	startStr := dtStart.Format("2006-01-02")
+	dateStr := dtStop.Format("2006-01-02")
+
+	//-------------------------------------------------------------------
+	// Values must be added in date order for the rolling stats to work
+	//-------------------------------------------------------------------
+	add := func(name string, dt time.Time, m MetricInfo) {
+		if truncateToDay(dt).Before(series.DtStart) {
+			c := series.Column(name)
+			c.Prior = append(c.Prior, m.Value)
+		} else {
+			series.SetRecord(dt)
+		}
+		if n > 0 {
+			rs, ok := stats[name]
+			if !ok {
+				rs = NewRollingStats(n)
+				stats[name] = rs
+			}
+			m.Mean, m.StdDevSquared, m.StatsValid = rs.AddValue(m.Value)
+		}
+		series.Set(name, dt, m)
+	}
+
+	//-------------------------------------------------------------------
+	// Sort the requests by table
+	//-------------------------------------------------------------------
+	exch := map[metricKey]string{}            // (LID,LID2) to FQ name
+	buckets := map[int]map[metricKey]string{} // bucket number to (MID,LID) to FQ name
+	prior := p.priorCount()
+	for _, v := range ss {
+		p.FieldSelectorFromCSVColName(v.Metric, &v)
+		p.GetShardInfo(dtStop, &v)
+		name := v.FQMetric()
 		if v.Metric == "EXClose" {
-			query := `SELECT XID,Date,LID,LID2, EXClose FROM ExchangeRate WHERE Date=? AND LID=? AND LID2=? LIMIT 1`
-			err = p.DB.QueryRow(query, dateStr, v.LID, v.LID2).Scan(&m.MetricValue.ID, &m.Date, &m.LID, &m.LID2, &m.MetricValue.Value)
+			exch[metricKey{v.LID, v.LID2}] = name
+		} else if v.MID > 0 {
+			if _, ok := buckets[v.BucketNumber]; !ok {
+				buckets[v.BucketNumber] = map[metricKey]string{}
+			}
+			buckets[v.BucketNumber][metricKey{v.MID, v.LID}] = name
+		} else {
+			continue // unrecognized metric, no column so Select will fall back to the db
+		}
+		series.Column(name)
+		if prior > 0 {
+			recs, err := p.selectPrior(dtStart, &v, prior)
 			if err != nil {
-				if err == sql.ErrNoRows {
-					continue // nothing to store in Fields
-				}
 				return nil, err
 			}
-			rec.Fields[v.FQMetric()] = m.MetricValue
-		} else {
-			// Prepare the query
-			query := fmt.Sprintf(`SELECT MEID,Date,MID,LID,MSID, MetricValue FROM %s WHERE Date=? AND MID=? AND LID=? LIMIT 1`, v.Table)
-			var nullint sql.NullInt64
-			err = p.DB.QueryRow(query, dateStr, v.MID, v.LID).Scan(&m.MetricValue.ID, &m.Date, &m.MID, &m.LID, &nullint, &m.MetricValue.Value)
+			for _, m := range recs {
+				add(name, m.Date, m.MetricValue)
+			}
+		}
+	}
+
+	//-------------------------------------------------------------------
+	// ExchangeRate
+	//-------------------------------------------------------------------
+	if len(exch) > 0 {
+		conds := []string{}
+		args := []interface{}{startStr, dateStr}
+		for k := range exch {
+			conds = append(conds, "(LID=? AND LID2=?)")
+			args = append(args, k.MID, k.LID)
+		}
+		query := `SELECT Date,LID,LID2,EXClose FROM ExchangeRate WHERE Date>=? AND Date<=? AND (` + strings.Join(conds, " OR ") + `) ORDER BY Date`
+		rows, err := p.DB.Query(query, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var m MetricRecord
+			if err = rows.Scan(&m.Date, &m.LID, &m.LID2, &m.MetricValue.Value); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			add(exch[metricKey{m.LID, m.LID2}], m.Date, m.MetricValue)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//-------------------------------------------------------------------
+	// Metrics shards, oldest decade first
+	//-------------------------------------------------------------------
+	first := (dtStart.Year() / 10) * 10
+	if first < 2000 {
+		first = 2000 // there are no earlier shards
+	}
+	for decade := first; decade <= (dtStop.Year()/10)*10; decade += 10 {
+		for bucket, metrics := range buckets {
+			conds := []string{}
+			args := []interface{}{startStr, dateStr}
+			for k := range metrics {
+				conds = append(conds, "(MID=? AND LID=?)")
+				args = append(args, k.MID, k.LID)
+			}
+			table := fmt.Sprintf("Metrics_%d_%d", bucket, decade)
+			query := fmt.Sprintf(`SELECT Date,MID,LID,MetricValue FROM %s WHERE Date>=? AND Date<=? AND (%s) ORDER BY Date`, table, strings.Join(conds, " OR "))
+			rows, err := p.DB.Query(query, args...)
 			if err != nil {
-				if err == sql.ErrNoRows {
-					continue // nothing to store in Fields
-				}
 				return nil, err
 			}
-			if nullint.Valid {
-				v.MSID = int(nullint.Int64)
-				m.MetricValue.MSID = int(nullint.Int64)
+			for rows.Next() {
+				var m MetricRecord
+				var val sql.NullFloat64
+				if err = rows.Scan(&m.Date, &m.MID, &m.LID, &val); err != nil {
+					rows.Close()
+					return nil, err
+				}
+				if !val.Valid {
+					continue
+				}
+				m.MetricValue.Value = val.Float64
+				add(metrics[metricKey{m.MID, m.LID}], m.Date, m.MetricValue)
+			}
+			err = rows.Err()
+			rows.Close()
+			if err != nil {
+				return nil, err
 			}
-			rec.Fields[v.FQMetric()] = m.MetricValue
 		}
 	}
-	return &rec, nil
+	return series, nil
 }
@@ -22,7 +22,7 @@ func (p *Database) InsertMetricsSource(m *MetricsSource) (int64, error) {
 	switch p.Datatype {
 	case "CSV":
 		return 0, fmt.Errorf("this operation is net yet supported for CSV databases")
-	case "SQL":
+	case "SQL", "SQLITE":
 		return p.SQLDB.InsertMetricsSource(m)
 	default:
 		return 0, fmt.Errorf("unknown database type: %s", p.Datatype)
@@ -70,3 +70,42 @@ func CheckAndInsertHash(db *sql.DB, hash string, elite bool) (bool, error) {
 	// Return false to indicate the hash was not found and has been inserted
 	return false, nil
 }
+
+// AllHashes returns every hash in the database, in sorted order.
+func AllHashes(db *sql.DB) ([]string, error) {
+	rows, err := db.Query("SELECT hash FROM hashes ORDER BY hash")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var h string
+		if err = rows.Scan(&h); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// ReplaceHashes removes all hashes from the database and inserts the supplied
+// list in their place.
+func ReplaceHashes(db *sql.DB, hashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	if _, err = tx.Exec("DELETE FROM hashes"); err != nil {
+		tx.Rollback()
+		return err
+	}
+	for _, h := range hashes {
+		if _, err = tx.Exec("INSERT INTO hashes (hash) VALUES (?)", h); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
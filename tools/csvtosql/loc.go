@@ -1,6 +1,8 @@
 package main
 
 import (
+	"sort"
+
 	"github.com/stmansour/psim/newdata"
 )
 
@@ -50,3 +52,20 @@ func CopyCsvLocalesToSQL() error {
 	}
 	return nil
 }
+
+// CopyCsvBlocsToSQL copies the bloc definitions of the CSV database to sql.
+// The locale cache of the sql database must be loaded.
+func CopyCsvBlocsToSQL() error {
+	names := make([]string, 0, len(app.csvdb.Blocs))
+	for k := range app.csvdb.Blocs {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	for _, k := range names {
+		b := app.csvdb.Blocs[k]
+		if _, err := app.sqldb.InsertBloc(&b); err != nil {
+			return err
+		}
+	}
+	return nil
+}
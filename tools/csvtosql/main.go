@@ -22,14 +22,21 @@ type Application struct {
 	DtStop              time.Time
 	metricsSrc          string
 	MSID                int
-	SkipMetricMigration bool // if true, skip the metric migration step
+	SkipMetricMigration bool   // if true, skip the metric migration step
+	DBType              string // target database type: "SQL" or "SQLITE"
+	SQLiteFname         string // SQLite file to create when DBType is "SQLITE"
 }
 
 var app Application
 
 func readCommandLineArgs() {
 	flag.BoolVar(&app.SkipMetricMigration, "S", false, "skip the metric migration step, just create the metrics tables")
+	flag.StringVar(&app.DBType, "t", "SQL", "target database type: SQL (MySQL) or SQLITE")
+	flag.StringVar(&app.SQLiteFname, "f", "", "SQLite database file to create, default is data/plato.db. Only used when -t SQLITE")
 	flag.Parse()
+	if app.DBType != "SQL" && app.DBType != "SQLITE" {
+		log.Fatalf("unrecognized target database type: %s\n", app.DBType)
+	}
 }
 
 //	main - this function creates a new db from scratch. It uses the
@@ -89,12 +96,15 @@ func main() {
 	}
 
 	//---------------------------------------------------------------------
-	// open the SQL database
+	// open the SQL (or SQLite) database
 	//---------------------------------------------------------------------
-	app.sqldb, err = newdata.NewDatabase("SQL", app.cfg, app.extres)
+	app.sqldb, err = newdata.NewDatabase(app.DBType, app.cfg, app.extres)
 	if err != nil {
 		log.Fatalf("Error creating database: %s\n", err.Error())
 	}
+	if app.DBType == "SQLITE" {
+		app.sqldb.SetSQLiteFilename(app.SQLiteFname)
+	}
 	if err = app.sqldb.Open(); err != nil {
 		log.Fatalf("db.Open returned error: %s\n", err.Error())
 	}
@@ -126,10 +136,11 @@ func main() {
 	//         Tables             Description
 	//      -----------           -------------------------------
 	//       1. Locales           locale names:  USA USD, JPN JPY, etc..
-	//       2. MISubclasses      Metric Influencers
-	//       3  MetricsSources    Where the metrics come from
-	//       4. Exchange Rate     Currency exchange rates
-	//       4. Metrics_n_decade  all metrics
+	//       2. Blocs             groups of locales: G7, Eurozone, etc..
+	//       3. MISubclasses      Metric Influencers
+	//       4. MetricsSources    Where the metrics come from
+	//       5. Exchange Rate     Currency exchange rates
+	//       6. Metrics_n_decade  all metrics
 	//----------------------------------------------------------------------
 	if err = CopyCsvLocalesToSQL(); err != nil {
 		log.Fatalf("Error from CopyCsvLocalesToSQL: %s\n", err.Error())
@@ -141,6 +152,9 @@ func main() {
 	if err = app.sqldb.SQLDB.LoadLocaleCache(); err != nil {
 		log.Fatalf("Error from LoadLocalCache: %s\n", err.Error())
 	}
+	if err = CopyCsvBlocsToSQL(); err != nil {
+		log.Fatalf("Error from CopyCsvBlocsToSQL: %s\n", err.Error())
+	}
 	if err = CopyCsvMISubclassesToSQL(); err != nil {
 		log.Fatalf("Error from CopyCsvMISubclassesToSql: %s\n", err.Error())
 	}
@@ -24,6 +24,8 @@ type Application struct {
 	DtStart     time.Time
 	DtStop      time.Time
 	ShardMetric string
+	DBType      string // source database type: "SQL" or "SQLITE"
+	SQLiteFname string // SQLite file to read when DBType is "SQLITE"
 }
 
 var app Application
@@ -31,7 +33,12 @@ var app Application
 func readCommandLineArgs() {
 	flag.StringVar(&app.ShardMetric, "s", "", "print the shard info for the supplied metric (as seen in CSV column header)")
 	flag.StringVar(&app.cfName, "c", "", "configuration file to use (instead of config.json)")
+	flag.StringVar(&app.DBType, "t", "SQL", "source database type: SQL (MySQL) or SQLITE")
+	flag.StringVar(&app.SQLiteFname, "f", "", "SQLite database file to read, default is data/plato.db. Only used when -t SQLITE")
 	flag.Parse()
+	if app.DBType != "SQL" && app.DBType != "SQLITE" {
+		log.Fatalf("unrecognized source database type: %s\n", app.DBType)
+	}
 }
 
 func main() {
@@ -53,11 +60,14 @@ func main() {
 	app.cfg = cfg
 
 	//---------------------------------------------------------------------
-	// open the SQL database
+	// open the SQL (or SQLite) database
 	//---------------------------------------------------------------------
-	if app.sqldb, err = newdata.NewDatabase("SQL", app.cfg, app.extres); err != nil {
+	if app.sqldb, err = newdata.NewDatabase(app.DBType, app.cfg, app.extres); err != nil {
 		log.Fatalf("Error creating database: %s\n", err.Error())
 	}
+	if app.DBType == "SQLITE" {
+		app.sqldb.SetSQLiteFilename(app.SQLiteFname)
+	}
 	if err = app.sqldb.Open(); err != nil {
 		log.Fatalf("db.Open returned error: %s\n", err.Error())
 	}
@@ -104,6 +114,13 @@ func main() {
 		log.Fatalf("*** FATAL ERROR ***  WriteMetricsSourcesToCSV returned error: %s\n", err)
 	}
 
+	//----------------------------------------------------------------------
+	//   2a. Blocs
+	//----------------------------------------------------------------------
+	if err = app.csvdb.CSVDB.WriteBlocsToCSV(app.sqldb.Blocs); err != nil {
+		log.Fatalf("*** FATAL ERROR ***  WriteBlocsToCSV returned error: %s\n", err)
+	}
+
 	//----------------------------------------------------------------------
 	//   3. MISubclasses
 	//----------------------------------------------------------------------
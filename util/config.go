@@ -12,6 +12,141 @@ import (
 	json5 "github.com/yosuke-furukawa/json5/encoding/json5"
 )
 
+// Parent selection methods for SelectionMethod in the config file
+const (
+	SelectRoulette   = "roulette"   // roulette wheel, chance is proportional to fitness
+	SelectTournament = "tournament" // best of TournamentSize randomly chosen Investors
+	SelectRank       = "rank"       // linear rank, chance depends on fitness rank
+	SelectSUS        = "sus"        // stochastic universal sampling
+)
+
+// SelectionMethods lists the valid values for SelectionMethod
+var SelectionMethods = []string{SelectRoulette, SelectTournament, SelectRank, SelectSUS}
+
+// Investor fitness metrics for FitnessMetric in the config file
+const (
+	FitnessDefault      = "default"      // weighted profit and correctness
+	FitnessSharpe       = "sharpe"       // Sharpe ratio of the daily returns
+	FitnessSortino      = "sortino"      // Sortino ratio of the daily returns
+	FitnessCalmar       = "calmar"       // annualized return / max drawdown
+	FitnessProfitFactor = "profitfactor" // gross profit / gross loss
+	FitnessWinRate      = "winrate"      // fraction of profitable Investments
+)
+
+// FitnessMetrics lists the valid values for FitnessMetric
+var FitnessMetrics = []string{FitnessDefault, FitnessSharpe, FitnessSortino, FitnessCalmar, FitnessProfitFactor, FitnessWinRate}
+
+// Crossover operators for the numeric genes of Influencers, for Crossover in
+// the config file
+const (
+	CrossoverBlend      = "blend"      // BLX-alpha, uniform in the parents' interval widened by CrossoverAlpha on each side
+	CrossoverArithmetic = "arithmetic" // a random weighted average of the parents' values
+	CrossoverUniform    = "uniform"    // the value of either parent
+)
+
+// Crossovers lists the valid values for Crossover
+var Crossovers = []string{CrossoverBlend, CrossoverArithmetic, CrossoverUniform}
+
+// Mutation operators for the numeric genes of Influencers, for GeneMutation
+// in the config file
+const (
+	MutationGaussian = "gaussian" // add a normally distributed amount
+	MutationCreep    = "creep"    // add a uniformly distributed amount
+)
+
+// GeneMutations lists the valid values for GeneMutation
+var GeneMutations = []string{MutationGaussian, MutationCreep}
+
+// DefaultGeneMutationSigma is used when GeneMutationSigma is not set
+const DefaultGeneMutationSigma = 0.1
+
+// Limits on the size of the rule trees of rule tree Investors, used when
+// RuleMaxDepth and RuleMaxNodes are not set
+const (
+	DefaultRuleMaxDepth = 6
+	DefaultRuleMaxNodes = 31
+)
+
+// Position sizing policies, for PositionSizing in the config file. They
+// decide how much C1 a buy spends.
+const (
+	SizingStandard    = "standard"    // StdInvestment * ActionPct
+	SizingFractional  = "fractional"  // SizingFraction of the portfolio value * ActionPct
+	SizingVolatility  = "volatility"  // a one standard deviation move of the exchange rate costs VolatilityTarget of the portfolio value
+	SizingKelly       = "kelly"       // KellyFraction of the Kelly criterion from the Investor's completed Investments
+	SizingMaxExposure = "maxexposure" // StdInvestment * ActionPct, but never more than MaxExposure of the portfolio value held in C2
+)
+
+// PositionSizings lists the valid values for PositionSizing
+var PositionSizings = []string{SizingStandard, SizingFractional, SizingVolatility, SizingKelly, SizingMaxExposure}
+
+// Defaults for the position sizing settings that are not set
+const (
+	DefaultSizingFraction   = 0.1
+	DefaultVolatilityTarget = 0.01
+	DefaultKellyFraction    = 0.5
+	DefaultKellyMinTrades   = 10
+	DefaultMaxExposure      = 0.5
+)
+
+// Execution models, for ExecutionModel in the config file. They decide the
+// exchange rate an Investor actually gets when it converts.
+const (
+	ExecMid          = "mid"          // the EXClose value, no cost
+	ExecFixedSpread  = "fixedspread"  // a fixed spread of ExecSpreadPips around EXClose
+	ExecMetricSpread = "metricspread" // the spread between the ExecBidMetric and ExecAskMetric metrics, times ExecRangeFactor
+	ExecVolSlippage  = "volslippage"  // ExecSpreadPips plus slippage of ExecSlippageFactor standard deviations of EXClose
+)
+
+// ExecutionModels lists the valid values for ExecutionModel
+var ExecutionModels = []string{ExecMid, ExecFixedSpread, ExecMetricSpread, ExecVolSlippage}
+
+// Defaults for the execution model settings that are not set
+const (
+	DefaultExecSpreadPips     = 1.0
+	DefaultExecBidMetric      = "EXBid"
+	DefaultExecAskMetric      = "EXAsk"
+	DefaultExecRangeFactor    = 1.0
+	DefaultExecSlippageFactor = 0.1
+)
+
+// Lot selection policies, for LotSelection in the config file. They decide
+// which Investments, the tax lots, a sale of C2 takes the C2 from.
+const (
+	LotFIFO        = "fifo"        // the oldest Investment first
+	LotLIFO        = "lifo"        // the newest Investment first
+	LotHIFO        = "hifo"        // the Investment with the highest cost per unit of C2 first
+	LotHighestLoss = "highestloss" // the Investment with the greatest loss, or the smallest gain, at the rate of the sale first
+	LotSpecificID  = "specificid"  // the Investments named in SpecificLots, or with Investor.SelectLots, first, then the oldest
+)
+
+// LotDateFmt is the format of the buy dates in SpecificLots
+const LotDateFmt = "2006-01-02"
+
+// LotSelections lists the valid values for LotSelection
+var LotSelections = []string{LotFIFO, LotLIFO, LotHIFO, LotHighestLoss, LotSpecificID}
+
+// DefaultLongTermDays is the holding period, in days, beyond which a gain is
+// long-term when LongTermDays is not set
+const DefaultLongTermDays = 365
+
+// Trading day rules, for TradingDay in the config file. They decide the days
+// on which Investors trade. The weekdays of TradingEvery follow it, for
+// example "every monday" or "every monday, thursday".
+const (
+	TradingDaily            = "daily"                       // every day the market is not closed, including weekends
+	TradingWeekdays         = "weekdays"                    // Monday through Friday
+	TradingEvery            = "every"                       // the weekdays listed
+	TradingFirstBusinessDay = "first business day of month" // the first weekday of each month the market is open
+	TradingLastBusinessDay  = "last business day of month"  // the last weekday of each month the market is open
+)
+
+// TradingDayRule is the parsed form of TradingDay
+type TradingDayRule struct {
+	Kind string  // one of the Trading... rules
+	Days [7]bool // TradingEvery: the weekdays to trade, indexed by time.Weekday
+}
+
 // CustomDate is used so that unmarshaling a date will work with
 // dates in the format we want to enter them.
 // ---------------------------------------------------------------------------
@@ -84,7 +219,7 @@ type FileConfig struct {
 	PopulationSize  int                    // how many investors are in this population
 	InitFunds       float64                // amount of funds each Investor is "staked" at the outset of the simulation
 	StdInvestment   float64                // standard investment amount
-	TradingDay      int                    // this needs to be completely re-thought -- it's like a recurrence rule
+	TradingDay      string                 // which days Investors trade, see AppConfig
 	TradingTime     time.Time              // time of day when buy/sell is executed
 	MaxInf          int                    // maximum number of influencers for any Investor
 	MinInf          int                    // minimum number of influencers for any Investor
@@ -129,6 +264,7 @@ type AppConfig struct {
 	ConfigFilename          string              // filename of the configuration file read
 	C1                      string              // Currency1 - the currency that we're trying to maximize
 	C2                      string              // Currency2 - the currency that we invest in to sell later and make a profit (or loss)
+	Pairs                   []string            // if set, Investors are portfolios of these pairs, like USDJPY. C1 is the home currency of every pair
 	DtStart                 CustomDate          // simulation begins on this date
 	DtStop                  CustomDate          // simulation ends on this date. Guaranteed that no "buys" happen after this date
 	EnforceStopDate         bool                // stops on DtStop even if there is a C2 Balance, if false and C2 Balance > 0 on StopDate, simulation will continue in sell-only mode until C2 < 1.00
@@ -145,11 +281,33 @@ type AppConfig struct {
 	SplitInitFunds          bool                // if true split initial funds evenly between C1 and C2 on DtStart
 	StdInvestment           float64             // standard investment amount
 	StdSellPercent          float64             // standard sell percentage
-	TradingDay              int                 // this needs to be completely re-thought -- it's like a recurrence rule
+	TradingDay              string              // which days Investors trade: daily (default), weekdays, "every monday", "every monday, thursday", "first business day of month" or "last business day of month". No day the database's trading calendar lists as closed is a trading day
+	TradingDayDeltas        bool                // if true, Influencers count Delta1 and Delta2 in days the market is open rather than calendar days
 	TradingTime             time.Time           // time of day when buy/sell is executed
 	Generations             int                 // current generation in the simulator
 	MutationRate            int                 // 1 - 100 indicating the % of mutation
-	DBSource                string              // {CSV | Database | OnlineService}
+	SelectionMethod         string              // how parents are selected for the next generation: roulette (default), tournament, rank, or sus
+	TournamentSize          int                 // number of Investors in each tournament when SelectionMethod is tournament
+	FitnessMetric           string              // what an Investor's fitness score measures: default (profit and correctness), sharpe, sortino, calmar, profitfactor, or winrate
+	MultiObjective          bool                // if true, parents are chosen by Pareto rank (NSGA-II) on annualized return, max drawdown, trade count and correctness rather than by fitness score
+	AccuracyWeightedVotes   bool                // if true, each Influencer's vote is weighted by its running accuracy in the current generation
+	Crossover               string              // how the numeric genes of two parents' Influencers are combined: blend (default), arithmetic, or uniform
+	CrossoverAlpha          float64             // blend crossover: how far beyond the parents' values a child's gene can be, as a fraction of their difference
+	GeneMutation            string              // how a numeric gene of an Influencer is mutated: gaussian (default) or creep
+	GeneMutationSigma       float64             // size of a gene mutation as a fraction of the gene's range
+	RuleTreeInvestors       float64             // fraction, 0 to 1, of the random Investors in generation 1 that decide with evolved rule trees rather than Influencers
+	RuleMaxDepth            int                 // deepest a rule tree may grow
+	RuleMaxNodes            int                 // most nodes a rule tree may have
+	RuleParsimony           float64             // subtracted from a rule tree Investor's fitness score for each node of its rule trees, discourages bloat
+	COAStrategies           []string            // the course of action strategies random Investors may use, DistributedDecision and MajorityRules if not set
+	PositionSizing          string              // how much C1 a buy spends: standard (default), fractional, volatility, kelly, or maxexposure
+	EvolvePositionSizing    bool                // if true, the position sizing policy is a gene of each Investor and PositionSizing is not used
+	SizingFraction          float64             // fractional: fraction of the portfolio value a buy spends at an ActionPct of 1
+	VolatilityTarget        float64             // volatility: fraction of the portfolio value a one standard deviation move of the exchange rate may cost
+	KellyFraction           float64             // kelly: fraction of the full Kelly bet to make
+	KellyMinTrades          int                 // kelly: completed Investments needed before the Kelly criterion is used, standard sizing until then
+	MaxExposure             float64             // maxexposure: largest fraction of the portfolio value that may be held in C2
+	DBSource                string              // {CSV | SQL | SQLITE}
 	RandNano                int64               // random number seed used for this simulation
 	InfPredDebug            bool                // print debug info about every prediction
 	Trace                   bool                // use this flag to cause full trace information to be printed regarding every Investor decision every day.
@@ -162,6 +320,12 @@ type AppConfig struct {
 	Recommendation          bool                // if true then show buy/sell/hold recommendation for DtStart
 	CrucibleName            string              // name of the crucible
 	CrucibleARThreshold     float64             // AR threshold... it only counts if if the annualized return is above this amount.  Use 0.15 for 15%
+	CrucibleLotSelections   []string            // if set, the crucible runs each TopInvestor once with each of these LotSelection policies
+	WalkForwardMode         bool                // if true, evolve on a training window, test the top Investors on the following window, and roll forward
+	WalkForwardTrain        string              // duration of the training (in-sample) window, ex: "1y"
+	WalkForwardTest         string              // duration of the test (out-of-sample) window, ex: "3m"
+	WalkForwardStep         string              // how far both windows move forward each time, defaults to WalkForwardTest
+	WalkForwardTopN         int                 // number of top Investors from each training window to run on the test window
 	ReportDirectory         string              // final directory where all reports should be
 	ReportTimestamp         string              // timestamp to used for archived reports
 	ReportDirSet            bool                // when false the info needs to be set, when true it's already set
@@ -172,6 +336,20 @@ type AppConfig struct {
 	EliteCount              int                 // calculated by the simulator
 	ExecutableFilePath      string              // path to the executable
 	StopLoss                float64             // Expressed as a percentage of the Portfolio Value. That is, use 0.10 for 10%.  Sell all C2 immediately if the PV has lost this much of the initial funding.
+	TakeProfit              float64             // sell the C2 of an Investment once it has gained this fraction of its value, use 0.05 for 5%.  0 turns the rule off
+	TrailingStop            float64             // sell the C2 of an Investment once it has lost this fraction of its value from its best value since the buy.  0 turns the rule off
+	MaxHoldingDays          int                 // sell the C2 of an Investment that has been held this many days.  0 turns the rule off
+	CarryRates              map[string]string   // currency -> metric with its annual interest rate in percent, e.g. {"USD": "DR", "JPY": "DR"}. Interest accrues daily on the balance in each currency listed
+	ExecutionModel          string              // the exchange rate a conversion gets: mid (default), fixedspread, metricspread, or volslippage
+	ExecSpreadPips          float64             // fixedspread: the bid/ask spread in pips. metricspread: the spread used when the metrics have no value. volslippage: the spread added to the slippage
+	ExecPipSize             float64             // size of a pip in the exchange rate, if 0 it is 0.01 when C1 or C2 is JPY and 0.0001 otherwise
+	ExecBidMetric           string              // metricspread: the C1C2 metric with the bid, or the low, of the exchange rate
+	ExecAskMetric           string              // metricspread: the C1C2 metric with the ask, or the high, of the exchange rate
+	ExecRangeFactor         float64             // metricspread: the spread is this fraction of ask - bid. Use less than 1 for a high/low range
+	ExecSlippageFactor      float64             // volslippage: the slippage is this many rolling standard deviations of EXClose
+	LotSelection            string              // which Investments a sale of C2 takes the C2 from: highestloss (default), fifo, lifo, hifo, or specificid
+	SpecificLots            []string            // specificid: the Investments a sale takes its C2 from first, in order, by id or by buy date
+	LongTermDays            int                 // a realized gain on C2 held longer than this many days is long-term, 365 if 0
 	TxnFeeFactor            float64             // cost per transaction that is multiplied by the amount. 0.0002 == 2 basis points, 0 if not set
 	TxnFee                  float64             // a flat cost that is added for each transaction, 0 if not set
 	InvestorBonusPlan       bool                // rewards Investors earning high ROI by giving a bonus to their FitnessScore.  PV >= 110% receive 100% bonus, PV >= 115% get 200%, PV >= 120% get 300%, and PV >= 400% get 500%
@@ -325,6 +503,44 @@ func LoadConfig(cfname string) (*AppConfig, error) {
 	if cfg.GracePeriodDays == 0 {
 		cfg.GracePeriodDays = 5 // 5 days of grace period
 	}
+	if err = ValidateSelectionMethod(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateFitnessMetric(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateRuleTrees(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateGeneOperators(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidatePositionSizing(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateExitRules(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateCarryRates(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateExecutionModel(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateTradingDay(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidateLotSelection(&cfg); err != nil {
+		return &cfg, err
+	}
+	if err = ValidatePairs(&cfg); err != nil {
+		return &cfg, err
+	}
+	if cfg.WalkForwardMode {
+		if err = ValidateWalkForward(&cfg); err != nil {
+			return &cfg, err
+		}
+	}
 
 	//-------------------------------------------------------------------
 	// CRUCIBLE processing...
@@ -342,6 +558,350 @@ func LoadConfig(cfname string) (*AppConfig, error) {
 	return &cfg, nil
 }
 
+// ValidateSelectionMethod checks SelectionMethod and TournamentSize. An
+// empty SelectionMethod means roulette wheel selection.
+// ---------------------------------------------------------------------
+func ValidateSelectionMethod(cfg *AppConfig) error {
+	cfg.SelectionMethod = strings.ToLower(strings.TrimSpace(cfg.SelectionMethod))
+	if len(cfg.SelectionMethod) == 0 {
+		cfg.SelectionMethod = SelectRoulette
+	}
+	found := false
+	for _, m := range SelectionMethods {
+		if m == cfg.SelectionMethod {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("unknown SelectionMethod %q, it must be one of: %s", cfg.SelectionMethod, strings.Join(SelectionMethods, ", "))
+	}
+	if cfg.TournamentSize == 0 {
+		cfg.TournamentSize = 3 // a reasonable default
+	}
+	if cfg.SelectionMethod == SelectTournament && (cfg.TournamentSize < 1 || cfg.TournamentSize > cfg.PopulationSize) {
+		return fmt.Errorf("TournamentSize is %d, it must be in the range 1 to PopulationSize (%d)", cfg.TournamentSize, cfg.PopulationSize)
+	}
+	return nil
+}
+
+// ValidateFitnessMetric checks FitnessMetric. An empty FitnessMetric means
+// the default fitness score.
+// ---------------------------------------------------------------------
+func ValidateFitnessMetric(cfg *AppConfig) error {
+	cfg.FitnessMetric = strings.ToLower(strings.TrimSpace(cfg.FitnessMetric))
+	if len(cfg.FitnessMetric) == 0 {
+		cfg.FitnessMetric = FitnessDefault
+	}
+	for _, m := range FitnessMetrics {
+		if m == cfg.FitnessMetric {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown FitnessMetric %q, it must be one of: %s", cfg.FitnessMetric, strings.Join(FitnessMetrics, ", "))
+}
+
+// ValidateGeneOperators checks Crossover, CrossoverAlpha, GeneMutation and
+// GeneMutationSigma. Empty operators mean blend crossover and gaussian
+// mutation.
+// ---------------------------------------------------------------------
+func ValidateGeneOperators(cfg *AppConfig) error {
+	cfg.Crossover = strings.ToLower(strings.TrimSpace(cfg.Crossover))
+	if len(cfg.Crossover) == 0 {
+		cfg.Crossover = CrossoverBlend
+	}
+	if !contains(Crossovers, cfg.Crossover) {
+		return fmt.Errorf("unknown Crossover %q, it must be one of: %s", cfg.Crossover, strings.Join(Crossovers, ", "))
+	}
+	if cfg.CrossoverAlpha < 0 {
+		return fmt.Errorf("CrossoverAlpha is %g, it cannot be negative", cfg.CrossoverAlpha)
+	}
+	cfg.GeneMutation = strings.ToLower(strings.TrimSpace(cfg.GeneMutation))
+	if len(cfg.GeneMutation) == 0 {
+		cfg.GeneMutation = MutationGaussian
+	}
+	if !contains(GeneMutations, cfg.GeneMutation) {
+		return fmt.Errorf("unknown GeneMutation %q, it must be one of: %s", cfg.GeneMutation, strings.Join(GeneMutations, ", "))
+	}
+	if cfg.GeneMutationSigma < 0 || cfg.GeneMutationSigma > 1 {
+		return fmt.Errorf("GeneMutationSigma is %g, it must be in the range 0 to 1", cfg.GeneMutationSigma)
+	}
+	if cfg.GeneMutationSigma == 0 {
+		cfg.GeneMutationSigma = DefaultGeneMutationSigma
+	}
+	return nil
+}
+
+// ValidateRuleTrees checks RuleTreeInvestors, RuleMaxDepth, RuleMaxNodes and
+// RuleParsimony. Unset limits get their default values.
+// ---------------------------------------------------------------------
+func ValidateRuleTrees(cfg *AppConfig) error {
+	if cfg.RuleTreeInvestors < 0 || cfg.RuleTreeInvestors > 1 {
+		return fmt.Errorf("RuleTreeInvestors is %g, it must be in the range 0 to 1", cfg.RuleTreeInvestors)
+	}
+	if cfg.RuleMaxDepth == 0 {
+		cfg.RuleMaxDepth = DefaultRuleMaxDepth
+	}
+	if cfg.RuleMaxNodes == 0 {
+		cfg.RuleMaxNodes = DefaultRuleMaxNodes
+	}
+	if cfg.RuleMaxDepth < 2 || cfg.RuleMaxNodes < 3 {
+		return fmt.Errorf("RuleMaxDepth must be at least 2 and RuleMaxNodes at least 3, found %d and %d", cfg.RuleMaxDepth, cfg.RuleMaxNodes)
+	}
+	if cfg.RuleParsimony < 0 {
+		return fmt.Errorf("RuleParsimony is %g, it cannot be negative", cfg.RuleParsimony)
+	}
+	return nil
+}
+
+// ValidatePositionSizing checks PositionSizing and the settings of the
+// sizing policies. An empty PositionSizing means standard sizing. Settings
+// that are not set get their default values.
+// ---------------------------------------------------------------------
+func ValidatePositionSizing(cfg *AppConfig) error {
+	cfg.PositionSizing = strings.ToLower(strings.TrimSpace(cfg.PositionSizing))
+	if len(cfg.PositionSizing) == 0 {
+		cfg.PositionSizing = SizingStandard
+	}
+	if !contains(PositionSizings, cfg.PositionSizing) {
+		return fmt.Errorf("unknown PositionSizing %q, it must be one of: %s", cfg.PositionSizing, strings.Join(PositionSizings, ", "))
+	}
+	if cfg.SizingFraction == 0 {
+		cfg.SizingFraction = DefaultSizingFraction
+	}
+	if cfg.VolatilityTarget == 0 {
+		cfg.VolatilityTarget = DefaultVolatilityTarget
+	}
+	if cfg.KellyFraction == 0 {
+		cfg.KellyFraction = DefaultKellyFraction
+	}
+	if cfg.KellyMinTrades == 0 {
+		cfg.KellyMinTrades = DefaultKellyMinTrades
+	}
+	if cfg.MaxExposure == 0 {
+		cfg.MaxExposure = DefaultMaxExposure
+	}
+	for _, v := range []struct {
+		name string
+		x    float64
+	}{
+		{"SizingFraction", cfg.SizingFraction},
+		{"VolatilityTarget", cfg.VolatilityTarget},
+		{"KellyFraction", cfg.KellyFraction},
+		{"MaxExposure", cfg.MaxExposure},
+	} {
+		if v.x < 0 || v.x > 1 {
+			return fmt.Errorf("%s is %g, it must be in the range 0 to 1", v.name, v.x)
+		}
+	}
+	if cfg.KellyMinTrades < 0 {
+		return fmt.Errorf("KellyMinTrades is %d, it cannot be negative", cfg.KellyMinTrades)
+	}
+	return nil
+}
+
+// ValidateExitRules checks the settings of the per-Investment exit rules
+// ---------------------------------------------------------------------
+func ValidateExitRules(cfg *AppConfig) error {
+	if cfg.TakeProfit < 0 {
+		return fmt.Errorf("TakeProfit is %g, it cannot be negative", cfg.TakeProfit)
+	}
+	if cfg.TrailingStop < 0 || cfg.TrailingStop >= 1 {
+		return fmt.Errorf("TrailingStop is %g, it must be at least 0 and less than 1", cfg.TrailingStop)
+	}
+	if cfg.MaxHoldingDays < 0 {
+		return fmt.Errorf("MaxHoldingDays is %d, it cannot be negative", cfg.MaxHoldingDays)
+	}
+	return nil
+}
+
+// ValidateCarryRates checks CarryRates. The currencies are upper case, like
+// C1 and C2, and each must have a metric.
+// ---------------------------------------------------------------------
+func ValidateCarryRates(cfg *AppConfig) error {
+	if len(cfg.CarryRates) == 0 {
+		return nil
+	}
+	m := map[string]string{}
+	for k, v := range cfg.CarryRates {
+		k = strings.ToUpper(strings.TrimSpace(k))
+		v = strings.TrimSpace(v)
+		if len(k) == 0 || len(v) == 0 {
+			return fmt.Errorf("CarryRates needs a currency and a metric, found %q: %q", k, v)
+		}
+		m[k] = v
+	}
+	cfg.CarryRates = m
+	return nil
+}
+
+// ValidateExecutionModel checks ExecutionModel and its settings. An empty
+// ExecutionModel means mid. Settings that are not set get their default
+// values. ExecSpreadPips only has a default for fixedspread, the other
+// models may use a spread of 0.
+// ---------------------------------------------------------------------
+func ValidateExecutionModel(cfg *AppConfig) error {
+	cfg.ExecutionModel = strings.ToLower(strings.TrimSpace(cfg.ExecutionModel))
+	if len(cfg.ExecutionModel) == 0 {
+		cfg.ExecutionModel = ExecMid
+	}
+	if !contains(ExecutionModels, cfg.ExecutionModel) {
+		return fmt.Errorf("unknown ExecutionModel %q, it must be one of: %s", cfg.ExecutionModel, strings.Join(ExecutionModels, ", "))
+	}
+	if cfg.ExecutionModel == ExecFixedSpread && cfg.ExecSpreadPips == 0 {
+		cfg.ExecSpreadPips = DefaultExecSpreadPips
+	}
+	if len(cfg.ExecBidMetric) == 0 {
+		cfg.ExecBidMetric = DefaultExecBidMetric
+	}
+	if len(cfg.ExecAskMetric) == 0 {
+		cfg.ExecAskMetric = DefaultExecAskMetric
+	}
+	if cfg.ExecRangeFactor == 0 {
+		cfg.ExecRangeFactor = DefaultExecRangeFactor
+	}
+	if cfg.ExecSlippageFactor == 0 {
+		cfg.ExecSlippageFactor = DefaultExecSlippageFactor
+	}
+	for _, v := range []struct {
+		name string
+		x    float64
+	}{
+		{"ExecSpreadPips", cfg.ExecSpreadPips},
+		{"ExecPipSize", cfg.ExecPipSize},
+		{"ExecRangeFactor", cfg.ExecRangeFactor},
+		{"ExecSlippageFactor", cfg.ExecSlippageFactor},
+	} {
+		if v.x < 0 {
+			return fmt.Errorf("%s is %g, it cannot be negative", v.name, v.x)
+		}
+	}
+	return nil
+}
+
+// ValidateLotSelection checks LotSelection, SpecificLots, LongTermDays and
+// CrucibleLotSelections. An empty LotSelection means highestloss. The buy
+// dates in SpecificLots are rewritten in LotDateFmt, anything that is not a
+// date is an Investment id.
+// ---------------------------------------------------------------------
+func ValidateLotSelection(cfg *AppConfig) error {
+	cfg.LotSelection = strings.ToLower(strings.TrimSpace(cfg.LotSelection))
+	if len(cfg.LotSelection) == 0 {
+		cfg.LotSelection = LotHighestLoss
+	}
+	if !contains(LotSelections, cfg.LotSelection) {
+		return fmt.Errorf("unknown LotSelection %q, it must be one of: %s", cfg.LotSelection, strings.Join(LotSelections, ", "))
+	}
+	for k, v := range cfg.CrucibleLotSelections {
+		v = strings.ToLower(strings.TrimSpace(v))
+		if !contains(LotSelections, v) {
+			return fmt.Errorf("unknown LotSelection %q in CrucibleLotSelections, it must be one of: %s", v, strings.Join(LotSelections, ", "))
+		}
+		cfg.CrucibleLotSelections[k] = v
+	}
+	for k, v := range cfg.SpecificLots {
+		v = strings.TrimSpace(v)
+		if dt, err := StringToDate(v); err == nil {
+			v = dt.Format(LotDateFmt)
+		}
+		cfg.SpecificLots[k] = v
+	}
+	if len(cfg.SpecificLots) == 0 && (cfg.LotSelection == LotSpecificID || contains(cfg.CrucibleLotSelections, LotSpecificID)) {
+		return fmt.Errorf("LotSelection %s needs the lots to sell first in SpecificLots", LotSpecificID)
+	}
+	if cfg.LongTermDays < 0 {
+		return fmt.Errorf("LongTermDays is %d, it cannot be negative", cfg.LongTermDays)
+	}
+	if cfg.LongTermDays == 0 {
+		cfg.LongTermDays = DefaultLongTermDays
+	}
+	return nil
+}
+
+// ValidateTradingDay checks TradingDay. An empty TradingDay means daily.
+// ---------------------------------------------------------------------
+func ValidateTradingDay(cfg *AppConfig) error {
+	cfg.TradingDay = strings.Join(strings.Fields(strings.ToLower(cfg.TradingDay)), " ")
+	if len(cfg.TradingDay) == 0 {
+		cfg.TradingDay = TradingDaily
+	}
+	_, err := ParseTradingDay(cfg.TradingDay)
+	return err
+}
+
+// ParseTradingDay parses a TradingDay rule. An empty rule is daily.
+// ---------------------------------------------------------------------
+func ParseTradingDay(s string) (TradingDayRule, error) {
+	var r TradingDayRule
+	s = strings.Join(strings.Fields(strings.ToLower(s)), " ")
+	switch {
+	case len(s) == 0 || s == TradingDaily:
+		r.Kind = TradingDaily
+	case s == TradingWeekdays || s == TradingFirstBusinessDay || s == TradingLastBusinessDay:
+		r.Kind = s
+	case strings.HasPrefix(s, TradingEvery+" "):
+		r.Kind = TradingEvery
+		for _, d := range strings.Split(s[len(TradingEvery)+1:], ",") {
+			d = strings.TrimSpace(d)
+			found := false
+			for wd := time.Sunday; wd <= time.Saturday; wd++ {
+				if d == strings.ToLower(wd.String()) {
+					r.Days[wd] = true
+					found = true
+				}
+			}
+			if !found {
+				return r, fmt.Errorf("TradingDay %q: unknown weekday %q", s, d)
+			}
+		}
+	default:
+		return r, fmt.Errorf("unknown TradingDay %q, it must be one of: %s, %s, %s <weekday>[, <weekday>...], %s, %s",
+			s, TradingDaily, TradingWeekdays, TradingEvery, TradingFirstBusinessDay, TradingLastBusinessDay)
+	}
+	return r, nil
+}
+
+// contains returns true if s is in list
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateWalkForward checks the walk-forward window durations and sets the
+// defaults for WalkForwardStep and WalkForwardTopN.
+// ---------------------------------------------------------------------
+func ValidateWalkForward(cfg *AppConfig) error {
+	if len(cfg.WalkForwardStep) == 0 {
+		cfg.WalkForwardStep = cfg.WalkForwardTest
+	}
+	if cfg.WalkForwardTopN < 1 {
+		cfg.WalkForwardTopN = 5
+	}
+	specs := []struct{ name, val string }{
+		{"WalkForwardTrain", cfg.WalkForwardTrain},
+		{"WalkForwardTest", cfg.WalkForwardTest},
+		{"WalkForwardStep", cfg.WalkForwardStep},
+	}
+	dt := time.Date(2020, time.January, 1, 0, 0, 0, 0, time.UTC)
+	for _, s := range specs {
+		if len(s.val) == 0 {
+			return fmt.Errorf("%s must be set in walk-forward mode", s.name)
+		}
+		dt2, err := AddDuration(s.val, dt)
+		if err != nil {
+			return fmt.Errorf("%s: %s", s.name, err.Error())
+		}
+		if !dt2.After(dt) {
+			return fmt.Errorf("%s must be a positive duration, it is %q", s.name, s.val)
+		}
+	}
+	return nil
+}
+
 // parseCustomCruciblePeriod takes a CustomCruciblePeriod and calculates the start and stop times.
 func parseCustomCruciblePeriod(ccp *CustomCruciblePeriod) (CruciblePeriod, error) {
 	var cp CruciblePeriod
@@ -408,6 +968,50 @@ func ProcessCrucibleSettings(cfg *AppConfig, fcfg *FileConfig) error {
 	return nil
 }
 
+// parseDurationSpec parses a duration such as "1y", "3m", "2w" or "10d"
+// into its amount and unit.
+func parseDurationSpec(duration string) (int, byte, error) {
+	s := strings.TrimSpace(duration)
+	if len(s) < 2 {
+		return 0, 0, fmt.Errorf("invalid duration %q", duration)
+	}
+	unit := s[len(s)-1] // 'm', 'y', 'd', 'w'
+	amount, err := strconv.Atoi(s[:len(s)-1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid duration %q: %s", duration, err.Error())
+	}
+	return amount, unit, nil
+}
+
+// AddDuration returns dt plus the duration. The duration uses the same
+// syntax as the Duration of a CruciblePeriod: "1y", "3m", "2w" or "10d". If
+// dt is the last day of a month, adding months or years ends on the last day
+// of the resulting month.
+// ---------------------------------------------------------------------
+func AddDuration(duration string, dt time.Time) (time.Time, error) {
+	amount, unit, err := parseDurationSpec(duration)
+	if err != nil {
+		return dt, err
+	}
+	switch unit {
+	case 'y', 'm':
+		if unit == 'y' {
+			amount *= 12
+		}
+		first := time.Date(dt.Year(), dt.Month(), 1, 0, 0, 0, 0, dt.Location()).AddDate(0, amount, 0)
+		last := first.AddDate(0, 1, -1)
+		if dt.Day() > last.Day() || dt.AddDate(0, 0, 1).Day() == 1 {
+			return last, nil
+		}
+		return first.AddDate(0, 0, dt.Day()-1), nil
+	case 'w':
+		return dt.AddDate(0, 0, 7*amount), nil
+	case 'd':
+		return dt.AddDate(0, 0, amount), nil
+	}
+	return dt, fmt.Errorf("unknown duration unit %q in %q", string(unit), duration)
+}
+
 // calculateStartDate calculates the start date by subtracting the specified 'duration' from 'endDate'.
 func calculateStartDate(duration string, endDate time.Time) time.Time {
 	parts := strings.Fields(duration)
@@ -416,9 +1020,7 @@ func calculateStartDate(duration string, endDate time.Time) time.Time {
 	}
 
 	// Parse duration and unit
-	unit := parts[0][len(parts[0])-1] // 'm', 'y', 'd', 'w'
-	amountStr := parts[0][:len(parts[0])-1]
-	amount, err := strconv.Atoi(amountStr)
+	amount, unit, err := parseDurationSpec(parts[0])
 	if err != nil {
 		fmt.Println("Error converting duration amount to integer:", err)
 		return time.Time{}
@@ -543,3 +1145,31 @@ func (cfg *AppConfig) GenerateFName(basename string) string {
 	fname += ".csv"
 	return fname
 }
+
+// ValidatePairs checks Pairs. Each pair is C1 followed by a foreign
+// currency, like USDJPY, and may only be listed once. C2 is set to the
+// foreign currency of the first pair, it is the C2 of everything that
+// needs a single pair.
+// ---------------------------------------------------------------------
+func ValidatePairs(cfg *AppConfig) error {
+	if len(cfg.Pairs) == 0 {
+		return nil
+	}
+	seen := map[string]bool{}
+	for k, v := range cfg.Pairs {
+		v = strings.ToUpper(strings.TrimSpace(v))
+		if len(v) != 6 || v[:3] != cfg.C1 {
+			return fmt.Errorf("invalid pair %q in Pairs, it must be C1 (%s) followed by a currency, like %sJPY", v, cfg.C1, cfg.C1)
+		}
+		if v[3:] == cfg.C1 {
+			return fmt.Errorf("invalid pair %q in Pairs, it trades C1 for C1", v)
+		}
+		if seen[v] {
+			return fmt.Errorf("pair %s is listed more than once in Pairs", v)
+		}
+		seen[v] = true
+		cfg.Pairs[k] = v
+	}
+	cfg.C2 = cfg.Pairs[0][3:]
+	return nil
+}
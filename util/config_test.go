@@ -182,6 +182,48 @@ func TestCalculateStartDate(t *testing.T) {
 	}
 }
 
+func TestAddDuration(t *testing.T) {
+	tests := []struct {
+		duration string
+		start    time.Time
+		expected time.Time
+	}{
+		{"1y", time.Date(2023, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"1y", time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), time.Date(2025, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"3m", time.Date(2023, 1, 15, 0, 0, 0, 0, time.UTC), time.Date(2023, 4, 15, 0, 0, 0, 0, time.UTC)},
+		{"1m", time.Date(2023, 1, 31, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"1m", time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC), time.Date(2023, 3, 31, 0, 0, 0, 0, time.UTC)},
+		{"1m", time.Date(2023, 1, 30, 0, 0, 0, 0, time.UTC), time.Date(2023, 2, 28, 0, 0, 0, 0, time.UTC)},
+		{"14m", time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)},
+		{"2w", time.Date(2023, 5, 1, 0, 0, 0, 0, time.UTC), time.Date(2023, 5, 15, 0, 0, 0, 0, time.UTC)},
+		{"10d", time.Date(2023, 5, 25, 0, 0, 0, 0, time.UTC), time.Date(2023, 6, 4, 0, 0, 0, 0, time.UTC)},
+	}
+	for _, tc := range tests {
+		result, err := AddDuration(tc.duration, tc.start)
+		if err != nil {
+			t.Errorf("%s + %s: unexpected error: %s", tc.start.Format("2006-01-02"), tc.duration, err)
+			continue
+		}
+		if !result.Equal(tc.expected) {
+			t.Errorf("%s + %s = %s, expected %s", tc.start.Format("2006-01-02"), tc.duration, result.Format("2006-01-02"), tc.expected.Format("2006-01-02"))
+		}
+		//-----------------------------------------------------------------
+		// A window that starts on start and ends the day before the result
+		// has the same start date that calculateStartDate computes
+		//-----------------------------------------------------------------
+		if tc.start.Day() == 1 || tc.duration[len(tc.duration)-1] == 'w' {
+			if back := calculateStartDate(tc.duration, result.AddDate(0, 0, -1)); !back.Equal(tc.start) {
+				t.Errorf("calculateStartDate(%s, %s) = %s, expected %s", tc.duration, result.AddDate(0, 0, -1).Format("2006-01-02"), back.Format("2006-01-02"), tc.start.Format("2006-01-02"))
+			}
+		}
+	}
+	for _, bad := range []string{"", "y", "3q", "xm"} {
+		if _, err := AddDuration(bad, time.Now()); err == nil {
+			t.Errorf("expected an error for duration %q", bad)
+		}
+	}
+}
+
 func TestLoadConfig(t *testing.T) {
 	Init(-1)
 	cfg, err := LoadConfig("")
@@ -320,3 +362,47 @@ func TestMigrateStruct(t *testing.T) {
 		t.Errorf("Got:      %s\n", x)
 	}
 }
+
+func TestValidatePairs(t *testing.T) {
+	cfg := CreateTestingCFG()
+	cfg.C1, cfg.C2 = "USD", "JPY"
+	cfg.Pairs = []string{" usdeur", "USDJPY"}
+	if err := ValidatePairs(cfg); err != nil {
+		t.Fatalf("ValidatePairs returned error: %s", err)
+	}
+	if cfg.Pairs[0] != "USDEUR" || cfg.C2 != "EUR" {
+		t.Errorf("expected Pairs[0] = USDEUR and C2 = EUR, got %s and %s", cfg.Pairs[0], cfg.C2)
+	}
+
+	bad := [][]string{
+		{"EURJPY"},           // not C1
+		{"USDJP"},            // too short
+		{"USDUSD"},           // C1 for C1
+		{"USDJPY", "usdjpy"}, // duplicate
+	}
+	for _, pairs := range bad {
+		cfg.Pairs = pairs
+		if err := ValidatePairs(cfg); err == nil {
+			t.Errorf("expected an error for Pairs %v", pairs)
+		}
+	}
+}
+
+func TestValidateLotSelection(t *testing.T) {
+	cfg := CreateTestingCFG()
+	cfg.LotSelection = " FIFO"
+	if err := ValidateLotSelection(cfg); err != nil || cfg.LotSelection != LotFIFO {
+		t.Errorf("expected fifo, got %q, err = %v", cfg.LotSelection, err)
+	}
+	cfg.LotSelection = LotSpecificID
+	if err := ValidateLotSelection(cfg); err == nil {
+		t.Errorf("expected an error for LotSelection specificid without SpecificLots")
+	}
+	cfg.SpecificLots = []string{" 1/15/2020", "ABCDEFGHIJ0123456789"}
+	if err := ValidateLotSelection(cfg); err != nil {
+		t.Errorf("ValidateLotSelection returned error: %s", err)
+	}
+	if cfg.SpecificLots[0] != "2020-01-15" || cfg.SpecificLots[1] != "ABCDEFGHIJ0123456789" {
+		t.Errorf("expected a buy date and an id, got %v", cfg.SpecificLots)
+	}
+}
@@ -5,7 +5,7 @@ import (
 )
 
 // ValidDBSources contains the valid configuration choices for database
-var ValidDBSources = []string{"CSV", "SQL"}
+var ValidDBSources = []string{"CSV", "SQL", "SQLITE"}
 
 // ValidateConfig ensures that all the configuration file numbers are valid, that no
 //
@@ -16,8 +16,9 @@ var Digits = "0123456789"
 // they know what they're doing.
 // -----------------------------------------------------------------------------
 var UtilData struct {
-	Rand *rand.Rand
-	mu   sync.Mutex // Protects Rand
+	Rand   *rand.Rand
+	mu     sync.Mutex  // Protects Rand
+	stream *RandStream // the stream behind Rand, it knows its seed and how many values have been drawn
 }
 
 // Init is the util library's initialization functio for all the really
@@ -36,6 +37,6 @@ func Init(randNano int64) int64 {
 		randNano = now.UnixNano()
 	}
 	// fmt.Printf("Random number seed:  %d\n", randNano)
-	UtilData.Rand = rand.New(rand.NewSource(randNano)) // specific seed
+	RestoreRand(randNano, 0) // specific seed
 	return randNano
 }
@@ -1,5 +1,7 @@
 package util
 
+import "math/rand"
+
 // RandomInRange returns a random number, r, such that:
 //
 //	a <= r <= b
@@ -15,3 +17,93 @@ func RandomInRange(a, b int) int {
 	}
 	return UtilData.Rand.Intn(b-a+1) + a
 }
+
+// streamSource is a rand.Source that produces the SplitMix64 sequence of its
+// seed. Unlike the math/rand generators, its n-th value depends only on the
+// seed and n, so it can be put back into any state it was in by setting the
+// number of values drawn.
+type streamSource struct {
+	seed  int64
+	draws uint64
+}
+
+const splitMixGamma = 0x9e3779b97f4a7c15
+
+func (c *streamSource) Uint64() uint64 {
+	c.draws++
+	z := uint64(c.seed) + c.draws*splitMixGamma
+	z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+	z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+	return z ^ (z >> 31)
+}
+
+func (c *streamSource) Int63() int64 {
+	return int64(c.Uint64() >> 1)
+}
+
+func (c *streamSource) Seed(seed int64) {
+	c.seed = seed
+	c.draws = 0
+}
+
+// RandStream is a seeded random number generator whose state can be saved
+// and restored. It is not threadsafe, each stream must be used by one
+// goroutine at a time.
+// -------------------------------------------------------
+type RandStream struct {
+	*rand.Rand
+	seed int64
+	src  *streamSource
+}
+
+// NewRandStream returns a RandStream seeded with seed
+// -------------------------------------------------------
+func NewRandStream(seed int64) *RandStream {
+	return RestoreRandStream(seed, 0)
+}
+
+// RestoreRandStream returns a RandStream seeded with seed and advanced by
+// draws values. It produces the same sequence as the stream whose State
+// returned seed and draws.
+// -------------------------------------------------------
+func RestoreRandStream(seed int64, draws uint64) *RandStream {
+	src := &streamSource{seed: seed, draws: draws}
+	return &RandStream{Rand: rand.New(src), seed: seed, src: src}
+}
+
+// State returns the seed of the stream and the number of values that have
+// been drawn from it.
+// -------------------------------------------------------
+func (r *RandStream) State() (int64, uint64) {
+	return r.seed, r.src.draws
+}
+
+// InRange returns a random number, n, such that a <= n <= b
+// -------------------------------------------------------
+func (r *RandStream) InRange(a, b int) int {
+	if a > b {
+		a, b = b, a
+	}
+	return r.Intn(b-a+1) + a
+}
+
+// RandState returns the seed of UtilData.Rand and the number of values that
+// have been drawn from it. RestoreRand uses them to put the generator back
+// into exactly this state.
+// -------------------------------------------------------
+func RandState() (int64, uint64) {
+	UtilData.mu.Lock()
+	defer UtilData.mu.Unlock()
+	return UtilData.stream.State()
+}
+
+// RestoreRand recreates UtilData.Rand from seed and advances it by draws
+// values. After it returns, the generator produces the same sequence it did
+// when RandState returned seed and draws.
+// -------------------------------------------------------
+func RestoreRand(seed int64, draws uint64) {
+	UtilData.mu.Lock()
+	defer UtilData.mu.Unlock()
+	UtilData.stream = RestoreRandStream(seed, draws)
+	UtilData.Rand = UtilData.stream.Rand
+}
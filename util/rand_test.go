@@ -0,0 +1,48 @@
+package util
+
+import (
+	"testing"
+)
+
+func TestRestoreRand(t *testing.T) {
+	Init(42)
+	for i := 0; i < 25; i++ {
+		RandomInRange(0, 100)
+	}
+	UtilData.Rand.Float64()
+	seed, draws := RandState()
+	if seed != 42 {
+		t.Errorf("expected seed 42, got %d", seed)
+	}
+	if draws == 0 {
+		t.Fatalf("expected a non-zero draw count")
+	}
+
+	var want []int
+	for i := 0; i < 10; i++ {
+		want = append(want, RandomInRange(0, 1000))
+	}
+
+	RestoreRand(seed, draws)
+	for i := 0; i < len(want); i++ {
+		if got := RandomInRange(0, 1000); got != want[i] {
+			t.Errorf("value %d: expected %d, got %d", i, want[i], got)
+		}
+	}
+}
+
+func TestRestoreRandStream(t *testing.T) {
+	r := NewRandStream(7)
+	r.Perm(50)
+	r.Float64()
+	seed, draws := r.State()
+	restored := RestoreRandStream(seed, draws)
+	for i := 0; i < 10; i++ {
+		if a, b := r.Int63(), restored.Int63(); a != b {
+			t.Errorf("value %d: expected %d, got %d", i, a, b)
+		}
+	}
+	if _, d := restored.State(); d != draws+10 {
+		t.Errorf("expected %d draws, got %d", draws+10, d)
+	}
+}
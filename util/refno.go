@@ -17,21 +17,32 @@ import (
 //
 // -----------------------------------------------------------------------------
 func GenerateRefNo() string {
+	return generateRefNo(RandomInRange)
+}
+
+// GenerateRefNoFrom is GenerateRefNo using the supplied stream rather than
+// UtilData.Rand
+// -----------------------------------------------------------------------------
+func GenerateRefNoFrom(r *RandStream) string {
+	return generateRefNo(r.InRange)
+}
+
+func generateRefNo(inRange func(a, b int) int) string {
 	var l []byte
 
 	// Generate 10 random digits and 5 random letters
 	for i := 0; i < 10; i++ {
-		l = append(l, Alphabet[RandomInRange(0, 25)])
+		l = append(l, Alphabet[inRange(0, 25)])
 	}
 	for i := 0; i < 10; i++ {
-		l = append(l, Digits[RandomInRange(0, 9)])
+		l = append(l, Digits[inRange(0, 9)])
 	}
 	// move them around some random number of times
 	// fmt.Printf("Initial val:  %s\n", string(l))
-	swaps := 5 + RandomInRange(0, 9)
+	swaps := 5 + inRange(0, 9)
 	for i := 0; i < swaps; i++ {
-		j := RandomInRange(0, 9)
-		k := 10 + RandomInRange(0, 9)
+		j := inRange(0, 9)
+		k := 10 + inRange(0, 9)
 		l[k], l[j] = l[j], l[k]
 	}
 	return string(l)